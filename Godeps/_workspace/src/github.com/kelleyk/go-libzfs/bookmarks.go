@@ -0,0 +1,185 @@
+package zfs
+
+// #cgo LDFLAGS: -lzfs_core
+// #include <stdlib.h>
+// #include <libzfs_core.h>
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Bookmark describes a bookmark (see `zfs bookmark`): a record of the point at which a snapshot was taken, which can
+// be the source of an incremental send stream even after the snapshot has been destroyed.
+type Bookmark struct {
+	Name      string // the full name, e.g. "pool/fs#mark"
+	GUID      uint64 // the GUID of the snapshot that the bookmark was created from
+	CreateTXG uint64
+	Creation  time.Time
+}
+
+// splitBookmarkName returns the name of the filesystem or volume that the bookmark name (e.g. "pool/fs#mark") belongs
+// to and the part of name after the "#".
+func splitBookmarkName(name string) (dataset, mark string, err error) {
+	parts := strings.SplitN(name, "#", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.ContainsAny(parts[0], "@#") ||
+		strings.ContainsAny(parts[1], "@#/") {
+		return "", "", fmt.Errorf("not a bookmark name: %s", name)
+	}
+	return parts[0], parts[1], nil
+}
+
+// DatasetBookmark creates the bookmark bookmarkName (e.g. "pool/fs#mark") from the snapshot snapName (e.g.
+// "pool/fs@snap"), which must belong to the same filesystem or volume.
+func DatasetBookmark(snapName, bookmarkName string) error {
+	dataset, _, err := splitBookmarkName(bookmarkName)
+	if err != nil {
+		return err
+	}
+	parts := strings.SplitN(snapName, "@", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return fmt.Errorf("not a snapshot name: %s", snapName)
+	}
+	if parts[0] != dataset {
+		return fmt.Errorf("bookmark %s must belong to the same dataset as snapshot %s", bookmarkName, snapName)
+	}
+
+	var cbookmarks *C.nvlist_t
+	if r := C.nvlist_alloc(&cbookmarks, C.NV_UNIQUE_NAME, 0); r != 0 {
+		return errors.New("Failed to allocate bookmark list")
+	}
+	defer C.nvlist_free(cbookmarks)
+	csBookmark := C.CString(bookmarkName)
+	defer C.free(unsafe.Pointer(csBookmark))
+	csSnap := C.CString(snapName)
+	defer C.free(unsafe.Pointer(csSnap))
+	if r := C.nvlist_add_string(cbookmarks, csBookmark, csSnap); r != 0 {
+		return errors.New("Failed to add bookmark to list")
+	}
+
+	var errlist *C.nvlist_t
+	errno := C.lzc_bookmark(cbookmarks, &errlist)
+	if errlist != nil {
+		C.nvlist_free(errlist)
+	}
+	if errno != 0 {
+		return fmt.Errorf("failed to create bookmark %s: %v", bookmarkName, syscall.Errno(errno))
+	}
+	return nil
+}
+
+// ListBookmarks returns the bookmarks of d, which must be a filesystem or volume, in the order in which they were
+// created.
+func (d *Dataset) ListBookmarks() ([]Bookmark, error) {
+	if d.list == nil {
+		return nil, errors.New(msgDatasetIsNil)
+	}
+	path, err := d.Path()
+	if err != nil {
+		return nil, err
+	}
+
+	var cprops *C.nvlist_t
+	if r := C.nvlist_alloc(&cprops, C.NV_UNIQUE_NAME, 0); r != 0 {
+		return nil, errors.New("Failed to allocate property list")
+	}
+	defer C.nvlist_free(cprops)
+	for _, name := range []string{"guid", "createtxg", "creation"} {
+		csName := C.CString(name)
+		r := C.nvlist_add_boolean(cprops, csName)
+		C.free(unsafe.Pointer(csName))
+		if r != 0 {
+			return nil, errors.New("Failed to add property to list")
+		}
+	}
+
+	csPath := C.CString(path)
+	defer C.free(unsafe.Pointer(csPath))
+	var cbookmarks *C.nvlist_t
+	if errno := C.lzc_get_bookmarks(csPath, cprops, &cbookmarks); errno != 0 {
+		return nil, fmt.Errorf("failed to list bookmarks of %s: %v", path, syscall.Errno(errno))
+	}
+	l := (*NVList)(cbookmarks)
+	defer l.Free()
+
+	// Each pair maps the part of a bookmark's name after the "#" to an nvlist that maps each requested property's name
+	// to an nvlist containing its "value".
+	var bookmarks []Bookmark
+	for p := l.Next(nil); p != nil; p = l.Next(p) {
+		props, ok := p.Value().(*NVList)
+		if !ok {
+			return nil, fmt.Errorf("expected nvlist for bookmark %q", p.Name())
+		}
+		b := Bookmark{Name: path + "#" + p.Name()}
+		for q := props.Next(nil); q != nil; q = props.Next(q) {
+			prop, ok := q.Value().(*NVList)
+			if !ok {
+				return nil, fmt.Errorf("expected nvlist for property %q of bookmark %q", q.Name(), p.Name())
+			}
+			var value uint64
+			for r := prop.Next(nil); r != nil; r = prop.Next(r) {
+				if r.Name() == "value" {
+					if value, ok = r.Value().(uint64); !ok {
+						return nil, fmt.Errorf("unexpected value for property %q of bookmark %q", q.Name(), p.Name())
+					}
+				}
+			}
+			switch q.Name() {
+			case "guid":
+				b.GUID = value
+			case "createtxg":
+				b.CreateTXG = value
+			case "creation":
+				b.Creation = time.Unix(int64(value), 0)
+			}
+		}
+		bookmarks = append(bookmarks, b)
+	}
+	sort.Sort(bookmarksByTXG(bookmarks))
+	return bookmarks, nil
+}
+
+// DestroyBookmark destroys the bookmark name (e.g. "pool/fs#mark").
+func DestroyBookmark(name string) error {
+	if _, _, err := splitBookmarkName(name); err != nil {
+		return err
+	}
+
+	var cbookmarks *C.nvlist_t
+	if r := C.nvlist_alloc(&cbookmarks, C.NV_UNIQUE_NAME, 0); r != 0 {
+		return errors.New("Failed to allocate bookmark list")
+	}
+	defer C.nvlist_free(cbookmarks)
+	csName := C.CString(name)
+	defer C.free(unsafe.Pointer(csName))
+	if r := C.nvlist_add_boolean(cbookmarks, csName); r != 0 {
+		return errors.New("Failed to add bookmark to list")
+	}
+
+	var errlist *C.nvlist_t
+	errno := C.lzc_destroy_bookmarks(cbookmarks, &errlist)
+	if errlist != nil {
+		C.nvlist_free(errlist)
+	}
+	if errno != 0 {
+		return fmt.Errorf("failed to destroy bookmark %s: %v", name, syscall.Errno(errno))
+	}
+	return nil
+}
+
+type bookmarksByTXG []Bookmark
+
+func (a bookmarksByTXG) Len() int      { return len(a) }
+func (a bookmarksByTXG) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a bookmarksByTXG) Less(i, j int) bool {
+	if a[i].CreateTXG != a[j].CreateTXG {
+		return a[i].CreateTXG < a[j].CreateTXG
+	}
+	return a[i].Name < a[j].Name
+}
@@ -0,0 +1,115 @@
+package zfs
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSplitBookmarkName(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		dataset string
+		mark    string
+		valid   bool
+	}{
+		{"pool#mark", "pool", "mark", true},
+		{"pool/fs/child#2016-01-01", "pool/fs/child", "2016-01-01", true},
+		{"pool/fs", "", "", false},
+		{"#mark", "", "", false},
+		{"pool/fs#", "", "", false},
+		{"pool/fs@snap#mark", "", "", false},
+		{"pool/fs#mark#again", "", "", false},
+		{"pool/fs#mark@snap", "", "", false},
+		{"pool/fs#mark/child", "", "", false},
+	} {
+		dataset, mark, err := splitBookmarkName(tt.name)
+		if (err == nil) != tt.valid {
+			t.Errorf("splitBookmarkName(%q) returned error %v; expected valid=%v", tt.name, err, tt.valid)
+			continue
+		}
+		if dataset != tt.dataset || mark != tt.mark {
+			t.Errorf("splitBookmarkName(%q) = %q, %q; expected %q, %q", tt.name, dataset, mark, tt.dataset, tt.mark)
+		}
+	}
+}
+
+func TestDatasetBookmarkInvalidNames(t *testing.T) {
+	for _, tt := range []struct {
+		snap, bookmark string
+	}{
+		{"pool/fs@snap", "pool/fs"},
+		{"pool/fs", "pool/fs#mark"},
+		{"pool/fs@", "pool/fs#mark"},
+		{"pool/fs@snap", "pool/other#mark"},
+	} {
+		if err := DatasetBookmark(tt.snap, tt.bookmark); err == nil {
+			t.Errorf("DatasetBookmark(%q, %q) succeeded", tt.snap, tt.bookmark)
+		}
+	}
+	if err := DestroyBookmark("pool/fs@snap"); err == nil {
+		t.Error("DestroyBookmark of a snapshot name succeeded")
+	}
+}
+
+// TestBookmarks creates bookmarks of the snapshots of a file-backed pool, lists them, and destroys them.
+func TestBookmarks(t *testing.T) {
+	const name = "golibzfs_bookmarks"
+	_, cleanup := createTestPool(t, name, 1, nil)
+	defer cleanup()
+
+	var guids []uint64
+	for _, snap := range []string{"first", "second"} {
+		d, err := DatasetSnapshot(name+"@"+snap, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		guid, err := d.GetProperty(DatasetPropGUID)
+		d.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var g uint64
+		if _, err := fmt.Sscan(guid.Value, &g); err != nil {
+			t.Fatal(err)
+		}
+		guids = append(guids, g)
+	}
+	// The bookmarks are created in the opposite order from their names, so that they are listed by TXG, not by name.
+	if err := DatasetBookmark(name+"@first", name+"#z-first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DatasetBookmark(name+"@second", name+"#a-second"); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := DatasetOpen(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	bookmarks, err := d.ListBookmarks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookmarks) != 2 || bookmarks[0].Name != name+"#z-first" || bookmarks[1].Name != name+"#a-second" {
+		t.Fatalf("bookmarks are %+v", bookmarks)
+	}
+	for i, b := range bookmarks {
+		if b.GUID != guids[i] {
+			t.Errorf("bookmark %s has GUID %d; expected %d", b.Name, b.GUID, guids[i])
+		}
+		if b.CreateTXG == 0 || b.Creation.IsZero() {
+			t.Errorf("bookmark %s has no createtxg or creation time: %+v", b.Name, b)
+		}
+	}
+
+	if err := DestroyBookmark(name + "#z-first"); err != nil {
+		t.Fatal(err)
+	}
+	if bookmarks, err = d.ListBookmarks(); err != nil {
+		t.Fatal(err)
+	}
+	if len(bookmarks) != 1 || bookmarks[0].Name != name+"#a-second" {
+		t.Errorf("bookmarks after destroying one are %+v", bookmarks)
+	}
+}
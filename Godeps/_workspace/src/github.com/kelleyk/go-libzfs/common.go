@@ -394,11 +394,21 @@ const (
 	DatasetPropRelatime                = C.ZFS_PROP_RELATIME
 	DatasetPropRedundantMetadata       = C.ZFS_PROP_REDUNDANT_METADATA
 	DatasetPropOverlay                 = C.ZFS_PROP_OVERLAY
+	DatasetPropReceiveResumeToken      = C.ZFS_PROP_RECEIVE_RESUME_TOKEN
 	// DatasetPropPrevSnap                = C.ZFS_PROP_PREV_SNAP
-	// DatasetPropReceiveResumeToken      = C.ZFS_PROP_RECEIVE_RESUME_TOKEN
 	DatasetNumProps = C.ZFS_NUM_PROPS
 )
 
+// Available returns an error if libzfs could not be initialized, e.g. because the ZFS kernel module is not loaded or
+// because the caller does not have permission to open the ZFS control device.  Every other function in this package
+// will fail in that case.
+func Available() error {
+	if libzfsHandle == nil {
+		return errors.New("libzfs uninitialized; is the zfs module loaded, and do you have permission to open /dev/zfs?")
+	}
+	return nil
+}
+
 // LastError get last underlying libzfs error description if any
 func LastError() (err error) {
 	errno := C.libzfs_errno(libzfsHandle)
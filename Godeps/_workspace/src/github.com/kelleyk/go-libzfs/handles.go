@@ -0,0 +1,49 @@
+package zfs
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// handleSet records which of the C handles (zpool_list_t or dataset_list_t items) that back Pool and Dataset values
+// are open.  Pools and Datasets are often copied (e.g. by PoolOpenAll, or by ranging over a slice of them), and every
+// copy refers to the same handle; the set ensures that only the first Close of any of them frees it.
+//
+// N.B.: Once a handle has been freed, the C allocator may reuse its address for a new handle, so a stale copy of a
+// closed Pool or Dataset must still not be used or closed after other pools or datasets have been opened.
+//
+type handleSet struct {
+	mu   sync.Mutex
+	open map[unsafe.Pointer]struct{}
+}
+
+var (
+	openPools    handleSet
+	openDatasets handleSet
+
+	// borrowedPools are the items that hold the pool handles of datasets (see Dataset.Pool).  The pool handle
+	// belongs to the dataset's handle, so closing such a pool frees only the item.
+	borrowedPools handleSet
+)
+
+// add records that the handle p has been opened.
+func (s *handleSet) add(p unsafe.Pointer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.open == nil {
+		s.open = make(map[unsafe.Pointer]struct{})
+	}
+	s.open[p] = struct{}{}
+}
+
+// remove records that the handle p is being closed.  It returns false if p is not open (e.g. because it has already
+// been closed), in which case p must not be freed.
+func (s *handleSet) remove(p unsafe.Pointer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.open[p]; !ok {
+		return false
+	}
+	delete(s.open, p)
+	return true
+}
@@ -0,0 +1,26 @@
+package zfs
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestHandleSet(t *testing.T) {
+	var s handleSet
+	a, b := new(int), new(int)
+	s.add(unsafe.Pointer(a))
+	s.add(unsafe.Pointer(b))
+
+	if !s.remove(unsafe.Pointer(a)) {
+		t.Error("first remove of an open handle returned false")
+	}
+	if s.remove(unsafe.Pointer(a)) {
+		t.Error("second remove of the same handle returned true")
+	}
+	if !s.remove(unsafe.Pointer(b)) {
+		t.Error("remove of another open handle returned false")
+	}
+	if s.remove(unsafe.Pointer(new(int))) {
+		t.Error("remove of a handle that was never added returned true")
+	}
+}
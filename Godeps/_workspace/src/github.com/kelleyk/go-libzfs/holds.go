@@ -0,0 +1,126 @@
+package zfs
+
+// #include <stdlib.h>
+// #include <libzfs.h>
+// #include "zpool.h"
+// #include "zfs.h"
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// HoldInfo describes a user hold on a snapshot (see `zfs hold`).  A snapshot cannot be destroyed while it has holds.
+type HoldInfo struct {
+	Tag     string
+	Created time.Time
+}
+
+// DatasetHold places a hold with the given tag on the snapshot snapName (e.g. "pool/fs@snap").  If recursive is
+// true, the snapshot of the same name of each of the dataset's descendants is held, too.
+func DatasetHold(snapName, tag string, recursive bool) error {
+	return withSnapshotParent(snapName, func(zh *C.zfs_handle_t, csSnap *C.char) C.int {
+		csTag := C.CString(tag)
+		defer C.free(unsafe.Pointer(csTag))
+		return C.zfs_hold(zh, csSnap, csTag, booleanT(recursive), -1)
+	})
+}
+
+// DatasetRelease releases the hold with the given tag from the snapshot snapName (e.g. "pool/fs@snap").  If
+// recursive is true, it is released from the snapshot of the same name of each of the dataset's descendants, too.
+func DatasetRelease(snapName, tag string, recursive bool) error {
+	return withSnapshotParent(snapName, func(zh *C.zfs_handle_t, csSnap *C.char) C.int {
+		csTag := C.CString(tag)
+		defer C.free(unsafe.Pointer(csTag))
+		return C.zfs_release(zh, csSnap, csTag, booleanT(recursive))
+	})
+}
+
+// withSnapshotParent opens the filesystem or volume that the snapshot snapName belongs to and calls f with its handle
+// and the part of snapName after the "@".  f should return nonzero on failure.
+func withSnapshotParent(snapName string, f func(zh *C.zfs_handle_t, csSnap *C.char) C.int) error {
+	parts := strings.SplitN(snapName, "@", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("not a snapshot name: %s", snapName)
+	}
+
+	csPath := C.CString(parts[0])
+	defer C.free(unsafe.Pointer(csPath))
+	zh := C.zfs_open(libzfsHandle, csPath, C.int(DatasetTypeFilesystem|DatasetTypeVolume))
+	if zh == nil {
+		return LastError()
+	}
+	defer C.zfs_close(zh)
+
+	csSnap := C.CString(parts[1])
+	defer C.free(unsafe.Pointer(csSnap))
+	if f(zh, csSnap) != 0 {
+		return LastError()
+	}
+	return nil
+}
+
+// Holds returns the holds on d, which must be a snapshot, sorted by tag.
+func (d *Dataset) Holds() ([]HoldInfo, error) {
+	if d.list == nil {
+		return nil, errors.New(msgDatasetIsNil)
+	}
+
+	var nvl *C.nvlist_t
+	if C.zfs_get_holds(d.list.zh, &nvl) != 0 {
+		return nil, LastError()
+	}
+	l := (*NVList)(nvl)
+	defer l.Free()
+
+	// Each pair maps a tag to the time (in seconds since the epoch) at which the hold was placed.
+	var holds []HoldInfo
+	for p := l.Next(nil); p != nil; p = l.Next(p) {
+		created, ok := p.Value().(uint64)
+		if !ok {
+			return nil, fmt.Errorf("unexpected value for hold %q", p.Name())
+		}
+		holds = append(holds, HoldInfo{Tag: p.Name(), Created: time.Unix(int64(created), 0)})
+	}
+	sort.Sort(holdsByTag(holds))
+	return holds, nil
+}
+
+// AllHolds returns the holds on each of d's snapshots (i.e. on the snapshots among d.Children), keyed by the
+// snapshot's full name.  Snapshots without holds are omitted.
+func (d *Dataset) AllHolds() (map[string][]HoldInfo, error) {
+	all := make(map[string][]HoldInfo)
+	for i := range d.Children {
+		snap := &d.Children[i]
+		if snap.Type != DatasetTypeSnapshot {
+			continue
+		}
+		// The userrefs property is cheap to read, and is nonzero iff the snapshot has holds.
+		if snap.Properties[DatasetPropUserrefs].Value == "0" {
+			continue
+		}
+		path, err := snap.Path()
+		if err != nil {
+			return nil, err
+		}
+		holds, err := snap.Holds()
+		if err != nil {
+			return nil, err
+		}
+		if len(holds) > 0 {
+			all[path] = holds
+		}
+	}
+	return all, nil
+}
+
+type holdsByTag []HoldInfo
+
+func (a holdsByTag) Len() int           { return len(a) }
+func (a holdsByTag) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a holdsByTag) Less(i, j int) bool { return a[i].Tag < a[j].Tag }
@@ -0,0 +1,112 @@
+package zfs
+
+import (
+	"testing"
+	"time"
+)
+
+// TestHolds places holds on snapshots of a file-backed pool, including recursively, lists them, and releases them.
+func TestHolds(t *testing.T) {
+	const name = "golibzfs_holds"
+	_, cleanup := createTestPool(t, name, 1, nil)
+	defer cleanup()
+
+	child, err := DatasetCreate(name+"/child", DatasetTypeFilesystem, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child.Close()
+	for _, snap := range []string{"first", "second"} {
+		d, err := DatasetSnapshot(name+"@"+snap, true, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Close()
+	}
+
+	start := time.Now().Add(-time.Second)
+	if err := DatasetHold(name+"@first", "backup", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := DatasetHold(name+"@first", "audit", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := DatasetHold(name+"@first", "backup", false); err == nil {
+		t.Error("placing the same hold twice succeeded")
+	}
+	if err := DatasetHold(name+"@nonexistent", "backup", false); err == nil {
+		t.Error("holding a nonexistent snapshot succeeded")
+	}
+	if err := DatasetHold(name, "backup", false); err == nil {
+		t.Error("holding a filesystem succeeded")
+	}
+
+	// holds returns the tags of the holds on each of the snapshots of the dataset path.
+	holds := func(path string) map[string][]string {
+		d, err := DatasetOpen(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+		all, err := d.AllHolds()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tags := make(map[string][]string)
+		for snap, snapHolds := range all {
+			for _, hold := range snapHolds {
+				tags[snap] = append(tags[snap], hold.Tag)
+				if hold.Created.Before(start) || hold.Created.After(time.Now().Add(time.Second)) {
+					t.Errorf("hold %s on %s was created at %v", hold.Tag, snap, hold.Created)
+				}
+			}
+		}
+		return tags
+	}
+	check := func(path string, expected map[string][]string) {
+		tags := holds(path)
+		if len(tags) != len(expected) {
+			t.Errorf("holds on snapshots of %s are %v; expected %v", path, tags, expected)
+			return
+		}
+		for snap, expectedTags := range expected {
+			if len(tags[snap]) != len(expectedTags) {
+				t.Errorf("holds on snapshots of %s are %v; expected %v", path, tags, expected)
+				return
+			}
+			for i := range expectedTags {
+				if tags[snap][i] != expectedTags[i] {
+					t.Errorf("holds on snapshots of %s are %v; expected %v", path, tags, expected)
+					return
+				}
+			}
+		}
+	}
+	// The holds are sorted by tag.
+	check(name, map[string][]string{name + "@first": {"audit", "backup"}})
+	check(name+"/child", map[string][]string{name + "/child@first": {"audit"}})
+
+	// A held snapshot cannot be destroyed.
+	d, err := DatasetOpen(name + "@first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Destroy(false)
+	d.Close()
+	if err == nil {
+		t.Fatal("destroyed a held snapshot")
+	}
+
+	if err := DatasetRelease(name+"@first", "audit", true); err != nil {
+		t.Fatal(err)
+	}
+	check(name, map[string][]string{name + "@first": {"backup"}})
+	check(name+"/child", map[string][]string{})
+	if err := DatasetRelease(name+"@first", "audit", false); err == nil {
+		t.Error("releasing a hold that was already released succeeded")
+	}
+	if err := DatasetRelease(name+"@first", "backup", false); err != nil {
+		t.Fatal(err)
+	}
+	check(name, map[string][]string{})
+}
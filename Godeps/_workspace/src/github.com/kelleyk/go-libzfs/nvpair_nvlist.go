@@ -1,10 +1,12 @@
 package zfs
 
+//#include <stdlib.h>
 //#include <libnvpair.h>
 import "C"
 import (
 	"strings"
 	"syscall"
+	"unsafe"
 )
 
 // NVList corresponds to nvlist_t.
@@ -73,3 +75,50 @@ func (l *NVList) String() string {
 
 	return strings.Join(parts, ", ")
 }
+
+// AddNVList adds a copy of v to l under name.
+func (l *NVList) AddNVList(name string, v *NVList) error {
+	csName := C.CString(name)
+	defer C.free(unsafe.Pointer(csName))
+	if errno := C.nvlist_add_nvlist((*C.nvlist_t)(l), csName, (*C.nvlist_t)(v)); errno != 0 {
+		return syscall.Errno(errno)
+	}
+	return nil
+}
+
+// AddUint64Array adds a copy of v to l under name.
+func (l *NVList) AddUint64Array(name string, v []uint64) error {
+	csName := C.CString(name)
+	defer C.free(unsafe.Pointer(csName))
+	var p *C.uint64_t
+	if len(v) > 0 {
+		p = (*C.uint64_t)(unsafe.Pointer(&v[0]))
+	}
+	if errno := C.nvlist_add_uint64_array((*C.nvlist_t)(l), csName, p, C.uint_t(len(v))); errno != 0 {
+		return syscall.Errno(errno)
+	}
+	return nil
+}
+
+// LookupNVList returns the nvlist in l under name, which belongs to l, and false if there is none.
+func (l *NVList) LookupNVList(name string) (*NVList, bool) {
+	csName := C.CString(name)
+	defer C.free(unsafe.Pointer(csName))
+	var v *C.nvlist_t
+	if C.nvlist_lookup_nvlist((*C.nvlist_t)(l), csName, &v) != 0 {
+		return nil, false
+	}
+	return (*NVList)(v), true
+}
+
+// LookupUint64Array returns a copy of the uint64 array in l under name, and false if there is none.
+func (l *NVList) LookupUint64Array(name string) ([]uint64, bool) {
+	csName := C.CString(name)
+	defer C.free(unsafe.Pointer(csName))
+	var p *C.uint64_t
+	var n C.uint_t
+	if C.nvlist_lookup_uint64_array((*C.nvlist_t)(l), csName, &p, &n) != 0 {
+		return nil, false
+	}
+	return copyinUint64s(p, n), true
+}
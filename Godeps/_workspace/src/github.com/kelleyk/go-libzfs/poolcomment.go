@@ -0,0 +1,43 @@
+package zfs
+
+import (
+	"fmt"
+)
+
+// MaxPoolCommentLen is the maximum length, in bytes, of a pool's comment (ZPROP_MAX_COMMENT in libzfs).
+const MaxPoolCommentLen = 32
+
+// Comment returns pool's comment (see the "comment" pool property), or "" if it has none.
+func (pool *Pool) Comment() (string, error) {
+	prop, err := pool.GetProperty(PoolPropComment)
+	if err != nil {
+		return "", err
+	}
+	// libzfs reports a pool without a comment as having the comment "-".
+	if prop.Value == "-" {
+		return "", nil
+	}
+	return prop.Value, nil
+}
+
+// SetComment sets pool's comment, which must satisfy ValidatePoolComment.  An empty comment removes the pool's comment.
+func (pool *Pool) SetComment(comment string) error {
+	if err := ValidatePoolComment(comment); err != nil {
+		return err
+	}
+	return pool.SetProperty(PoolPropComment, comment)
+}
+
+// ValidatePoolComment returns an error if libzfs would reject comment as the comment of a pool: it may be at most
+// MaxPoolCommentLen bytes long and may contain only printable ASCII characters.
+func ValidatePoolComment(comment string) error {
+	if len(comment) > MaxPoolCommentLen {
+		return fmt.Errorf("pool comment is %d bytes long; the maximum is %d", len(comment), MaxPoolCommentLen)
+	}
+	for i := 0; i < len(comment); i++ {
+		if c := comment[i]; c < ' ' || c > '~' {
+			return fmt.Errorf("pool comment contains a non-printable character (%q)", c)
+		}
+	}
+	return nil
+}
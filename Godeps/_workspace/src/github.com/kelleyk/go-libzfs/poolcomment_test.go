@@ -0,0 +1,56 @@
+package zfs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePoolComment(t *testing.T) {
+	for _, tt := range []struct {
+		comment string
+		valid   bool
+	}{
+		{"", true},
+		{"rack 4, shelf 2", true},
+		{"~!@#$%^&*()_+`-={}|[]\\:\";'<>?,./", true},
+		{strings.Repeat("x", MaxPoolCommentLen), true},
+		{strings.Repeat("x", MaxPoolCommentLen+1), false},
+		{"tab\there", false},
+		{"newline\n", false},
+		{"del\x7f", false},
+		{"café", false},
+	} {
+		if err := ValidatePoolComment(tt.comment); (err == nil) != tt.valid {
+			t.Errorf("ValidatePoolComment(%q) = %v; expected valid=%v", tt.comment, err, tt.valid)
+		}
+	}
+}
+
+// TestPoolSetComment sets the comment of a file-backed pool and reads it back.
+func TestPoolSetComment(t *testing.T) {
+	const name = "golibzfs_comment"
+	pool, cleanup := createTestPool(t, name, 1, nil)
+	defer cleanup()
+
+	if comment, err := pool.Comment(); err != nil || comment != "" {
+		t.Fatalf("new pool has comment %q (%v); expected none", comment, err)
+	}
+	for _, comment := range []string{"rack 4, shelf 2", ""} {
+		if err := pool.SetComment(comment); err != nil {
+			t.Fatal(err)
+		}
+		// The comment is read back through a new handle, so that it is not merely the value that was cached.
+		reopened, err := PoolOpen(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := reopened.Comment()
+		reopened.Close()
+		if err != nil || got != comment {
+			t.Errorf("comment is %q (%v); expected %q", got, err, comment)
+		}
+	}
+	if err := pool.SetComment("tab\there"); err == nil {
+		t.Error("invalid comment was set")
+	}
+}
@@ -0,0 +1,33 @@
+package zfs
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// PoolOpenByGUID opens the imported pool with the given GUID.  Unlike its name, a pool's GUID does not change when the
+// pool is renamed (e.g. on import).  Returns Pool object, requires Pool.Close() to be called explicitly for memory
+// cleanup after object is not needed anymore.
+func PoolOpenByGUID(guid uint64) (pool Pool, err error) {
+	pools, err := PoolOpenAll()
+	if err != nil {
+		PoolCloseAll(pools)
+		return
+	}
+
+	want := strconv.FormatUint(guid, 10)
+	found := -1
+	for i := range pools {
+		if found == -1 && pools[i].Properties[PoolPropGUID].Value == want {
+			found = i
+			continue
+		}
+		pools[i].Close()
+	}
+	if found == -1 {
+		err = fmt.Errorf("no imported pool has GUID %d", guid)
+		return
+	}
+	pool = pools[found]
+	return
+}
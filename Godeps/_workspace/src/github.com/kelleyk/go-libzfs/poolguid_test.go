@@ -0,0 +1,39 @@
+package zfs
+
+import (
+	"strconv"
+	"testing"
+)
+
+// TestPoolOpenByGUID opens a file-backed pool by its GUID.
+func TestPoolOpenByGUID(t *testing.T) {
+	const name = "golibzfs_guid"
+	pool, cleanup := createTestPool(t, name, 1, nil)
+	defer cleanup()
+
+	guid, err := strconv.ParseUint(pool.Properties[PoolPropGUID].Value, 10, 64)
+	if err != nil {
+		t.Fatalf("unexpected value for guid property: %v", err)
+	}
+	opened, err := PoolOpenByGUID(guid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer opened.Close()
+	if got, err := opened.Name(); err != nil || got != name {
+		t.Errorf("pool with GUID %d is named %q (%v); expected %q", guid, got, err, name)
+	}
+}
+
+// TestPoolOpenByUnknownGUID checks that no pool is opened for a GUID that no imported pool has.  No pool ever has GUID
+// 0.
+func TestPoolOpenByUnknownGUID(t *testing.T) {
+	if err := Available(); err != nil {
+		t.Skip(err)
+	}
+	if pool, err := PoolOpenByGUID(0); err == nil {
+		name, _ := pool.Name()
+		pool.Close()
+		t.Errorf("opened pool %q for GUID 0", name)
+	}
+}
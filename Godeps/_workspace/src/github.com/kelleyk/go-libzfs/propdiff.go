@@ -0,0 +1,42 @@
+package zfs
+
+// DatasetPropertyDiff compares the properties of two datasets, which will typically be two snapshots of the same
+// dataset.  It returns a map from each property whose value differs to its values in snapA and snapB, in that order.
+// A property that is present for only one of the datasets has the empty string as its value for the other.
+//
+// N.B.: Not every property applies to snapshots, and some of those that do are inherited from the snapshotted
+// dataset's current value rather than recorded when the snapshot was taken.
+//
+func DatasetPropertyDiff(snapA, snapB string) (diff map[Prop][2]string, err error) {
+	a, err := DatasetOpen(snapA)
+	if err != nil {
+		return
+	}
+	defer a.Close()
+
+	b, err := DatasetOpen(snapB)
+	if err != nil {
+		return
+	}
+	defer b.Close()
+
+	diff = PropertyDiff(a.Properties, b.Properties)
+	return
+}
+
+// PropertyDiff compares two sets of properties; see DatasetPropertyDiff.  Only property values are compared;
+// differences in property sources are ignored.
+func PropertyDiff(a, b map[Prop]Property) map[Prop][2]string {
+	diff := make(map[Prop][2]string)
+	for p, aProp := range a {
+		if bProp, ok := b[p]; !ok || aProp.Value != bProp.Value {
+			diff[p] = [2]string{aProp.Value, bProp.Value}
+		}
+	}
+	for p, bProp := range b {
+		if _, ok := a[p]; !ok {
+			diff[p] = [2]string{"", bProp.Value}
+		}
+	}
+	return diff
+}
@@ -0,0 +1,40 @@
+package zfs
+
+// #include <stdlib.h>
+// #include <libzfs.h>
+// #include "zpool.h"
+// #include "zfs.h"
+import "C"
+
+import (
+	"fmt"
+)
+
+// RemovalStatus returns the statistics for the most recent device removal from pool, and true if that removal is
+// still in progress.  It returns a nil RemovalStat if no device has ever been removed from pool (which is always the
+// case with versions of ZFS that do not support device removal).
+func (pool *Pool) RemovalStatus() (*RemovalStat, bool, error) {
+	config := C.zpool_get_config(pool.list.zph, nil)
+	if config == nil {
+		return nil, false, fmt.Errorf("Failed zpool_get_config")
+	}
+	return removalStatusFromConfig(NVListFromPointer(config))
+}
+
+// removalStatusFromConfig returns the removal statistics in config, a pool's configuration; see Pool.RemovalStatus.
+func removalStatusFromConfig(config *NVList) (*RemovalStat, bool, error) {
+	nvroot, ok := config.LookupNVList(C.ZPOOL_CONFIG_VDEV_TREE)
+	if !ok {
+		return nil, false, fmt.Errorf("Failed to fetch %s", C.ZPOOL_CONFIG_VDEV_TREE)
+	}
+	a, ok := nvroot.LookupUint64Array(removalStatsKey)
+	if !ok {
+		return nil, false, nil
+	}
+
+	stat, err := removalStatFromArray(a)
+	if err != nil {
+		return nil, false, err
+	}
+	return stat, stat.State == DSLScanStateScanning, nil
+}
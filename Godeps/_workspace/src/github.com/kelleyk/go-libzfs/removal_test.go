@@ -0,0 +1,64 @@
+package zfs
+
+import (
+	"testing"
+)
+
+// TestRemovalStatusFromConfig parses synthetic pool configurations, in which the removal statistics are a uint64 array
+// in the nvlist of the vdev tree, nested in the configuration.
+func TestRemovalStatusFromConfig(t *testing.T) {
+	for _, tt := range []struct {
+		desc       string
+		noTree     bool
+		stats      []uint64 // nil if the vdev tree has no removal statistics
+		stat       *RemovalStat
+		inProgress bool
+		err        bool
+	}{
+		{desc: "no vdev tree", noTree: true, err: true},
+		{desc: "never removed"},
+		{
+			desc:       "in progress",
+			stats:      []uint64{uint64(DSLScanStateScanning), 1, 1500000000, 0, 1 << 30, 1 << 29, 4096},
+			stat:       &RemovalStat{DSLScanStateScanning, 1, 1500000000, 0, 1 << 30, 1 << 29, 4096},
+			inProgress: true,
+		},
+		{
+			desc:  "finished",
+			stats: []uint64{uint64(DSLScanStateFinished), 2, 1500000000, 1500000100, 1 << 30, 1 << 30, 8192},
+			stat:  &RemovalStat{DSLScanStateFinished, 2, 1500000000, 1500000100, 1 << 30, 1 << 30, 8192},
+		},
+		{desc: "too short", stats: []uint64{uint64(DSLScanStateScanning), 1}, err: true},
+	} {
+		config := NewNVList(NVUniqueName)
+		if !tt.noTree {
+			tree := NewNVList(NVUniqueName)
+			if tt.stats != nil {
+				if err := tree.AddUint64Array(removalStatsKey, tt.stats); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := config.AddNVList("vdev_tree", tree)
+			tree.Free()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		stat, inProgress, err := removalStatusFromConfig(config)
+		config.Free()
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error %v", tt.desc, err)
+			continue
+		}
+		if inProgress != tt.inProgress {
+			t.Errorf("%s: in progress is %v; expected %v", tt.desc, inProgress, tt.inProgress)
+		}
+		switch {
+		case (stat == nil) != (tt.stat == nil):
+			t.Errorf("%s: stat is %+v; expected %+v", tt.desc, stat, tt.stat)
+		case stat != nil && *stat != *tt.stat:
+			t.Errorf("%s: stat is %+v; expected %+v", tt.desc, *stat, *tt.stat)
+		}
+	}
+}
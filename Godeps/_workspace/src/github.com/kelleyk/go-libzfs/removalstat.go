@@ -0,0 +1,51 @@
+package zfs
+
+import (
+	"fmt"
+	"time"
+)
+
+// removalStatsKey is ZPOOL_CONFIG_REMOVAL_STATS, which only newer versions of libzfs (those that support device
+// removal) define.
+const removalStatsKey = "removal_stats"
+
+// RemovalStat - Device removal statistics.  Corresponds to `pool_removal_stat_t` in `include/sys/fs/zfs.h`.
+type RemovalStat struct {
+	State         DSLScanState // Current removal state e.g. scanning (in progress), finished ...
+	RemovingVDev  uint64       // ID of the top-level vdev being removed
+	StartTime     uint64       // Removal start time, in seconds since the epoch
+	EndTime       uint64       // Removal end time, in seconds since the epoch
+	ToCopy        uint64       // Total bytes to copy
+	Copied        uint64       // Total bytes copied
+	MappingMemory uint64       // Bytes of memory used by the indirect mapping
+}
+
+// removalStatFromArray decodes the uint64 array that libzfs stores under removalStatsKey; the elements are the fields of
+// pool_removal_stat_t, in order.
+func removalStatFromArray(a []uint64) (*RemovalStat, error) {
+	if len(a) < 7 {
+		return nil, fmt.Errorf("%s: expected 7 values, got %d", removalStatsKey, len(a))
+	}
+	return &RemovalStat{
+		State:         DSLScanState(a[0]),
+		RemovingVDev:  a[1],
+		StartTime:     a[2],
+		EndTime:       a[3],
+		ToCopy:        a[4],
+		Copied:        a[5],
+		MappingMemory: a[6],
+	}, nil
+}
+
+// Rate returns the average rate, in bytes per second, at which data has been copied off of the device being removed.
+// While the removal is in progress, the rate is measured up to now.
+func (s *RemovalStat) Rate(now time.Time) uint64 {
+	end := s.EndTime
+	if s.State == DSLScanStateScanning {
+		end = uint64(now.Unix())
+	}
+	if end <= s.StartTime {
+		return 0
+	}
+	return s.Copied / (end - s.StartTime)
+}
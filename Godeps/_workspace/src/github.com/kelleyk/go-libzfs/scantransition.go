@@ -0,0 +1,63 @@
+package zfs
+
+// ScanTransition describes how a pool's scan (e.g. scrub or resilver) changed between two successive reads of its
+// PoolScanStat; see ClassifyScanTransition.
+type ScanTransition int
+
+const (
+	ScanTransitionNone       ScanTransition = iota // nothing changed (e.g. no scan is or was running)
+	ScanTransitionStarted                          // a scan began
+	ScanTransitionProgressed                       // the same scan is still running
+	ScanTransitionCompleted                        // a scan finished
+	ScanTransitionCanceled                         // a scan was canceled
+	ScanTransitionRestarted                        // the scan that was running was replaced by a new one
+)
+
+func (t ScanTransition) String() string {
+	switch t {
+	case ScanTransitionNone:
+		return "none"
+	case ScanTransitionStarted:
+		return "started"
+	case ScanTransitionProgressed:
+		return "progressed"
+	case ScanTransitionCompleted:
+		return "completed"
+	case ScanTransitionCanceled:
+		return "canceled"
+	case ScanTransitionRestarted:
+		return "restarted"
+	default:
+		return "<UNKNOWN-VALUE>"
+	}
+}
+
+// ClassifyScanTransition classifies the change from prev to cur, which are successive reads of the same pool's scan
+// statistics.  A scan is identified by its function and start time; a scan whose counters went backwards is also
+// treated as a new scan, since ZFS resets them when a scan is restarted.  If an entire scan both started and ended
+// between the two reads, the transition is classified by how it ended.
+func ClassifyScanTransition(prev, cur PoolScanStat) ScanTransition {
+	sameScan := prev.Func == cur.Func && prev.StartTime == cur.StartTime && cur.Examined >= prev.Examined
+	wasScanning := prev.State == DSLScanStateScanning
+
+	switch cur.State {
+	case DSLScanStateScanning:
+		switch {
+		case !wasScanning:
+			return ScanTransitionStarted
+		case sameScan:
+			return ScanTransitionProgressed
+		default:
+			return ScanTransitionRestarted
+		}
+	case DSLScanStateFinished:
+		if wasScanning || !sameScan {
+			return ScanTransitionCompleted
+		}
+	case DSLScanStateCanceled:
+		if wasScanning || !sameScan {
+			return ScanTransitionCanceled
+		}
+	}
+	return ScanTransitionNone
+}
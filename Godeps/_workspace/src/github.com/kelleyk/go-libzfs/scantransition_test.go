@@ -0,0 +1,44 @@
+package zfs
+
+import (
+	"testing"
+)
+
+func TestClassifyScanTransition(t *testing.T) {
+	idle := PoolScanStat{}
+	scrub := PoolScanStat{Func: PoolScanFuncScrub, State: DSLScanStateScanning, StartTime: 1000, Examined: 1 << 20}
+	further := scrub
+	further.Examined = 2 << 20
+	restarted := scrub
+	restarted.StartTime = 2000
+	reset := scrub
+	reset.Examined = 0
+	finished := further
+	finished.State = DSLScanStateFinished
+	canceled := further
+	canceled.State = DSLScanStateCanceled
+	later := finished
+	later.StartTime = 3000
+
+	for _, tt := range []struct {
+		desc      string
+		prev, cur PoolScanStat
+		want      ScanTransition
+	}{
+		{"no scan", idle, idle, ScanTransitionNone},
+		{"none to scanning", idle, scrub, ScanTransitionStarted},
+		{"still scanning", scrub, further, ScanTransitionProgressed},
+		{"scanning to finished", scrub, finished, ScanTransitionCompleted},
+		{"scanning to canceled", scrub, canceled, ScanTransitionCanceled},
+		{"new start time", scrub, restarted, ScanTransitionRestarted},
+		{"counters went backwards", further, reset, ScanTransitionRestarted},
+		{"still finished", finished, finished, ScanTransitionNone},
+		{"still canceled", canceled, canceled, ScanTransitionNone},
+		{"whole scan between reads", finished, later, ScanTransitionCompleted},
+		{"whole scan from idle", idle, finished, ScanTransitionCompleted},
+	} {
+		if got := ClassifyScanTransition(tt.prev, tt.cur); got != tt.want {
+			t.Errorf("%s: got %v; expected %v", tt.desc, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package zfs
+
+// #include <stdlib.h>
+// #include <libzfs.h>
+// #include "zpool.h"
+// #include "zfs.h"
+import "C"
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"unsafe"
+)
+
+// SendFlags controls what is included in a send stream.  Each field corresponds to an option of `zfs send`.
+type SendFlags struct {
+	Replicate  bool // -R: include descendant datasets, along with all snapshots and properties
+	DoAll      bool // -I: for an incremental stream, include all intermediate snapshots
+	Props      bool // -p: include the dataset's properties
+	Dedup      bool // -D: generate a deduplicated stream
+	LargeBlock bool // -L: permit blocks larger than 128K
+	EmbedData  bool // -e: permit WRITE_EMBEDDED records
+	Compress   bool // -c: send blocks compressed as they are on disk
+}
+
+func (f SendFlags) toC() (cflags C.sendflags_t) {
+	cflags.replicate = booleanT(f.Replicate)
+	cflags.doall = booleanT(f.DoAll)
+	cflags.props = booleanT(f.Props)
+	cflags.dedup = booleanT(f.Dedup)
+	cflags.largeblock = booleanT(f.LargeBlock)
+	cflags.embed_data = booleanT(f.EmbedData)
+	cflags.compress = booleanT(f.Compress)
+	return
+}
+
+// Send writes a send stream for the snapshot toSnap of the filesystem or volume d to w.  If fromSnap is nonempty, the
+// stream is incremental from that snapshot.  Both snapshot names are given without the dataset name (i.e. they are
+// the part of the name after the "@").
+func (d *Dataset) Send(fromSnap, toSnap string, flags SendFlags, w io.Writer) (err error) {
+	if d.list == nil {
+		err = errors.New(msgDatasetIsNil)
+		return
+	}
+
+	var csFrom *C.char
+	if fromSnap != "" {
+		csFrom = C.CString(fromSnap)
+		defer C.free(unsafe.Pointer(csFrom))
+	}
+	csTo := C.CString(toSnap)
+	defer C.free(unsafe.Pointer(csTo))
+	cflags := flags.toC()
+
+	return sendToWriter(w, func(fd C.int) C.int {
+		return C.zfs_send(d.list.zh, csFrom, csTo, &cflags, fd, nil, nil, nil)
+	})
+}
+
+// Verify reads all of the data in d, which must be a snapshot, so that ZFS validates the checksum of every block that
+// it reads; any I/O or checksum error is returned.  It does so by generating a full send stream for the snapshot and
+// discarding it.  It returns the number of bytes in the stream, which is roughly the amount of data that was read.
+//
+// Unlike a scrub, Verify checks only the copy of each block that ZFS happens to read, and does not re-read blocks that
+// are already cached in the ARC.  It stops early, returning ctx.Err(), if ctx is canceled.
+//
+func (d *Dataset) Verify(ctx context.Context) (bytesRead uint64, err error) {
+	if d.list == nil {
+		return 0, errors.New(msgDatasetIsNil)
+	}
+	path, err := d.Path()
+	if err != nil {
+		return 0, err
+	}
+
+	w := &discardWriter{ctx: ctx}
+	var sendErr error
+	err = withSnapshotParent(path, func(zh *C.zfs_handle_t, csSnap *C.char) C.int {
+		var cflags C.sendflags_t
+		sendErr = sendToWriter(w, func(fd C.int) C.int {
+			return C.zfs_send(zh, nil, csSnap, &cflags, fd, nil, nil, nil)
+		})
+		return 0
+	})
+	if err == nil {
+		err = sendErr
+	}
+	return w.n, err
+}
+
+// discardWriter counts and discards what is written to it, and fails once its context is done.
+type discardWriter struct {
+	ctx context.Context
+	n   uint64
+}
+
+func (w *discardWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	w.n += uint64(len(p))
+	return len(p), nil
+}
+
+// sendToWriter calls send, which should write a send stream to the file descriptor it is given and return nonzero on
+// failure, and copies the stream to w.
+//
+// libzfs can only write to a file descriptor, so the stream passes through a pipe.  If writing to w fails, the read
+// end of the pipe is closed so that libzfs's writes fail (with EPIPE) instead of blocking forever.
+//
+func sendToWriter(w io.Writer, send func(fd C.int) C.int) error {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	copyErrC := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(w, pr)
+		pr.Close()
+		copyErrC <- err
+	}()
+
+	var sendErr error
+	if send(C.int(pw.Fd())) != 0 {
+		sendErr = LastError()
+		if sendErr == nil {
+			sendErr = errors.New("send failed")
+		}
+	}
+	pw.Close()
+
+	// If w failed, that's probably also why the send failed, so report that error in preference to the other.
+	if copyErr := <-copyErrC; copyErr != nil {
+		return copyErr
+	}
+	return sendErr
+}
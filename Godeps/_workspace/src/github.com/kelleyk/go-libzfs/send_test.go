@@ -0,0 +1,100 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// TestVerify verifies a snapshot on a file-backed pool, and then verifies it again after corrupting its data in the
+// file that backs the pool.
+func TestVerify(t *testing.T) {
+	const name = "golibzfs_verify"
+	pool, cleanup := createTestPool(t, name, 1, nil)
+	defer cleanup()
+	tree, err := pool.VDevTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := tree.Leaves()[0].Path
+
+	// Random data is stored as written, even if compression is enabled, so it can be found in the image.
+	data := make([]byte, 1<<20)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	where, unmount := mountTestDataset(t, name)
+	err = ioutil.WriteFile(filepath.Join(where, "data"), data, 0644)
+	unmount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := DatasetSnapshot(name+"@snap", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := snap.Verify(context.Background())
+	snap.Close()
+	if err != nil {
+		t.Fatalf("failed to verify an intact snapshot: %v", err)
+	}
+	if n < uint64(len(data)) {
+		t.Errorf("read %d bytes; expected at least %d", n, len(data))
+	}
+
+	// Exporting the pool evicts its data from the ARC, so that it is read from the image again once it is imported.
+	if err := pool.Export(false, "go-libzfs test"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marker := data[:64]
+	corrupted := 0
+	for i := bytes.Index(b, marker); i >= 0; i = bytes.Index(b, marker) {
+		b[i] ^= 0xff
+		corrupted++
+	}
+	if corrupted == 0 {
+		t.Fatal("data not found in the image")
+	}
+	if err := ioutil.WriteFile(image, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := PoolImport(name, []string{filepath.Dir(image)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer imported.Close()
+
+	snap, err = DatasetOpen(name + "@snap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+	if _, err := snap.Verify(context.Background()); err == nil {
+		t.Error("verified a corrupted snapshot")
+	}
+}
+
+// TestVerifyCanceled checks that Verify stops once its context is canceled.
+func TestVerifyCanceled(t *testing.T) {
+	const name = "golibzfs_verify_cancel"
+	_, cleanup := createTestPool(t, name, 1, nil)
+	defer cleanup()
+	snap, err := DatasetSnapshot(name+"@snap", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := snap.Verify(ctx); err != context.Canceled {
+		t.Errorf("Verify returned %v; expected %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,62 @@
+package zfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// sendStreamMagic is DMU_BACKUP_MAGIC, the value of the drr_magic field of the BEGIN record of a send stream.
+	sendStreamMagic = 0x2F5bacbac
+	// sendStreamHeaderLen is the length of the BEGIN record (a dmu_replay_record_t) that starts a send stream.
+	sendStreamHeaderLen = 312
+	// sendStreamCompound is DMU_COMPOUNDSTREAM, the header type of a stream that contains other streams.
+	sendStreamCompound = 2
+)
+
+// SendStreamHeader describes a send stream (e.g. one written by Dataset.Send).  It corresponds to the `drr_begin`
+// record that starts the stream; see `include/sys/zfs_ioctl.h`.
+type SendStreamHeader struct {
+	ToName       string    // The snapshot that the stream is of, e.g. "pool/fs@snap"
+	ToGUID       uint64    // The GUID of that snapshot
+	FromGUID     uint64    // The GUID of the snapshot that an incremental stream is from, or 0 for a full stream
+	CreationTime time.Time // When the snapshot was created
+	// Compound is true if the stream is a package of streams, such as a replication (-R) stream, rather than the
+	// stream of a single snapshot.
+	Compound bool
+}
+
+// ParseSendStreamHeader decodes the header at the start of b, which should be (at least) the first 312 bytes of a
+// send stream.  A stream is written in the byte order of the host that sent it; either order is accepted.
+func ParseSendStreamHeader(b []byte) (*SendStreamHeader, error) {
+	if len(b) < sendStreamHeaderLen {
+		return nil, fmt.Errorf("send stream header is %d bytes; expected %d", len(b), sendStreamHeaderLen)
+	}
+	var order binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint64(b[8:]) == sendStreamMagic:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint64(b[8:]) == sendStreamMagic:
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("not a send stream: bad magic number")
+	}
+	if recordType := order.Uint32(b[0:]); recordType != 0 {
+		return nil, fmt.Errorf("send stream starts with a record of type %d; expected BEGIN (0)", recordType)
+	}
+
+	name := b[56 : 56+256]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	return &SendStreamHeader{
+		ToName:       string(name),
+		ToGUID:       order.Uint64(b[40:]),
+		FromGUID:     order.Uint64(b[48:]),
+		CreationTime: time.Unix(int64(order.Uint64(b[24:])), 0),
+		Compound:     order.Uint64(b[16:])&0x3 == sendStreamCompound,
+	}, nil
+}
@@ -0,0 +1,73 @@
+package zfs
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// sendStreamHeader returns the BEGIN record of a stream of the snapshot toName, encoded in the given byte order.
+func sendStreamHeader(order binary.ByteOrder, toName string, compound bool) []byte {
+	b := make([]byte, sendStreamHeaderLen)
+	order.PutUint32(b[0:], 0)                   // drr_type: DRR_BEGIN
+	order.PutUint32(b[4:], 0)                   // drr_payloadlen
+	order.PutUint64(b[8:], sendStreamMagic)     // drr_magic
+	order.PutUint64(b[16:], 1)                  // drr_versioninfo: DMU_SUBSTREAM
+	order.PutUint64(b[24:], 1500000000)         // drr_creation_time
+	order.PutUint32(b[32:], 2)                  // drr_type: DMU_OST_ZFS
+	order.PutUint64(b[40:], 0x1122334455667788) // drr_toguid
+	order.PutUint64(b[48:], 42)                 // drr_fromguid
+	if compound {
+		order.PutUint64(b[16:], sendStreamCompound)
+	}
+	copy(b[56:], toName)
+	return b
+}
+
+func TestParseSendStreamHeader(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for _, compound := range []bool{false, true} {
+			b := append(sendStreamHeader(order, "tank/data@snap", compound), "the rest of the stream"...)
+			h, err := ParseSendStreamHeader(b)
+			if err != nil {
+				t.Fatalf("%v: %v", order, err)
+			}
+			expected := SendStreamHeader{
+				ToName:       "tank/data@snap",
+				ToGUID:       0x1122334455667788,
+				FromGUID:     42,
+				CreationTime: time.Unix(1500000000, 0),
+				Compound:     compound,
+			}
+			if *h != expected {
+				t.Errorf("%v: header is %+v; expected %+v", order, *h, expected)
+			}
+		}
+	}
+
+	// A name that fills drr_toname has no terminating NUL.
+	name := make([]byte, 256)
+	for i := range name {
+		name[i] = 'a'
+	}
+	if h, err := ParseSendStreamHeader(sendStreamHeader(binary.LittleEndian, string(name), false)); err != nil {
+		t.Error(err)
+	} else if h.ToName != string(name) {
+		t.Errorf("name is %q; expected %q", h.ToName, name)
+	}
+
+	badMagic := sendStreamHeader(binary.LittleEndian, "tank/data@snap", false)
+	badMagic[8]++
+	notBegin := sendStreamHeader(binary.BigEndian, "tank/data@snap", false)
+	notBegin[3] = 1 // DRR_OBJECT
+	for _, b := range [][]byte{
+		nil,
+		sendStreamHeader(binary.LittleEndian, "tank/data@snap", false)[:sendStreamHeaderLen-1],
+		badMagic,
+		notBegin,
+	} {
+		if _, err := ParseSendStreamHeader(b); err == nil {
+			t.Errorf("parsed a bad header: %x", b)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package zfs
+
+// #cgo LDFLAGS: -lzfs_core
+// #include <stdlib.h>
+// #include <libzfs_core.h>
+import "C"
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+// SendSize returns an estimate of the size, in bytes, of the stream that Send would write for the same arguments,
+// without generating the stream.  With Compress, the estimate is of the compressed stream.  Replicate is not
+// supported, since the estimate covers the snapshots of d alone; with DoAll, the estimate does not include the small
+// overhead of each intermediate snapshot.
+func (d *Dataset) SendSize(fromSnap, toSnap string, flags SendFlags) (uint64, error) {
+	if d.list == nil {
+		return 0, errors.New(msgDatasetIsNil)
+	}
+	if flags.Replicate {
+		return 0, errors.New("send size estimates are not supported for replication streams")
+	}
+	path, err := d.Path()
+	if err != nil {
+		return 0, err
+	}
+
+	csTo := C.CString(path + "@" + toSnap)
+	defer C.free(unsafe.Pointer(csTo))
+	var csFrom *C.char
+	if fromSnap != "" {
+		csFrom = C.CString(path + "@" + fromSnap)
+		defer C.free(unsafe.Pointer(csFrom))
+	}
+	var cflags C.enum_lzc_send_flags
+	if flags.EmbedData {
+		cflags |= C.LZC_SEND_FLAG_EMBED_DATA
+	}
+	if flags.LargeBlock {
+		cflags |= C.LZC_SEND_FLAG_LARGE_BLOCK
+	}
+	if flags.Compress {
+		cflags |= C.LZC_SEND_FLAG_COMPRESS
+	}
+
+	var space C.uint64_t
+	if errno := C.lzc_send_space(csTo, csFrom, cflags, &space); errno != 0 {
+		return 0, syscall.Errno(errno)
+	}
+	return uint64(space), nil
+}
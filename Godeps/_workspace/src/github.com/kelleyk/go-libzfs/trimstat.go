@@ -0,0 +1,115 @@
+package zfs
+
+import "time"
+
+// VDevTrimState - Corresponds to `vdev_trim_state_t` in `include/sys/fs/zfs.h`.
+type VDevTrimState uint64
+
+const (
+	VDevTrimStateNone VDevTrimState = iota
+	VDevTrimStateActive
+	VDevTrimStateCanceled
+	VDevTrimStateSuspended
+	VDevTrimStateComplete
+)
+
+func (s VDevTrimState) String() string {
+	switch s {
+	case VDevTrimStateNone:
+		return "none"
+	case VDevTrimStateActive:
+		return "active"
+	case VDevTrimStateCanceled:
+		return "canceled"
+	case VDevTrimStateSuspended:
+		return "suspended"
+	case VDevTrimStateComplete:
+		return "complete"
+	default:
+		return "<UNKNOWN-VALUE>"
+	}
+}
+
+// TrimStat - Trim statistics for a single leaf device.  Only newer versions of ZFS (those that support TRIM) report
+// them; they are the vs_trim_* fields at the end of their `vdev_stat_t`.
+type TrimStat struct {
+	State        VDevTrimState
+	NotSupported bool   // true if the device does not support TRIM
+	Errors       uint64 // trim errors
+	BytesDone    uint64 // bytes trimmed
+	BytesEst     uint64 // total bytes to trim
+	ActionTime   uint64 // time at which the trim's state last changed (e.g. it started), in seconds since the epoch
+}
+
+// trimStatsOffset is the index of vs_trim_errors in the uint64 array that libzfs stores under ZPOOL_CONFIG_VDEV_STATS,
+// with the `vdev_stat_t` layout of ZFS 0.8; the other vs_trim_* fields follow it.
+const trimStatsOffset = 35
+
+// vdevStatsKey is ZPOOL_CONFIG_VDEV_STATS.
+const vdevStatsKey = "vdev_stats"
+
+// trimStatFromConfig returns the trim statistics in nv, the configuration of a leaf device (see trimStatFromStats).
+func trimStatFromConfig(nv *NVList) *TrimStat {
+	a, ok := nv.LookupUint64Array(vdevStatsKey)
+	if !ok {
+		return nil
+	}
+	return trimStatFromStats(a)
+}
+
+// trimStatFromStats decodes the trim statistics from the raw ZPOOL_CONFIG_VDEV_STATS array of a leaf device.  It
+// returns nil if the array is too short to contain them (i.e. if this version of ZFS does not support TRIM).
+func trimStatFromStats(a []uint64) *TrimStat {
+	if len(a) < trimStatsOffset+6 {
+		return nil
+	}
+	a = a[trimStatsOffset:]
+	return &TrimStat{
+		Errors:       a[0],
+		NotSupported: a[1] != 0,
+		BytesDone:    a[2],
+		BytesEst:     a[3],
+		State:        VDevTrimState(a[4]),
+		ActionTime:   a[5],
+	}
+}
+
+// Rate returns the average rate, in bytes per second, at which the device has been trimmed since the trim started.
+// It is only meaningful while the trim is active.
+func (s *TrimStat) Rate(now time.Time) uint64 {
+	start := s.ActionTime
+	if s.State != VDevTrimStateActive || uint64(now.Unix()) <= start {
+		return 0
+	}
+	return s.BytesDone / (uint64(now.Unix()) - start)
+}
+
+// VDevTrimStat describes the trim progress of a single leaf device.
+type VDevTrimStat struct {
+	Name string
+	Path string
+	TrimStat
+}
+
+// TrimStatus returns the trim progress of each leaf device in the pool (e.g. each disk), whether the trim was started
+// manually (`zpool trim`) or by autotrim.  It returns no results if this version of ZFS does not support TRIM.
+func (pool *Pool) TrimStatus() ([]VDevTrimStat, error) {
+	vdevs, err := pool.VDevTree()
+	if err != nil {
+		return nil, err
+	}
+	return vdevs.TrimResults(), nil
+}
+
+// TrimResults returns a VDevTrimStat for each leaf device in the tree that reports trim statistics; see
+// Pool.TrimStatus.
+func (v *VDevTree) TrimResults() []VDevTrimStat {
+	var results []VDevTrimStat
+	for _, leaf := range v.Leaves() {
+		if leaf.Trim == nil {
+			continue
+		}
+		results = append(results, VDevTrimStat{Name: leaf.Name, Path: leaf.Path, TrimStat: *leaf.Trim})
+	}
+	return results
+}
@@ -0,0 +1,81 @@
+package zfs
+
+import (
+	"testing"
+	"time"
+)
+
+// leafConfig returns a synthetic configuration of a leaf device whose ZPOOL_CONFIG_VDEV_STATS array has n elements,
+// the last of which are set by set.
+func leafConfig(t *testing.T, n int, set func(stats []uint64)) *NVList {
+	stats := make([]uint64, n)
+	if set != nil {
+		set(stats)
+	}
+	nv := NewNVList(NVUniqueName)
+	if err := nv.AddUint64Array(vdevStatsKey, stats); err != nil {
+		nv.Free()
+		t.Fatal(err)
+	}
+	return nv
+}
+
+func TestTrimStatFromConfig(t *testing.T) {
+	// ZFS 0.8 and later report trim statistics after the other fields of vdev_stat_t.
+	nv := leafConfig(t, trimStatsOffset+6, func(stats []uint64) {
+		copy(stats[trimStatsOffset:], []uint64{2, 0, 1 << 20, 1 << 30, uint64(VDevTrimStateActive), 1500000000})
+	})
+	stat := trimStatFromConfig(nv)
+	nv.Free()
+	expected := TrimStat{
+		State:      VDevTrimStateActive,
+		Errors:     2,
+		BytesDone:  1 << 20,
+		BytesEst:   1 << 30,
+		ActionTime: 1500000000,
+	}
+	if stat == nil || *stat != expected {
+		t.Fatalf("trim stat is %+v; expected %+v", stat, expected)
+	}
+	if rate := stat.Rate(time.Unix(1500000000+16, 0)); rate != 1<<16 {
+		t.Errorf("rate is %d; expected %d", rate, 1<<16)
+	}
+
+	nv = leafConfig(t, trimStatsOffset+6, func(stats []uint64) {
+		stats[trimStatsOffset+1] = 1
+	})
+	if stat := trimStatFromConfig(nv); stat == nil || !stat.NotSupported || stat.State != VDevTrimStateNone {
+		t.Errorf("trim stat is %+v; expected an unsupported device", stat)
+	}
+	nv.Free()
+
+	// Older versions of ZFS report a shorter array, and no trim statistics.
+	nv = leafConfig(t, trimStatsOffset, nil)
+	if stat := trimStatFromConfig(nv); stat != nil {
+		t.Errorf("trim stat is %+v; expected none", stat)
+	}
+	nv.Free()
+
+	nv = NewNVList(NVUniqueName)
+	if stat := trimStatFromConfig(nv); stat != nil {
+		t.Errorf("trim stat is %+v for a device without stats; expected none", stat)
+	}
+	nv.Free()
+}
+
+func TestTrimResults(t *testing.T) {
+	tree := raidz2CacheTree()
+	tree.Devices[0].Devices[1].Trim = &TrimStat{State: VDevTrimStateComplete, BytesDone: 100, BytesEst: 100}
+	tree.Devices[1].Devices[0].Trim = &TrimStat{State: VDevTrimStateActive, BytesDone: 10, BytesEst: 100}
+
+	results := tree.TrimResults()
+	if len(results) != 2 {
+		t.Fatalf("got %d results; expected 2: %+v", len(results), results)
+	}
+	if results[0].Name != "sdb" || results[0].State != VDevTrimStateComplete {
+		t.Errorf("first result is %+v", results[0])
+	}
+	if results[1].Name != "nvme0n1" || results[1].Path != "/dev/nvme0n1p1" || results[1].BytesDone != 10 {
+		t.Errorf("second result is %+v", results[1])
+	}
+}
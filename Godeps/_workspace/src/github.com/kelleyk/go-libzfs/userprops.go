@@ -0,0 +1,21 @@
+package zfs
+
+// userPropSourceReceived is the source that libzfs reports for a user property that was received (e.g. with
+// `zfs receive`); it is ZPROP_SOURCE_VAL_RECVD in libzfs.
+const userPropSourceReceived = "$recvd"
+
+// userPropertySource converts the source that libzfs reports for a user property of the dataset dPath into one of the
+// strings used for Property.Source.  libzfs reports the name of the dataset that the property is set on, which is
+// dPath itself unless the property is inherited, or userPropSourceReceived if the property was received.
+func userPropertySource(source, dPath string) string {
+	switch source {
+	case userPropSourceReceived:
+		return "received"
+	case dPath:
+		return "local"
+	case "":
+		return "none"
+	default:
+		return "inherited"
+	}
+}
@@ -0,0 +1,106 @@
+package zfs
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestUserPropertySource(t *testing.T) {
+	for _, tt := range []struct {
+		source, expected string
+	}{
+		{"tank/fs", "local"},
+		{"tank", "inherited"},
+		{"tank/fs/child", "inherited"},
+		{"$recvd", "received"},
+		{"", "none"},
+	} {
+		if source := userPropertySource(tt.source, "tank/fs"); source != tt.expected {
+			t.Errorf("source %q of a property of tank/fs is %q; expected %q", tt.source, source, tt.expected)
+		}
+	}
+}
+
+// TestAllUserProperties reads user properties that are set locally, inherited, and received (from a send stream
+// that includes properties, received with `zfs receive`) on a file-backed pool.
+func TestAllUserProperties(t *testing.T) {
+	const name = "golibzfs_userprops"
+	_, cleanup := createTestPool(t, name, 1, nil)
+	defer cleanup()
+	zfsPath, err := exec.LookPath("zfs")
+	if err != nil {
+		t.Skip("zfs is not installed")
+	}
+
+	setUserProperties := func(path string, props map[string]string) {
+		d, err := DatasetOpen(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+		for k, v := range props {
+			if err := d.SetUserProperty(k, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	src, err := DatasetCreate(name+"/src", DatasetTypeFilesystem, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.Close()
+	setUserProperties(name, map[string]string{"com.example:pool": "everywhere"})
+	setUserProperties(name+"/src", map[string]string{"com.example:sent": "yes", "com.example:tag": "src"})
+	snap, err := DatasetSnapshot(name+"/src@sent", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap.Close()
+
+	src, err = DatasetOpen(name + "/src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	cmd := exec.Command(zfsPath, "receive", "-u", name+"/dst")
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	sendErr := src.Send("", "sent", SendFlags{Props: true}, w)
+	w.Close()
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("zfs receive failed: %v", err)
+	}
+	if sendErr != nil {
+		t.Fatal(sendErr)
+	}
+	// A local value overrides the received one.
+	setUserProperties(name+"/dst", map[string]string{"com.example:tag": "dst"})
+
+	dst, err := DatasetOpen(name + "/dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	props, err := dst.AllUserProperties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]Property{
+		"com.example:pool": {Value: "everywhere", Source: "inherited"},
+		"com.example:sent": {Value: "yes", Source: "received"},
+		"com.example:tag":  {Value: "dst", Source: "local"},
+	}
+	if len(props) != len(expected) {
+		t.Errorf("user properties are %+v; expected %+v", props, expected)
+	}
+	for k, v := range expected {
+		if props[k] != v {
+			t.Errorf("user property %s is %+v; expected %+v", k, props[k], v)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package zfs
+
+// #include <stdlib.h>
+// #include <libzfs.h>
+// #include "zpool.h"
+// #include "zfs.h"
+import "C"
+
+import (
+	"errors"
+	"sort"
+)
+
+// UserSpace returns the space charged to each user on d (see `zfs userspace`), sorted by identity.
+func (d *Dataset) UserSpace() ([]UserSpaceEntry, error) {
+	return d.userSpace(C.ZFS_PROP_USERUSED)
+}
+
+// GroupSpace returns the space charged to each group on d (see `zfs groupspace`), sorted by identity.
+func (d *Dataset) GroupSpace() ([]UserSpaceEntry, error) {
+	return d.userSpace(C.ZFS_PROP_GROUPUSED)
+}
+
+func (d *Dataset) userSpace(typ C.zfs_userquota_prop_t) ([]UserSpaceEntry, error) {
+	if d.list == nil {
+		return nil, errors.New(msgDatasetIsNil)
+	}
+
+	var list *C.userspace_list_t
+	rc := C.userspace_list(d.list.zh, typ, &list)
+	defer C.userspace_list_free(list)
+	if rc != 0 {
+		return nil, LastError()
+	}
+
+	var entries []UserSpaceEntry
+	for item := list; item != nil; item = C.userspace_next(item) {
+		entries = append(entries, UserSpaceEntry{
+			Domain: C.GoString(item.domain),
+			ID:     uint32(item.rid),
+			Used:   uint64(item.space),
+		})
+	}
+	sort.Sort(userSpaceByIdentity(entries))
+	return entries, nil
+}
@@ -0,0 +1,38 @@
+package zfs
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// UserSpaceEntry describes the space charged to one user or group on a dataset.
+type UserSpaceEntry struct {
+	// Domain is empty for a POSIX user or group.  For an SMB identity, it is the domain part of the identity's SID
+	// (e.g. "S-1-5-21-3623811015-3361044348-30300820").
+	Domain string
+	// ID is the UID or GID of a POSIX identity, or the relative ID (RID) of an SMB identity within Domain.
+	ID uint32
+	// Used is the number of bytes charged to the identity.
+	Used uint64
+}
+
+// Identity returns the identity that e describes in the form used by `zfs userspace -n`: the numeric UID or GID of a
+// POSIX identity, or the full SID (e.g. "S-1-5-21-3623811015-3361044348-30300820-1013") of an SMB identity.
+func (e UserSpaceEntry) Identity() string {
+	if e.Domain == "" {
+		return strconv.FormatUint(uint64(e.ID), 10)
+	}
+	return fmt.Sprintf("%s-%d", e.Domain, e.ID)
+}
+
+// userSpaceByIdentity sorts POSIX identities (by ID) before SMB identities (by domain, then RID).
+type userSpaceByIdentity []UserSpaceEntry
+
+func (a userSpaceByIdentity) Len() int      { return len(a) }
+func (a userSpaceByIdentity) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a userSpaceByIdentity) Less(i, j int) bool {
+	if a[i].Domain != a[j].Domain {
+		return a[i].Domain < a[j].Domain
+	}
+	return a[i].ID < a[j].ID
+}
@@ -0,0 +1,84 @@
+package zfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"testing"
+)
+
+func TestUserSpaceEntryIdentity(t *testing.T) {
+	entries := []UserSpaceEntry{
+		{Domain: "S-1-5-21-3623811015-3361044348-30300820", ID: 1013},
+		{ID: 1000},
+		{Domain: "S-1-5-21-1", ID: 500},
+		{ID: 0},
+		{Domain: "S-1-5-21-1", ID: 42},
+	}
+	sort.Sort(userSpaceByIdentity(entries))
+	var identities []string
+	for _, e := range entries {
+		identities = append(identities, e.Identity())
+	}
+	// POSIX identities come first, by ID; then SMB identities, by domain and then RID.
+	expected := []string{"0", "1000", "S-1-5-21-1-42", "S-1-5-21-1-500", "S-1-5-21-3623811015-3361044348-30300820-1013"}
+	if len(identities) != len(expected) {
+		t.Fatalf("identities are %v; expected %v", identities, expected)
+	}
+	for i := range expected {
+		if identities[i] != expected[i] {
+			t.Fatalf("identities are %v; expected %v", identities, expected)
+		}
+	}
+}
+
+// TestUserSpace writes files owned by a user and a group to a file-backed pool and checks that the space is charged to
+// them.
+func TestUserSpace(t *testing.T) {
+	const name = "golibzfs_userspace"
+	const uid, gid = 4321, 8765
+	_, cleanup := createTestPool(t, name, 1, nil)
+	defer cleanup()
+	where, unmount := mountTestDataset(t, name)
+	defer unmount()
+
+	path := filepath.Join(where, "data")
+	if err := ioutil.WriteFile(path, make([]byte, 1<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(path, uid, gid); err != nil {
+		t.Fatal(err)
+	}
+	// The space is charged once the transaction group that writes the file has been synced.
+	syscall.Sync()
+
+	d, err := DatasetOpen(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for _, tt := range []struct {
+		kind  string
+		id    uint32
+		space func() ([]UserSpaceEntry, error)
+	}{
+		{"user", uid, d.UserSpace},
+		{"group", gid, d.GroupSpace},
+	} {
+		entries, err := tt.space()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var used uint64
+		for _, e := range entries {
+			if e.Domain == "" && e.ID == tt.id {
+				used = e.Used
+			}
+		}
+		if used < 1<<20 {
+			t.Errorf("%s %d is charged %d bytes; expected at least %d: %+v", tt.kind, tt.id, used, 1<<20, entries)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package zfs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VDevScrubResult describes the errors found, and the repairs made, on a single leaf device.
+type VDevScrubResult struct {
+	Name           string
+	Path           string
+	ChecksumErrors uint64 // checksum errors
+	SelfHealed     uint64 // bytes repaired
+	Repaired       bool   // true iff any bytes were repaired
+}
+
+// ScrubReport returns a VDevScrubResult for each leaf device in the pool (e.g. each disk).
+//
+// N.B.: The underlying counters are cumulative; they are reset when the pool is imported or when its errors are
+// cleared (e.g. with `zpool clear`), not when a scrub starts.
+//
+func (pool *Pool) ScrubReport() ([]VDevScrubResult, error) {
+	vdevs, err := pool.VDevTree()
+	if err != nil {
+		return nil, err
+	}
+	return vdevs.ScrubResults(), nil
+}
+
+// ScrubResults returns a VDevScrubResult for each leaf device in the tree; see Pool.ScrubReport.
+func (v *VDevTree) ScrubResults() []VDevScrubResult {
+	var results []VDevScrubResult
+	for _, leaf := range v.Leaves() {
+		results = append(results, VDevScrubResult{
+			Name:           leaf.Name,
+			Path:           leaf.Path,
+			ChecksumErrors: leaf.Stat.ChecksumErrors,
+			SelfHealed:     leaf.Stat.SelfHealed,
+			Repaired:       leaf.Stat.SelfHealed > 0,
+		})
+	}
+	return results
+}
+
+// VDevHealthSummary counts the leaf devices in a tree by state and totals their errors; see VDevTree.HealthSummary.
+type VDevHealthSummary struct {
+	Online, Degraded, Faulted, Offline, Removed int
+	Unavailable                                 int // devices that cannot be opened, or that are in any other state
+
+	ReadErrors, WriteErrors, ChecksumErrors uint64
+}
+
+// HealthSummary summarizes the state and the errors of each leaf device in the tree (see Leaves), e.g. for a
+// dashboard.  The states and error counters of groups of devices (e.g. mirrors, raidz groups, and devices that are
+// being replaced) are not counted, since they only reflect those of their members.
+func (v *VDevTree) HealthSummary() VDevHealthSummary {
+	var s VDevHealthSummary
+	for _, leaf := range v.Leaves() {
+		switch leaf.Stat.State {
+		case VDevStateHealthy:
+			s.Online++
+		case VDevStateDegraded:
+			s.Degraded++
+		case VDevStateFaulted:
+			s.Faulted++
+		case VDevStateOffline:
+			s.Offline++
+		case VDevStateRemoved:
+			s.Removed++
+		default:
+			s.Unavailable++
+		}
+		s.ReadErrors += leaf.Stat.ReadErrors
+		s.WriteErrors += leaf.Stat.WriteErrors
+		s.ChecksumErrors += leaf.Stat.ChecksumErrors
+	}
+	return s
+}
+
+// String returns a one-line description of s, e.g. "3 online, 1 faulted; 0 read, 0 write, 5 checksum errors".  States
+// that no device is in are omitted.
+func (s VDevHealthSummary) String() string {
+	var states []string
+	for _, c := range []struct {
+		n     int
+		state string
+	}{
+		{s.Online, "online"}, {s.Degraded, "degraded"}, {s.Faulted, "faulted"}, {s.Offline, "offline"},
+		{s.Removed, "removed"}, {s.Unavailable, "unavailable"},
+	} {
+		if c.n > 0 {
+			states = append(states, fmt.Sprintf("%d %s", c.n, c.state))
+		}
+	}
+	if len(states) == 0 {
+		states = []string{"no devices"}
+	}
+	return fmt.Sprintf("%s; %d read, %d write, %d checksum errors", strings.Join(states, ", "), s.ReadErrors,
+		s.WriteErrors, s.ChecksumErrors)
+}
+
+// Leaves returns each leaf device (i.e. each disk or file) in the tree, in order, including those in e.g. cache
+// groups.
+func (v *VDevTree) Leaves() []*VDevTree {
+	var leaves []*VDevTree
+	v.walk(func(vdev *VDevTree) bool {
+		if len(vdev.Devices) == 0 && (vdev.Type == VDevTypeDisk || vdev.Type == VDevTypeFile) {
+			leaves = append(leaves, vdev)
+		}
+		return true
+	})
+	return leaves
+}
+
+// Find returns the first device in the tree (in depth-first order, starting with v itself) whose name, path, or GUID
+// (formatted in decimal, as by `zpool status -g`) is nameOrGUID.
+func (v *VDevTree) Find(nameOrGUID string) (*VDevTree, bool) {
+	var found *VDevTree
+	v.walk(func(vdev *VDevTree) bool {
+		if vdev.Name == nameOrGUID || (vdev.Path != "" && vdev.Path == nameOrGUID) ||
+			(vdev.GUID != 0 && strconv.FormatUint(vdev.GUID, 10) == nameOrGUID) {
+			found = vdev
+			return false
+		}
+		return true
+	})
+	return found, found != nil
+}
+
+// walk calls f on v and then on each of its descendants, depth first, until f returns false.  It returns false iff
+// the walk was stopped.
+func (v *VDevTree) walk(f func(*VDevTree) bool) bool {
+	if !f(v) {
+		return false
+	}
+	for i := range v.Devices {
+		if !v.Devices[i].walk(f) {
+			return false
+		}
+	}
+	return true
+}
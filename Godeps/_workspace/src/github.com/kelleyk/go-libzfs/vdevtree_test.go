@@ -0,0 +1,85 @@
+package zfs
+
+import (
+	"testing"
+)
+
+// raidz2CacheTree returns the tree of a pool with a raidz2 group of four disks and a cache device, as built for
+// PoolCreate.
+func raidz2CacheTree() VDevTree {
+	return VDevTree{
+		Type: VDevTypeRoot,
+		Name: "tank",
+		GUID: 1,
+		Devices: []VDevTree{
+			{
+				Type:   VDevTypeRaidz,
+				Name:   "raidz2-0",
+				Parity: 2,
+				GUID:   2,
+				Devices: []VDevTree{
+					{Type: VDevTypeDisk, Name: "sda", Path: "/dev/sda1", GUID: 3},
+					{Type: VDevTypeDisk, Name: "sdb", Path: "/dev/sdb1", GUID: 4},
+					{Type: VDevTypeDisk, Name: "sdc", Path: "/dev/sdc1", GUID: 5},
+					{Type: VDevTypeDisk, Name: "sdd", Path: "/dev/sdd1", GUID: 6},
+				},
+			},
+			{
+				Type: VDevTypeL2cache,
+				Name: "cache",
+				Devices: []VDevTree{
+					{Type: VDevTypeDisk, Name: "nvme0n1", Path: "/dev/nvme0n1p1", GUID: 7},
+				},
+			},
+		},
+	}
+}
+
+func TestVDevTreeLeaves(t *testing.T) {
+	tree := raidz2CacheTree()
+	var names []string
+	for _, leaf := range tree.Leaves() {
+		names = append(names, leaf.Name)
+	}
+	expected := []string{"sda", "sdb", "sdc", "sdd", "nvme0n1"}
+	if len(names) != len(expected) {
+		t.Fatalf("leaves are %v; expected %v", names, expected)
+	}
+	for i := range names {
+		if names[i] != expected[i] {
+			t.Fatalf("leaves are %v; expected %v", names, expected)
+		}
+	}
+
+	// The leaves are the devices in the tree, not copies of them.
+	tree.Leaves()[4].Stat.ChecksumErrors = 3
+	if tree.Devices[1].Devices[0].Stat.ChecksumErrors != 3 {
+		t.Error("leaf is a copy of the device in the tree")
+	}
+}
+
+func TestVDevTreeFind(t *testing.T) {
+	tree := raidz2CacheTree()
+	for _, tt := range []struct {
+		nameOrGUID string
+		found      string // the name of the device found, or "" if none is
+	}{
+		{"sdc", "sdc"},
+		{"/dev/sdb1", "sdb"},
+		{"7", "nvme0n1"},
+		{"raidz2-0", "raidz2-0"},
+		{"tank", "tank"},
+		{"cache", "cache"},
+		{"sde", ""},
+		{"0", ""},
+		{"", ""},
+	} {
+		vdev, ok := tree.Find(tt.nameOrGUID)
+		switch {
+		case ok != (tt.found != ""):
+			t.Errorf("Find(%q) found %v; expected %q", tt.nameOrGUID, ok, tt.found)
+		case ok && vdev.Name != tt.found:
+			t.Errorf("Find(%q) found %q; expected %q", tt.nameOrGUID, vdev.Name, tt.found)
+		}
+	}
+}
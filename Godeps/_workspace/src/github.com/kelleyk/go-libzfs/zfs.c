@@ -82,6 +82,36 @@ int read_dataset_property(zfs_handle_t *zh, property_list_t *list, int prop) {
 	return r;
 }
 
+int userspace_list_callb(void *data, const char *domain, uid_t rid, uint64_t space) {
+	userspace_list_t **lroot = (userspace_list_t**)data;
+	userspace_list_t *nroot = malloc(sizeof(userspace_list_t));
+
+	nroot->domain = strdup(domain);
+	nroot->rid = rid;
+	nroot->space = space;
+	nroot->pnext = (void*)*lroot;
+	*lroot = nroot;
+	return 0;
+}
+
+int userspace_list(zfs_handle_t *zh, zfs_userquota_prop_t type, userspace_list_t **first) {
+	*first = 0;
+	return zfs_userspace(zh, type, userspace_list_callb, first);
+}
+
+void userspace_list_free(userspace_list_t *list) {
+	userspace_list_t *next;
+	for ( ; list; list = next) {
+		next = list->pnext;
+		free(list->domain);
+		free(list);
+	}
+}
+
+userspace_list_t *userspace_next(userspace_list_t *list) {
+	return list->pnext;
+}
+
 int clear_last_error(libzfs_handle_t *hdl) {
 	zfs_standard_error(hdl, EZFS_SUCCESS, "success");
 	return 0;
@@ -9,6 +9,7 @@ import "C"
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"unsafe"
 )
 
@@ -49,6 +50,7 @@ func (d *Dataset) openChildren() (err error) {
 	d.Children = make([]Dataset, 0, 5)
 	errcode := C.dataset_list_children(d.list.zh, &(dataset.list))
 	for dataset.list != nil {
+		openDatasets.add(unsafe.Pointer(dataset.list))
 		dataset.Type = DatasetType(C.zfs_get_type(dataset.list.zh))
 		dataset.Properties = make(map[Prop]Property)
 		err = dataset.ReloadProperties()
@@ -76,6 +78,7 @@ func DatasetOpenAll() (datasets []Dataset, err error) {
 	var dataset Dataset
 	errcode := C.dataset_list_root(libzfsHandle, &dataset.list)
 	for dataset.list != nil {
+		openDatasets.add(unsafe.Pointer(dataset.list))
 
 		dataset.Type = DatasetType(C.zfs_get_type(dataset.list.zh))
 		err = dataset.ReloadProperties()
@@ -108,6 +111,7 @@ func DatasetCloseAll(datasets []Dataset) {
 // DatasetOpen open dataset and all of its recursive children datasets
 func DatasetOpen(path string) (d Dataset, err error) {
 	d.list = C.create_dataset_list_item()
+	openDatasets.add(unsafe.Pointer(d.list))
 	csPath := C.CString(path)
 	d.list.zh = C.zfs_open(libzfsHandle, csPath, 0xF)
 	C.free(unsafe.Pointer(csPath))
@@ -171,12 +175,19 @@ func DatasetCreate(path string, dtype DatasetType,
 
 // Close close dataset and all its recursive children datasets (close handle
 // and cleanup dataset object/s from memory)
+//
+// Closing a dataset more than once, or closing more than one copy of the same Dataset, is harmless.
 func (d *Dataset) Close() {
-	if d.list != nil && d.list.zh != nil {
-		C.dataset_list_close(d.list)
+	if d.list != nil && openDatasets.remove(unsafe.Pointer(d.list)) {
+		if d.list.zh != nil {
+			C.dataset_list_close(d.list)
+		} else {
+			C.free(unsafe.Pointer(d.list))
+		}
 	}
-	for _, cd := range d.Children {
-		cd.Close()
+	d.list = nil
+	for i := range d.Children {
+		d.Children[i].Close()
 	}
 }
 
@@ -224,19 +235,51 @@ func (d *Dataset) DestroyRecursive() (err error) {
 	return
 }
 
+// DestroySnapshotRecursive destroys the snapshot snapName (e.g. "pool/fs@snap") along with the snapshot of the same
+// name of each of the dataset's descendants, in a single operation; this is what `zfs destroy -r pool/fs@snap` does.
+// Descendants that do not have a snapshot with that name are ignored.  Set deferred to true to defer destruction of
+// snapshots that are held or that have clones.
+func DestroySnapshotRecursive(snapName string, deferred bool) (err error) {
+	parts := strings.SplitN(snapName, "@", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		err = fmt.Errorf("not a snapshot name: %s", snapName)
+		return
+	}
+
+	csPath := C.CString(parts[0])
+	defer C.free(unsafe.Pointer(csPath))
+	zh := C.zfs_open(libzfsHandle, csPath, C.int(DatasetTypeFilesystem|DatasetTypeVolume))
+	if zh == nil {
+		err = LastError()
+		return
+	}
+	defer C.zfs_close(zh)
+
+	csSnap := C.CString(parts[1])
+	defer C.free(unsafe.Pointer(csSnap))
+	if ec := C.zfs_destroy_snaps(zh, csSnap, booleanT(deferred)); ec != 0 {
+		err = LastError()
+	}
+	return
+}
+
 // Pool returns pool dataset belongs to
 func (d *Dataset) Pool() (p Pool, err error) {
 	if d.list == nil {
 		err = errors.New(msgDatasetIsNil)
 		return
 	}
+	// The pool handle belongs to d's handle, so closing p frees only the list item that holds it (see borrowedPools).
 	p.list = C.create_zpool_list_item()
 	p.list.zph = C.zfs_get_pool_handle(d.list.zh)
-	if p.list != nil {
-		err = p.ReloadProperties()
+	if p.list.zph == nil {
+		C.free(unsafe.Pointer(p.list))
+		p.list = nil
+		err = LastError()
 		return
 	}
-	err = LastError()
+	borrowedPools.add(unsafe.Pointer(p.list))
+	err = p.ReloadProperties()
 	return
 }
 
@@ -266,46 +309,50 @@ func (d *Dataset) ReloadProperties() (err error) {
 	return
 }
 
-func (d *Dataset) reloadUserProperties() error {
-	var srcStr string
+func (d *Dataset) reloadUserProperties() (err error) {
+	d.UserProperties, err = d.AllUserProperties()
+	return
+}
+
+// AllUserProperties returns all of d's user properties (i.e. those whose names contain a colon), keyed by name,
+// including those that d inherits and those that were received (e.g. with `zfs receive`).  Each property's Source is
+// "local", "inherited", or "received".
+func (d *Dataset) AllUserProperties() (map[string]Property, error) {
+	if d.list == nil {
+		return nil, errors.New(msgDatasetIsNil)
+	}
 	dPath, err := d.Path()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	d.UserProperties = make(map[string]Property)
+	props := make(map[string]Property)
 
+	// Each pair maps a property name to an nvlist containing (at least) "value" and "source" strings.
 	l := (*NVList)(C.zfs_get_user_props(d.list.zh))
-
-	var p *NVPair
-	for {
-		p = l.Next(p)
-		if p == nil {
-			break
-		}
-
-		pVal := p.Value().(*NVList)
-
-		valPair := pVal.Next(nil)
-		srcPair := pVal.Next(valPair)
-		if pVal.Next(srcPair) != nil {
-			return fmt.Errorf("expected length-2 nvlist for user property")
+	for p := l.Next(nil); p != nil; p = l.Next(p) {
+		pVal, ok := p.Value().(*NVList)
+		if !ok {
+			return nil, fmt.Errorf("expected nvlist for user property %q", p.Name())
 		}
 
-		if valPair.ValueString() == dPath {
-			srcStr = "local"
-		} else {
-			// XXX: I believe there is another case or two; see libzfs
-			srcStr = "inherited"
+		var value, source string
+		for q := pVal.Next(nil); q != nil; q = pVal.Next(q) {
+			switch q.Name() {
+			case "value":
+				value = q.ValueString()
+			case "source":
+				source = q.ValueString()
+			}
 		}
 
-		d.UserProperties[p.Name()] = Property{
-			Value:  valPair.ValueString(),
-			Source: srcStr,
+		props[p.Name()] = Property{
+			Value:  value,
+			Source: userPropertySource(source, dPath),
 		}
 	}
 
-	return nil
+	return props, nil
 }
 
 // GetProperty reload and return single specified property. This also reloads requested
@@ -351,6 +398,47 @@ func (d *Dataset) SetProperty(p Prop, value string) (err error) {
 	return
 }
 
+// SetUserProperty sets the user property name (which must contain a colon, e.g. "com.example:foo") to value.
+func (d *Dataset) SetUserProperty(name, value string) (err error) {
+	if d.list == nil {
+		err = errors.New(msgDatasetIsNil)
+		return
+	}
+	csName := C.CString(name)
+	defer C.free(unsafe.Pointer(csName))
+	csValue := C.CString(value)
+	defer C.free(unsafe.Pointer(csValue))
+	if errcode := C.zfs_prop_set(d.list.zh, csName, csValue); errcode != 0 {
+		err = LastError()
+		return
+	}
+	// Update UserProperties member with change made
+	if d.UserProperties == nil {
+		d.UserProperties = make(map[string]Property)
+	}
+	d.UserProperties[name] = Property{Value: value, Source: "local"}
+	return
+}
+
+// WrittenSince returns the amount of referenced space, in bytes, that has been written to d since the snapshot snap
+// was taken (the "written@snap" property).  snap may be either the part of the snapshot's name after the "@" or its
+// full name; it must be a snapshot of d or of the dataset d was cloned from.
+func (d *Dataset) WrittenSince(snap string) (written uint64, err error) {
+	if d.list == nil {
+		err = errors.New(msgDatasetIsNil)
+		return
+	}
+	csName := C.CString("written@" + snap)
+	defer C.free(unsafe.Pointer(csName))
+	var value C.uint64_t
+	if errcode := C.zfs_prop_get_written_int(d.list.zh, csName, &value); errcode != 0 {
+		err = LastError()
+		return
+	}
+	written = uint64(value)
+	return
+}
+
 // Clone - clones the dataset.  The target must be of the same type as
 // the source.
 func (d *Dataset) Clone(target string, props map[Prop]Property) (rd Dataset, err error) {
@@ -390,6 +478,33 @@ func DatasetSnapshot(path string, recur bool, props map[Prop]Property) (rd Datas
 	return
 }
 
+// DatasetSnapshots creates each of the snapshots in paths (e.g. "pool/fs@snap") atomically: either all of them are
+// created, at the same point in time, or none are.  The snapshots must all be in the same pool.
+func DatasetSnapshots(paths []string, props map[Prop]Property) (err error) {
+	var cprops *C.nvlist_t
+	if cprops, err = datasetPropertiesTonvlist(props); err != nil {
+		return
+	}
+	defer C.nvlist_free(cprops)
+	var csnaps *C.nvlist_t
+	if r := C.nvlist_alloc(&csnaps, C.NV_UNIQUE_NAME, 0); r != 0 {
+		return errors.New("Failed to allocate snapshot list")
+	}
+	defer C.nvlist_free(csnaps)
+	for _, path := range paths {
+		csPath := C.CString(path)
+		r := C.nvlist_add_boolean(csnaps, csPath)
+		C.free(unsafe.Pointer(csPath))
+		if r != 0 {
+			return errors.New("Failed to add snapshot to list")
+		}
+	}
+	if errc := C.zfs_snapshot_nvl(libzfsHandle, csnaps, cprops); errc != 0 {
+		err = LastError()
+	}
+	return
+}
+
 // Path return zfs dataset path/name
 func (d *Dataset) Path() (path string, err error) {
 	if d.list == nil {
@@ -22,6 +22,19 @@ dataset_list_t *dataset_next(dataset_list_t *dataset);
 
 int read_dataset_property(zfs_handle_t *zh, property_list_t *list, int prop);
 
+struct userspace_list {
+	char *domain;
+	uint64_t rid;
+	uint64_t space;
+	void *pnext;
+};
+
+typedef struct userspace_list userspace_list_t;
+
+int userspace_list(zfs_handle_t *zh, zfs_userquota_prop_t type, userspace_list_t **first);
+void userspace_list_free(userspace_list_t *list);
+userspace_list_t *userspace_next(userspace_list_t *list);
+
 int clear_last_error(libzfs_handle_t *libzfs);
 
 char** alloc_cstrings(int size);
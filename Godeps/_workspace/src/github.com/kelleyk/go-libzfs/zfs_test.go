@@ -0,0 +1,59 @@
+package zfs
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// TestWrittenSince writes data to a file-backed pool and checks how much has been written since the snapshots taken
+// before and after.
+func TestWrittenSince(t *testing.T) {
+	const name = "golibzfs_written"
+	const size = 1 << 20
+	_, cleanup := createTestPool(t, name, 1, nil)
+	defer cleanup()
+
+	snapshot := func(snap string) {
+		d, err := DatasetSnapshot(name+"@"+snap, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Close()
+	}
+	snapshot("before")
+	// Random data is not compressed, so it takes up (at least) as much space as was written.
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	where, unmount := mountTestDataset(t, name)
+	err := ioutil.WriteFile(filepath.Join(where, "data"), data, 0644)
+	unmount() // which syncs the data
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot("after")
+
+	d, err := DatasetOpen(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for _, snap := range []string{"before", name + "@before"} {
+		if written, err := d.WrittenSince(snap); err != nil {
+			t.Error(err)
+		} else if written < size {
+			t.Errorf("%d bytes written since %s; expected at least %d", written, snap, size)
+		}
+	}
+	if written, err := d.WrittenSince("after"); err != nil {
+		t.Error(err)
+	} else if written >= size {
+		t.Errorf("%d bytes written since after; expected less than %d", written, size)
+	}
+	if _, err := d.WrittenSince("nonexistent"); err == nil {
+		t.Error("found space written since a nonexistent snapshot")
+	}
+}
@@ -97,8 +97,10 @@ type VDevTree struct {
 	Parity   uint
 	Path     string
 	Name     string
+	GUID     uint64 // stable across reconfigurations (e.g. device renaming), unlike Name and Path
 	Stat     VDevStat
 	ScanStat PoolScanStat
+	Trim     *TrimStat // nil unless this version of ZFS reports trim statistics
 }
 
 // ExportedPool is type representing ZFS pool available for import
@@ -124,6 +126,9 @@ type Pool struct {
 	list       *C.zpool_list_t
 	Properties []Property
 	Features   map[string]string
+
+	// vdevTree is the tree most recently read by VDevTree or RefreshVDevTree, or nil if it must be read again.
+	vdevTree *VDevTree
 }
 
 // PoolOpen open ZFS pool handler by name.
@@ -135,6 +140,7 @@ func PoolOpen(name string) (pool Pool, err error) {
 	pool.list = C.zpool_list_open(libzfsHandle, csName)
 
 	if pool.list != nil {
+		openPools.add(unsafe.Pointer(pool.list))
 		err = pool.ReloadProperties()
 		return
 	}
@@ -145,7 +151,7 @@ func PoolOpen(name string) (pool Pool, err error) {
 func poolGetConfig(name string, nv *C.nvlist_t) (vdevs VDevTree, err error) {
 	var dtype *C.char
 	var c, children C.uint_t
-	var notpresent C.uint64_t
+	var notpresent, guid C.uint64_t
 	var vs *C.vdev_stat_t
 	var ps *C.pool_scan_stat_t
 	var child **C.nvlist_t
@@ -155,6 +161,9 @@ func poolGetConfig(name string, nv *C.nvlist_t) (vdevs VDevTree, err error) {
 	}
 	vdevs.Name = name
 	vdevs.Type = VDevType(C.GoString(dtype))
+	if 0 == C.nvlist_lookup_uint64(nv, C.sZPOOL_CONFIG_GUID, &guid) {
+		vdevs.GUID = uint64(guid)
+	}
 	if vdevs.Type == VDevTypeMissing || vdevs.Type == VDevTypeHole {
 		return
 	}
@@ -184,6 +193,7 @@ func poolGetConfig(name string, nv *C.nvlist_t) (vdevs VDevTree, err error) {
 	vdevs.Stat.ScanRemoving = uint64(vs.vs_scan_removing)
 	vdevs.Stat.ScanProcessed = uint64(vs.vs_scan_processed)
 	vdevs.Stat.Fragmentation = uint64(vs.vs_fragmentation)
+	vdevs.Trim = trimStatFromConfig(NVListFromPointer(nv))
 
 	// Fetch vdev scan stats
 	if 0 == C.nvlist_lookup_uint64_array_ps(nv, C.sZPOOL_CONFIG_SCAN_STATS,
@@ -401,6 +411,89 @@ func PoolImportByGUID(guid string, searchpaths []string) (pool Pool, err error)
 	return
 }
 
+// ImportOptions controls how PoolImportAll imports pools.
+type ImportOptions struct {
+	// AltRoot, if nonempty, is the alternate root directory (the "altroot" property) to use for each imported pool.
+	AltRoot string
+}
+
+// PoolImportAll given a list of directories to search, find and import every pool that is available for import and
+// that is neither destroyed nor already imported.  It returns handles to the pools that were imported, which have to
+// be closed after not needed anymore, and an error for each pool that could not be imported.
+func PoolImportAll(searchpaths []string, opts ImportOptions) (pools []Pool, errs []error) {
+	var config *C.nvlist_t
+	var cname *C.char
+	var poolState, guid C.uint64_t
+	var elem *C.nvpair_t
+
+	// Pools that are already imported are identified by GUID, since names need not be unique.
+	imported := make(map[string]struct{})
+	openPools, err := PoolOpenAll()
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+	for _, p := range openPools {
+		imported[p.Properties[PoolPropGUID].Value] = struct{}{}
+	}
+	PoolCloseAll(openPools)
+
+	var csAltRoot *C.char
+	if opts.AltRoot != "" {
+		csAltRoot = C.CString(opts.AltRoot)
+		defer C.free(unsafe.Pointer(csAltRoot))
+	}
+
+	numofp := len(searchpaths)
+	cpaths := C.alloc_cstrings(C.int(numofp))
+	defer C.free(unsafe.Pointer(cpaths))
+	for i, path := range searchpaths {
+		csPath := C.CString(path)
+		defer C.free(unsafe.Pointer(csPath))
+		C.strings_setat(cpaths, C.int(i), csPath)
+	}
+
+	found := C.zpool_find_import(libzfsHandle, C.int(numofp), cpaths)
+	defer C.nvlist_free(found)
+	for elem = C.nvlist_next_nvpair(found, nil); elem != nil; elem = C.nvlist_next_nvpair(found, elem) {
+		if C.nvpair_value_nvlist(elem, &config) != 0 {
+			errs = append(errs, LastError())
+			continue
+		}
+		if C.nvlist_lookup_string(config, C.sZPOOL_CONFIG_POOL_NAME, &cname) != 0 {
+			errs = append(errs, fmt.Errorf("Failed to fetch %s", C.ZPOOL_CONFIG_POOL_NAME))
+			continue
+		}
+		name := C.GoString(cname)
+		if C.nvlist_lookup_uint64(config, C.sZPOOL_CONFIG_POOL_STATE, &poolState) != 0 {
+			errs = append(errs, fmt.Errorf("%s: Failed to fetch %s", name, C.ZPOOL_CONFIG_POOL_STATE))
+			continue
+		}
+		if PoolState(poolState) == PoolStateDestroyed {
+			continue
+		}
+		if C.nvlist_lookup_uint64(config, C.sZPOOL_CONFIG_POOL_GUID, &guid) != 0 {
+			errs = append(errs, fmt.Errorf("%s: Failed to fetch %s", name, C.ZPOOL_CONFIG_POOL_GUID))
+			continue
+		}
+		if _, ok := imported[fmt.Sprint(guid)]; ok {
+			continue
+		}
+
+		if C.zpool_import(libzfsHandle, config, cname, csAltRoot) != 0 {
+			errs = append(errs, fmt.Errorf("%s: %v", name, LastError()))
+			continue
+		}
+		pool, err := PoolOpen(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+			continue
+		}
+		pools = append(pools, pool)
+	}
+	return
+}
+
 // func PoolList(paths []string, cache string) (pools []Pool, err error) {
 //
 // }
@@ -415,6 +508,7 @@ func PoolOpenAll() (pools []Pool, err error) {
 	}
 	errcode := C.zpool_list(libzfsHandle, &pool.list)
 	for pool.list != nil {
+		openPools.add(unsafe.Pointer(pool.list))
 		err = pool.ReloadProperties()
 		if err != nil {
 			return
@@ -456,7 +550,10 @@ func PoolStateToName(state PoolState) (name string) {
 }
 
 // RefreshStats the pool's vdev statistics, e.g. bytes read/written.
+// The tree cached by VDevTree is discarded, so that the next call reads
+// the refreshed statistics.
 func (pool *Pool) RefreshStats() (err error) {
+	pool.vdevTree = nil
 	if 0 != C.refresh_stats(pool.list) {
 		return errors.New("error refreshing stats")
 	}
@@ -576,9 +673,18 @@ func (pool *Pool) SetProperty(p Prop, value string) (err error) {
 
 // Close ZFS pool handler and release associated memory.
 // Do not use Pool object after this.
+//
+// Closing a pool more than once, or closing more than one copy of the same Pool, is harmless.
 func (pool *Pool) Close() {
-	C.zpool_list_close(pool.list)
+	if pool.list != nil {
+		if openPools.remove(unsafe.Pointer(pool.list)) {
+			C.zpool_list_close(pool.list)
+		} else if borrowedPools.remove(unsafe.Pointer(pool.list)) {
+			C.free(unsafe.Pointer(pool.list))
+		}
+	}
 	pool.list = nil
+	pool.vdevTree = nil
 }
 
 // Name get (re-read) ZFS pool name property
@@ -937,8 +1043,31 @@ func (pool *Pool) ExportForce(log string) (err error) {
 	return
 }
 
-// VDevTree - Fetch pool's current vdev tree configuration, state and stats
+// VDevTree - Fetch pool's vdev tree configuration, state and stats.
+// The tree is parsed from the pool's configuration on the first call and
+// cached on pool; later calls return the cached tree, whose state and
+// statistics are only as fresh as the last call to RefreshVDevTree (or to
+// RefreshStats, after which the tree is parsed again).  The returned tree
+// shares its slices with the cached one, so it must not be modified.
 func (pool *Pool) VDevTree() (vdevs VDevTree, err error) {
+	if pool.vdevTree != nil {
+		return *pool.vdevTree, nil
+	}
+	return pool.readVDevTree()
+}
+
+// RefreshVDevTree refreshes the pool's statistics (see RefreshStats) and
+// re-reads its vdev tree, replacing the tree cached by VDevTree.
+func (pool *Pool) RefreshVDevTree() (vdevs VDevTree, err error) {
+	if err = pool.RefreshStats(); err != nil {
+		return
+	}
+	return pool.readVDevTree()
+}
+
+// readVDevTree parses the pool's vdev tree from its configuration and
+// caches it.
+func (pool *Pool) readVDevTree() (vdevs VDevTree, err error) {
 	var nvroot *C.nvlist_t
 	var poolName string
 	config := C.zpool_get_config(pool.list.zph, nil)
@@ -954,5 +1083,9 @@ func (pool *Pool) VDevTree() (vdevs VDevTree, err error) {
 	if poolName, err = pool.Name(); err != nil {
 		return
 	}
-	return poolGetConfig(poolName, nvroot)
+	if vdevs, err = poolGetConfig(poolName, nvroot); err != nil {
+		return
+	}
+	pool.vdevTree = &vdevs
+	return
 }
@@ -0,0 +1,81 @@
+package zfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// TestPoolImportAll creates two pools, each backed by a file, exports them, and checks that PoolImportAll imports both
+// of them, and that a second call imports neither again.  Creating pools needs root privileges, so the test is skipped
+// without them.
+func TestPoolImportAll(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("creating pools requires root privileges")
+	}
+
+	dir, err := ioutil.TempDir("", "go-libzfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	names := []string{"golibzfs_import_a", "golibzfs_import_b"}
+	for _, name := range names {
+		path := filepath.Join(dir, name+".img")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = f.Truncate(64 << 20) // the smallest vdev that ZFS accepts
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pool, err := PoolCreate(name, []VDevTree{{Type: VDevTypeFile, Path: path}}, nil, PoolProperties{},
+			DatasetProperties{})
+		if err != nil {
+			t.Fatalf("failed to create pool %s: %v", name, err)
+		}
+		err = pool.Export(false, "go-libzfs test")
+		pool.Close()
+		if err != nil {
+			t.Fatalf("failed to export pool %s: %v", name, err)
+		}
+	}
+
+	pools, errs := PoolImportAll([]string{dir}, ImportOptions{})
+	defer func() {
+		for _, pool := range pools {
+			pool.Destroy("go-libzfs test")
+		}
+		PoolCloseAll(pools)
+	}()
+	for _, err := range errs {
+		t.Error(err)
+	}
+	var imported []string
+	for _, pool := range pools {
+		name, err := pool.Name()
+		if err != nil {
+			t.Fatal(err)
+		}
+		imported = append(imported, name)
+	}
+	sort.Strings(imported)
+	if len(imported) != len(names) || imported[0] != names[0] || imported[1] != names[1] {
+		t.Fatalf("imported %v; expected %v", imported, names)
+	}
+
+	again, errs := PoolImportAll([]string{dir}, ImportOptions{})
+	PoolCloseAll(again)
+	for _, err := range errs {
+		t.Error(err)
+	}
+	if len(again) != 0 {
+		t.Errorf("imported %d pools that were already imported", len(again))
+	}
+}
@@ -0,0 +1,216 @@
+package zfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// createTestPool creates a pool with the given name, backed by the given number of files, and returns it along with a
+// function that destroys it.  The pool's vdevs are a file vdev for each file, or, if layout is not nil, those that
+// layout returns given them (e.g. a raidz group of them).  Creating pools needs root privileges, so the test is skipped
+// without them.
+func createTestPool(t testing.TB, name string, files int, layout func(files []VDevTree) []VDevTree) (Pool,
+	func()) {
+
+	if os.Geteuid() != 0 {
+		t.Skip("creating pools requires root privileges")
+	}
+
+	dir, err := ioutil.TempDir("", "go-libzfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vdevs := make([]VDevTree, files)
+	for i := range vdevs {
+		path := filepath.Join(dir, fmt.Sprintf("%s-%d.img", name, i))
+		f, err := os.Create(path)
+		if err == nil {
+			err = f.Truncate(64 << 20) // the smallest vdev that ZFS accepts
+			f.Close()
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+		vdevs[i] = VDevTree{Type: VDevTypeFile, Path: path}
+	}
+	if layout != nil {
+		vdevs = layout(vdevs)
+	}
+
+	pool, err := PoolCreate(name, vdevs, nil, PoolProperties{}, DatasetProperties{})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("failed to create pool %s: %v", name, err)
+	}
+	return pool, func() {
+		pool.Destroy("go-libzfs test")
+		pool.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// mountTestDataset mounts the filesystem path (e.g. the root dataset of a pool created by createTestPool) and returns
+// its mountpoint, along with a function that unmounts it; a pool cannot be destroyed while its filesystems are mounted.
+// Data written to the filesystem is accounted for (e.g. in its properties) once it has been synced (see syscall.Sync).
+func mountTestDataset(t testing.TB, path string) (string, func()) {
+	d, err := DatasetOpen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Mount("", 0); err != nil {
+		d.Close()
+		t.Fatalf("failed to mount %s: %v", path, err)
+	}
+	mounted, where := d.IsMounted()
+	if !mounted {
+		d.Close()
+		t.Fatalf("%s is not mounted", path)
+	}
+	return where, func() {
+		d.Unmount(0)
+		d.Close()
+	}
+}
+
+// TestPoolCloseTwice checks that closing a Pool twice, or closing a copy of it too, is harmless, both for pools opened
+// by name and for the pools of datasets, and that closing the pool of a dataset leaves the dataset usable.
+func TestPoolCloseTwice(t *testing.T) {
+	const name = "golibzfs_close"
+	_, cleanup := createTestPool(t, name, 1, nil)
+	defer cleanup()
+
+	pool, err := PoolOpen(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied := pool
+	pool.Close()
+	pool.Close()
+	copied.Close()
+
+	d, err := DatasetOpen(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	for i := 0; i < 2; i++ {
+		pool, err := d.Pool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := pool.Name(); err != nil || got != name {
+			t.Errorf("pool of dataset is named %q (%v); expected %q", got, err, name)
+		}
+		copied := pool
+		pool.Close()
+		pool.Close()
+		copied.Close()
+	}
+	if _, err := d.Path(); err != nil {
+		t.Errorf("dataset unusable after its pool was closed: %v", err)
+	}
+	copiedDataset := d
+	d.Close()
+	copiedDataset.Close()
+}
+
+// TestPoolVDevTreeGUIDs checks the GUIDs that VDevTree reads from the configuration of a file-backed mirrored pool.
+func TestPoolVDevTreeGUIDs(t *testing.T) {
+	pool, cleanup := createTestPool(t, "golibzfs_vdevguid", 2, func(files []VDevTree) []VDevTree {
+		return []VDevTree{{Type: VDevTypeMirror, Devices: files}}
+	})
+	defer cleanup()
+
+	tree, err := pool.VDevTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The root vdev's GUID is the pool's.
+	if guid := strconv.FormatUint(tree.GUID, 10); guid != pool.Properties[PoolPropGUID].Value {
+		t.Errorf("root vdev has GUID %s; expected the pool's GUID, %s", guid, pool.Properties[PoolPropGUID].Value)
+	}
+	leaves := tree.Leaves()
+	if len(leaves) != 2 {
+		t.Fatalf("found %d leaves; expected 2", len(leaves))
+	}
+	guids := map[uint64]bool{tree.GUID: true, tree.Devices[0].GUID: true}
+	for _, leaf := range leaves {
+		if leaf.GUID == 0 || guids[leaf.GUID] {
+			t.Errorf("leaf %s has GUID %d, which is zero or not unique", leaf.Path, leaf.GUID)
+		}
+		guids[leaf.GUID] = true
+
+		found, ok := tree.Find(strconv.FormatUint(leaf.GUID, 10))
+		if !ok || found.Path != leaf.Path {
+			t.Errorf("Find(%d) found %v (%v); expected %s", leaf.GUID, found, ok, leaf.Path)
+		}
+	}
+}
+
+// TestPoolRefreshVDevTree checks that VDevTree returns the cached tree until RefreshVDevTree reads the pool's state
+// again.
+func TestPoolRefreshVDevTree(t *testing.T) {
+	const name = "golibzfs_refresh"
+	pool, cleanup := createTestPool(t, name, 1, nil)
+	defer cleanup()
+
+	before, err := pool.VDevTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Creating a dataset waits for the transaction group that allocates its metadata to be synced.
+	d, err := DatasetCreate(name+"/fs", DatasetTypeFilesystem, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	cached, err := pool.VDevTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.Stat.Alloc != before.Stat.Alloc {
+		t.Errorf("cached tree changed without a refresh: %d bytes allocated, then %d", before.Stat.Alloc,
+			cached.Stat.Alloc)
+	}
+	refreshed, err := pool.RefreshVDevTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.Stat.Alloc <= before.Stat.Alloc {
+		t.Errorf("refresh did not pick up new allocations: %d bytes allocated, then %d", before.Stat.Alloc,
+			refreshed.Stat.Alloc)
+	}
+	if again, err := pool.VDevTree(); err != nil || again.Stat.Alloc != refreshed.Stat.Alloc {
+		t.Errorf("refreshed tree was not cached: %d bytes allocated, then %d (%v)", refreshed.Stat.Alloc,
+			again.Stat.Alloc, err)
+	}
+}
+
+// BenchmarkPoolVDevTree compares reading the cached tree with reading it again from the pool's configuration.
+func BenchmarkPoolVDevTree(b *testing.B) {
+	pool, cleanup := createTestPool(b, "golibzfs_bench", 4, func(files []VDevTree) []VDevTree {
+		return []VDevTree{{Type: VDevTypeRaidz, Devices: files[:3]}, {Type: VDevTypeL2cache, Devices: files[3:]}}
+	})
+	defer cleanup()
+
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := pool.VDevTree(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("refresh", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := pool.RefreshVDevTree(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package gokk
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+var rfc3339AnywhereRegexp = regexp.MustCompile(`(?i)` + RFC3339Pattern)
+
+// ExtractRFC3339 finds the last timestamp in s that matches RFC3339Pattern and parses it.  It returns the timestamp,
+// s with the timestamp removed, and true; or, if s contains no timestamp that can be parsed, the zero time, s, and
+// false.  Fractional seconds are preserved; a timestamp without a time zone is taken to be in UTC.
+func ExtractRFC3339(s string) (time.Time, string, bool) {
+	locs := rfc3339AnywhereRegexp.FindAllStringIndex(s, -1)
+	if len(locs) == 0 {
+		return time.Time{}, s, false
+	}
+	loc := locs[len(locs)-1]
+
+	ts, err := parseRFC3339(s[loc[0]:loc[1]])
+	if err != nil {
+		return time.Time{}, s, false
+	}
+	return ts, s[:loc[0]] + s[loc[1]:], true
+}
+
+// parseRFC3339 parses a string that matches RFC3339Pattern.
+func parseRFC3339(s string) (time.Time, error) {
+	s = strings.ToUpper(s) // RFC 3339 permits "t" and "z"; time.Parse does not
+	if ts, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return ts, nil
+	}
+	// RFC3339Pattern also matches timestamps without a time zone.
+	return time.ParseInLocation("2006-01-02T15:04:05.999999999", s, time.UTC)
+}
@@ -0,0 +1,36 @@
+package gokk
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExtractRFC3339(t *testing.T) {
+	ts := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, tt := range []struct {
+		s    string
+		ts   time.Time
+		rest string
+		ok   bool
+	}{
+		{"2016-01-02T03:04:05Z_daily", ts, "_daily", true},                               // prefix
+		{"daily_2016-01-02T03:04:05Z", ts, "daily_", true},                               // suffix
+		{"zfs-auto-snap_2016-01-02T03:04:05Z_daily", ts, "zfs-auto-snap__daily", true},   // middle
+		{"2015-12-31T00:00:00Z-2016-01-02T03:04:05Z", ts, "2015-12-31T00:00:00Z-", true}, // the last one wins
+		{"daily_2016-01-02T03:04:05.123456789Z", ts.Add(123456789), "daily_", true},      // fractional seconds
+		{"daily_2016-01-02T03:04:05.5Z", ts.Add(500 * time.Millisecond), "daily_", true}, // fractional seconds
+		{"daily_2016-01-02T05:04:05+02:00", ts, "daily_", true},                          // offset
+		{"daily_2016-01-01T22:04:05-05:00", ts, "daily_", true},                          // negative offset
+		{"daily_2016-01-02t03:04:05z", ts, "daily_", true},                               // lower case
+		{"daily_2016-01-02T03:04:05", ts, "daily_", true},                                // no time zone
+		{"daily_2016-13-02T03:04:05Z", time.Time{}, "daily_2016-13-02T03:04:05Z", false}, // no such month
+		{"daily_2016-01-02-0304", time.Time{}, "daily_2016-01-02-0304", false},           // not RFC 3339
+		{"", time.Time{}, "", false},
+	} {
+		got, rest, ok := ExtractRFC3339(tt.s)
+		if !got.Equal(tt.ts) || rest != tt.rest || ok != tt.ok {
+			t.Errorf("ExtractRFC3339(%q) = %v, %q, %v; expected %v, %q, %v", tt.s, got, rest, ok, tt.ts, tt.rest, tt.ok)
+		}
+	}
+}
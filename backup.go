@@ -0,0 +1,6 @@
+package zfstools
+
+// LastBackupProperty is the user property, set on a dataset by zfs-backup, that records the name (the part after the
+// `@`) of the most recent snapshot of the dataset that was successfully sent.  Later backups are sent incrementally
+// from that snapshot, so destroying it breaks the chain of backups.
+const LastBackupProperty = "zfstools:last-backup"
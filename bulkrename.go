@@ -0,0 +1,139 @@
+package zfstools
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	zfs "github.com/kelleyk/go-libzfs"
+)
+
+// SnapshotRename is one step of a bulk rename: the snapshot whose full name is From (e.g. "pool/fs@old") is renamed to
+// To (e.g. "pool/fs@new").
+type SnapshotRename struct {
+	From, To string
+}
+
+// PlanSnapshotRenames checks that renames (which maps full snapshot names to their new full names) can be carried out
+// one at a time, given that the snapshots named in existing exist, and returns the renames in the order in which they
+// should be applied (sorted by From).  Each snapshot must exist and keep its dataset, each new name must be valid (see
+// NormalizeDatasetName), and no two snapshots may be given the same new name.  A new name must not be in use, even by
+// a snapshot that is itself being renamed, since the order in which they were renamed would then matter.
+func PlanSnapshotRenames(renames map[string]string, existing []string) ([]SnapshotRename, error) {
+	exists := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		exists[name] = true
+	}
+
+	plan := make([]SnapshotRename, 0, len(renames))
+	for from, to := range renames {
+		plan = append(plan, SnapshotRename{From: from, To: to})
+	}
+	sort.Sort(byFrom(plan))
+
+	targets := make(map[string]string, len(plan))
+	for _, r := range plan {
+		if !exists[r.From] {
+			return nil, fmt.Errorf("no such snapshot: %s", r.From)
+		}
+		i, j := strings.Index(r.From, "@"), strings.Index(r.To, "@")
+		if j <= 0 || j == len(r.To)-1 || r.From[:i] != r.To[:j] {
+			return nil, fmt.Errorf("cannot rename %s to %s: not a snapshot of the same dataset", r.From, r.To)
+		}
+		if _, err := NormalizeDatasetName(r.To); err != nil {
+			return nil, fmt.Errorf("cannot rename %s to %s: %v", r.From, r.To, err)
+		}
+		if other, ok := targets[r.To]; ok {
+			return nil, fmt.Errorf("cannot rename both %s and %s to %s", other, r.From, r.To)
+		}
+		if exists[r.To] {
+			return nil, fmt.Errorf("cannot rename %s to %s: snapshot already exists", r.From, r.To)
+		}
+		targets[r.To] = r.From
+	}
+	return plan, nil
+}
+
+type byFrom []SnapshotRename
+
+func (a byFrom) Len() int           { return len(a) }
+func (a byFrom) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byFrom) Less(i, j int) bool { return a[i].From < a[j].From }
+
+// ApplySnapshotRenames carries out plan (see PlanSnapshotRenames) in order by calling rename, and calls progress (if
+// it is not nil) after each step with the number of steps completed so far.  If a step fails, the steps that have
+// already been carried out are undone, in reverse order, on a best-effort basis; the error that is returned says
+// which (if any) could not be undone.
+func ApplySnapshotRenames(plan []SnapshotRename, rename func(from, to string) error,
+	progress func(r SnapshotRename, done, total int)) error {
+
+	for i, r := range plan {
+		if err := rename(r.From, r.To); err != nil {
+			err = fmt.Errorf("failed to rename %s to %s: %s", r.From, r.To, err)
+			var stuck []string
+			for j := i - 1; j >= 0; j-- {
+				if rename(plan[j].To, plan[j].From) != nil {
+					stuck = append(stuck, plan[j].To)
+				}
+			}
+			if len(stuck) > 0 {
+				return fmt.Errorf("%s; also failed to rename back %s", err, strings.Join(stuck, ", "))
+			}
+			return err
+		}
+		if progress != nil {
+			progress(r, i+1, len(plan))
+		}
+	}
+	return nil
+}
+
+// RenameSnapshotsBulk renames snapshots of d and of its descendants, as given by renames (which maps full snapshot
+// names to their new full names); see PlanSnapshotRenames and ApplySnapshotRenames.  Nothing is renamed if the renames
+// conflict with one another or with existing snapshots.
+func RenameSnapshotsBulk(d *zfs.Dataset, renames map[string]string,
+	progress func(r SnapshotRename, done, total int)) error {
+
+	existing, err := SnapshotNames(d)
+	if err != nil {
+		return err
+	}
+	plan, err := PlanSnapshotRenames(renames, existing)
+	if err != nil {
+		return err
+	}
+	return ApplySnapshotRenames(plan, renameSnapshot, progress)
+}
+
+// SnapshotNames returns the full names of the snapshots of d and of its descendants.
+func SnapshotNames(d *zfs.Dataset) ([]string, error) {
+	var names []string
+	for i := range d.Children {
+		dd := &d.Children[i]
+		if dd.Type != zfs.DatasetTypeSnapshot {
+			more, err := SnapshotNames(dd)
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, more...)
+			continue
+		}
+		name, err := dd.Path()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// renameSnapshot renames the snapshot from to to.  The snapshot is opened by name, rather than through an existing
+// handle, so that a snapshot can be renamed back after it has been renamed.
+func renameSnapshot(from, to string) error {
+	d, err := zfs.DatasetOpen(from)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Rename(to, false, false)
+}
@@ -0,0 +1,94 @@
+package zfstools
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSnapshots renames snapshots in a set of names, failing to rename any snapshot whose current name is in fail.
+type fakeSnapshots struct {
+	names map[string]bool
+	fail  map[string]bool
+}
+
+func (f *fakeSnapshots) rename(from, to string) error {
+	if f.fail[from] || !f.names[from] || f.names[to] {
+		return errors.New("rename failed")
+	}
+	delete(f.names, from)
+	f.names[to] = true
+	return nil
+}
+
+func TestRenameSnapshotsBulk(t *testing.T) {
+	existing := []string{"ds@a", "ds@b", "ds@c", "ds/child@a"}
+	renames := map[string]string{"ds@c": "ds@z", "ds@a": "ds@x", "ds/child@a": "ds/child@x"}
+
+	plan, err := PlanSnapshotRenames(renames, existing)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []SnapshotRename{{"ds/child@a", "ds/child@x"}, {"ds@a", "ds@x"}, {"ds@c", "ds@z"}}, plan)
+
+	fake := &fakeSnapshots{names: map[string]bool{"ds@a": true, "ds@b": true, "ds@c": true, "ds/child@a": true}}
+	var done []int
+	err = ApplySnapshotRenames(plan, fake.rename, func(r SnapshotRename, n, total int) {
+		assert.Equal(t, 3, total)
+		done = append(done, n)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, done)
+	assert.Equal(t, map[string]bool{"ds@x": true, "ds@b": true, "ds@z": true, "ds/child@x": true}, fake.names)
+}
+
+func TestPlanSnapshotRenamesConflicts(t *testing.T) {
+	existing := []string{"ds@a", "ds@b", "ds@c"}
+	for _, tt := range []struct {
+		desc    string
+		renames map[string]string
+	}{
+		{"two snapshots given the same name", map[string]string{"ds@a": "ds@x", "ds@b": "ds@x"}},
+		{"new name already exists", map[string]string{"ds@a": "ds@c"}},
+		{"new name is being renamed away", map[string]string{"ds@a": "ds@b", "ds@b": "ds@y"}},
+		{"no such snapshot", map[string]string{"ds@nope": "ds@x"}},
+		{"different dataset", map[string]string{"ds@a": "other@a"}},
+		{"not a snapshot name", map[string]string{"ds@a": "ds"}},
+		{"empty snapshot name", map[string]string{"ds@a": "ds@"}},
+		{"invalid snapshot name", map[string]string{"ds@a": "ds@new*name"}},
+	} {
+		plan, err := PlanSnapshotRenames(tt.renames, existing)
+		assert.Error(t, err, tt.desc)
+		assert.Nil(t, plan, tt.desc)
+	}
+}
+
+func TestApplySnapshotRenamesRollback(t *testing.T) {
+	plan := []SnapshotRename{{"ds@a", "ds@x"}, {"ds@b", "ds@y"}, {"ds@c", "ds@z"}}
+
+	// The third rename fails, so the first two are undone.
+	fake := &fakeSnapshots{
+		names: map[string]bool{"ds@a": true, "ds@b": true, "ds@c": true},
+		fail:  map[string]bool{"ds@c": true},
+	}
+	var done int
+	err := ApplySnapshotRenames(plan, fake.rename, func(r SnapshotRename, n, total int) { done = n })
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "ds@c")
+		assert.NotContains(t, err.Error(), "rename back")
+	}
+	assert.Equal(t, 2, done)
+	assert.Equal(t, map[string]bool{"ds@a": true, "ds@b": true, "ds@c": true}, fake.names)
+
+	// If undoing a rename fails too, the error says which snapshot was left with its new name.
+	fake = &fakeSnapshots{
+		names: map[string]bool{"ds@a": true, "ds@b": true, "ds@c": true},
+		fail:  map[string]bool{"ds@c": true, "ds@x": true},
+	}
+	err = ApplySnapshotRenames(plan, fake.rename, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "rename back ds@x")
+	}
+	assert.Equal(t, map[string]bool{"ds@x": true, "ds@b": true, "ds@c": true}, fake.names)
+}
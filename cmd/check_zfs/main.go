@@ -0,0 +1,212 @@
+// check_zfs is a Nagios (or Icinga) plugin that checks each imported pool.  It prints a one-line summary, followed by
+// performance data (each pool's capacity, fragmentation, device errors and time since its last scrub), and exits with
+// the plugin status: 0 (OK), 1 (WARNING), 2 (CRITICAL) or 3 (UNKNOWN).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	zfs "github.com/kelleyk/go-libzfs"
+)
+
+// Plugin statuses, which are also the exit codes.
+const (
+	statusOK = iota
+	statusWarning
+	statusCritical
+	statusUnknown
+)
+
+var statusNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+var (
+	help = flag.Bool("help", false, "Print this usage message.")
+
+	warnCapacity = flag.Int("w", 80, "Warn when a pool's capacity is at least this percentage.")
+	critCapacity = flag.Int("c", 90, "Report a critical problem when a pool's capacity is at least this percentage.")
+	warnErrors   = flag.Uint64("errors-w", 1, "Warn when a pool's devices have had at least this many read, write, and checksum errors in all.")
+	critErrors   = flag.Uint64("errors-c", 10, "Report a critical problem when a pool's devices have had at least this many read, write, and checksum errors in all.")
+)
+
+// thresholds are the values given with -w, -c, -errors-w, and -errors-c.
+type thresholds struct {
+	warnCapacity, critCapacity int
+	warnErrors, critErrors     uint64
+}
+
+// poolInfo is what is checked about each pool.
+type poolInfo struct {
+	name   string
+	state  zfs.VDevState // the state of the pool's root vdev
+	status zfs.PoolStatus
+
+	capacity      int // percent
+	fragmentation int // percent, or -1 if the pool does not report it
+
+	// errors is the total number of read, write, and checksum errors of the pool's devices.
+	errors uint64
+
+	// scrubAge is the time since the pool's last scrub finished, or -1 if the pool's last scan was not a finished scrub.
+	scrubAge time.Duration
+}
+
+func main() {
+	flag.Parse()
+
+	if *help || len(flag.Args()) != 0 {
+		flag.Usage()
+		os.Exit(statusUnknown)
+	}
+
+	t := thresholds{*warnCapacity, *critCapacity, *warnErrors, *critErrors}
+	if t.warnCapacity > t.critCapacity || t.warnErrors > t.critErrors {
+		fmt.Println("ZFS UNKNOWN - warning thresholds must not exceed critical thresholds")
+		os.Exit(statusUnknown)
+	}
+
+	pools, err := readPools(time.Now())
+	if err != nil {
+		fmt.Printf("ZFS UNKNOWN - %s\n", err)
+		os.Exit(statusUnknown)
+	}
+
+	status, output := check(pools, t)
+	fmt.Println(output)
+	os.Exit(status)
+}
+
+// readPools returns what is checked about each imported pool; now is used to compute the time since each pool's last
+// scrub.
+func readPools(now time.Time) ([]poolInfo, error) {
+	pools, err := zfs.PoolOpenAll()
+	defer zfs.PoolCloseAll(pools)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []poolInfo
+	for _, p := range pools {
+		name, err := p.Name()
+		if err != nil {
+			return nil, err
+		}
+		status, err := p.Status()
+		if err != nil {
+			return nil, err
+		}
+		vdevTree, err := p.VDevTree()
+		if err != nil {
+			return nil, err
+		}
+		capacity, err := parsePercent(p.Properties[zfs.PoolPropCapacity].Value)
+		if err != nil {
+			return nil, fmt.Errorf("pool %s: unexpected capacity: %v", name, err)
+		}
+		fragmentation, err := parsePercent(p.Properties[zfs.PoolPropFragmentation].Value)
+		if err != nil {
+			fragmentation = -1 // e.g. "-", on pools without the spacemap_histogram feature
+		}
+
+		infos = append(infos, poolInfo{
+			name:          name,
+			state:         vdevTree.Stat.State,
+			status:        status,
+			capacity:      capacity,
+			fragmentation: fragmentation,
+			errors:        deviceErrors(vdevTree),
+			scrubAge:      scrubAge(vdevTree.ScanStat, now),
+		})
+	}
+	return infos, nil
+}
+
+// parsePercent parses a pool property value such as "42%".
+func parsePercent(v string) (int, error) {
+	return strconv.Atoi(strings.TrimSuffix(v, "%"))
+}
+
+// deviceErrors returns the total number of read, write, and checksum errors of the leaf devices in t.
+func deviceErrors(t zfs.VDevTree) uint64 {
+	s := t.HealthSummary()
+	return s.ReadErrors + s.WriteErrors + s.ChecksumErrors
+}
+
+// scrubAge returns the time from the end of the scan described by s to now, or -1 if s is not a finished scrub (e.g.
+// if the pool has never been scrubbed, or if it has since been resilvered).
+func scrubAge(s zfs.PoolScanStat, now time.Time) time.Duration {
+	if s.Func != zfs.PoolScanFuncScrub || s.State != zfs.DSLScanStateFinished {
+		return -1
+	}
+	return now.Sub(time.Unix(int64(s.EndTime), 0))
+}
+
+// check returns the plugin status for pools and the line to print: a summary, followed by performance data.
+//
+// A pool whose root vdev is degraded, or whose status is otherwise not OK (other than because it could merely be
+// upgraded, as with `zpool status -x`), is a warning; a pool that is faulted or unavailable is critical.  The pool's
+// capacity and device errors are compared with t.
+func check(pools []poolInfo, t thresholds) (int, string) {
+	if len(pools) == 0 {
+		return statusUnknown, "ZFS UNKNOWN - no pools are imported"
+	}
+
+	status := statusOK
+	var problems, perfdata []string
+	raise := func(s int, format string, args ...interface{}) {
+		if s > status {
+			status = s
+		}
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	for _, p := range pools {
+		switch {
+		case p.state < zfs.VDevStateDegraded:
+			raise(statusCritical, "%s: %v", p.name, p.state)
+		case p.state == zfs.VDevStateDegraded:
+			raise(statusWarning, "%s: %v", p.name, p.state)
+		default:
+			switch p.status {
+			case zfs.PoolStatusOk, zfs.PoolStatusVersionOlder, zfs.PoolStatusFeatDisabled:
+			default:
+				raise(statusWarning, "%s: %v", p.name, p.status)
+			}
+		}
+
+		switch {
+		case p.capacity >= t.critCapacity:
+			raise(statusCritical, "%s is %d%% full", p.name, p.capacity)
+		case p.capacity >= t.warnCapacity:
+			raise(statusWarning, "%s is %d%% full", p.name, p.capacity)
+		}
+
+		switch {
+		case p.errors >= t.critErrors:
+			raise(statusCritical, "%s has had %d device errors", p.name, p.errors)
+		case p.errors >= t.warnErrors:
+			raise(statusWarning, "%s has had %d device errors", p.name, p.errors)
+		}
+
+		perfdata = append(perfdata, fmt.Sprintf("'%s_capacity'=%d%%;%d;%d;0;100", p.name, p.capacity,
+			t.warnCapacity, t.critCapacity))
+		if p.fragmentation >= 0 {
+			perfdata = append(perfdata, fmt.Sprintf("'%s_fragmentation'=%d%%;;;0;100", p.name, p.fragmentation))
+		}
+		perfdata = append(perfdata, fmt.Sprintf("'%s_errors'=%d;%d;%d;0", p.name, p.errors, t.warnErrors,
+			t.critErrors))
+		if p.scrubAge >= 0 {
+			perfdata = append(perfdata, fmt.Sprintf("'%s_scrub_age'=%ds;;;0", p.name, int64(p.scrubAge/time.Second)))
+		}
+	}
+
+	summary := fmt.Sprintf("%d pools are healthy", len(pools))
+	if len(problems) > 0 {
+		summary = strings.Join(problems, "; ")
+	}
+	return status, fmt.Sprintf("ZFS %s - %s | %s", statusNames[status], summary, strings.Join(perfdata, " "))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	th := thresholds{warnCapacity: 80, critCapacity: 90, warnErrors: 1, critErrors: 10}
+	healthy := poolInfo{name: "tank", state: zfs.VDevStateHealthy, status: zfs.PoolStatusOk, capacity: 42,
+		fragmentation: 7, scrubAge: 36 * time.Hour}
+
+	status, output := check([]poolInfo{healthy}, th)
+	assert.Equal(t, statusOK, status)
+	assert.Equal(t, "ZFS OK - 1 pools are healthy | 'tank_capacity'=42%;80;90;0;100 'tank_fragmentation'=7%;;;0;100 "+
+		"'tank_errors'=0;1;10;0 'tank_scrub_age'=129600s;;;0", output)
+
+	for _, tt := range []struct {
+		pool    poolInfo
+		status  int
+		problem string
+	}{
+		{poolInfo{capacity: 85}, statusWarning, "ZFS WARNING - tank is 85% full |"},
+		{poolInfo{capacity: 90}, statusCritical, "ZFS CRITICAL - tank is 90% full |"},
+		{poolInfo{errors: 3}, statusWarning, "ZFS WARNING - tank has had 3 device errors |"},
+		{poolInfo{errors: 12}, statusCritical, "ZFS CRITICAL - tank has had 12 device errors |"},
+		{poolInfo{state: zfs.VDevStateDegraded, status: zfs.PoolStatusMissingDevR}, statusWarning,
+			"ZFS WARNING - tank: degraded |"},
+		{poolInfo{state: zfs.VDevStateCantOpen, status: zfs.PoolStatusMissingDevNr}, statusCritical,
+			"ZFS CRITICAL - tank: cannot open |"},
+		{poolInfo{status: zfs.PoolStatusFailingDev}, statusWarning, "ZFS WARNING - tank: "},
+		// Pools that could merely be upgraded are healthy.
+		{poolInfo{status: zfs.PoolStatusVersionOlder}, statusOK, "ZFS OK - 1 pools are healthy |"},
+	} {
+		p := healthy
+		if tt.pool.state != 0 {
+			p.state = tt.pool.state
+		}
+		if tt.pool.status != 0 {
+			p.status = tt.pool.status
+		}
+		if tt.pool.capacity != 0 {
+			p.capacity = tt.pool.capacity
+		}
+		p.errors = tt.pool.errors
+
+		status, output := check([]poolInfo{p}, th)
+		assert.Equal(t, tt.status, status, tt.problem)
+		assert.Contains(t, output, tt.problem)
+	}
+
+	// The worst status wins, and every problem is listed.
+	full := healthy
+	full.name, full.capacity, full.fragmentation, full.scrubAge = "backup", 95, -1, -1
+	degraded := healthy
+	degraded.state, degraded.status = zfs.VDevStateDegraded, zfs.PoolStatusMissingDevR
+	status, output = check([]poolInfo{degraded, full}, th)
+	assert.Equal(t, statusCritical, status)
+	assert.Contains(t, output, "ZFS CRITICAL - tank: degraded; backup is 95% full | ")
+	assert.NotContains(t, output, "backup_fragmentation")
+	assert.NotContains(t, output, "backup_scrub_age")
+
+	status, output = check(nil, th)
+	assert.Equal(t, statusUnknown, status)
+	assert.Equal(t, "ZFS UNKNOWN - no pools are imported", output)
+}
+
+func TestDeviceErrors(t *testing.T) {
+	tree := zfs.VDevTree{Type: zfs.VDevTypeRoot, Name: "tank", Devices: []zfs.VDevTree{
+		{Type: zfs.VDevTypeMirror, Name: "mirror-0", Stat: zfs.VDevStat{ReadErrors: 100}, Devices: []zfs.VDevTree{
+			{Type: zfs.VDevTypeDisk, Name: "sda", Stat: zfs.VDevStat{ReadErrors: 1, WriteErrors: 2}},
+			{Type: zfs.VDevTypeDisk, Name: "sdb", Stat: zfs.VDevStat{ChecksumErrors: 4}},
+		}},
+	}}
+	// The counts of interior vdevs are not added again.
+	assert.Equal(t, uint64(7), deviceErrors(tree))
+}
+
+func TestScrubAge(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	scrubbed := zfs.PoolScanStat{Func: zfs.PoolScanFuncScrub, State: zfs.DSLScanStateFinished, EndTime: 1000000 - 3600}
+	assert.Equal(t, time.Hour, scrubAge(scrubbed, now))
+
+	resilvered := scrubbed
+	resilvered.Func = zfs.PoolScanFuncResilver
+	assert.Equal(t, time.Duration(-1), scrubAge(resilvered, now))
+	scanning := scrubbed
+	scanning.State = zfs.DSLScanStateScanning
+	assert.Equal(t, time.Duration(-1), scrubAge(scanning, now))
+}
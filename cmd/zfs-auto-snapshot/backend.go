@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Backend is the set of operations used by the degraded mode in which the tool runs when libzfs is not available (see
+// Tool.mainDegraded).  cliBackend implements it with the `zfs` command.
+type Backend interface {
+	// List returns the filesystems and volumes named in roots (or every one, if roots is empty), and their
+	// descendants if recursive is true.
+	List(roots []string, recursive bool) ([]backendDataset, error)
+	// Snapshots returns the snapshots of dataset (but not those of its descendants).
+	Snapshots(dataset string) ([]backendSnapshot, error)
+	// Snapshot creates the snapshot path with the given user properties, and returns its GUID and creation time.
+	Snapshot(path string, userProps map[string]string) (guid uint64, created time.Time, err error)
+	// Destroy destroys the snapshot path.
+	Destroy(path string) error
+	// PoolReadonly returns true if the named pool is imported read-only.
+	PoolReadonly(pool string) (bool, error)
+}
+
+// backendDataset is a filesystem or volume listed by a Backend.  AutoSnapshot is the value of its
+// AutoSnapshotProperty, and AutoSnapshotSet is false if the property is not set.  Receiving is true if a receive into
+// it is in progress or was interrupted (see datasetReceiving).
+type backendDataset struct {
+	Name            string
+	AutoSnapshot    string
+	AutoSnapshotSet bool
+	Receiving       bool
+}
+
+// backendSnapshot is a snapshot listed by a Backend.  Series is the value of its AutoSnapshotSeriesProperty, or "" if
+// the property is not set.
+type backendSnapshot struct {
+	Path   string
+	Series string
+}
+
+// cliBackend is a Backend that runs the `zfs` command (found on $PATH).
+type cliBackend struct{}
+
+func (cliBackend) List(roots []string, recursive bool) ([]backendDataset, error) {
+	args := []string{"list", "-H", "-o", "name,receive_resume_token," + AutoSnapshotProperty, "-t", "filesystem,volume"}
+	if recursive {
+		args = append(args, "-r")
+	}
+	rows, err := runZFS(append(args, roots...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var datasets []backendDataset
+	for _, row := range rows {
+		if len(row) != 3 {
+			return nil, fmt.Errorf("unexpected output from zfs list: %q", strings.Join(row, "\t"))
+		}
+		d := backendDataset{Name: row[0], Receiving: strings.Contains(row[0], "%") || row[1] != "-"}
+		if row[2] != "-" {
+			d.AutoSnapshot, d.AutoSnapshotSet = row[2], true
+		}
+		datasets = append(datasets, d)
+	}
+	return datasets, nil
+}
+
+func (cliBackend) Snapshots(dataset string) ([]backendSnapshot, error) {
+	rows, err := runZFS("list", "-H", "-o", "name,"+AutoSnapshotSeriesProperty, "-t", "snapshot", "-d", "1", dataset)
+	if err != nil {
+		return nil, err
+	}
+
+	var snaps []backendSnapshot
+	for _, row := range rows {
+		if len(row) != 2 {
+			return nil, fmt.Errorf("unexpected output from zfs list: %q", strings.Join(row, "\t"))
+		}
+		snap := backendSnapshot{Path: row[0]}
+		if row[1] != "-" {
+			snap.Series = row[1]
+		}
+		snaps = append(snaps, snap)
+	}
+	return snaps, nil
+}
+
+func (cliBackend) Snapshot(path string, userProps map[string]string) (uint64, time.Time, error) {
+	names := make([]string, 0, len(userProps))
+	for name := range userProps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	args := []string{"snapshot"}
+	for _, name := range names {
+		args = append(args, "-o", name+"="+userProps[name])
+	}
+	if _, err := runZFS(append(args, path)...); err != nil {
+		return 0, time.Time{}, err
+	}
+
+	rows, err := runZFS("get", "-H", "-p", "-o", "value", "guid,creation", path)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if len(rows) != 2 || len(rows[0]) != 1 || len(rows[1]) != 1 {
+		return 0, time.Time{}, fmt.Errorf("unexpected output from zfs get: %q", rows)
+	}
+	guid, err := strconv.ParseUint(rows[0][0], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("unexpected value for guid property of %s: %q", path, rows[0][0])
+	}
+	secs, err := strconv.ParseInt(rows[1][0], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("unexpected value for creation property of %s: %q", path, rows[1][0])
+	}
+	return guid, time.Unix(secs, 0), nil
+}
+
+func (cliBackend) Destroy(path string) error {
+	_, err := runZFS("destroy", path)
+	return err
+}
+
+func (cliBackend) PoolReadonly(pool string) (bool, error) {
+	rows, err := runZpool("get", "-H", "-o", "value", "readonly", pool)
+	if err != nil {
+		return false, err
+	}
+	if len(rows) != 1 || len(rows[0]) != 1 {
+		return false, fmt.Errorf("unexpected output from zpool get: %q", rows)
+	}
+	return rows[0][0] == "on", nil
+}
+
+// runZFS runs `zfs` with the given arguments and returns the tab-separated fields of each line of its output (as
+// printed when -H is given).
+func runZFS(args ...string) ([][]string, error) {
+	return runCommand("zfs", args...)
+}
+
+// runZpool is the equivalent of runZFS for `zpool`.
+func runZpool(args ...string) ([][]string, error) {
+	return runCommand("zpool", args...)
+}
+
+func runCommand(name string, args ...string) ([][]string, error) {
+	cmd := exec.Command(name, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	var rows [][]string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line != "" {
+			rows = append(rows, strings.Split(line, "\t"))
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeZFSScript records its arguments in $dir/args, prints $dir/out (if it exists), and fails if $dir/fail exists.
+const fakeZFSScript = `#!/bin/sh
+dir=$(dirname "$0")
+echo "$@" >> "$dir/args"
+if [ -e "$dir/fail" ]; then
+	echo "cannot open: dataset does not exist" >&2
+	exit 1
+fi
+if [ -e "$dir/out" ]; then
+	cat "$dir/out"
+fi
+`
+
+// withFakeZFS puts fake `zfs` and `zpool` commands first on $PATH for the duration of the test, and returns the
+// directory that contains them.
+func withFakeZFS(t *testing.T) (dir string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "zfs-auto-snapshot-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"zfs", "zpool"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(fakeZFSScript), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+oldPath)
+	return dir, func() {
+		os.Setenv("PATH", oldPath)
+		os.RemoveAll(dir)
+	}
+}
+
+// fakeZFSCalls returns the argument lists with which the fake `zfs` command in dir has been run, and forgets them.
+func fakeZFSCalls(t *testing.T, dir string) []string {
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(dir, "args"))
+	return strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+}
+
+func setFakeZFSOutput(t *testing.T, dir, out string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, "out"), []byte(out), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCLIBackendList(t *testing.T) {
+	dir, cleanup := withFakeZFS(t)
+	defer cleanup()
+	b := cliBackend{}
+
+	setFakeZFSOutput(t, dir, "tank\t-\t-\ntank/a\t-\tfalse\ntank/b\t-\ttrue\ntank/c\t1-e604ea4bf-e0\t-\n")
+	datasets, err := b.List([]string{"tank"}, true)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []backendDataset{
+			{Name: "tank"},
+			{Name: "tank/a", AutoSnapshot: "false", AutoSnapshotSet: true},
+			{Name: "tank/b", AutoSnapshot: "true", AutoSnapshotSet: true},
+			{Name: "tank/c", Receiving: true},
+		}, datasets)
+	}
+	assert.Equal(t, []string{"list -H -o name,receive_resume_token,com.sun:auto-snapshot -t filesystem,volume -r tank"},
+		fakeZFSCalls(t, dir))
+
+	setFakeZFSOutput(t, dir, "tank@zfs-auto-snap_daily_2016-01-01T00:00:00Z\tdaily\ntank@manual\t-\n")
+	snaps, err := b.Snapshots("tank")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []backendSnapshot{
+			{Path: "tank@zfs-auto-snap_daily_2016-01-01T00:00:00Z", Series: "daily"},
+			{Path: "tank@manual"},
+		}, snaps)
+	}
+	assert.Equal(t, []string{"list -H -o name,zfstools:auto-snapshot-series -t snapshot -d 1 tank"},
+		fakeZFSCalls(t, dir))
+
+	setFakeZFSOutput(t, dir, "tank\t-\n")
+	_, err = b.List(nil, false)
+	assert.Error(t, err, "output without the property column")
+	fakeZFSCalls(t, dir)
+
+	setFakeZFSOutput(t, dir, "on\n")
+	readonly, err := b.PoolReadonly("tank")
+	if assert.NoError(t, err) {
+		assert.True(t, readonly)
+	}
+	assert.Equal(t, []string{"get -H -o value readonly tank"}, fakeZFSCalls(t, dir))
+	setFakeZFSOutput(t, dir, "off\n")
+	readonly, err = b.PoolReadonly("tank")
+	if assert.NoError(t, err) {
+		assert.False(t, readonly)
+	}
+}
+
+func TestCLIBackendSnapshotDestroy(t *testing.T) {
+	dir, cleanup := withFakeZFS(t)
+	defer cleanup()
+	b := cliBackend{}
+
+	// The same output serves both `zfs snapshot` (which prints nothing that is read) and `zfs get`.
+	setFakeZFSOutput(t, dir, "1234\n1451606400\n")
+	guid, created, err := b.Snapshot("tank@snap", map[string]string{
+		"zfstools:auto-snapshot-series": "daily",
+		"com.sun:auto-snapshot-desc":    "auto daily",
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint64(1234), guid)
+		assert.True(t, created.Equal(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)), "%v", created)
+	}
+	assert.Equal(t, []string{
+		"snapshot -o com.sun:auto-snapshot-desc=auto daily -o zfstools:auto-snapshot-series=daily tank@snap",
+		"get -H -p -o value guid,creation tank@snap",
+	}, fakeZFSCalls(t, dir))
+
+	assert.NoError(t, b.Destroy("tank@snap"))
+	assert.Equal(t, []string{"destroy tank@snap"}, fakeZFSCalls(t, dir))
+
+	// Failures are reported along with what zfs printed.
+	if err := ioutil.WriteFile(filepath.Join(dir, "fail"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = b.Destroy("tank@snap")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "dataset does not exist")
+	}
+	_, _, err = b.Snapshot("tank@snap", nil)
+	assert.Error(t, err)
+}
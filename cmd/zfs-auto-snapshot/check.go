@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	zfs "github.com/kelleyk/go-libzfs"
+)
+
+// checkItem is a single line in the checklist printed by the "check" subcommand.
+type checkItem struct {
+	desc string
+	f    func() error
+}
+
+// checkEnv holds the operations that the "check" subcommand exercises.  They are fields so that tests can inject
+// failures; see defaultCheckEnv for the real implementations.
+type checkEnv struct {
+	available  func() error
+	loadConfig func(path string) (*configFile, error)
+	poolNames  func() ([]string, error)
+
+	// delegation, if non-nil, checks that the current user will be allowed to create and destroy snapshots.
+	delegation func() error
+}
+
+func defaultCheckEnv(checkDelegation bool) checkEnv {
+	env := checkEnv{
+		available:  zfs.Available,
+		loadConfig: loadConfig,
+		poolNames:  openPoolNames,
+	}
+	if checkDelegation && os.Geteuid() != 0 {
+		env.delegation = checkPoolDelegation
+	}
+	return env
+}
+
+// checkItems returns the checklist for the "check" subcommand.  Checks that depend on libzfs are skipped (and
+// reported as failures) if libzfs is not available.
+func checkItems(env checkEnv, configPath string) []checkItem {
+	var zfsErr error
+
+	items := []checkItem{
+		{"libzfs is available", func() error {
+			zfsErr = env.available()
+			return zfsErr
+		}},
+		{"configuration file parses and validates", func() error {
+			if configPath == "" {
+				return errors.New("no config file path given")
+			}
+			_, err := env.loadConfig(configPath)
+			return err
+		}},
+		{"pools can be opened", func() error {
+			if zfsErr != nil {
+				return errors.New("skipped; libzfs is not available")
+			}
+			names, err := env.poolNames()
+			if err != nil {
+				return err
+			}
+			if len(names) == 0 {
+				return errors.New("no pools found")
+			}
+			return nil
+		}},
+	}
+
+	if env.delegation != nil {
+		items = append(items, checkItem{"snapshot and destroy permissions are delegated", func() error {
+			if zfsErr != nil {
+				return errors.New("skipped; libzfs is not available")
+			}
+			return env.delegation()
+		}})
+	}
+
+	return items
+}
+
+// runChecks runs each check in order, printing a checklist to w.  It returns true iff every check passed.
+func runChecks(w io.Writer, items []checkItem) bool {
+	ok := true
+	for _, item := range items {
+		if err := item.f(); err != nil {
+			ok = false
+			fmt.Fprintf(w, "[FAIL] %s: %v\n", item.desc, err)
+		} else {
+			fmt.Fprintf(w, "[ OK ] %s\n", item.desc)
+		}
+	}
+	return ok
+}
+
+// openPoolNames returns the names of all imported pools.
+func openPoolNames() ([]string, error) {
+	pools, err := zfs.PoolOpenAll()
+	defer zfs.PoolCloseAll(pools)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, p := range pools {
+		name, err := p.Name()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// checkPoolDelegation returns an error if delegated administration is disabled on any imported pool.  Without it, a
+// non-root user cannot be granted the "snapshot" and "destroy" permissions via `zfs allow`.
+//
+// N.B.: This does not check the permissions that have actually been granted.
+//
+func checkPoolDelegation() error {
+	pools, err := zfs.PoolOpenAll()
+	defer zfs.PoolCloseAll(pools)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pools {
+		name, err := p.Name()
+		if err != nil {
+			return err
+		}
+		prop, err := p.GetProperty(zfs.PoolPropDelegation)
+		if err != nil {
+			return err
+		}
+		if prop.Value != "on" {
+			return fmt.Errorf("delegation is disabled on pool %s", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunChecks(t *testing.T) {
+	errFail := errors.New("injected failure")
+
+	passingEnv := func() checkEnv {
+		return checkEnv{
+			available:  func() error { return nil },
+			loadConfig: func(string) (*configFile, error) { return &configFile{}, nil },
+			poolNames:  func() ([]string, error) { return []string{"tank"}, nil },
+			delegation: func() error { return nil },
+		}
+	}
+
+	for _, tt := range []struct {
+		desc       string
+		configPath string
+		modify     func(env *checkEnv)
+		failures   []string
+	}{
+		{"all checks pass", "config.yaml", func(env *checkEnv) {}, nil},
+		{"libzfs unavailable", "config.yaml", func(env *checkEnv) {
+			env.available = func() error { return errFail }
+		}, []string{"libzfs is available", "pools can be opened", "snapshot and destroy permissions are delegated"}},
+		{"no config path", "", func(env *checkEnv) {}, []string{"configuration file parses and validates"}},
+		{"invalid config", "config.yaml", func(env *checkEnv) {
+			env.loadConfig = func(string) (*configFile, error) { return nil, errFail }
+		}, []string{"configuration file parses and validates"}},
+		{"cannot open pools", "config.yaml", func(env *checkEnv) {
+			env.poolNames = func() ([]string, error) { return nil, errFail }
+		}, []string{"pools can be opened"}},
+		{"no pools", "config.yaml", func(env *checkEnv) {
+			env.poolNames = func() ([]string, error) { return nil, nil }
+		}, []string{"pools can be opened"}},
+		{"delegation disabled", "config.yaml", func(env *checkEnv) {
+			env.delegation = func() error { return errFail }
+		}, []string{"snapshot and destroy permissions are delegated"}},
+	} {
+		env := passingEnv()
+		tt.modify(&env)
+
+		var buf bytes.Buffer
+		ok := runChecks(&buf, checkItems(env, tt.configPath))
+		assert.Equal(t, len(tt.failures) == 0, ok, tt.desc)
+
+		out := buf.String()
+		for _, desc := range tt.failures {
+			assert.Contains(t, out, "[FAIL] "+desc, tt.desc)
+		}
+		assert.Equal(t, len(tt.failures), bytes.Count(buf.Bytes(), []byte("[FAIL]")), tt.desc)
+	}
+}
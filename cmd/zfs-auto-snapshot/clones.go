@@ -0,0 +1,180 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/kelleyk/zfstools"
+)
+
+// cloneDescendants returns the clones of the named dataset, the clones of those clones, and so on, sorted by name.
+// snapshotClones maps the path of each snapshot that has clones to the value of its clones property (see
+// Tool.snapshotClones).
+func cloneDescendants(dataset string, snapshotClones map[string]string) []string {
+	clonesOf := make(map[string][]string)
+	for snapPath, clones := range snapshotClones {
+		origin, err := zfstools.SnapshotParent(snapPath)
+		if err != nil {
+			continue
+		}
+		for _, clone := range strings.Split(clones, ",") {
+			if clone != "" {
+				clonesOf[origin] = append(clonesOf[origin], clone)
+			}
+		}
+	}
+
+	var descendants []string
+	seen := map[string]bool{dataset: true}
+	for queue := []string{dataset}; len(queue) > 0; queue = queue[1:] {
+		for _, clone := range clonesOf[queue[0]] {
+			if !seen[clone] {
+				seen[clone] = true
+				descendants = append(descendants, clone)
+				queue = append(queue, clone)
+			}
+		}
+	}
+	sort.Strings(descendants)
+	return descendants
+}
+
+// cloneGroups divides those of datasets that are related by cloning into groups that are snapshotted together (see
+// -include-clones).  It returns a map from the dataset that each group originates from to the other members of the
+// group, which are that dataset's clone descendants (see cloneDescendants) among datasets.  A clone whose origin is
+// itself a clone belongs to the group of the earliest of its origins among datasets.  Datasets that are related to no
+// others are left out.
+func cloneGroups(datasets []string, snapshotClones map[string]string) map[string][]string {
+	selected := make(map[string]bool)
+	for _, name := range datasets {
+		selected[name] = true
+	}
+
+	descendants := make(map[string][]string)
+	member := make(map[string]bool)
+	for _, name := range datasets {
+		for _, clone := range cloneDescendants(name, snapshotClones) {
+			if selected[clone] {
+				descendants[name] = append(descendants[name], clone)
+				member[clone] = true
+			}
+		}
+	}
+
+	groups := make(map[string][]string)
+	for name, clones := range descendants {
+		if !member[name] {
+			groups[name] = clones
+		}
+	}
+	return groups
+}
+
+// groupSnapshots returns meta, which describes a new snapshot of a dataset, followed by a description of the
+// snapshot of the same name of each of the other datasets that are snapshotted along with it (see Tool.groupMembers).
+func (tool *Tool) groupSnapshots(meta *zfstools.SnapMetadata) []*zfstools.SnapMetadata {
+	metas := []*zfstools.SnapMetadata{meta}
+	for _, clone := range tool.groupMembers[meta.Dataset] {
+		cloneMeta := *meta
+		cloneMeta.Dataset = clone
+		metas = append(metas, &cloneMeta)
+	}
+	return metas
+}
+
+// withGroupCreated returns snaps (the snapshots of dataset in the series s, most recent first) with the snapshots of
+// dataset in s that were created during this run along with those of another dataset (see Tool.groupMembers), which
+// were not seen when the tool started.  It also returns how many such snapshots there were.
+func (tool *Tool) withGroupCreated(dataset string, s seriesConfig,
+	snaps []*zfstools.SnapMetadata) ([]*zfstools.SnapMetadata, int) {
+
+	tool.mu.Lock()
+	defer tool.mu.Unlock()
+
+	known := make(map[string]bool)
+	for _, snap := range snaps {
+		known[snap.Path()] = true
+	}
+	created := 0
+	for _, meta := range tool.groupCreated[dataset] {
+		if meta.Label != s.Label {
+			continue
+		}
+		created++
+		// With -state-db, the snapshot is already known.
+		if !known[meta.Path()] {
+			snaps = append(snaps, meta)
+		}
+	}
+	sort.Sort(zfstools.ByTS(snaps))
+	return snaps, created
+}
+
+// recordGroupDestroyed records that meta, a snapshot of a dataset that is snapshotted along with another (see
+// Tool.groupMembers), has been destroyed recursively along with that dataset's snapshot of the same name, so that it
+// still counts toward its own dataset's removals (see groupDestroyedQty).
+func (tool *Tool) recordGroupDestroyed(meta *zfstools.SnapMetadata) {
+	tool.mu.Lock()
+	defer tool.mu.Unlock()
+	tool.groupDestroyed[meta.Dataset] = append(tool.groupDestroyed[meta.Dataset], meta)
+}
+
+// groupDestroyedQty returns how many snapshots of dataset in the series s have been destroyed during this run along
+// with those of another dataset (see recordGroupDestroyed).
+func (tool *Tool) groupDestroyedQty(dataset string, s seriesConfig) int {
+	tool.mu.Lock()
+	defer tool.mu.Unlock()
+
+	n := 0
+	for _, meta := range tool.groupDestroyed[dataset] {
+		if meta.Label == s.Label {
+			n++
+		}
+	}
+	return n
+}
+
+// groupDue returns the snapshots in the series s of each of the datasets that are snapshotted along with dataset (see
+// Tool.groupMembers) that are due to be removed under that dataset's own retention (see dueSnapshots), keyed by path.
+// series are the configured series, from which each dataset's own are derived.
+func (tool *Tool) groupDue(dataset string, series []seriesConfig, s seriesConfig,
+	now time.Time) (map[string]*zfstools.SnapMetadata, error) {
+
+	due := make(map[string]*zfstools.SnapMetadata)
+	for _, member := range tool.groupMembers[dataset] {
+		d := tool.datasetsByName[member]
+		snaps, err := tool.getSnapshots(d, s)
+		if err != nil {
+			return nil, err
+		}
+		snaps, _ = tool.withGroupCreated(member, s, snaps)
+		holds, err := d.AllHolds()
+		if err != nil {
+			return nil, err
+		}
+		for _, snap := range tool.dueSnapshots(member, d, series, s.Label, snaps, holds, now) {
+			due[snap.Path()] = snap
+		}
+	}
+	return due, nil
+}
+
+// dueSnapshots returns those of snaps (the snapshots of the dataset d, whose name is dsPath, in the series label, most
+// recent first) that d's own series (see datasetSeries) say should be removed and that could be removed: that is,
+// without the snapshot that the next backup is based on (see backupBase) and those that have holds.  series are the
+// configured series.  Unlike manageSnapshots, it changes nothing.
+func (tool *Tool) dueSnapshots(dsPath string, d zfs.Dataset, series []seriesConfig, label string,
+	snaps []*zfstools.SnapMetadata, holds map[string][]zfs.HoldInfo, now time.Time) []*zfstools.SnapMetadata {
+
+	for _, s := range tool.datasetSeries(dsPath, d, series) {
+		if s.Label != label {
+			continue
+		}
+		due := snapshotsToRemove(snaps, s, now)
+		due = excludeBackupBase(due, tool.backupBase(d))
+		return excludeHeld(due, holds)
+	}
+	return nil
+}
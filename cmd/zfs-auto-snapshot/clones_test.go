@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+// testSnapshotClones has tank/base, its clone tank/clone, and a clone of that clone, tank/clone2; tank/other has an
+// unrelated clone elsewhere in the pool.
+var testSnapshotClones = map[string]string{
+	"tank/base@s1":  "tank/clone",
+	"tank/clone@s2": "tank/clone2",
+	"tank/other@s3": "tank/scratch/copy",
+}
+
+func TestCloneDescendants(t *testing.T) {
+	for _, tt := range []struct {
+		dataset     string
+		descendants []string
+	}{
+		{"tank/base", []string{"tank/clone", "tank/clone2"}},
+		{"tank/clone", []string{"tank/clone2"}},
+		{"tank/clone2", nil},
+		{"tank/other", []string{"tank/scratch/copy"}},
+		{"tank", nil},
+	} {
+		assert.Equal(t, tt.descendants, cloneDescendants(tt.dataset, testSnapshotClones), tt.dataset)
+	}
+
+	// A snapshot may have more than one clone.
+	assert.Equal(t, []string{"tank/a", "tank/b"},
+		cloneDescendants("tank/x", map[string]string{"tank/x@s": "tank/b,tank/a"}))
+}
+
+func TestCloneGroups(t *testing.T) {
+	for _, tt := range []struct {
+		datasets []string
+		groups   map[string][]string
+	}{
+		{[]string{"tank/base", "tank/clone", "tank/clone2", "tank/other"},
+			map[string][]string{"tank/base": {"tank/clone", "tank/clone2"}}},
+		// A chain that is missing a link (e.g. because the middle clone was excluded) is still one group.
+		{[]string{"tank/base", "tank/clone2"}, map[string][]string{"tank/base": {"tank/clone2"}}},
+		// Without the original, the first clone is the origin of the group.
+		{[]string{"tank/clone", "tank/clone2"}, map[string][]string{"tank/clone": {"tank/clone2"}}},
+		{[]string{"tank/base", "tank/other"}, map[string][]string{}},
+	} {
+		assert.Equal(t, tt.groups, cloneGroups(tt.datasets, testSnapshotClones), "%v", tt.datasets)
+	}
+}
+
+func TestSnapshotWithClones(t *testing.T) {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	tool := &Tool{
+		l:            l,
+		allowCreate:  true,
+		groupMembers: cloneGroups([]string{"tank/base", "tank/clone", "tank/clone2"}, testSnapshotClones),
+		groupCreated: make(map[string][]*zfstools.SnapMetadata),
+	}
+	now := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := seriesConfig{Label: "hourly", Interval: time.Hour, Keep: 1}
+
+	// The dataset, its clone, and the clone's clone are all snapshotted by a single call to create, under the same
+	// name.
+	var calls [][]string
+	create := func(meta *zfstools.SnapMetadata) error {
+		var paths []string
+		for i, m := range tool.groupSnapshots(meta) {
+			paths = append(paths, m.Path())
+			if i > 0 {
+				tool.groupCreated[m.Dataset] = append(tool.groupCreated[m.Dataset], m)
+			}
+		}
+		calls = append(calls, paths)
+		return nil
+	}
+	noRemove := func([]*zfstools.SnapMetadata) error { return nil }
+	assert.NoError(t, tool.manageSeries("tank/base", s, nil, now, nil, create, noRemove))
+	name := "@zfs-auto-snap_hourly_2016-01-02T03:04:05Z"
+	assert.Equal(t, [][]string{{"tank/base" + name, "tank/clone" + name, "tank/clone2" + name}}, calls)
+
+	// When a clone's own snapshots are pruned, the new snapshot counts toward its series, so the older one goes.
+	older := &zfstools.SnapMetadata{
+		Dataset: "tank/clone", Prefix: "zfs-auto-snap", Label: "hourly", TS: now.Add(-time.Hour),
+	}
+	snaps, created := tool.withGroupCreated("tank/clone", s, []*zfstools.SnapMetadata{older})
+	assert.Equal(t, 1, created)
+	var removed []*zfstools.SnapMetadata
+	remove := func(snaps []*zfstools.SnapMetadata) error {
+		removed = append(removed, snaps...)
+		return nil
+	}
+	assert.NoError(t, tool.manageSeries("tank/clone", s, snaps, now, nil, nil, remove))
+	assert.Equal(t, []*zfstools.SnapMetadata{older}, removed)
+
+	// Other series are unaffected.
+	_, created = tool.withGroupCreated("tank/clone", seriesConfig{Label: "daily"}, nil)
+	assert.Equal(t, 0, created)
+}
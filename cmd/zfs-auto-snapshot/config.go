@@ -1,10 +1,15 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/kelleyk/zfstools"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -12,11 +17,76 @@ type seriesConfig struct {
 	Label    string
 	Interval time.Duration
 	Keep     int
+
+	// ID, if not empty, identifies the series in the AutoSnapshotSeriesProperty of its snapshots in place of Label.
+	// When changing a series' label, set ID to the old label so that the series' existing snapshots stay in it.
+	ID string
+
+	// WrittenThreshold, if nonzero, makes taking a new snapshot depend on how much has been written to the dataset
+	// since the series' most recent snapshot instead of on how long ago it was taken: a new snapshot is taken once more
+	// than WrittenThreshold bytes have been written, even if Interval has not yet elapsed, and is not taken otherwise,
+	// even if it has.  Interval may be omitted when WrittenThreshold is given.
+	WrittenThreshold uint64
+
+	// MinRetention, if nonzero, prevents pruning from leaving the series without a snapshot at least this old.
+	MinRetention time.Duration
+
+	// MaxAge, if nonzero, retains every snapshot that is no older than this, even beyond Keep (see snapshotsToRemove);
+	// e.g. a MaxAge of 720h with a Keep of 0 keeps 30 days of snapshots, however irregularly they were taken.
+	MaxAge time.Duration
+
+	// Thinning, if given, thins the snapshots that are otherwise retained, other than the Keep most recent, more and
+	// more coarsely as they age (see thinningSchedule); it is typically given with a Keep of -1.
+	Thinning thinningSchedule
+
+	// DescTemplate, if not empty, is a text/template that is rendered to produce the description stored on each new
+	// snapshot in the series (see AutoSnapshotDescProperty); e.g. `auto {{.Label}} on {{.Hostname}}`.  See descData
+	// for the available fields.
+	DescTemplate string
+
+	// Guard, if given, must be satisfied for a new snapshot to be taken in the series (see guardConfig).
+	Guard *guardConfig
 }
 
+// trimConfig schedules TRIM on the pools of the selected datasets (see Tool.scheduleTrims).
+type trimConfig struct {
+	// Interval is how often each pool is trimmed, e.g. 168h for weekly.
+	Interval time.Duration
+}
+
+// errTrimNeedsStateDB is returned when the configuration file has a trim section but -state-db was not given.
+var errTrimNeedsStateDB = errors.New("the config file's trim section requires -state-db, in which trims are recorded")
+
 type configFile struct {
 	Series []seriesConfig
 	Foo    string
+
+	// Trim, if given, has the pools of the selected datasets trimmed on a schedule.
+	Trim *trimConfig
+
+	// LegacyTimestampFormats are layouts (for time.Parse, e.g. "2006-01-02-1504") for the timestamps in the names of
+	// snapshots that were not created by this tool but that should be managed by it.  RFC 3339 timestamps are always
+	// recognized.
+	LegacyTimestampFormats []string
+
+	// NameOrder is the order of the prefix and the label in the names of snapshots: "prefix_label" (the default) or
+	// "label_prefix" (see zfstools.NameOrder).  It applies both to the snapshots that are taken and to recognizing
+	// existing ones.
+	NameOrder string
+
+	// ExcludePatterns and ExcludeRegexps exclude the datasets whose names match any of them (and the descendants of
+	// those datasets), in addition to those given with -exclude.  Patterns are globs (see path.Match, e.g.
+	// "*/cache"); regexps are not anchored (see regexp, e.g. "^tank/(tmp|scratch)$").
+	ExcludePatterns []string
+	ExcludeRegexps  []string
+
+	// Policies give the datasets in particular subtrees their own series, which are merged with Series (see
+	// resolvePolicy); e.g. a policy for "tank/vm/*" can keep fewer snapshots of virtual machines.  When more than one
+	// policy applies to a dataset, the most specific wins (see matchPolicy).
+	Policies []policyConfig
+
+	// compiledExcludes are the compiled ExcludeRegexps; they are set by Validate.
+	compiledExcludes []*regexp.Regexp
 }
 
 func loadConfig(path string) (*configFile, error) {
@@ -30,6 +100,9 @@ func loadConfig(path string) (*configFile, error) {
 		return nil, err
 	}
 
+	if *autoLabel {
+		conf.fillLabels()
+	}
 	if err := conf.Validate(); err != nil {
 		return nil, err
 	}
@@ -37,18 +110,251 @@ func loadConfig(path string) (*configFile, error) {
 	return conf, nil
 }
 
+// Validate checks c and prepares it for use.  If c is invalid, the error describes every problem that was found (see
+// configErrors).
 func (c *configFile) Validate() error {
-	for _, series := range c.Series {
+	if errs := c.validationErrors(); len(errs) > 0 {
+		return configErrors(errs)
+	}
+	return nil
+}
+
+// configErrors describes each of the problems found with a configuration file.
+type configErrors []error
+
+func (e configErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// configProblem is a problem with one field of a configuration file.  Field is the field's path, using the keys that
+// appear in the file, e.g. "series[2].keep" or "trim.interval".
+type configProblem struct {
+	Field string
+	Msg   string
+}
+
+func (p configProblem) Error() string {
+	return p.Field + ": " + p.Msg
+}
+
+// validationErrors returns every problem with c, each a configProblem.  It also sets compiledExcludes.
+func (c *configFile) validationErrors() []error {
+	var errs []error
+	problem := func(field, format string, args ...interface{}) {
+		errs = append(errs, configProblem{Field: field, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	for i, pattern := range c.ExcludePatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			problem(fmt.Sprintf("excludepatterns[%d]", i), "invalid exclude pattern %q: %v", pattern, err)
+		}
+	}
+	c.compiledExcludes = nil
+	for i, expr := range c.ExcludeRegexps {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			problem(fmt.Sprintf("excluderegexps[%d]", i), "invalid exclude regexp %q: %v", expr, err)
+			continue
+		}
+		c.compiledExcludes = append(c.compiledExcludes, re)
+	}
+
+	if err := zfstools.NameOrder(c.NameOrder).Validate(); err != nil {
+		problem("nameorder", "%v", err)
+	}
+
+	if c.Trim != nil && c.Trim.Interval <= time.Duration(0) {
+		problem("trim.interval", "trim has interval <= 0")
+	}
+
+	for i, layout := range c.LegacyTimestampFormats {
+		if (time.Time{}).Format(layout) == layout {
+			problem(fmt.Sprintf("legacytimestampformats[%d]", i),
+				"legacy timestamp format %q contains no date or time fields", layout)
+		}
+	}
+
+	validateSeries("series", c.Series, problem)
+	for i, policy := range c.Policies {
+		field := fmt.Sprintf("policies[%d]", i)
+		if policy.Pattern == "" {
+			problem(field+".pattern", "policy has empty pattern")
+		} else if _, err := path.Match(policy.Pattern, ""); err != nil {
+			problem(field+".pattern", "invalid policy pattern %q: %v", policy.Pattern, err)
+		}
+		validateSeries(field+".series", policy.Series, problem)
+	}
+
+	return errs
+}
+
+// validateSeries reports each problem with list, which is found at the field prefix (e.g. "series"), to problem.
+func validateSeries(prefix string, list []seriesConfig, problem func(field, format string, args ...interface{})) {
+	// Snapshot names are distinguished only by label (the prefix is the same for every series), so two series with the
+	// same label would compete for the same snapshots.
+	labels := make(map[string]bool)
+	ids := make(map[string]bool)
+	for i, series := range list {
+		field := func(name string) string { return fmt.Sprintf("%s[%d].%s", prefix, i, name) }
+
+		duplicateLabel := false
 		if series.Label == "" {
-			return fmt.Errorf("series has empty label")
+			problem(field("label"), "series has empty label")
+		} else {
+			duplicateLabel = labels[series.Label]
+			if duplicateLabel {
+				problem(field("label"), "more than one series has label %q", series.Label)
+			}
+			labels[series.Label] = true
+			if strings.ContainsAny(series.Label, "_@/") {
+				// The label could not be recovered from the names of the series' snapshots (see
+				// zfstools.ParseSnapName).
+				problem(field("label"), "series label %q contains an underscore, '@', or '/'", series.Label)
+			}
+			// A duplicate label is also a duplicate ID unless ID is given; don't report the same problem twice.
+			if ids[series.seriesID()] && (series.ID != "" || !duplicateLabel) {
+				problem(field("id"), "more than one series has id %q", series.seriesID())
+			}
+			ids[series.seriesID()] = true
+		}
+		if series.Keep < 0 && series.Keep != -1 {
+			problem(field("keep"), "series %q has invalid value for 'keep'", series.Label)
 		}
-		if series.Keep <= 0 && series.Keep != -1 {
-			return fmt.Errorf("series has invalid value for 'keep'")
+		if series.Interval < time.Duration(0) || (series.Interval == time.Duration(0) && series.WrittenThreshold == 0) {
+			problem(field("interval"), "series %q has interval <= 0", series.Label)
 		}
-		if series.Interval <= time.Duration(0) {
-			return fmt.Errorf("series has interval <= 0")
+		if series.MinRetention < time.Duration(0) {
+			problem(field("minretention"), "series %q has minretention < 0", series.Label)
+		}
+		if series.MaxAge < time.Duration(0) {
+			problem(field("maxage"), "series %q has maxage < 0", series.Label)
+		}
+		for j, step := range series.Thinning {
+			stepField := func(name string) string { return field(fmt.Sprintf("thinning[%d].%s", j, name)) }
+			if step.After <= time.Duration(0) {
+				problem(stepField("after"), "series %q has a thinning step with after <= 0", series.Label)
+			} else if j > 0 && step.After <= series.Thinning[j-1].After {
+				problem(stepField("after"), "series %q has thinning steps out of order (by after)", series.Label)
+			}
+			if step.Every <= time.Duration(0) {
+				problem(stepField("every"), "series %q has a thinning step with every <= 0", series.Label)
+			}
+		}
+		if series.DescTemplate != "" {
+			// Render with placeholder data so that references to nonexistent fields are caught, too.
+			if _, err := renderDesc(series.DescTemplate, descData{}); err != nil {
+				problem(field("desctemplate"), "series %q has invalid desctemplate: %v", series.Label, err)
+			}
+		}
+		if series.Guard != nil {
+			if series.Guard.File == "" && series.Guard.Command == "" {
+				problem(field("guard"), "series %q has a guard with neither a file nor a command", series.Label)
+			}
+			if series.Guard.Timeout < time.Duration(0) {
+				problem(field("guard.timeout"), "series %q has a guard with timeout < 0", series.Label)
+			}
 		}
 	}
+}
 
-	return nil
+// fastIntervals returns a configProblem for each of c's series that has an interval shorter than min (see
+// -min-interval), which is likely a mistake (e.g. a series left over from testing) that would pile up snapshots.
+// Series that have only a WrittenThreshold are not checked.  The series of c's policies are checked, too.
+func (c *configFile) fastIntervals(min time.Duration) []error {
+	var errs []error
+	check := func(prefix string, list []seriesConfig) {
+		for i, series := range list {
+			if series.Interval > time.Duration(0) && series.Interval < min {
+				errs = append(errs, configProblem{
+					Field: fmt.Sprintf("%s[%d].interval", prefix, i),
+					Msg: fmt.Sprintf("series %q has interval %v, which is shorter than -min-interval (%v)",
+						series.Label, series.Interval, min),
+				})
+			}
+		}
+	}
+	check("series", c.Series)
+	for i, policy := range c.Policies {
+		check(fmt.Sprintf("policies[%d].series", i), policy.Series)
+	}
+	return errs
+}
+
+// labelsContaining returns a problem for each series (including those of policies) whose label contains sep (see
+// -sep), since the label could not be recovered from the names of the series' snapshots.
+func (c *configFile) labelsContaining(sep string) []error {
+	var errs []error
+	check := func(prefix string, list []seriesConfig) {
+		for i, series := range list {
+			if strings.Contains(series.Label, sep) {
+				errs = append(errs, configProblem{
+					Field: fmt.Sprintf("%s[%d].label", prefix, i),
+					Msg:   fmt.Sprintf("series label %q contains the separator %q (see -sep)", series.Label, sep),
+				})
+			}
+		}
+	}
+	check("series", c.Series)
+	for i, policy := range c.Policies {
+		check(fmt.Sprintf("policies[%d].series", i), policy.Series)
+	}
+	return errs
+}
+
+// fillLabels gives each of c's series (including those of its policies) that has no label one derived from its
+// interval (see derivedLabel).  Series that have no interval (only a WrittenThreshold) are left without one.
+func (c *configFile) fillLabels() {
+	fill := func(list []seriesConfig) {
+		for i := range list {
+			if list[i].Label == "" && list[i].Interval > time.Duration(0) {
+				list[i].Label = derivedLabel(list[i].Interval)
+			}
+		}
+	}
+	fill(c.Series)
+	for _, policy := range c.Policies {
+		fill(policy.Series)
+	}
+}
+
+// derivedLabel returns the label for a series with the given interval (see -auto-label): "hourly", "daily", or
+// "weekly" for the usual intervals, and otherwise "every-" followed by the interval in the largest unit that divides it
+// evenly, e.g. "every-90m".  Such labels contain only letters, digits, and hyphens, so they are always valid.
+func derivedLabel(interval time.Duration) string {
+	switch interval {
+	case time.Hour:
+		return "hourly"
+	case 24 * time.Hour:
+		return "daily"
+	case 7 * 24 * time.Hour:
+		return "weekly"
+	}
+	for _, unit := range []struct {
+		d    time.Duration
+		name string
+	}{{time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}, {time.Millisecond, "ms"}} {
+		if interval%unit.d == 0 {
+			return fmt.Sprintf("every-%d%s", interval/unit.d, unit.name)
+		}
+	}
+	return fmt.Sprintf("every-%dns", interval)
+}
+
+// excludes returns true if the dataset name matches one of c's ExcludePatterns or ExcludeRegexps.
+func (c *configFile) excludes(name string) bool {
+	for _, pattern := range c.ExcludePatterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	for _, re := range c.compiledExcludes {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
 }
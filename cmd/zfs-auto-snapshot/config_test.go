@@ -0,0 +1,276 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	zfs "github.com/kelleyk/go-libzfs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateLegacyTimestampFormats(t *testing.T) {
+	assert.NoError(t, (&configFile{LegacyTimestampFormats: []string{"2006-01-02-1504"}}).Validate())
+	assert.Error(t, (&configFile{LegacyTimestampFormats: []string{"daily"}}).Validate())
+}
+
+func TestValidateNameOrder(t *testing.T) {
+	for _, order := range []string{"", "prefix_label", "label_prefix"} {
+		assert.NoError(t, (&configFile{NameOrder: order}).Validate(), order)
+	}
+	assert.Error(t, (&configFile{NameOrder: "label-prefix"}).Validate())
+}
+
+func TestLabelsContaining(t *testing.T) {
+	conf := &configFile{
+		Series: []seriesConfig{{Label: "daily"}, {Label: "every hour"}},
+		Policies: []policyConfig{
+			{Pattern: "tank/*", Series: []seriesConfig{{Label: "every day"}}},
+		},
+	}
+	assert.Empty(t, conf.labelsContaining("_"))
+	var fields []string
+	for _, err := range conf.labelsContaining(" ") {
+		fields = append(fields, err.(configProblem).Field)
+	}
+	assert.Equal(t, []string{"series[1].label", "policies[0].series[0].label"}, fields)
+}
+
+func TestDerivedLabel(t *testing.T) {
+	for interval, label := range map[time.Duration]string{
+		time.Hour:               "hourly",
+		24 * time.Hour:          "daily",
+		168 * time.Hour:         "weekly",
+		15 * time.Minute:        "every-15m",
+		90 * time.Minute:        "every-90m",
+		36 * time.Hour:          "every-36h",
+		90 * time.Second:        "every-90s",
+		1500 * time.Millisecond: "every-1500ms",
+	} {
+		assert.Equal(t, label, derivedLabel(interval), "%v", interval)
+	}
+}
+
+func TestFillLabels(t *testing.T) {
+	conf := &configFile{
+		Series: []seriesConfig{
+			{Interval: time.Hour, Keep: 24},
+			{Label: "daily", Interval: 24 * time.Hour, Keep: 7},
+			{Interval: 90 * time.Minute, Keep: 4},
+			{WrittenThreshold: 1 << 30, Keep: 10},
+		},
+		Policies: []policyConfig{
+			{Pattern: "tank/*", Series: []seriesConfig{{Interval: 168 * time.Hour, Keep: 4}}},
+		},
+	}
+	conf.fillLabels()
+	var labels []string
+	for _, s := range conf.Series {
+		labels = append(labels, s.Label)
+	}
+	assert.Equal(t, []string{"hourly", "daily", "every-90m", ""}, labels)
+	assert.Equal(t, "weekly", conf.Policies[0].Series[0].Label)
+
+	// A series without an interval still needs a label.
+	if errs, ok := conf.Validate().(configErrors); assert.True(t, ok) && assert.Len(t, errs, 1) {
+		assert.Equal(t, "series[3].label", errs[0].(configProblem).Field)
+	}
+	conf.Series = conf.Series[:3]
+	assert.NoError(t, conf.Validate())
+}
+
+func TestValidateSeriesIDs(t *testing.T) {
+	daily := seriesConfig{Label: "daily", Interval: time.Hour, Keep: 1}
+	renamed := seriesConfig{Label: "day", ID: "daily", Interval: time.Hour, Keep: 1}
+	assert.NoError(t, (&configFile{Series: []seriesConfig{renamed}}).Validate())
+	assert.Error(t, (&configFile{Series: []seriesConfig{daily, renamed}}).Validate())
+}
+
+func TestValidateSeriesLabels(t *testing.T) {
+	hourly := seriesConfig{Label: "hourly", Interval: time.Hour, Keep: 24}
+	daily := seriesConfig{Label: "daily", Interval: 24 * time.Hour, Keep: 7}
+	dailyAgain := seriesConfig{Label: "daily", Interval: 12 * time.Hour, Keep: 3, ID: "twice-daily"}
+
+	assert.NoError(t, (&configFile{Series: []seriesConfig{hourly, daily}}).Validate())
+	err := (&configFile{Series: []seriesConfig{hourly, daily, dailyAgain}}).Validate()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `"daily"`)
+	}
+}
+
+func TestValidateTrim(t *testing.T) {
+	assert.NoError(t, (&configFile{Trim: &trimConfig{Interval: 168 * time.Hour}}).Validate())
+	assert.Error(t, (&configFile{Trim: &trimConfig{}}).Validate())
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	conf := &configFile{
+		Series: []seriesConfig{
+			{Label: "", Interval: time.Hour, Keep: -3},
+			{Label: "daily", Interval: 24 * time.Hour, Keep: 7, MinRetention: -time.Hour},
+			{Label: "daily", Keep: 7},
+		},
+		ExcludePatterns: []string{"[", "*/cache"},
+		NameOrder:       "label-prefix",
+		Trim:            &trimConfig{},
+	}
+	err := conf.Validate()
+	errs, ok := err.(configErrors)
+	if !assert.True(t, ok, "%T: %v", err, err) {
+		return
+	}
+
+	var fields []string
+	for _, err := range errs {
+		if problem, ok := err.(configProblem); assert.True(t, ok, "%T: %v", err, err) {
+			fields = append(fields, problem.Field)
+		}
+	}
+	assert.Equal(t, []string{
+		"excludepatterns[0]",
+		"nameorder",
+		"trim.interval",
+		"series[0].label",
+		"series[0].keep",
+		"series[1].minretention",
+		"series[2].label",
+		"series[2].interval",
+	}, fields)
+	assert.Contains(t, err.Error(), `series[2].label: more than one series has label "daily"; `)
+}
+
+func TestFastIntervals(t *testing.T) {
+	for _, tt := range []struct {
+		interval         time.Duration
+		writtenThreshold uint64
+		fast             bool
+	}{
+		{10 * time.Second, 0, true},
+		{59 * time.Second, 0, true},
+		{time.Minute, 0, false},
+		{time.Hour, 0, false},
+		{0, 1 << 30, false},
+		{10 * time.Second, 1 << 30, true},
+	} {
+		conf := &configFile{Series: []seriesConfig{
+			{Label: "daily", Interval: 24 * time.Hour, Keep: 7},
+			{Label: "test", Interval: tt.interval, WrittenThreshold: tt.writtenThreshold, Keep: 3},
+		}}
+		errs := conf.fastIntervals(time.Minute)
+		if !tt.fast {
+			assert.Empty(t, errs, "%v", tt.interval)
+		} else if assert.Len(t, errs, 1, "%v", tt.interval) {
+			assert.Equal(t, "series[1].interval", errs[0].(configProblem).Field)
+		}
+	}
+}
+
+func TestCheckIntervals(t *testing.T) {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	tool := &Tool{l: l}
+	conf := &configFile{Series: []seriesConfig{{Label: "tensec", Interval: 10 * time.Second, Keep: 3}}}
+
+	err := tool.checkIntervals(conf)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `series[0].interval: series "tensec" has interval 10s`)
+	}
+
+	*minInterval = 5 * time.Second
+	assert.NoError(t, tool.checkIntervals(conf))
+	*minInterval = time.Minute
+
+	// With -allow-fast-intervals, the series is only warned about.
+	*allowFastIntervals = true
+	assert.NoError(t, tool.checkIntervals(conf))
+	*allowFastIntervals = false
+}
+
+func TestValidateKeep(t *testing.T) {
+	for _, tt := range []struct {
+		keep  int
+		valid bool
+	}{
+		{-2, false},
+		{-1, true},
+		{0, true},
+		{3, true},
+	} {
+		err := (&configFile{Series: []seriesConfig{{Label: "daily", Interval: time.Hour, Keep: tt.keep}}}).Validate()
+		assert.Equal(t, tt.valid, err == nil, "keep: %d", tt.keep)
+	}
+}
+
+func TestValidateWrittenThreshold(t *testing.T) {
+	for _, tt := range []struct {
+		interval  time.Duration
+		threshold uint64
+		valid     bool
+	}{
+		{time.Hour, 0, true},
+		{0, 0, false},
+		{0, 1 << 30, true},
+		{time.Hour, 1 << 30, true},
+		{-time.Hour, 1 << 30, false},
+	} {
+		err := (&configFile{Series: []seriesConfig{
+			{Label: "daily", Interval: tt.interval, Keep: 3, WrittenThreshold: tt.threshold}}}).Validate()
+		assert.Equal(t, tt.valid, err == nil, "interval: %v, writtenthreshold: %d", tt.interval, tt.threshold)
+	}
+}
+
+func TestConfigExcludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zfs-auto-snapshot-test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+
+	write := func(conf string) {
+		assert.NoError(t, ioutil.WriteFile(path, []byte(conf), 0644))
+	}
+
+	write(`
+series:
+  - label: daily
+    interval: 24h
+    keep: 7
+excludepatterns:
+  - "*/cache"
+excluderegexps:
+  - "^tank/(tmp|scratch)$"
+`)
+	conf, err := loadConfig(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	targets := make(map[string]zfs.Dataset)
+	for _, name := range []string{"tank", "tank/cache", "tank/cache/thumbs", "tank/home", "tank/home/cache", "tank/tmp",
+		"tank/tmpfiles", "tank/scratch/a"} {
+		targets[name] = zfs.Dataset{}
+	}
+	excludeSubtrees(targets, conf.excludes)
+
+	var remaining []string
+	for name := range targets {
+		remaining = append(remaining, name)
+	}
+	sort.Strings(remaining)
+	// "*" does not match "/", so tank/home/cache is not matched by "*/cache".
+	assert.Equal(t, []string{"tank", "tank/home", "tank/home/cache", "tank/tmpfiles"}, remaining)
+
+	write("excluderegexps:\n  - \"tank/(\"\n")
+	_, err = loadConfig(path)
+	assert.Error(t, err)
+
+	write("excludepatterns:\n  - \"tank/[\"\n")
+	_, err = loadConfig(path)
+	assert.Error(t, err)
+}
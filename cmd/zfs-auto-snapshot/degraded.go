@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/kelleyk/zfstools"
+)
+
+// mainDegraded is run in place of the rest of Main when libzfs is not available (e.g. because the installed library
+// does not match the kernel module).  It manages the snapshots of the datasets named in names using only the
+// operations provided by b, one dataset at a time.  The flags that need more than those operations are rejected (see
+// degradedUnsupported).  Pools that are being scanned are not detected, so -skip-scrub has no effect; nor are
+// space-pressure pruning, scheduled trims, per-dataset keep properties, or series with a writtenthreshold (which are
+// skipped) supported.  Snapshots with holds or clones cannot be destroyed, and the attempt fails.
+func (tool *Tool) mainDegraded(b Backend, names []string) error {
+	if err := degradedUnsupported(); err != nil {
+		return err
+	}
+	if *configPath == "" {
+		return fmt.Errorf("no config file path given")
+	}
+	conf, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	tool.legacyFormats = conf.LegacyTimestampFormats
+	tool.nameOrder = zfstools.NameOrder(conf.NameOrder)
+	tool.sep = *sep
+	if errs := conf.labelsContaining(tool.sep); len(errs) != 0 {
+		return configErrors(errs)
+	}
+	if err := tool.checkIntervals(conf); err != nil {
+		return err
+	}
+	if conf.Trim != nil {
+		tool.l.Warn("trims are not scheduled without libzfs")
+	}
+
+	datasets, err := tool.degradedDatasets(b, names, conf)
+	if err != nil {
+		return err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	tool.l.WithFields(logrus.Fields{"datasets": len(datasets)}).Info("examining selected datasets")
+	manage := tool.shutdown.track(func(dsPath string) error {
+		return tool.manageDegraded(b, dsPath, resolvePolicy(conf.Policies, dsPath, conf.Series), hostname)
+	})
+	for _, dsPath := range datasets {
+		if err := manage(dsPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// degradedUnsupported returns an error naming the first of the flags that mainDegraded cannot honor that is given, so
+// that no dataset that they would exclude or snapshot that they would protect is touched.
+func degradedUnsupported() error {
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"-retention-preview", *retentionPreview > 0},
+		{"-reclaimable", *reclaimableFlag},
+		{"-roots-only", *rootsOnly},
+		{"-include-clones", *includeClones},
+		{"-where", len(whereFlags) != 0},
+		{"-exclude-mountpoint", len(excludeMountpointFlags) != 0},
+		{"-state-db", *stateDBPath != ""},
+		{"-protect-backup-base", *protectBase},
+		{"-property-template", *propertyTemplate != ""},
+	} {
+		if f.set {
+			return fmt.Errorf("%s is not available without libzfs", f.name)
+		}
+	}
+	return nil
+}
+
+// degradedDatasets returns the names of the datasets selected by names (see selectDatasets), less those excluded by
+// -pool, -exclude, the configuration file, or AutoSnapshotProperty, and those that are being received into or are on
+// read-only pools.
+func (tool *Tool) degradedDatasets(b Backend, names []string, conf *configFile) ([]string, error) {
+	if len(names) == 0 {
+		return nil, errors.New("filesystem argument list is empty")
+	}
+	roots := names
+	if len(names) == 1 && names[0] == "//" {
+		roots = nil
+	} else {
+		for _, name := range names {
+			if name == "//" {
+				return nil, errors.New("the // must be the only argument if it is given")
+			}
+		}
+	}
+
+	listed, err := b.List(roots, *recursive && roots != nil)
+	if err != nil {
+		return nil, err
+	}
+	targetDatasets := make(map[string]zfs.Dataset)
+	for _, d := range listed {
+		targetDatasets[d.Name] = zfs.Dataset{}
+	}
+	if len(poolFlags) > 0 {
+		pools := make(map[string]bool)
+		for _, pool := range poolFlags {
+			// Each pool's root dataset has the pool's name.
+			if listed, err := b.List([]string{pool}, false); err != nil || len(listed) == 0 {
+				return nil, fmt.Errorf("-pool: no such pool: %v", pool)
+			}
+			pools[pool] = true
+		}
+		for _, path := range keepPools(targetDatasets, pools) {
+			tool.l.WithFields(logrus.Fields{"dataset": path, "pool": poolName(path)}).Debug("excluded by -pool")
+		}
+	}
+
+	excludeNames := make(map[string]bool)
+	for _, name := range excludeFlags {
+		excludeNames[name] = true
+	}
+	excludeSubtrees(targetDatasets, func(name string) bool {
+		return excludeNames[name] || conf.excludes(name)
+	})
+	for _, d := range listed {
+		if _, ok := targetDatasets[d.Name]; !ok {
+			continue
+		}
+		if d.Receiving {
+			tool.l.WithFields(logrus.Fields{"dataset": d.Name}).Warn(
+				"dataset skipped because a receive into it is in progress")
+			delete(targetDatasets, d.Name)
+			continue
+		}
+		if tool.excludedByProperty(d.Name, d.AutoSnapshot, d.AutoSnapshotSet, *defaultExclude) {
+			tool.l.WithFields(logrus.Fields{"dataset": d.Name}).Debug("excluded")
+			delete(targetDatasets, d.Name)
+		}
+	}
+
+	selected := datasetNames(targetDatasets)
+	readonly, err := readonlyDatasets(selected, b.PoolReadonly)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range selected {
+		if readonly[path] {
+			tool.l.WithFields(logrus.Fields{"dataset": path, "pool": poolName(path)}).Info(
+				"dataset skipped because its pool is imported read-only")
+			delete(targetDatasets, path)
+		}
+	}
+	return datasetNames(targetDatasets), nil
+}
+
+// manageDegraded is the equivalent of manageSnapshots for mainDegraded.  The series of snapshots that predate
+// AutoSnapshotSeriesProperty are not recorded, since b cannot set properties on existing snapshots.
+func (tool *Tool) manageDegraded(b Backend, dsPath string, series []seriesConfig, hostname string) (err error) {
+	// Datasets are managed one at a time, so tool.mu need not be held.
+	if tool.summary != nil {
+		defer func() {
+			tool.summary.record(dsPath, 0, 0, err)
+		}()
+	}
+
+	listed, err := b.Snapshots(dsPath)
+	if err != nil {
+		return err
+	}
+	var tagged []taggedSnapshot
+	for _, snap := range listed {
+		meta, err := zfstools.ParseSnapNameSep(tool.nameOrder, tool.sep, *prefix, snap.Path, tool.legacyFormats...)
+		if err != nil {
+			// Most likely taken by hand or by another tool; see -report-unparsed.
+			tool.l.WithFields(logrus.Fields{"snapshot": snap.Path}).WithError(err).Debug(
+				"skipping snapshot whose name cannot be parsed")
+			continue
+		}
+		if meta != nil {
+			tagged = append(tagged, taggedSnapshot{meta: meta, series: snap.Series})
+		}
+	}
+
+	var createErr error
+	for _, s := range series {
+		if s.WrittenThreshold != 0 {
+			tool.l.WithFields(logrus.Fields{"dataset": dsPath, "series": s.Label}).Warn(
+				"series skipped, since writtenthreshold is not supported without libzfs")
+			continue
+		}
+		tool.l.WithFields(logrus.Fields{"dataset": dsPath, "series": s.Label}).Info("managing snapshots")
+
+		snaps, _ := selectSeries(tagged, s)
+		if snaps == nil {
+			snaps = []*zfstools.SnapMetadata{}
+		}
+		sort.Sort(zfstools.ByTS(snaps))
+
+		created, removed := 0, 0
+		now := time.Now()
+		create := func(meta *zfstools.SnapMetadata) error {
+			userProps, err := snapshotUserProps(s, meta, hostname)
+			if err != nil {
+				return err
+			}
+			guid, creation, err := b.Snapshot(meta.Path(), userProps)
+			if err != nil {
+				return err
+			}
+			if tool.status != nil {
+				tool.status.recordCreated(meta, guid, creation)
+			}
+			created++
+			return nil
+		}
+		remove := func(snaps []*zfstools.SnapMetadata) error {
+			if !tool.allowDestroy {
+				for _, snap := range snaps {
+					tool.l.WithFields(logrus.Fields{"snapshot": snap.Path()}).Info("snapshot would be removed")
+				}
+				if tool.dryRun {
+					tool.plan.addRemove(snaps)
+				}
+				return nil
+			}
+			for _, snap := range snaps {
+				tool.l.WithFields(logrus.Fields{"snapshot": snap.Path()}).Info("destroying snapshot")
+				if err := b.Destroy(snap.Path()); err != nil {
+					return err
+				}
+				removed++
+			}
+			return nil
+		}
+
+		if *destroyOnly {
+			create = nil
+		}
+
+		err := tool.manageSeries(dsPath, s, snaps, now, nil, create, remove)
+		if tool.status != nil {
+			tool.status.recordSeries(dsPath, s.Label, now, created, removed, err)
+			if saveErr := tool.status.save(); saveErr != nil {
+				tool.l.WithError(saveErr).Warn("failed to write status file")
+			}
+		}
+		if tool.summary != nil {
+			tool.summary.record(dsPath, created, removed, nil)
+		}
+		if err != nil {
+			if _, ok := err.(*createError); !ok {
+				return err
+			}
+			if createErr == nil {
+				createErr = err
+			}
+		}
+	}
+
+	return createErr
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBackend is a Backend whose datasets and snapshots are kept in memory.
+type fakeBackend struct {
+	datasets []backendDataset
+	snaps    map[string][]backendSnapshot // by dataset
+	fail     map[string]bool              // snapshots that cannot be destroyed
+	readonly map[string]bool              // pools that are imported read-only
+}
+
+func (f *fakeBackend) List(roots []string, recursive bool) ([]backendDataset, error) {
+	var listed []backendDataset
+	for _, d := range f.datasets {
+		for _, root := range roots {
+			if d.Name == root || (recursive && strings.HasPrefix(d.Name, root+"/")) {
+				listed = append(listed, d)
+				break
+			}
+		}
+		if roots == nil {
+			listed = append(listed, d)
+		}
+	}
+	return listed, nil
+}
+
+func (f *fakeBackend) Snapshots(dataset string) ([]backendSnapshot, error) {
+	return f.snaps[dataset], nil
+}
+
+func (f *fakeBackend) Snapshot(path string, userProps map[string]string) (uint64, time.Time, error) {
+	dataset := path[:strings.Index(path, "@")]
+	f.snaps[dataset] = append(f.snaps[dataset], backendSnapshot{Path: path, Series: userProps[AutoSnapshotSeriesProperty]})
+	return 1, time.Now(), nil
+}
+
+func (f *fakeBackend) Destroy(path string) error {
+	if f.fail[path] {
+		return errors.New("snapshot has dependent clones")
+	}
+	dataset := path[:strings.Index(path, "@")]
+	for i, snap := range f.snaps[dataset] {
+		if snap.Path == path {
+			f.snaps[dataset] = append(f.snaps[dataset][:i], f.snaps[dataset][i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("no such snapshot")
+}
+
+func (f *fakeBackend) PoolReadonly(pool string) (bool, error) {
+	return f.readonly[pool], nil
+}
+
+func (f *fakeBackend) snapshotNames(dataset string) []string {
+	var names []string
+	for _, snap := range f.snaps[dataset] {
+		names = append(names, snap.Path)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestDegradedDatasets(t *testing.T) {
+	b := &fakeBackend{datasets: []backendDataset{
+		{Name: "tank"},
+		{Name: "tank/a", AutoSnapshot: "false", AutoSnapshotSet: true},
+		{Name: "tank/b"},
+		{Name: "tank/cache"},
+		{Name: "tank/recv", Receiving: true},
+		{Name: "tank2", AutoSnapshot: "true", AutoSnapshotSet: true},
+		{Name: "backup"},
+	}, readonly: map[string]bool{"backup": true}}
+	conf := &configFile{ExcludePatterns: []string{"*/cache"}}
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	tool := &Tool{l: l}
+
+	for _, tt := range []struct {
+		names     []string
+		recursive bool
+		selected  []string
+	}{
+		{[]string{"//"}, false, []string{"tank", "tank/b", "tank2"}},
+		{[]string{"tank"}, false, []string{"tank"}},
+		{[]string{"tank"}, true, []string{"tank", "tank/b"}},
+	} {
+		*recursive = tt.recursive
+		selected, err := tool.degradedDatasets(b, tt.names, conf)
+		if assert.NoError(t, err, "%v", tt.names) {
+			assert.Equal(t, tt.selected, selected, "%v recursive=%v", tt.names, tt.recursive)
+		}
+	}
+	*recursive = false
+
+	_, err := tool.degradedDatasets(b, nil, conf)
+	assert.Error(t, err)
+	_, err = tool.degradedDatasets(b, []string{"tank", "//"}, conf)
+	assert.Error(t, err)
+
+	// -pool keeps only the datasets on the pools named, which must exist.
+	defer func() { poolFlags = nil }()
+	poolFlags = stringsFlag{"tank2"}
+	selected, err := tool.degradedDatasets(b, []string{"//"}, conf)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"tank2"}, selected)
+	}
+	poolFlags = stringsFlag{"nosuchpool"}
+	_, err = tool.degradedDatasets(b, []string{"//"}, conf)
+	assert.Error(t, err)
+}
+
+func TestDegradedUnsupported(t *testing.T) {
+	assert.NoError(t, degradedUnsupported())
+	for _, tt := range []struct {
+		flag  string
+		set   func()
+		reset func()
+	}{
+		{"-retention-preview", func() { *retentionPreview = time.Hour }, func() { *retentionPreview = 0 }},
+		{"-reclaimable", func() { *reclaimableFlag = true }, func() { *reclaimableFlag = false }},
+		{"-roots-only", func() { *rootsOnly = true }, func() { *rootsOnly = false }},
+		{"-include-clones", func() { *includeClones = true }, func() { *includeClones = false }},
+		{"-where", func() { whereFlags = stringsFlag{"compression=lz4"} }, func() { whereFlags = nil }},
+		{"-exclude-mountpoint", func() { excludeMountpointFlags = stringsFlag{"/tmp"} },
+			func() { excludeMountpointFlags = nil }},
+		{"-state-db", func() { *stateDBPath = "/var/lib/state" }, func() { *stateDBPath = "" }},
+		{"-protect-backup-base", func() { *protectBase = true }, func() { *protectBase = false }},
+		{"-property-template", func() { *propertyTemplate = "tank" }, func() { *propertyTemplate = "" }},
+	} {
+		tt.set()
+		err := degradedUnsupported()
+		tt.reset()
+		if assert.Error(t, err, tt.flag) {
+			assert.Contains(t, err.Error(), tt.flag)
+		}
+	}
+	assert.NoError(t, degradedUnsupported())
+}
+
+func TestManageDegraded(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	old := func(days int) backendSnapshot {
+		ts := now.AddDate(0, 0, -days).Format(time.RFC3339)
+		return backendSnapshot{Path: "tank@zfs-auto-snap_daily_" + ts, Series: "daily"}
+	}
+	b := &fakeBackend{snaps: map[string][]backendSnapshot{
+		"tank": {old(3), old(2), old(1), {Path: "tank@manual"}},
+	}}
+	series := []seriesConfig{
+		{Label: "daily", Interval: 24 * time.Hour, Keep: 2},
+		{Label: "churn", WrittenThreshold: 1 << 30, Keep: 10},
+	}
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	tool := &Tool{l: l, allowCreate: true, allowDestroy: true, summary: newRunSummary()}
+
+	// A new daily snapshot is taken and the two oldest are destroyed; the series with a writtenthreshold is skipped.
+	if assert.NoError(t, tool.manageDegraded(b, "tank", series, "host")) {
+		assert.Equal(t, map[string]*runStats{"tank": {created: 1, destroyed: 2}}, tool.summary.datasets)
+		names := b.snapshotNames("tank")
+		assert.Equal(t, 3, len(names), "%v", names)
+		assert.Contains(t, names, old(1).Path)
+		assert.Contains(t, names, "tank@manual")
+		assert.NotContains(t, names, old(2).Path)
+		assert.NotContains(t, names, old(3).Path)
+		for _, snap := range b.snaps["tank"] {
+			assert.False(t, strings.Contains(snap.Path, "_churn_"), snap.Path)
+		}
+	}
+
+	// A snapshot that cannot be destroyed fails the run.
+	b = &fakeBackend{
+		snaps: map[string][]backendSnapshot{"tank": {old(3), old(2), old(1)}},
+		fail:  map[string]bool{old(3).Path: true},
+	}
+	tool.summary = newRunSummary()
+	assert.Error(t, tool.manageDegraded(b, "tank", series[:1], "host"))
+	if st := tool.summary.datasets["tank"]; assert.NotNil(t, st) {
+		assert.Error(t, st.err)
+	}
+	tool.summary = nil
+
+	// With -destroy-only, no snapshot is taken, so only the oldest is destroyed; with -dry-run, that is only reported.
+	defer func(prev bool) { *destroyOnly = prev }(*destroyOnly)
+	*destroyOnly = true
+	b = &fakeBackend{snaps: map[string][]backendSnapshot{"tank": {old(3), old(2), old(1)}}}
+	dryRunTool := &Tool{l: l, dryRun: true, plan: &plan{}}
+	if assert.NoError(t, dryRunTool.manageDegraded(b, "tank", series[:1], "host")) {
+		assert.Equal(t, []string{"-\ttank\tdaily\t" + old(3).Path}, dryRunTool.plan.lines())
+		assert.Equal(t, 3, len(b.snaps["tank"]))
+	}
+	if assert.NoError(t, tool.manageDegraded(b, "tank", series[:1], "host")) {
+		assert.Equal(t, []string{old(2).Path, old(1).Path}, b.snapshotNames("tank"))
+	}
+}
+
+// TestManageDegradedForeignSnapshot checks that a snapshot whose name looks like one of ours but cannot be parsed (e.g.
+// one taken by another tool) is skipped, rather than stopping the dataset's snapshots from being managed.
+func TestManageDegradedForeignSnapshot(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	old := func(days int) backendSnapshot {
+		ts := now.AddDate(0, 0, -days).Format(time.RFC3339)
+		return backendSnapshot{Path: "tank@zfs-auto-snap_daily_" + ts, Series: "daily"}
+	}
+	foreign := backendSnapshot{Path: "tank@zfs-auto-snap_daily_2016-13-45T00:00:00Z"}
+	b := &fakeBackend{snaps: map[string][]backendSnapshot{"tank": {old(2), foreign, old(1)}}}
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	tool := &Tool{l: l, allowCreate: true, allowDestroy: true}
+
+	if assert.NoError(t, tool.manageDegraded(b, "tank", []seriesConfig{{Label: "daily", Interval: 24 * time.Hour,
+		Keep: 2}}, "host")) {
+		names := b.snapshotNames("tank")
+		assert.Equal(t, 3, len(names), "%v", names)
+		assert.Contains(t, names, foreign.Path)
+		assert.Contains(t, names, old(1).Path)
+		assert.NotContains(t, names, old(2).Path)
+	}
+}
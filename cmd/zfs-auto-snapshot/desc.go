@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"text/template"
+	"time"
+
+	"github.com/kelleyk/zfstools"
+)
+
+// descData is the data that a series' DescTemplate is rendered with.
+type descData struct {
+	Label    string
+	Dataset  string
+	Hostname string
+	Time     time.Time
+}
+
+// renderDesc renders the snapshot description template tmpl (see text/template) with data.
+func renderDesc(tmpl string, data descData) (string, error) {
+	t, err := template.New("desc").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// snapshotUserProps returns the user properties that should be set on the new snapshot described by meta, which
+// belongs to the series s.
+func snapshotUserProps(s seriesConfig, meta *zfstools.SnapMetadata, hostname string) (map[string]string, error) {
+	userProps := map[string]string{AutoSnapshotSeriesProperty: s.seriesID()}
+	if s.DescTemplate != "" {
+		desc, err := renderDesc(s.DescTemplate, descData{
+			Label:    meta.Label,
+			Dataset:  meta.Dataset,
+			Hostname: hostname,
+			Time:     meta.TS,
+		})
+		if err != nil {
+			return nil, err
+		}
+		userProps[AutoSnapshotDescProperty] = desc
+	}
+	return userProps, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotUserProps(t *testing.T) {
+	meta := &zfstools.SnapMetadata{
+		Dataset: "tank/data",
+		Prefix:  "zfs-auto-snap",
+		Label:   "daily",
+		TS:      time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	s := seriesConfig{Label: "daily", DescTemplate: `auto {{.Label}} of {{.Dataset}} on {{.Hostname}} at {{.Time.Format "2006-01-02"}}`}
+	props, err := snapshotUserProps(s, meta, "nas")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		AutoSnapshotDescProperty:   "auto daily of tank/data on nas at 2016-01-02",
+		AutoSnapshotSeriesProperty: "daily",
+	}, props)
+
+	// Without a template, no description is set; the series is recorded by ID if the series has one.
+	props, err = snapshotUserProps(seriesConfig{Label: "day", ID: "daily"}, meta, "nas")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{AutoSnapshotSeriesProperty: "daily"}, props)
+}
+
+func TestValidateDescTemplate(t *testing.T) {
+	for _, tt := range []struct {
+		tmpl string
+		ok   bool
+	}{
+		{"auto {{.Label}} on {{.Hostname}}", true},
+		{"auto {{.Label}", false},  // doesn't parse
+		{"auto {{.Event}}", false}, // no such field
+	} {
+		c := &configFile{Series: []seriesConfig{{Label: "daily", Interval: time.Hour, Keep: 1, DescTemplate: tt.tmpl}}}
+		if tt.ok {
+			assert.NoError(t, c.Validate(), tt.tmpl)
+		} else {
+			assert.Error(t, c.Validate(), tt.tmpl)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+)
+
+var (
+	// freezeFS and thawFS freeze and thaw the filesystem mounted at the given path.  They are variables so that tests
+	// can replace them.
+	freezeFS = fsFreeze
+	thawFS   = fsThaw
+)
+
+// withFrozenFS freezes the filesystem mounted at mountpoint, calls f, and then thaws the filesystem.  The filesystem
+// is thawed even if f fails.  If f is not called because the filesystem could not be frozen, the error from freezing
+// is returned.
+func withFrozenFS(mountpoint string, f func() error) (err error) {
+	if err := freezeFS(mountpoint); err != nil {
+		return fmt.Errorf("failed to freeze filesystem at %s: %v", mountpoint, err)
+	}
+	defer func() {
+		if thawErr := thawFS(mountpoint); thawErr != nil && err == nil {
+			err = fmt.Errorf("failed to thaw filesystem at %s: %v", mountpoint, thawErr)
+		}
+	}()
+
+	return f()
+}
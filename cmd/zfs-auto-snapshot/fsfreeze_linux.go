@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// These are _IOWR('X', 119, int) and _IOWR('X', 120, int) from <linux/fs.h>.
+const (
+	ioctlFIFREEZE = 0xc0045877
+	ioctlFITHAW   = 0xc0045878
+)
+
+func fsFreeze(mountpoint string) error {
+	return fsIoctl(mountpoint, ioctlFIFREEZE)
+}
+
+func fsThaw(mountpoint string) error {
+	return fsIoctl(mountpoint, ioctlFITHAW)
+}
+
+func fsIoctl(mountpoint string, req uintptr) error {
+	f, err := os.Open(mountpoint)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
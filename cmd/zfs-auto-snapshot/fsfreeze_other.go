@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+var errFreezeUnsupported = errors.New("freezing filesystems is only supported on Linux")
+
+func fsFreeze(mountpoint string) error {
+	return errFreezeUnsupported
+}
+
+func fsThaw(mountpoint string) error {
+	return errFreezeUnsupported
+}
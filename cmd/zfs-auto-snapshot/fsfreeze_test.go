@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithFrozenFS(t *testing.T) {
+	defer func(freeze, thaw func(string) error) {
+		freezeFS, thawFS = freeze, thaw
+	}(freezeFS, thawFS)
+
+	errFail := errors.New("injected failure")
+
+	for _, tt := range []struct {
+		desc                         string
+		freezeErr, snapErr, thawErr  error
+		expectSnapshot, expectThawed bool
+		expectErr                    bool
+	}{
+		{"success", nil, nil, nil, true, true, false},
+		{"snapshot fails", nil, errFail, nil, true, true, true},
+		{"freeze fails", errFail, nil, nil, false, false, true},
+		{"thaw fails", nil, nil, errFail, true, true, true},
+	} {
+		var calls []string
+		freezeFS = func(mountpoint string) error {
+			calls = append(calls, "freeze "+mountpoint)
+			return tt.freezeErr
+		}
+		thawFS = func(mountpoint string) error {
+			calls = append(calls, "thaw "+mountpoint)
+			return tt.thawErr
+		}
+
+		err := withFrozenFS("/mnt/foo", func() error {
+			calls = append(calls, "snapshot")
+			return tt.snapErr
+		})
+		assert.Equal(t, tt.expectErr, err != nil, tt.desc)
+
+		expected := []string{"freeze /mnt/foo"}
+		if tt.expectSnapshot {
+			expected = append(expected, "snapshot")
+		}
+		if tt.expectThawed {
+			expected = append(expected, "thaw /mnt/foo")
+		}
+		assert.Equal(t, expected, calls, tt.desc)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultGuardTimeout is how long a guard's command may run if its Timeout is not given.
+const defaultGuardTimeout = time.Minute
+
+// guardConfig gates the creation of a series' snapshots on an external condition (see seriesConfig.Guard), e.g. an
+// application signaling that its data is in a consistent state.  Snapshots that are not taken because of a guard do
+// not count as failures, and the series' existing snapshots are still pruned as usual.
+type guardConfig struct {
+	// File, if not empty, is the path of a file that must exist for a snapshot to be taken.
+	File string
+
+	// Command, if not empty, is run with `sh -c` and must exit successfully for a snapshot to be taken.
+	Command string
+
+	// Timeout is how long Command may run before it is killed and considered to have failed; the default is one
+	// minute.
+	Timeout time.Duration
+}
+
+// check returns nil if g allows snapshots to be taken, or an error that explains why it does not.
+func (g *guardConfig) check() error {
+	if g.File != "" {
+		if _, err := os.Stat(g.File); err != nil {
+			return fmt.Errorf("guard file: %v", err)
+		}
+	}
+	if g.Command == "" {
+		return nil
+	}
+
+	timeout := g.Timeout
+	if timeout == 0 {
+		timeout = defaultGuardTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", g.Command)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %v", timeout)
+		}
+		return fmt.Errorf("guard command %q: %v: %s", g.Command, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// guardResults remembers the result of checking each guard, so that a guard is checked at most once per run, however
+// many datasets its series applies to.
+type guardResults struct {
+	mu      sync.Mutex
+	results map[*guardConfig]error
+}
+
+func newGuardResults() *guardResults {
+	return &guardResults{results: make(map[*guardConfig]error)}
+}
+
+// check returns the result of g.check, which is called only the first time that g is given.  It is safe to call from
+// more than one goroutine; concurrent callers wait for the guard to be checked.
+func (r *guardResults) check(g *guardConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err, ok := r.results[g]; ok {
+		return err
+	}
+	err := g.check()
+	r.results[g] = err
+	return err
+}
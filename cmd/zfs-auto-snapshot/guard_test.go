@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuardCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zfs-auto-snapshot-test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	marker := filepath.Join(dir, "ready")
+
+	assert.NoError(t, (&guardConfig{Command: "true"}).check())
+	err = (&guardConfig{Command: "echo not ready >&2; exit 3"}).check()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "not ready")
+	}
+	err = (&guardConfig{Command: "exec sleep 5", Timeout: 10 * time.Millisecond}).check()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "timed out")
+	}
+
+	assert.Error(t, (&guardConfig{File: marker}).check())
+	assert.NoError(t, ioutil.WriteFile(marker, nil, 0644))
+	assert.NoError(t, (&guardConfig{File: marker}).check())
+	// Both the file and the command must be satisfied.
+	assert.Error(t, (&guardConfig{File: marker, Command: "false"}).check())
+}
+
+func TestGuardResults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zfs-auto-snapshot-test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	runs := filepath.Join(dir, "runs")
+
+	g := &guardConfig{Command: "echo run >> " + runs}
+	r := newGuardResults()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, r.check(g))
+	}
+	data, err := ioutil.ReadFile(runs)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), "run"), "the guard should be checked once per run")
+}
+
+func TestManageSeriesGuard(t *testing.T) {
+	now := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	l := logrus.New()
+	l.Out = ioutil.Discard
+
+	for _, tt := range []struct {
+		command string
+		created bool
+	}{
+		{"true", true},
+		{"false", false},
+	} {
+		tool := &Tool{l: l, allowCreate: true, allowDestroy: true, guards: newGuardResults()}
+		s := seriesConfig{Label: "daily", Interval: 24 * time.Hour, Keep: 3, Guard: &guardConfig{Command: tt.command}}
+
+		var created bool
+		var removed []*zfstools.SnapMetadata
+		err := tool.manageSeries("tank", s, dailySnaps(now.Add(-24*time.Hour), 4), now, nil,
+			func(*zfstools.SnapMetadata) error { created = true; return nil },
+			func(snaps []*zfstools.SnapMetadata) error { removed = append(removed, snaps...); return nil })
+		assert.NoError(t, err, tt.command)
+		assert.Equal(t, tt.created, created, tt.command)
+		// Pruning is not affected by the guard, other than by the snapshot that it prevents.
+		if tt.created {
+			assert.Equal(t, 2, len(removed), tt.command)
+		} else {
+			assert.Equal(t, 1, len(removed), tt.command)
+		}
+	}
+}
+
+func TestValidateGuard(t *testing.T) {
+	daily := seriesConfig{Label: "daily", Interval: 24 * time.Hour, Keep: 7}
+	for _, tt := range []struct {
+		guard *guardConfig
+		field string
+	}{
+		{&guardConfig{Command: "true"}, ""},
+		{&guardConfig{File: "/run/app/ready"}, ""},
+		{&guardConfig{}, "series[0].guard"},
+		{&guardConfig{Command: "true", Timeout: -time.Second}, "series[0].guard.timeout"},
+	} {
+		s := daily
+		s.Guard = tt.guard
+		err := (&configFile{Series: []seriesConfig{s}}).Validate()
+		if tt.field == "" {
+			assert.NoError(t, err)
+		} else if errs, ok := err.(configErrors); assert.True(t, ok, tt.field) && assert.Len(t, errs, 1) {
+			assert.Equal(t, tt.field, errs[0].(configProblem).Field)
+		}
+	}
+}
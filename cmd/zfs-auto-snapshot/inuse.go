@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// snapshotRegistry records the snapshots that this process is sending (as the source of a send stream or the base of
+// an incremental one), so that they are not destroyed while the stream is being written, and the snapshots that it is
+// destroying, so that a send cannot start from one of them.  It complements holds, which protect snapshots from other
+// processes.
+type snapshotRegistry struct {
+	mu         sync.Mutex
+	sending    map[string]int // full snapshot name -> number of sends using it
+	destroying map[string]bool
+}
+
+// inUse is the registry of the snapshots that this process is using.
+var inUse = newSnapshotRegistry()
+
+func newSnapshotRegistry() *snapshotRegistry {
+	return &snapshotRegistry{sending: make(map[string]int), destroying: make(map[string]bool)}
+}
+
+// beginSend registers the named snapshots (full names) as being sent.  The caller must call the returned function once
+// the send has finished.  It fails if any of the snapshots is being destroyed.
+func (r *snapshotRegistry) beginSend(paths ...string) (func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, path := range paths {
+		if r.destroying[path] {
+			return nil, fmt.Errorf("snapshot %s is being destroyed", path)
+		}
+	}
+	for _, path := range paths {
+		r.sending[path]++
+	}
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for _, path := range paths {
+			if r.sending[path]--; r.sending[path] == 0 {
+				delete(r.sending, path)
+			}
+		}
+	}, nil
+}
+
+// beginDestroy registers the named snapshots as being destroyed and returns true, unless any of them is being sent, in
+// which case it returns false and registers none of them.  If it returns true, the caller must call endDestroy with the
+// same snapshots once they have been destroyed (or destroying them has failed).
+func (r *snapshotRegistry) beginDestroy(paths ...string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, path := range paths {
+		if r.sending[path] > 0 {
+			return false
+		}
+	}
+	for _, path := range paths {
+		r.destroying[path] = true
+	}
+	return true
+}
+
+func (r *snapshotRegistry) endDestroy(paths ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, path := range paths {
+		delete(r.destroying, path)
+	}
+}
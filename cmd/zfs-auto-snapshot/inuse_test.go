@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRegistry(t *testing.T) {
+	r := newSnapshotRegistry()
+	const base, snap, other = "tank@a", "tank@b", "tank@c"
+
+	// Simulate an incremental send from base to snap that runs concurrently with pruning.
+	started, finish, finished := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(finished)
+		done, err := r.beginSend(snap, base)
+		if !assert.NoError(t, err) {
+			close(started)
+			return
+		}
+		close(started)
+		<-finish
+		done()
+	}()
+	<-started
+
+	// While the send is in progress, neither of its snapshots can be destroyed, alone or along with others; other
+	// snapshots can be.
+	assert.False(t, r.beginDestroy(base))
+	assert.False(t, r.beginDestroy(snap))
+	assert.False(t, r.beginDestroy(other, snap))
+	if assert.True(t, r.beginDestroy(other)) {
+		// A send cannot start from a snapshot that is being destroyed.
+		_, err := r.beginSend(other)
+		assert.Error(t, err)
+		r.endDestroy(other)
+	}
+
+	// A second send of the same snapshot keeps it registered after the first finishes.
+	done, err := r.beginSend(snap)
+	if !assert.NoError(t, err) {
+		return
+	}
+	close(finish)
+	<-finished
+	assert.True(t, r.beginDestroy(base))
+	r.endDestroy(base)
+	assert.False(t, r.beginDestroy(snap))
+
+	done()
+	assert.True(t, r.beginDestroy(snap))
+	r.endDestroy(snap)
+	_, err = r.beginSend(snap)
+	assert.NoError(t, err)
+}
@@ -12,12 +12,19 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/kelleyk/go-libzfs"
+	"github.com/kelleyk/zfstools"
 )
 
 const (
@@ -28,32 +35,98 @@ const (
 	// N.B.: user properties are *always* strings; they can be up to 1024 characters.
 	//
 	AutoSnapshotProperty = "com.sun:auto-snapshot"
+
+	// AutoSnapshotDescProperty is the name of a property that is set on new snapshots to describe them; see the
+	// desctemplate configuration option.  The zfs-auto-snapshot script uses the same property for its --event option.
+	AutoSnapshotDescProperty = "com.sun:auto-snapshot-desc"
+
+	// AutoSnapshotSeriesProperty is the name of a property that is set on new snapshots to record the ID of the series
+	// that they belong to (see seriesConfig.ID), so that they remain in that series even if its label is changed.
+	AutoSnapshotSeriesProperty = "zfstools:auto-snapshot-series"
+
+	// AutoSnapshotKeepPropertyPrefix, followed by a series label (e.g. "zfstools:keep-hourly"), is the name of a
+	// property that overrides the series' keep setting for a dataset.  Like any user property, it is inherited, so it
+	// can be set on a pool's root dataset to change the default for every dataset on the pool.
+	AutoSnapshotKeepPropertyPrefix = "zfstools:keep-"
 )
 
 var (
-	logLevel = flag.String("log-level", "WARN", "XXX: write usage string")
-	help     = flag.Bool("help", false, "Print this usage message.")
+	logLevel  = flag.String("log-level", "WARN", "XXX: write usage string")
+	logFormat = flag.String("log-format", "text", "Format of log output; either \"text\" or \"json\".")
+	help      = flag.Bool("help", false, "Print this usage message.")
 
 	dryRun       = flag.Bool("dry-run", false, "Print actions without actually doing anything.  This flag overrides all other flags that enable or disable particular actions.")
+	diff         = flag.Bool("diff", false, "With -dry-run, print the snapshots that would be created and destroyed to stdout, in a stable format suitable for diff.")
+	output       = flag.String("output", "text", "With -dry-run, \"json\" prints a JSON document listing the snapshots that would be created and destroyed in each series of each dataset to stdout, and logs only errors; \"text\" logs them as usual.")
+	dryRunProbe  = flag.Bool("dry-run-probe", false, "Before a dry run, check that a snapshot of each selected dataset can actually be created and destroyed (e.g. that its pool is not out of space, and that the necessary permissions have been delegated) by creating and immediately destroying a probe snapshot.  Implies -dry-run.")
 	allowCreate  = flag.Bool("create", true, "Create new snapshots when appropriate (per configuration).")
 	allowDestroy = flag.Bool("destroy", true, "Destroy old snapshots when appropriate (per configuration).")
 
-	configPath = flag.String("config", "", "Path to configuration file.")
+	configPath  = flag.String("config", "", "Path to configuration file.")
+	autoLabel   = flag.Bool("auto-label", false, "Give each series in the configuration file that has no label one derived from its interval: \"hourly\" for 1h, \"daily\" for 24h, \"weekly\" for 168h, and e.g. \"every-90m\" otherwise.")
+	statusPath  = flag.String("status-file", "", "Path to a JSON file to which to write the status of each run (e.g. for monitoring).")
+	pushgateway = flag.String("pushgateway", "", "URL of a Prometheus Pushgateway to which to push metrics about each run.")
+	stateDBPath = flag.String("state-db", "", "Path to a file in which to record the snapshots that this tool creates.  When given, snapshots are found by consulting this file rather than by parsing snapshot names, except that the existing snapshots of a dataset that the file has no record of are found by their names and recorded.")
+
+	manifestPath   = flag.String("manifest", "", "Path to a file to which to write a manifest listing the snapshots created by each run (e.g. for a backup catalog).")
+	manifestFormat = flag.String("manifest-format", "json", "Format of the file given with -manifest: \"json\" or \"csv\".")
 
-	// TODO: implement me:
+	checkDelegation = flag.Bool("check-delegation", false, "With the \"check\" subcommand, also check that snapshot and destroy permissions can be delegated to the current user.")
+
+	// TODO: implement me (DescTemplate in the configuration file sets the same property):
 	// event = flag.String("event", "", "Set the com.sun:auto-snapshot-desc property to EVENT.")
 
 	recursive      = flag.Bool("recursive", false, "Snapshot named filesystem and all descendants.")
 	defaultExclude = flag.Bool("default-exclude", false, "Exclude datasets if com.sun:auto-snapshot is unset.")
+	pruneExcluded  = flag.Bool("prune-excluded", false, "Destroy old snapshots of excluded datasets (per configuration) without taking new ones.")
+	destroyOnly    = flag.Bool("destroy-only", false, "Only destroy old snapshots (per configuration), without taking new ones, e.g. to prune on a different schedule than snapshots are taken.  With -dry-run, the snapshots that would be destroyed are still reported.")
 	skipScrub      = flag.Bool("skip-scrub", true, "Do not snapshot filesystems in scrubbing pools.") // XXX: skip-scan instead?
+	createHold     = flag.String("create-with-hold", "", "Place a hold with this tag on each new snapshot (e.g. so that a backup tool can hold it in turn before it can be destroyed).  The hold is released when the snapshot is due to be destroyed.")
+	protectBase    = flag.Bool("protect-backup-base", false, "Never destroy the snapshot that the next zfs-backup of a dataset will be sent incrementally from.")
+	fsFreezeFlag   = flag.Bool("fsfreeze", false, "Freeze each mounted filesystem (with FIFREEZE) while its snapshot is taken.")
+	reportUnparsed = flag.Bool("report-unparsed", false, "Log the snapshots whose names contain the prefix but cannot be parsed (e.g. because of a typo).")
+	skipEmpty      = flag.Bool("skip-empty", false, "Do not snapshot datasets that reference no data at all.  Existing snapshots of such datasets are still destroyed as usual.")
+
+	spaceHighPct       = flag.Int("space-high-pct", 0, "If a pool's capacity is at least this percentage, destroy extra snapshots on it (see -space-low-pct and -space-emergency-keep).  0 disables this.")
+	spaceLowPct        = flag.Int("space-low-pct", 0, "When destroying extra snapshots, stop once the pool's capacity is below this percentage.  (default: the value of -space-high-pct)")
+	spaceEmergencyKeep = flag.Int("space-emergency-keep", 1, "When destroying extra snapshots, keep at least this many snapshots in each series.")
+	pruneStrategyFlag  = flag.String("prune-strategy", "oldest", "When destroying extra snapshots, the order in which to destroy them: \"oldest\" first, or those that would free the \"most-space\" first.")
+
+	parallelism        = flag.Int("parallelism", 1, "Manage the snapshots of at most this many datasets at once.  Experimental: libzfs is not safe for concurrent use, and every call goes through the one libzfs handle, so more than 1 risks misreported errors or worse.")
+	perPoolParallelism = flag.Int("per-pool-parallelism", 0, "Manage the snapshots of at most this many datasets on any one pool at once.  0 means no limit other than -parallelism.")
+
+	rootsOnly = flag.Bool("roots-only", false, "Instead of the datasets named on the command line, select only the root dataset of each imported pool (but not their descendants), e.g. for a quick safety net before maintenance.")
+
+	includeClones = flag.Bool("include-clones", false, "Also select the clones of each selected dataset (and their clones, and so on), and snapshot each dataset together with its clones, atomically.")
+
+	propertyTemplate = flag.String("property-template", "", "Give each new snapshot the user properties that are set locally on this dataset.  Native properties (e.g. compression) cannot be set on snapshots, and are skipped.")
+
+	minInterval        = flag.Duration("min-interval", time.Minute, "Refuse to run with a series whose interval is shorter than this, since it is likely a mistake (see -allow-fast-intervals).")
+	allowFastIntervals = flag.Bool("allow-fast-intervals", false, "Only warn about series whose interval is shorter than -min-interval.")
+
+	waitForPools    = flag.Duration("wait-for-pools", 0, "If no datasets can be opened at startup (e.g. because pools are still being imported at boot), keep trying, with backoff, for up to this long.  0 means not to wait.")
+	shutdownTimeout = flag.Duration("shutdown-timeout", time.Minute, "When asked to exit (with SIGTERM or SIGINT), start no new work, but wait up to this long for the snapshots (or send stream) in progress to finish before exiting anyway.")
+
+	retentionPreview = flag.Duration("retention-preview", 0, "Instead of managing snapshots, print a timeline of the snapshots that would be taken and destroyed over this long (e.g. \"720h\"), as though the tool were run at the interval of the most frequent series.  Implies -dry-run.")
+
+	sendIncr  = flag.String("send-incr", "", "After the run, write an incremental send stream between the two most recent snapshots in the series given by -send-label of the one dataset named to this file (\"-\" for stdout).  With -recursive, the stream includes the dataset's descendants.")
+	sendFull  = flag.String("send-full", "", "After the run, write a full send stream for the most recent snapshot in the series given by -send-label of the one dataset named to this file (\"-\" for stdout), e.g. to seed a replica.  With -recursive, the stream includes the dataset's descendants.")
+	sendLabel = flag.String("send-label", "", "The label of the series whose snapshots -send-incr or -send-full sends.  (default: the only series, if there is just one)")
+
+	reclaimableFlag = flag.Bool("reclaimable", false, "Instead of managing snapshots, print how much space destroying the snapshots that are beyond their series' retention would free on each dataset, largest first (e.g. to find runaway snapshot growth).  Implies -dry-run.")
 
 	// debug = flag.Bool("default", false, "Print debugging messages.")
-	// quiet   = flag.Bool("quiet", false, "Suppress warnings and notices at the console.")
+	quiet = flag.Bool("quiet", false, "Print the summary of the run only if a snapshot was created or destroyed, or a dataset could not be managed, e.g. so that cron sends mail only then.")
 	// syslog  = flag.Bool("syslog", false, "Write messages into the system log.")
 	// verbose = flag.Bool("verbose", false, "Print info messages.")
 	prefix = flag.String("prefix", "zfs-auto-snap", "XXX: write usage string")
 
-	// send-full, send-incr, sep
+	sep = flag.String("sep", zfstools.DefaultSep, "Separate the prefix, the label, and the timestamp in the names of snapshots with this character (\"_\" or \" \"), e.g. to recognize the snapshots taken by another tool.  Labels may not contain it.")
+
+	whereFlags             stringsFlag
+	excludeFlags           stringsFlag
+	excludeMountpointFlags stringsFlag
+	poolFlags              stringsFlag
 )
 
 type Tool struct {
@@ -62,17 +135,77 @@ type Tool struct {
 
 	rootDatasets   []zfs.Dataset
 	datasetsByName map[string]zfs.Dataset
+
+	// snapshotPaths contains the path of every snapshot that existed when the tool started.  destroyedSnapshots
+	// contains the path of every snapshot that the tool has since destroyed.
+	snapshotPaths      []string
+	destroyedSnapshots map[string]struct{}
+
+	// snapshotClones maps the path of each snapshot that has clones (when the tool started) to the value of its clones
+	// property; such snapshots cannot be destroyed.
+	snapshotClones map[string]string
+
+	// state is nil unless -state-db is given.
+	state *stateDB
+	// status is nil unless -status-file is given.
+	status *runStatus
+
+	// legacyFormats are the configured LegacyTimestampFormats, nameOrder the configured NameOrder, and sep the
+	// separator given with -sep.
+	legacyFormats []string
+	nameOrder     zfstools.NameOrder
+	sep           string
+
+	// policies are the configured Policies.
+	policies []policyConfig
+
+	// templateProps are the user properties read from the dataset given with -property-template.
+	templateProps map[string]string
+
+	// recursiveRoots are the datasets named on the command line with -recursive.
+	recursiveRoots []string
+
+	// groupMembers maps each dataset that is snapshotted along with others (its clones, with -include-clones, or its
+	// descendants, with -recursive) to those others.  groupCreated maps each of those others to the snapshots of it that
+	// have been created that way, and groupDestroyed to those that have been destroyed recursively along with a
+	// snapshot of the dataset (see removeSnapshots).
+	groupMembers   map[string][]string
+	groupCreated   map[string][]*zfstools.SnapMetadata
+	groupDestroyed map[string][]*zfstools.SnapMetadata
+
+	// dryRun is true if -dry-run was given; plan accumulates the changes that would have been made.
+	dryRun bool
+	plan   *plan
+
+	// parallel is true if more than one dataset may be managed at once (see -parallelism).  mu guards state, status,
+	// plan, and destroyedSnapshots while datasets are being managed.
+	parallel bool
+	mu       sync.Mutex
+
+	// shutdown is nil in tests; see handleShutdown.
+	shutdown *shutdown
+
+	// guards is nil in tests and retention previews, in which series' guards are assumed to be satisfied.
+	guards *guardResults
+
+	// summary is nil in tests; see runSummary.  mu guards it while datasets are being managed.
+	summary *runSummary
+
+	// spaceLowPct and pruneStrategy are the validated -space-low-pct and -prune-strategy; see spaceFlags.
+	spaceLowPct   int
+	pruneStrategy pruneStrategy
 }
 
 func main() {
-	var err error
-
+	flag.Var(&excludeFlags, "exclude", "Do not snapshot this dataset or its descendants, even if they are selected (e.g. with -recursive); may be given more than once.")
+	flag.Var(&poolFlags, "pool", "Only manage the snapshots of datasets on the pool with this name, even if others are selected (e.g. with \"//\"), e.g. so that each pool can have its own cron entry and configuration file; may be given more than once.")
+	flag.Var(&excludeMountpointFlags, "exclude-mountpoint", "Do not snapshot datasets whose mountpoint, or any directory that contains it, matches this glob (e.g. \"/var/lib/docker\"); may be given more than once.  Datasets that are not mounted at a path (e.g. whose mountpoint is \"legacy\" or \"none\") never match.")
+	flag.Var(&whereFlags, "where", "Only snapshot datasets whose properties satisfy this condition (e.g. \"compression=lz4\", \"mountpoint!=/tmp/*\"); may be given more than once.")
 	flag.Parse()
 
-	l := logrus.New()
-	l.Level, err = logrus.ParseLevel(*logLevel)
+	l, err := newLogger(os.Stderr, *logLevel, *logFormat)
 	if err != nil {
-		l.Fatal("failed to parse -log-level")
+		logrus.New().WithError(err).Fatal("failed to configure logging")
 	}
 
 	if *help {
@@ -82,17 +215,160 @@ func main() {
 		return
 	}
 
+	if flag.NArg() > 0 && flag.Arg(0) == "check" {
+		if !runChecks(os.Stdout, checkItems(defaultCheckEnv(*checkDelegation), *configPath)) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "validate" {
+		if !runValidate(os.Stdout, flag.Args()[1:]) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.NArg() > 0 && flag.Arg(0) == "send" {
+		sd := handleShutdown(l)
+		sd.begin()
+		err := runSend(os.Stdout, flag.Args()[1:])
+		sd.end()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *diff && !*dryRun {
+		l.Fatal("-diff requires -dry-run")
+	}
+	switch *output {
+	case "text":
+	case "json":
+		if !*dryRun || *diff {
+			l.Fatal("-output=json requires -dry-run, and may not be given with -diff")
+		}
+		// Only errors are logged, so that a wrapper can rely on the document alone.
+		if l.Level > logrus.ErrorLevel {
+			l.Level = logrus.ErrorLevel
+		}
+	default:
+		l.Fatalf("unexpected value for -output: %q", *output)
+	}
+	if *retentionPreview > 0 || *reclaimableFlag || *dryRunProbe {
+		*dryRun = true
+	}
+	if err := zfstools.ValidateSep(*sep); err != nil {
+		l.WithError(err).Fatal("invalid -sep")
+	}
+	spaceLowPct, pruneStrategy, err := spaceFlags()
+	if err != nil {
+		l.WithError(err).Fatal()
+	}
+
 	tool := &Tool{
 		l:            l,
 		allowCreate:  *allowCreate && !(*dryRun),
 		allowDestroy: *allowDestroy && !(*dryRun),
+		dryRun:       *dryRun,
+		plan:         &plan{},
+		shutdown:     handleShutdown(l),
+		guards:       newGuardResults(),
+		summary:      newRunSummary(),
+
+		spaceLowPct:   spaceLowPct,
+		pruneStrategy: pruneStrategy,
+	}
+	start := time.Now()
+	err = tool.Main()
+	// The summary goes to stderr, along with the logs, so that stdout is left to -diff and -output=json.
+	if len(tool.summary.datasets) > 0 && (!*quiet || tool.summary.eventful()) {
+		tool.summary.write(os.Stderr, time.Since(start))
 	}
-	if err := tool.Main(); err != nil {
+	if err != nil {
 		l.WithError(err).Fatal()
 	}
+	if *diff {
+		for _, line := range tool.plan.lines() {
+			fmt.Println(line)
+		}
+	}
+	if *output == "json" {
+		if err := tool.plan.writeJSON(os.Stdout); err != nil {
+			l.WithError(err).Fatal("failed to write plan")
+		}
+	}
+}
+
+// handleShutdown returns a shutdown that is stopped when the process receives SIGTERM or SIGINT (see -shutdown-timeout).
+func handleShutdown(l *logrus.Logger) *shutdown {
+	sd := newShutdown()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	go sd.handle(l, sigs, *shutdownTimeout, os.Exit)
+	return sd
+}
+
+// newLogger returns a logger that writes to out at the given level, using the named formatter ("text" or "json").
+func newLogger(out io.Writer, level, format string) (*logrus.Logger, error) {
+	var err error
+
+	l := logrus.New()
+	l.Out = out
+	l.Level, err = logrus.ParseLevel(level)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse -log-level: %v", err)
+	}
+
+	switch strings.ToLower(format) {
+	case "text":
+		l.Formatter = &logrus.TextFormatter{}
+	case "json":
+		l.Formatter = &logrus.JSONFormatter{}
+	default:
+		return nil, fmt.Errorf("unexpected value for -log-format: %q", format)
+	}
+
+	return l, nil
 }
 
-func (tool *Tool) Main() error {
+func (tool *Tool) Main() (err error) {
+	if *manifestPath != "" {
+		if err := validManifestFormat(*manifestFormat); err != nil {
+			return err
+		}
+	}
+	if *statusPath != "" || *pushgateway != "" || *manifestPath != "" {
+		if tool.status, err = loadRunStatus(*statusPath); err != nil {
+			return err
+		}
+		start := time.Now()
+		tool.status.beginRun(start)
+		defer func() {
+			tool.status.endRun(start, err)
+			if saveErr := tool.status.save(); saveErr != nil && err == nil {
+				err = saveErr
+			}
+			// The manifest is written even if the run failed, since it must list every snapshot that was created.
+			if *manifestPath != "" {
+				writeErr := tool.status.writeManifest(*manifestPath, *manifestFormat)
+				if writeErr != nil && err == nil {
+					err = writeErr
+				}
+			}
+			if *pushgateway != "" {
+				tool.pushMetrics(time.Since(start))
+			}
+		}()
+	}
+
+	if err := zfs.Available(); err != nil {
+		tool.l.WithError(err).Warn("libzfs is not available; falling back to the zfs command, with reduced functionality")
+		return tool.mainDegraded(cliBackend{}, flag.Args())
+	}
+
 	defer tool.cleanup()
 	if err := tool.preinit(); err != nil {
 		return err
@@ -100,20 +376,180 @@ func (tool *Tool) Main() error {
 
 	l := tool.l
 
-	targetDatasets, err := tool.selectDatasets(flag.Args())
+	if *propertyTemplate != "" {
+		d, ok := tool.datasetsByName[*propertyTemplate]
+		if !ok {
+			return fmt.Errorf("no such dataset: %s (given with -property-template)", *propertyTemplate)
+		}
+		var skipped []string
+		tool.templateProps, skipped = templateProperties(d)
+		for _, name := range skipped {
+			l.WithFields(logrus.Fields{"template": *propertyTemplate, "property": name}).Info(
+				"template property skipped, since it cannot be set on snapshots")
+		}
+	}
+
+	if *stateDBPath != "" {
+		if tool.state, err = loadStateDB(*stateDBPath); err != nil {
+			return err
+		}
+		dropped := tool.state.reconcile(tool.snapshotPaths)
+		l.WithFields(logrus.Fields{"path": *stateDBPath, "droppedQty": dropped}).Info("loaded state database")
+		if !tool.dryRun {
+			defer func() {
+				if saveErr := tool.state.save(); saveErr != nil && err == nil {
+					err = saveErr
+				}
+			}()
+		}
+	}
+
+	if *configPath == "" {
+		// TODO: implement default paths (e.g. XDG config directories, /etc/zfs-auto-snapshot.yaml, etc.)
+		return fmt.Errorf("no config file path given")
+	}
+
+	conf, err := loadConfig(*configPath)
 	if err != nil {
 		return err
 	}
+	tool.legacyFormats = conf.LegacyTimestampFormats
+	tool.nameOrder = zfstools.NameOrder(conf.NameOrder)
+	tool.sep = *sep
+	tool.policies = conf.Policies
+	if errs := conf.labelsContaining(tool.sep); len(errs) != 0 {
+		return configErrors(errs)
+	}
+	if err := tool.checkIntervals(conf); err != nil {
+		return err
+	}
+	if conf.Trim != nil && tool.state == nil {
+		return errTrimNeedsStateDB
+	}
+
+	l.WithFields(logrus.Fields{"seriesQty": len(conf.Series)}).Info("loaded configuration file")
+	for _, series := range conf.Series {
+		l.WithFields(logrus.Fields{
+			"series":       series.Label,
+			"interval":     series.Interval,
+			"keep":         series.Keep,
+			"minRetention": series.MinRetention,
+		}).Info("loaded series configuration")
+	}
+	for _, policy := range conf.Policies {
+		l.WithFields(logrus.Fields{"pattern": policy.Pattern, "seriesQty": len(policy.Series)}).Info(
+			"loaded policy configuration")
+	}
+
+	if *sendIncr != "" && *sendFull != "" {
+		return errors.New("-send-incr and -send-full may not both be given")
+	}
+
+	var targetDatasets map[string]zfs.Dataset
+	if *rootsOnly {
+		if len(flag.Args()) > 0 || *recursive {
+			return errors.New("-roots-only selects the datasets itself; give neither dataset names nor -recursive")
+		}
+		poolNames, err := openPoolNames()
+		if err != nil {
+			return err
+		}
+		targetDatasets, err = tool.selectRoots(poolNames)
+		if err != nil {
+			return err
+		}
+	} else {
+		targetDatasets, err = tool.selectDatasets(flag.Args())
+		if err != nil {
+			return err
+		}
+	}
+	if *includeClones {
+		for _, name := range datasetNames(targetDatasets) {
+			for _, clone := range cloneDescendants(name, tool.snapshotClones) {
+				if d, ok := tool.datasetsByName[clone]; ok {
+					l.WithFields(logrus.Fields{"dataset": clone, "origin": name}).Debug("selected clone")
+					targetDatasets[clone] = d
+				}
+			}
+		}
+	}
+	if len(poolFlags) > 0 {
+		pools := make(map[string]bool)
+		for _, pool := range poolFlags {
+			// Each pool's root dataset has the pool's name.
+			if _, ok := tool.datasetsByName[pool]; !ok {
+				return fmt.Errorf("-pool: no such pool: %v", pool)
+			}
+			pools[pool] = true
+		}
+		for _, path := range keepPools(targetDatasets, pools) {
+			l.WithFields(logrus.Fields{"dataset": path, "pool": poolName(path)}).Debug("excluded by -pool")
+		}
+	}
+	excludeNames := make(map[string]bool)
+	for _, name := range excludeFlags {
+		name, err := zfstools.NormalizeDatasetName(name)
+		if err != nil {
+			return fmt.Errorf("-exclude: %v", err)
+		}
+		excludeNames[name] = true
+	}
+	for _, path := range excludeSubtrees(targetDatasets, func(name string) bool {
+		return excludeNames[name] || conf.excludes(name)
+	}) {
+		l.WithFields(logrus.Fields{"dataset": path}).Debug("excluded by -exclude or configuration file")
+	}
+
+	var where []wherePredicate
+	for _, s := range whereFlags {
+		p, err := parseWhere(s)
+		if err != nil {
+			return err
+		}
+		where = append(where, p)
+	}
+	if err := checkMountpointPatterns(excludeMountpointFlags); err != nil {
+		return err
+	}
+
+	// pruneOnly contains the excluded datasets whose existing snapshots are still managed because -prune-excluded was
+	// given.
+	pruneOnly := make(map[string]zfs.Dataset)
+	for _, path := range datasetNames(targetDatasets) {
+		d := targetDatasets[path]
+		// Skip datasets that are being received into, whose contents may be inconsistent; their snapshots are left
+		// alone, too, since the receive may depend on them.
+		if datasetReceiving(path, d) {
+			l.WithFields(logrus.Fields{"dataset": path}).Warn("dataset skipped because a receive into it is in progress")
+			delete(targetDatasets, path)
+			continue
+		}
+
+		// Exclude datasets whose properties do not satisfy every -where condition.
+		if !matchAll(where, datasetPropertyValues(d)) {
+			l.WithFields(logrus.Fields{"dataset": path}).Debug("excluded by -where")
+			delete(targetDatasets, path)
+			continue
+		}
+		if mountpoint := d.Properties[zfs.DatasetPropMountpoint].Value; mountpointExcluded(excludeMountpointFlags,
+			mountpoint) {
+			l.WithFields(logrus.Fields{"dataset": path, "mountpoint": mountpoint}).Debug("excluded by -exclude-mountpoint")
+			delete(targetDatasets, path)
+			continue
+		}
 
-	for path, d := range targetDatasets {
 		// Exclude datasets based on configuration properties and flags.
 		exclude, err := tool.datasetExcluded(d, *defaultExclude)
 		if err != nil {
 			return err
 		}
 		if exclude {
-			l.WithFields(logrus.Fields{"dataset": path}).Debug("excluded")
+			l.WithFields(logrus.Fields{"dataset": path, "pruneExcluded": *pruneExcluded}).Debug("excluded")
 			delete(targetDatasets, path)
+			if *pruneExcluded {
+				pruneOnly[path] = d
+			}
 			continue
 		} else {
 			l.WithFields(logrus.Fields{"dataset": path}).Debug("not excluded")
@@ -132,28 +568,154 @@ func (tool *Tool) Main() error {
 		}
 	}
 
-	if *configPath == "" {
-		// TODO: implement default paths (e.g. XDG config directories, /etc/zfs-auto-snapshot.yaml, etc.)
-		return fmt.Errorf("no config file path given")
+	if *parallelism < 1 || *perPoolParallelism < 0 {
+		return errors.New("-parallelism must be at least 1, and -per-pool-parallelism must not be negative")
+	}
+	// Even with -per-pool-parallelism=1, the datasets of different pools are managed at once.
+	tool.parallel = *parallelism > 1
+	if tool.parallel {
+		l.WithFields(logrus.Fields{"parallelism": *parallelism}).Warn(
+			"libzfs is not safe for concurrent use; -parallelism greater than 1 is experimental")
 	}
 
-	conf, err := loadConfig(*configPath)
+	if *retentionPreview > 0 {
+		return tool.previewRetention(os.Stdout, targetDatasets, conf.Series, *retentionPreview)
+	}
+	if *reclaimableFlag {
+		return tool.reportReclaimable(os.Stdout, targetDatasets, conf.Series)
+	}
+
+	// Snapshots can be neither created nor destroyed on read-only pools.  This check comes after the retention preview,
+	// which changes nothing.
+	selected := append(datasetNames(targetDatasets), datasetNames(pruneOnly)...)
+	readonly, err := readonlyDatasets(selected, poolReadonly)
 	if err != nil {
 		return err
 	}
+	for _, path := range selected {
+		if !readonly[path] {
+			continue
+		}
+		l.WithFields(logrus.Fields{"dataset": path, "pool": poolName(path)}).Info(
+			"dataset skipped because its pool is imported read-only")
+		delete(targetDatasets, path)
+		delete(pruneOnly, path)
+	}
 
-	l.WithFields(logrus.Fields{"seriesQty": len(conf.Series)}).Info("loaded configuration file")
-	for _, series := range conf.Series {
-		l.WithFields(logrus.Fields{
-			"series":   series.Label,
-			"interval": series.Interval,
-			"keep":     series.Keep,
-		}).Info("loaded series configuration")
+	// Each clone that is snapshotted along with the dataset that it was cloned from, and each descendant that is
+	// snapshotted along with the dataset named with -recursive, is only pruned on its own.
+	tool.groupCreated = make(map[string][]*zfstools.SnapMetadata)
+	tool.groupDestroyed = make(map[string][]*zfstools.SnapMetadata)
+	tool.groupMembers = make(map[string][]string)
+	memberOnly := make(map[string]zfs.Dataset)
+	inCloneGroup := make(map[string]bool)
+	if *includeClones {
+		for origin, clones := range cloneGroups(datasetNames(targetDatasets), tool.snapshotClones) {
+			l.WithFields(logrus.Fields{"dataset": origin, "clones": clones}).Info(
+				"clones will be snapshotted along with dataset")
+			tool.groupMembers[origin] = clones
+			inCloneGroup[origin] = true
+			for _, clone := range clones {
+				inCloneGroup[clone] = true
+			}
+		}
+	}
+	if *recursive {
+		groups := recursiveGroups(tool.recursiveRoots, datasetNames(targetDatasets), inCloneGroup,
+			func(path string) []seriesConfig {
+				return tool.datasetSeries(path, targetDatasets[path], conf.Series)
+			})
+		for root, descendants := range groups {
+			l.WithFields(logrus.Fields{"dataset": root, "descendants": len(descendants)}).Info(
+				"descendants will be snapshotted along with dataset")
+			tool.groupMembers[root] = descendants
+		}
+	}
+	for _, members := range tool.groupMembers {
+		for _, member := range members {
+			memberOnly[member] = targetDatasets[member]
+			delete(targetDatasets, member)
+		}
+	}
+
+	// The dry run goes on even if a probe fails, so that the rest of what it would do is still logged.
+	if *dryRunProbe {
+		probed := append(datasetNames(targetDatasets), datasetNames(memberOnly)...)
+		if probeErr := tool.probeDatasets(defaultProbeOps, probed, time.Now()); probeErr != nil {
+			defer func() {
+				if err == nil {
+					err = probeErr
+				}
+			}()
+		}
 	}
 
 	l.WithFields(logrus.Fields{"datasets": len(targetDatasets)}).Info("examining selected datasets")
-	for _, d := range targetDatasets {
-		if err := tool.manageSnapshots(d, conf.Series); err != nil {
+	if err := forEachDataset(datasetNames(targetDatasets), *parallelism, *perPoolParallelism,
+		tool.shutdown.track(func(path string) error {
+			return tool.manageSnapshots(targetDatasets[path], conf.Series, !*destroyOnly)
+		})); err != nil {
+		return err
+	}
+	l.WithFields(logrus.Fields{"datasets": len(memberOnly)}).Info(
+		"pruning snapshots of datasets snapshotted with others")
+	if err := forEachDataset(datasetNames(memberOnly), *parallelism, *perPoolParallelism,
+		tool.shutdown.track(func(path string) error {
+			return tool.manageSnapshots(memberOnly[path], conf.Series, false)
+		})); err != nil {
+		return err
+	}
+	l.WithFields(logrus.Fields{"datasets": len(pruneOnly)}).Info("pruning snapshots of excluded datasets")
+	if err := forEachDataset(datasetNames(pruneOnly), *parallelism, *perPoolParallelism,
+		tool.shutdown.track(func(path string) error {
+			return tool.manageSnapshots(pruneOnly[path], conf.Series, false)
+		})); err != nil {
+		return err
+	}
+
+	// Sends, trims, and space-pressure pruning are finished as a whole, like the management of a dataset.
+	if !tool.shutdown.begin() {
+		return errShuttingDown
+	}
+	defer tool.shutdown.end()
+
+	if *sendIncr != "" {
+		if err := tool.sendSeries(flag.Args(), conf.Series, *sendLabel, *sendIncr, false); err != nil {
+			return err
+		}
+	}
+	if *sendFull != "" {
+		if err := tool.sendSeries(flag.Args(), conf.Series, *sendLabel, *sendFull, true); err != nil {
+			return err
+		}
+	}
+
+	if conf.Trim != nil {
+		if err := tool.scheduleTrims(defaultTrimEnv, datasetPools(datasetNames(targetDatasets)), conf.Trim.Interval,
+			tool.state.Trims, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	if *spaceHighPct > 0 {
+		if !tool.allowDestroy {
+			l.Info("not checking pool capacity, since destroying snapshots is disabled")
+			return nil
+		}
+
+		// The members of groups are pruned on their own (see above), so they are pruned under space pressure too.
+		pruned := make(map[string]zfs.Dataset, len(targetDatasets)+len(memberOnly))
+		for path, d := range targetDatasets {
+			pruned[path] = d
+		}
+		for path, d := range memberOnly {
+			pruned[path] = d
+		}
+		series := func(dsPath string) []seriesConfig {
+			return tool.datasetSeries(dsPath, pruned[dsPath], conf.Series)
+		}
+		if err := tool.relieveSpacePressure(tool.defaultSpaceEnv(pruned), datasetNames(pruned), series,
+			*spaceHighPct, tool.spaceLowPct, *spaceEmergencyKeep, tool.pruneStrategy, time.Now()); err != nil {
 			return err
 		}
 	}
@@ -161,6 +723,34 @@ func (tool *Tool) Main() error {
 	return nil
 }
 
+// checkIntervals returns an error describing each of conf's series whose interval is shorter than -min-interval,
+// unless -allow-fast-intervals was given, in which case it only logs a warning for each.
+func (tool *Tool) checkIntervals(conf *configFile) error {
+	errs := conf.fastIntervals(*minInterval)
+	if len(errs) == 0 {
+		return nil
+	}
+	if !*allowFastIntervals {
+		return configErrors(errs)
+	}
+	for _, err := range errs {
+		tool.l.WithError(err).Warn("series interval is shorter than -min-interval")
+	}
+	return nil
+}
+
+// pushMetrics pushes metrics about the run to the Pushgateway given with -pushgateway.  Failures are logged, but do not
+// cause the run to fail.
+func (tool *Tool) pushMetrics(duration time.Duration) {
+	hostname, err := os.Hostname()
+	if err == nil {
+		err = pushMetrics(*pushgateway, hostname, tool.status.metrics(duration))
+	}
+	if err != nil {
+		tool.l.WithFields(logrus.Fields{"pushgateway": *pushgateway}).WithError(err).Warn("failed to push metrics")
+	}
+}
+
 func (tool *Tool) cleanup() {
 	defer func() {
 		for _, d := range tool.rootDatasets {
@@ -174,20 +764,26 @@ func (tool *Tool) preinit() error {
 	var err error
 
 	tool.datasetsByName = make(map[string]zfs.Dataset)
-	tool.rootDatasets, err = zfs.DatasetOpenAll()
+	tool.destroyedSnapshots = make(map[string]struct{})
+	tool.snapshotClones = make(map[string]string)
+	tool.rootDatasets, err = waitForDatasets(tool.l, zfs.DatasetOpenAll, *waitForPools, time.Sleep)
 	if err != nil {
 		panic(err)
 	}
 
 	for _, d := range tool.rootDatasets {
 		if err := walkDataset(func(dd zfs.Dataset) error {
-			if dd.Properties[zfs.DatasetPropType].Value == "snapshot" {
-				return nil
-			}
 			path, err := dd.Path()
 			if err != nil {
 				return err
 			}
+			if dd.Properties[zfs.DatasetPropType].Value == "snapshot" {
+				tool.snapshotPaths = append(tool.snapshotPaths, path)
+				if clones := dd.Properties[zfs.DatasetPropClones].Value; clones != "" {
+					tool.snapshotClones[path] = clones
+				}
+				return nil
+			}
 			tool.datasetsByName[path] = dd
 			return nil
 		}, d); err != nil {
@@ -207,7 +803,9 @@ func (tool *Tool) selectDatasets(names []string) (map[string]zfs.Dataset, error)
 		return nil, errors.New("filesystem argument list is empty")
 	}
 	if len(names) == 1 && names[0] == "//" {
-		// TODO: If -recursive given, show warning that it is not necessary?
+		if *recursive {
+			tool.l.Warn("-recursive has no effect when // is given, since every dataset is already selected")
+		}
 		// apply -default-exclude
 		for path, d := range tool.datasetsByName {
 			targetDatasets[path] = d
@@ -216,190 +814,894 @@ func (tool *Tool) selectDatasets(names []string) (map[string]zfs.Dataset, error)
 	} else {
 		// show warning/error on -default-exclude here
 
+		normalized := make([]string, 0, len(names))
 		for _, dArg := range names {
 			if dArg == "//" {
 				return nil, errors.New("the // must be the only argument if it is given")
 			}
+			name, err := zfstools.NormalizeDatasetName(dArg)
+			if err != nil {
+				return nil, err
+			}
+			normalized = append(normalized, name)
+		}
+		names = normalized
+		if *recursive {
+			var covered map[string]string
+			names, covered = coveredNames(names)
+			tool.recursiveRoots = names
+			coveredList := make([]string, 0, len(covered))
+			for name := range covered {
+				coveredList = append(coveredList, name)
+			}
+			sort.Strings(coveredList)
+			for _, name := range coveredList {
+				tool.l.WithFields(logrus.Fields{"dataset": name, "ancestor": covered[name]}).Warn(
+					"dataset is already selected by -recursive because an ancestor is named, too")
+			}
+		}
+
+		for _, dArg := range names {
 			d, ok := tool.datasetsByName[dArg]
 			if !ok {
 				return nil, fmt.Errorf("no such dataset: %v", dArg)
 			}
 			if *recursive {
-				if err := walkDataset(func(dd zfs.Dataset) error {
-					if dd.Properties[zfs.DatasetPropType].Value == "snapshot" {
-						return nil
+				// datasetsByName contains every filesystem and volume (but no snapshots), so the named dataset's
+				// descendants are the entries whose names it is a prefix of.
+				for path, dd := range tool.datasetsByName {
+					if strings.HasPrefix(path, dArg+"/") {
+						targetDatasets[path] = dd
 					}
-					path, err := dd.Path()
-					if err != nil {
-						return err
-					}
-					targetDatasets[path] = dd
-					return nil
-				}, d); err != nil {
-					return nil, err
-				}
-			} else {
-				path, err := d.Path()
-				if err != nil {
-					return nil, err
 				}
-				targetDatasets[path] = d
 			}
+			targetDatasets[dArg] = d
 		}
 	}
 
 	return targetDatasets, nil
 }
 
-func (tool *Tool) datasetExcluded(d zfs.Dataset, defaultExclude bool) (bool, error) {
-	l := tool.l
+// selectRoots returns the root dataset of each of the named pools (see -roots-only).
+func (tool *Tool) selectRoots(poolNames []string) (map[string]zfs.Dataset, error) {
+	targetDatasets := make(map[string]zfs.Dataset)
+	for _, name := range poolNames {
+		d, ok := tool.datasetsByName[name]
+		if !ok {
+			return nil, fmt.Errorf("root dataset of pool %s not found", name)
+		}
+		targetDatasets[name] = d
+	}
+	return targetDatasets, nil
+}
+
+// coveredNames returns the given dataset names less those that are also given more than once or that are descendants
+// of another given name, which -recursive would select twice.  covered maps each name that was removed to the name
+// that it is covered by.
+func coveredNames(names []string) (kept []string, covered map[string]string) {
+	covered = make(map[string]string)
+	for i, name := range names {
+		for j, other := range names {
+			if strings.HasPrefix(name, other+"/") || (name == other && j < i) {
+				covered[name] = other
+				break
+			}
+		}
+		if _, ok := covered[name]; !ok {
+			kept = append(kept, name)
+		}
+	}
+	return kept, covered
+}
+
+// datasetNames returns the names of datasets, sorted.
+func datasetNames(datasets map[string]zfs.Dataset) []string {
+	var names []string
+	for name := range datasets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// excludeSubtrees removes from targetDatasets each dataset for which excluded returns true, and each of their
+// descendants.  It returns the names of the datasets that were removed.
+//
+// N.B.: Excluding a descendant of a dataset that is snapshotted with -recursive does not require giving up an atomic
+// recursive snapshot; the remaining datasets are still snapshotted together (see recursiveGroups).
+//
+func excludeSubtrees(targetDatasets map[string]zfs.Dataset, excluded func(name string) bool) []string {
+	var removed []string
+	for path := range targetDatasets {
+		// Check the dataset itself and then each of its ancestors.
+		for name := path; ; name = name[:strings.LastIndex(name, "/")] {
+			if excluded(name) {
+				delete(targetDatasets, path)
+				removed = append(removed, path)
+				break
+			}
+			if !strings.Contains(name, "/") {
+				break
+			}
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// keepPools removes each dataset that is not on one of pools (a set of pool names) from targetDatasets, and returns
+// their names, sorted.
+func keepPools(targetDatasets map[string]zfs.Dataset, pools map[string]bool) []string {
+	var removed []string
+	for path := range targetDatasets {
+		if !pools[poolName(path)] {
+			delete(targetDatasets, path)
+			removed = append(removed, path)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// datasetSeries returns a copy of series, merged with the series of the policy that applies to the dataset dPath (see
+// resolvePolicy), in which the Keep of each series is replaced by the value of the corresponding
+// AutoSnapshotKeepPropertyPrefix property of the dataset, if it has one.  Invalid values are logged and ignored.
+func (tool *Tool) datasetSeries(dPath string, d zfs.Dataset, series []seriesConfig) []seriesConfig {
+	series = resolvePolicy(tool.policies, dPath, series)
+	effective := make([]seriesConfig, len(series))
+	for i, s := range series {
+		effective[i] = s
+		name := AutoSnapshotKeepPropertyPrefix + s.Label
+		prop, ok := d.UserProperties[name]
+		if !ok {
+			continue
+		}
+		keep, err := strconv.Atoi(prop.Value)
+		if err != nil || (keep < 0 && keep != -1) {
+			tool.l.WithFields(logrus.Fields{"dataset": dPath, "value": prop.Value}).Warnf(
+				"unexpected value for property: %s", name)
+			continue
+		}
+		tool.l.WithFields(logrus.Fields{"dataset": dPath, "series": s.Label, "keep": keep, "source": prop.Source}).Debug(
+			"keep overridden by property")
+		effective[i].Keep = keep
+	}
+	return effective
+}
 
+func (tool *Tool) datasetExcluded(d zfs.Dataset, defaultExclude bool) (bool, error) {
 	dPath, err := d.Path()
 	if err != nil {
 		return false, err
 	}
 
 	prop, ok := d.UserProperties[AutoSnapshotProperty]
-	if !ok {
-		return defaultExclude, nil
+	return tool.excludedByProperty(dPath, prop.Value, ok, defaultExclude), nil
+}
+
+// excludedByProperty is the decision made by datasetExcluded, given the value of the dataset dPath's
+// AutoSnapshotProperty and whether it is set.
+func (tool *Tool) excludedByProperty(dPath, value string, set, defaultExclude bool) bool {
+	if !set {
+		return defaultExclude
 	}
 
-	switch strings.ToLower(prop.Value) {
+	switch strings.ToLower(value) {
 	case "true":
-		return false, nil
+		return false
 	case "false":
-		return true, nil
+		return true
 	default:
-		l.WithFields(logrus.Fields{"dataset": dPath}).Warnf("unexpected value for property: %s", AutoSnapshotProperty)
-		return defaultExclude, nil
+		tool.l.WithFields(logrus.Fields{"dataset": dPath}).Warnf("unexpected value for property: %s", AutoSnapshotProperty)
+		return defaultExclude
+	}
+}
+
+// removable returns those of snaps, which are snapshots of d (whose name is dsPath) that are to be removed, that can
+// be removed.  First, the holds that this tool placed on them (see -create-with-hold) are released, unless destroying
+// snapshots is disabled; then the snapshot that the next backup is based on (see backupBase), those that still have
+// holds (holds is keyed by full snapshot name, as returned by Dataset.AllHolds), and those that have clones are left
+// out, and logged.
+func (tool *Tool) removable(dsPath string, d zfs.Dataset, snaps []*zfstools.SnapMetadata,
+	holds map[string][]zfs.HoldInfo) ([]*zfstools.SnapMetadata, error) {
+
+	base := tool.backupBase(d)
+	if *createHold != "" {
+		// Release the holds that this tool placed on the snapshots when they were created; any other holds (e.g.
+		// those placed by a backup tool in the meantime) still prevent them from being destroyed.
+		var ownHeld []*zfstools.SnapMetadata
+		ownHeld, holds = dropHoldTag(snaps, holds, *createHold)
+		for _, snap := range ownHeld {
+			if !tool.allowDestroy {
+				tool.l.WithFields(logrus.Fields{"snapshot": snap.Path(), "tag": *createHold}).Info(
+					"hold would be released")
+				continue
+			}
+			tool.l.WithFields(logrus.Fields{"snapshot": snap.Path(), "tag": *createHold}).Info("releasing hold")
+			if err := zfs.DatasetRelease(snap.Path(), *createHold, false); err != nil {
+				return nil, err
+			}
+		}
 	}
+	if kept := excludeBackupBase(snaps, base); len(kept) < len(snaps) {
+		tool.l.WithFields(logrus.Fields{"dataset": dsPath, "snapshot": base}).Info(
+			"not removing snapshot that is the base for the next backup")
+		snaps = kept
+	}
+	if kept := excludeHeld(snaps, holds); len(kept) < len(snaps) {
+		tool.l.WithFields(logrus.Fields{"dataset": dsPath, "snapshotQty": len(snaps) - len(kept)}).Info(
+			"not removing snapshots that have holds")
+		snaps = kept
+	}
+	return tool.excludeCloned(snaps), nil
 }
 
-func (tool *Tool) removeSnapshots(d zfs.Dataset, snaps []*snapMetadata) error {
+// removeSnapshots destroys the given snapshots of d.  If descendants of d have snapshots with the same name as one of
+// the given snapshots (as they will if the snapshot was created recursively) and every one of those is in due (see
+// Tool.groupDue), they are destroyed along with it in a single operation; otherwise, and always if due is nil or
+// datasets are being managed in parallel (in which case the descendants' snapshots might be being destroyed at the same
+// time), each snapshot is destroyed on its own.
+//
+// Snapshots that have clones, which cannot be destroyed, and snapshots that this process is sending (see
+// snapshotRegistry) are skipped.  A snapshot that cannot be destroyed (e.g. because it is held) does not stop the
+// others from being destroyed; the error returned is then a destroyErrors with an error for each such snapshot.  The
+// number of the given snapshots that were actually destroyed is returned in either case.
+func (tool *Tool) removeSnapshots(d zfs.Dataset, snaps []*zfstools.SnapMetadata,
+	due map[string]*zfstools.SnapMetadata) (int, error) {
+
+	snaps = tool.excludeCloned(snaps)
 
 	snapPaths := make(map[string]struct{})
 	for _, snap := range snaps {
 		snapPaths[snap.Path()] = struct{}{}
 	}
 
+	destroyed := 0
+	var errs destroyErrors
 	for _, dd := range d.Children {
 		if dd.Properties[zfs.DatasetPropType].Value == "snapshot" {
 
 			ddPath, err := dd.Path()
 			if err != nil {
-				return err
+				errs = append(errs, err)
+				continue
 			}
 
 			if _, ok := snapPaths[ddPath]; ok {
-				tool.l.WithFields(logrus.Fields{"snapshot": ddPath}).Info("removing snapshot")
-				if err := dd.Destroy(false); err != nil {
-					return err
-				}
 				delete(snapPaths, ddPath)
+				covered := recursiveSnapshotPaths(ddPath, tool.snapshotPaths)
+				if recursiveDestroyOK(covered, due) && !tool.parallel && !tool.anyCloned(covered) &&
+					inUse.beginDestroy(covered...) {
+
+					tool.l.WithFields(logrus.Fields{"snapshot": ddPath, "snapshotQty": len(covered)}).Info(
+						"removing snapshot recursively")
+					err := zfs.DestroySnapshotRecursive(ddPath, false)
+					inUse.endDestroy(covered...)
+					if err != nil {
+						errs = append(errs, fmt.Errorf("failed to destroy %s recursively: %v", ddPath, err))
+						continue
+					}
+					for _, path := range covered {
+						tool.markDestroyed(path)
+						if path != ddPath {
+							tool.recordGroupDestroyed(due[path])
+						}
+					}
+					destroyed++
+				} else if inUse.beginDestroy(ddPath) {
+					tool.l.WithFields(logrus.Fields{"snapshot": ddPath}).Info("removing snapshot")
+					err := dd.Destroy(false)
+					inUse.endDestroy(ddPath)
+					if err != nil {
+						errs = append(errs, fmt.Errorf("failed to destroy %s: %v", ddPath, err))
+						continue
+					}
+					tool.markDestroyed(ddPath)
+					destroyed++
+				} else {
+					tool.l.WithFields(logrus.Fields{"snapshot": ddPath}).Info("not removing snapshot that is being sent")
+				}
 			}
 		}
 	}
 
-	if len(snapPaths) != 0 {
-		return fmt.Errorf("failed to find all snapshots marked for deletion")
+	missing := make([]string, 0, len(snapPaths))
+	for path := range snapPaths {
+		missing = append(missing, path)
+	}
+	sort.Strings(missing)
+	for _, path := range missing {
+		errs = append(errs, fmt.Errorf("failed to find %s, which was marked for deletion", path))
 	}
 
-	return nil
+	if len(errs) != 0 {
+		return destroyed, errs
+	}
+	return destroyed, nil
 }
 
-// getSnapshots returns all snapshots of the given dataset that have names like the ones produced by this tool and with
-// the given label (e.g. "hourly", "daily").  The snapshots are returned in order from most recent to least recent.
-func (tool *Tool) getSnapshots(d zfs.Dataset, label string) ([]*snapMetadata, error) {
-	snaps := []*snapMetadata{}
+// destroyErrors describes each of the snapshots that removeSnapshots failed to destroy.
+type destroyErrors []error
 
-	for _, dd := range d.Children {
+func (e destroyErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// excludeCloned returns snaps without the snapshots that have clones, logging a warning for each of those.
+func (tool *Tool) excludeCloned(snaps []*zfstools.SnapMetadata) []*zfstools.SnapMetadata {
+	kept := make([]*zfstools.SnapMetadata, 0, len(snaps))
+	for _, snap := range snaps {
+		if clones, ok := tool.snapshotClones[snap.Path()]; ok {
+			tool.l.WithFields(logrus.Fields{"snapshot": snap.Path(), "clones": clones}).Warn(
+				"not removing snapshot that has clones; destroy or promote the clones to allow it to be removed")
+			continue
+		}
+		kept = append(kept, snap)
+	}
+	return kept
+}
+
+// anyCloned returns true if any of the snapshots paths has clones.
+func (tool *Tool) anyCloned(paths []string) bool {
+	for _, path := range paths {
+		if _, ok := tool.snapshotClones[path]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// markDestroyed records that the snapshot path has been destroyed.
+func (tool *Tool) markDestroyed(path string) {
+	tool.mu.Lock()
+	defer tool.mu.Unlock()
+	tool.destroyedSnapshots[path] = struct{}{}
+	if tool.state != nil {
+		tool.state.forget(path)
+	}
+}
+
+// unparsedSnapshots returns those of snapPaths whose names (i.e. the parts after the "@") contain prefix but cannot be
+// parsed as the names of automatic snapshots, in the same order.  Such snapshots are not managed by this tool.
+func unparsedSnapshots(prefix string, snapPaths []string, order zfstools.NameOrder, sep string,
+	legacyFormats []string) []string {
+
+	var unparsed []string
+	for _, path := range snapPaths {
+		if i := strings.Index(path, "@"); i < 0 || !strings.Contains(path[i+1:], prefix) {
+			continue
+		}
+		if meta, err := zfstools.ParseSnapNameSep(order, sep, prefix, path, legacyFormats...); meta == nil || err != nil {
+			unparsed = append(unparsed, path)
+		}
+	}
+	return unparsed
+}
+
+// getSnapshots returns all snapshots of the given dataset that have names like the ones produced by this tool and that
+// belong to the series s (see selectSeries).  The snapshots are returned in order from most recent to least recent.
+//
+// With -state-db, the snapshots are those recorded in the state database.  The first time that a series of a dataset
+// is seen, the database is seeded with the snapshots found by their names (see stateDB.needsSeed).
+//
+// Snapshots that belong to s only by virtue of their names have AutoSnapshotSeriesProperty set on them (unless -dry-run
+// was given).  Snapshots whose names look like those produced by this tool but cannot be parsed (e.g. because of an
+// impossible timestamp) are skipped rather than causing an error.
+//
+func (tool *Tool) getSnapshots(d zfs.Dataset, s seriesConfig) ([]*zfstools.SnapMetadata, error) {
+	if tool.state == nil {
+		return tool.snapshotsByName(d, s)
+	}
+
+	// The state database already excludes snapshots destroyed earlier in this run.
+	dsPath, err := d.Path()
+	if err != nil {
+		return []*zfstools.SnapMetadata{}, err
+	}
+	tool.mu.Lock()
+	seed := tool.state.needsSeed(dsPath, s.Label)
+	tool.mu.Unlock()
+	if seed {
+		snaps, err := tool.snapshotsByName(d, s)
+		if err != nil {
+			return []*zfstools.SnapMetadata{}, err
+		}
+		tool.l.WithFields(logrus.Fields{"dataset": dsPath, "series": s.Label, "snapshotQty": len(snaps)}).Info(
+			"recording existing snapshots in state database")
+		tool.mu.Lock()
+		tool.state.seed(dsPath, s.Label, snaps)
+		tool.mu.Unlock()
+	}
+	tool.mu.Lock()
+	defer tool.mu.Unlock()
+	return tool.state.snapshots(dsPath, s.Label), nil
+}
+
+// snapshotsByName is like getSnapshots, but always finds the snapshots by their names.
+func (tool *Tool) snapshotsByName(d zfs.Dataset, s seriesConfig) ([]*zfstools.SnapMetadata, error) {
+	var tagged []taggedSnapshot
+	handles := make(map[string]*zfs.Dataset)
+
+	for i := range d.Children {
+		dd := &d.Children[i]
 		if dd.Properties[zfs.DatasetPropType].Value == "snapshot" {
 
 			path, err := dd.Path()
 			if err != nil {
-				return []*snapMetadata{}, err
+				return []*zfstools.SnapMetadata{}, err
 			}
 
-			meta, err := parseSnapName(*prefix, path)
-			if err != nil {
-				return []*snapMetadata{}, err
+			tool.mu.Lock()
+			_, destroyed := tool.destroyedSnapshots[path]
+			tool.mu.Unlock()
+			if destroyed {
+				// Destroyed earlier in this run, e.g. recursively along with a snapshot of an ancestor.
+				continue
+			}
 
+			meta, err := zfstools.ParseSnapNameSep(tool.nameOrder, tool.sep, *prefix, path, tool.legacyFormats...)
+			if err != nil {
+				// Most likely taken by hand or by another tool; see -report-unparsed.
+				tool.l.WithFields(logrus.Fields{"snapshot": path}).WithError(err).Debug(
+					"skipping snapshot whose name cannot be parsed")
+				continue
 			}
 
-			if meta != nil && meta.label == label {
-				snaps = append(snaps, meta)
+			if meta != nil {
+				series := dd.UserProperties[AutoSnapshotSeriesProperty].Value
+				tagged = append(tagged, taggedSnapshot{meta: meta, series: series})
+				handles[path] = dd
 			}
 
 		}
 	}
 
-	sort.Sort(byTS(snaps))
+	snaps, backfill := selectSeries(tagged, s)
+	for _, meta := range backfill {
+		// Snapshots taken before AutoSnapshotSeriesProperty existed are assigned to a series by their names.
+		tool.l.WithFields(logrus.Fields{"snapshot": meta.Path(), "series": meta.Label, "dryRun": tool.dryRun}).Info(
+			"recording series of existing snapshot")
+		if tool.dryRun {
+			continue
+		}
+		if err := handles[meta.Path()].SetUserProperty(AutoSnapshotSeriesProperty, meta.Label); err != nil {
+			return []*zfstools.SnapMetadata{}, err
+		}
+	}
+
+	if snaps == nil {
+		snaps = []*zfstools.SnapMetadata{}
+	}
+	sort.Sort(zfstools.ByTS(snaps))
 
 	return snaps, nil
 }
 
 // manageSnapshots takes a dataset and a list of configurations for snapshot series.  For each series, it creates a new
 // snapshot if the last snapshot in that series is older than the series' snapshot interval, and then removes any
-// snapshots in that series in excess of the number that series is configured to keep, starting with the oldest.
-func (tool *Tool) manageSnapshots(d zfs.Dataset, series []seriesConfig) error {
+// snapshots in that series in excess of the number that series is configured to keep (or that the dataset's properties
+// say to keep; see datasetSeries), starting with the oldest.
+//
+// If snapshot is false (e.g. because the dataset is excluded but -prune-excluded was given), no new snapshots are
+// taken, but old snapshots are still removed.  If a snapshot cannot be created, the remaining series are still managed,
+// but the first such error is returned.
+//
+func (tool *Tool) manageSnapshots(d zfs.Dataset, series []seriesConfig, snapshot bool) (err error) {
 	dsPath, err := d.Path()
 	if err != nil {
 		return err
 	}
+	if tool.summary != nil {
+		defer func() {
+			tool.mu.Lock()
+			tool.summary.record(dsPath, 0, 0, err)
+			tool.mu.Unlock()
+		}()
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	configured := series
+	series = tool.datasetSeries(dsPath, d, series)
+
+	if *reportUnparsed {
+		var snapPaths []string
+		for _, dd := range d.Children {
+			if dd.Properties[zfs.DatasetPropType].Value == "snapshot" {
+				path, err := dd.Path()
+				if err != nil {
+					return err
+				}
+				snapPaths = append(snapPaths, path)
+			}
+		}
+		for _, path := range unparsedSnapshots(*prefix, snapPaths, tool.nameOrder, tool.sep, tool.legacyFormats) {
+			tool.l.WithFields(logrus.Fields{"dataset": dsPath, "snapshot": path}).Warn(
+				"snapshot name contains prefix but cannot be parsed")
+		}
+	}
 
+	var created, removed int
+	createFor := func(s seriesConfig) func(*zfstools.SnapMetadata) error {
+		return func(meta *zfstools.SnapMetadata) error {
+			metas := tool.groupSnapshots(meta)
+			ds := []zfs.Dataset{d}
+			for _, meta := range metas[1:] {
+				ds = append(ds, tool.datasetsByName[meta.Dataset])
+			}
+
+			snapProps := make(map[zfs.Prop]zfs.Property)
+			snapPaths := make([]string, len(metas))
+			userProps := make([]map[string]string, len(metas))
+			for i, meta := range metas {
+				snapPaths[i] = meta.Path()
+				props, err := snapshotUserProps(s, meta, hostname)
+				if err != nil {
+					return err
+				}
+				mergeTemplateProperties(props, tool.templateProps)
+				userProps[i] = props
+			}
+			results, err := tool.createSnapshots(ds, snapPaths, snapProps, userProps)
+			if err != nil {
+				return err
+			}
+			tool.mu.Lock()
+			for i, meta := range metas {
+				if tool.state != nil {
+					tool.state.add(meta)
+				}
+				if tool.status != nil {
+					tool.status.recordCreated(meta, results[i].guid, results[i].created)
+				}
+				if i > 0 {
+					tool.groupCreated[meta.Dataset] = append(tool.groupCreated[meta.Dataset], meta)
+				}
+			}
+			tool.mu.Unlock()
+			created++
+			return nil
+		}
+	}
+	if snapshot && *skipEmpty {
+		empty, err := datasetEmpty(d)
+		if err != nil {
+			return err
+		}
+		if empty {
+			tool.l.WithFields(logrus.Fields{"dataset": dsPath}).Info("dataset is empty; not taking new snapshots")
+			snapshot = false
+		}
+	}
+	holds, err := d.AllHolds()
+	if err != nil {
+		return err
+	}
+	removeFor := func(s seriesConfig, now time.Time) func([]*zfstools.SnapMetadata) error {
+		return func(snaps []*zfstools.SnapMetadata) error {
+			snaps, err := tool.removable(dsPath, d, snaps, holds)
+			if err != nil {
+				return err
+			}
+			if len(snaps) == 0 {
+				return nil
+			}
+			if !tool.allowDestroy {
+				for _, snap := range snaps {
+					tool.l.WithFields(logrus.Fields{"snapshot": snap.Path()}).Info("snapshot would be removed")
+				}
+				if tool.dryRun {
+					tool.mu.Lock()
+					tool.plan.addRemove(snaps)
+					tool.mu.Unlock()
+				}
+				return nil
+			}
+			// The snapshots of the same names of the datasets snapshotted along with d are destroyed along with these
+			// only if those datasets' own retention would remove them too.
+			var due map[string]*zfstools.SnapMetadata
+			if len(tool.groupMembers[dsPath]) > 0 && !tool.parallel {
+				if due, err = tool.groupDue(dsPath, configured, s, now); err != nil {
+					tool.l.WithFields(logrus.Fields{"dataset": dsPath}).WithError(err).Warn(
+						"failed to examine snapshots of datasets snapshotted along with dataset; destroying one at a time")
+				} else {
+					for _, snap := range snaps {
+						due[snap.Path()] = snap
+					}
+				}
+			}
+			n, err := tool.removeSnapshots(d, snaps, due)
+			removed += n
+			return err
+		}
+	}
+
+	var createErr error
 	for _, s := range series {
 		tool.l.WithFields(logrus.Fields{"dataset": dsPath, "series": s.Label}).Info("managing snapshots")
 
-		snaps, err := tool.getSnapshots(d, s.Label)
+		snaps, err := tool.getSnapshots(d, s)
 		if err != nil {
 			return err
 		}
 
-		for _, snap := range snaps {
-			tool.l.Debugf("existing snapshot: %s", snap.ts)
+		snaps, created = tool.withGroupCreated(dsPath, s, snaps)
+		removed = tool.groupDestroyedQty(dsPath, s)
+		now := time.Now()
+		create := createFor(s)
+		if !snapshot {
+			create = nil
+		}
+		written := func(snap *zfstools.SnapMetadata) (uint64, error) {
+			return d.WrittenSince(snap.Path())
 		}
+		err = tool.manageSeries(dsPath, s, snaps, now, written, create, removeFor(s, now))
+		if tool.status != nil {
+			tool.mu.Lock()
+			tool.status.recordSeries(dsPath, s.Label, now, created, removed, err)
+			saveErr := tool.status.save()
+			tool.mu.Unlock()
+			if saveErr != nil {
+				tool.l.WithError(saveErr).Warn("failed to write status file")
+			}
+		}
+		if tool.summary != nil {
+			tool.mu.Lock()
+			tool.summary.record(dsPath, created, removed, nil)
+			tool.mu.Unlock()
+		}
+		if err != nil {
+			if _, ok := err.(*createError); !ok {
+				return err
+			}
+			if createErr == nil {
+				createErr = err
+			}
+		}
+	}
 
-		now := time.Now()
+	return createErr
+}
 
-		if len(snaps) > 0 {
-			tool.l.Debugf("interval since last snapshot: %v", now.Sub(snaps[0].ts))
-		}
+// backupBase returns the name (the part after the "@") of the snapshot of d that must not be destroyed because the
+// next backup of d will be sent incrementally from it, or "" if there is no such snapshot or -protect-backup-base was
+// not given.
+func (tool *Tool) backupBase(d zfs.Dataset) string {
+	if !*protectBase {
+		return ""
+	}
+	return d.UserProperties[zfstools.LastBackupProperty].Value
+}
+
+// datasetEmpty returns true if d references no data at all.  Note that a filesystem that contains no files still
+// references a small amount of metadata, and so is not empty.
+func datasetEmpty(d zfs.Dataset) (bool, error) {
+	value := d.Properties[zfs.DatasetPropReferenced].Value
+	referenced, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("unexpected value for referenced property: %q", value)
+	}
+	return referenced == 0, nil
+}
+
+// datasetReceiving returns true if the dataset d, whose name is path, is being received into: if it has a
+// receive_resume_token (because a resumable receive into it is in progress or was interrupted), if it is marked
+// inconsistent, or if it is the hidden dataset (e.g. "tank/fs/%recv") that a receive into an existing dataset writes to.
+func datasetReceiving(path string, d zfs.Dataset) bool {
+	if strings.Contains(path, "%") {
+		return true
+	}
+	if token := d.Properties[zfs.DatasetPropReceiveResumeToken].Value; token != "" && token != "-" {
+		return true
+	}
+	inconsistent := d.Properties[zfs.DatasetPropInconsistent].Value
+	return inconsistent == "1" || inconsistent == "on"
+}
+
+// createError is returned by manageSeries when a new snapshot could not be created.
+type createError struct {
+	snapshot string
+	err      error
+}
 
-		if len(snaps) == 0 || now.Sub(snaps[0].ts) >= s.Interval {
-			tool.l.WithFields(logrus.Fields{"dataset": dsPath, "series": s.Label, "allowCreate": tool.allowCreate}).Info(
-				"taking new snapshot")
+func (e *createError) Error() string {
+	return fmt.Sprintf("failed to create snapshot %q: %v", e.snapshot, e.err)
+}
+
+// manageSeries manages the series s of the dataset dsPath, whose existing snapshots are snaps (most recent first); see
+// manageSnapshots.  It calls written to find out whether a new snapshot is due (see snapshotDue), create to take a new
+// snapshot (unless creating snapshots is disabled) and remove with the snapshots that should be destroyed; remove is
+// responsible for checking whether destroying snapshots is disabled.  If create is nil, no new snapshot is taken, but
+// snapshots are still removed.
+//
+// If a new snapshot was due but could not be created, no snapshots are removed from the series: otherwise, e.g. a
+// dataset that has run out of space would lose an old snapshot on each run without gaining a new one.
+//
+// No snapshots are taken for a series that retains none (see snapshotsToRemove), since they would be destroyed
+// immediately; such a series only cleans up snapshots that already exist.  Nor are they taken for a series whose guard
+// is not satisfied (see guardConfig), though snapshots are still removed.
+//
+func (tool *Tool) manageSeries(dsPath string, s seriesConfig, snaps []*zfstools.SnapMetadata, now time.Time,
+	written func(*zfstools.SnapMetadata) (uint64, error), create func(*zfstools.SnapMetadata) error,
+	remove func([]*zfstools.SnapMetadata) error) error {
+
+	for _, snap := range snaps {
+		tool.l.Debugf("existing snapshot: %s", snap.TS)
+	}
 
-			meta := &snapMetadata{
-				dataset: dsPath,
-				prefix:  *prefix,
-				label:   s.Label,
-				ts:      now,
+	if len(snaps) > 0 {
+		tool.l.Debugf("interval since last snapshot: %v", now.Sub(snaps[0].TS))
+	}
+
+	due := false
+	if create != nil && !s.retainsNone() {
+		var err error
+		if due, err = snapshotDue(s, snaps, now, written); err != nil {
+			return err
+		}
+	}
+	if due && s.Guard != nil && tool.guards != nil {
+		if err := tool.guards.check(s.Guard); err != nil {
+			tool.l.WithFields(logrus.Fields{"dataset": dsPath, "series": s.Label}).WithError(err).Info(
+				"guard not satisfied; not taking new snapshot")
+			due = false
+		}
+	}
+	if due {
+		tool.l.WithFields(logrus.Fields{"dataset": dsPath, "series": s.Label, "allowCreate": tool.allowCreate}).Info(
+			"taking new snapshot")
+
+		meta := &zfstools.SnapMetadata{
+			Dataset: dsPath,
+			Prefix:  *prefix,
+			Label:   s.Label,
+			TS:      now,
+			Order:   tool.nameOrder,
+			Sep:     tool.sep,
+		}
+
+		if tool.allowCreate {
+			if err := create(meta); err != nil {
+				tool.l.WithFields(logrus.Fields{"dataset": dsPath, "series": s.Label}).WithError(err).Warn(
+					"failed to take new snapshot; not removing any snapshots from series")
+				return &createError{snapshot: meta.Path(), err: err}
 			}
 
-			snapProps := make(map[zfs.Prop]zfs.Property)
-			if tool.allowCreate {
-				_, err := zfs.DatasetSnapshot(meta.Path(), false, snapProps)
-				if err != nil {
-					return err
-				}
+			snaps = append([]*zfstools.SnapMetadata{meta}, snaps...)
+		} else if tool.dryRun {
+			// Pretend that the snapshot was taken, so that what would be removed is accurate.
+			tool.mu.Lock()
+			tool.plan.addCreate(meta)
+			tool.mu.Unlock()
+			snaps = append([]*zfstools.SnapMetadata{meta}, snaps...)
+		}
+	}
+
+	if toRemove := snapshotsToRemove(snaps, s, now); len(toRemove) > 0 {
+		if err := remove(toRemove); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// snapshotDue returns true if a new snapshot should be added to the series s, whose existing snapshots are snaps (most
+// recent first).  If s has a WrittenThreshold, that is the case if more than that many bytes have been written since
+// the most recent snapshot, as reported by written (which may be nil otherwise); if not, it is the case if Interval has
+// elapsed since the most recent snapshot.  A series with no snapshots is always due for one.
+func snapshotDue(s seriesConfig, snaps []*zfstools.SnapMetadata, now time.Time,
+	written func(*zfstools.SnapMetadata) (uint64, error)) (bool, error) {
+
+	if len(snaps) == 0 {
+		return true, nil
+	}
+	if s.WrittenThreshold == 0 {
+		return now.Sub(snaps[0].TS) >= s.Interval, nil
+	}
+	n, err := written(snaps[0])
+	if err != nil {
+		return false, fmt.Errorf("failed to get space written since %s: %v", snaps[0].Path(), err)
+	}
+	return n > s.WrittenThreshold, nil
+}
+
+// createdSnapshot is the GUID and creation time of a snapshot created by createSnapshots.
+type createdSnapshot struct {
+	guid    uint64
+	created time.Time
+}
 
-				snaps = append([]*snapMetadata{meta}, snaps...)
+// createSnapshots creates the snapshots snapPaths, each of the corresponding dataset in ds, and then sets the
+// corresponding user properties in userProps on each of them.  When there is more than one, they are created in a
+// single atomic operation, so they must all be in the same pool.  If -fsfreeze is given, each of ds that is a mounted
+// filesystem is frozen while the snapshots are taken.  If -create-with-hold is given, each new snapshot is held as soon
+// as its properties are set.
+func (tool *Tool) createSnapshots(ds []zfs.Dataset, snapPaths []string, snapProps map[zfs.Prop]zfs.Property,
+	userProps []map[string]string) ([]createdSnapshot, error) {
+
+	var snaps []zfs.Dataset
+	defer func() {
+		for i := range snaps {
+			snaps[i].Close()
+		}
+	}()
+	snapshot := func() error {
+		if len(snapPaths) == 1 {
+			snap, err := zfs.DatasetSnapshot(snapPaths[0], false, snapProps)
+			if err != nil {
+				return err
+			}
+			snaps = append(snaps, snap)
+			return nil
+		}
+		if err := zfs.DatasetSnapshots(snapPaths, snapProps); err != nil {
+			return err
+		}
+		for _, snapPath := range snapPaths {
+			snap, err := zfs.DatasetOpen(snapPath)
+			if err != nil {
+				return err
 			}
+			snaps = append(snaps, snap)
+		}
+		return nil
+	}
+	setUserProps := func(snap zfs.Dataset, snapPath string, userProps map[string]string) (c createdSnapshot, err error) {
+		value := snap.Properties[zfs.DatasetPropGUID].Value
+		if c.guid, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return c, fmt.Errorf("unexpected value for guid property of %s: %q", snapPath, value)
 		}
+		value = snap.Properties[zfs.DatasetPropCreation].Value
+		secs, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return c, fmt.Errorf("unexpected value for creation property of %s: %q", snapPath, value)
+		}
+		c.created = time.Unix(secs, 0)
+		for name, value := range userProps {
+			if err := snap.SetUserProperty(name, value); err != nil {
+				return c, fmt.Errorf("failed to set %s on %s: %v", name, snapPath, err)
+			}
+		}
+		if *createHold != "" {
+			if err := zfs.DatasetHold(snapPath, *createHold, false); err != nil {
+				return c, fmt.Errorf("failed to hold %s: %v", snapPath, err)
+			}
+		}
+		return c, nil
+	}
 
-		if s.Keep != -1 && len(snaps) > s.Keep {
-			// tool.l.WithFields(logrus.Fields{"dataset": dsPath, "series": s.Label, "allowDestroy": tool.allowDestroy}).Info("removing one or more snapshots")
-			if tool.allowDestroy {
-				if err := tool.removeSnapshots(d, snaps[s.Keep:]); err != nil {
-					return err
-				}
-			} else {
-				for _, snap := range snaps[s.Keep:] {
-					tool.l.WithFields(logrus.Fields{"snapshot": snap.Path()}).Info("snapshot would be removed")
-				}
+	take := snapshot
+	if *fsFreezeFlag {
+		for i := len(ds) - 1; i >= 0; i-- {
+			if ds[i].Properties[zfs.DatasetPropType].Value != "filesystem" {
+				continue
+			}
+			if mounted, mountpoint := ds[i].IsMounted(); mounted {
+				tool.l.WithFields(logrus.Fields{"snapshot": snapPaths[i], "mountpoint": mountpoint}).Debug(
+					"freezing filesystem for snapshot")
+				inner := take
+				take = func() error { return withFrozenFS(mountpoint, inner) }
 			}
 		}
 	}
+	if err := take(); err != nil {
+		return nil, err
+	}
 
-	return nil
+	created := make([]createdSnapshot, len(snaps))
+	for i := range snaps {
+		var err error
+		if created[i], err = setUserProps(snaps[i], snapPaths[i], userProps[i]); err != nil {
+			return nil, err
+		}
+	}
+	return created, nil
 }
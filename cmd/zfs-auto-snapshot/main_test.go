@@ -0,0 +1,521 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/kelleyk/go-libzfs"
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLogger(t *testing.T) {
+	for _, tt := range []struct {
+		format string
+		json   bool
+	}{
+		{"text", false},
+		{"json", true},
+	} {
+		var buf bytes.Buffer
+		l, err := newLogger(&buf, "INFO", tt.format)
+		if !assert.Nil(t, err) {
+			continue
+		}
+
+		l.WithFields(logrus.Fields{"dataset": "tank/foo", "label": "daily", "snapshot": "tank/foo@snap"}).Info("hello")
+
+		out := buf.Bytes()
+		if tt.json {
+			var entry map[string]interface{}
+			if assert.Nil(t, json.Unmarshal(out, &entry), "expected output to be valid JSON: %s", out) {
+				assert.Equal(t, "hello", entry["msg"])
+				assert.Equal(t, "tank/foo", entry["dataset"])
+				assert.Equal(t, "daily", entry["label"])
+				assert.Equal(t, "tank/foo@snap", entry["snapshot"])
+			}
+		} else {
+			assert.NotNil(t, json.Unmarshal(out, &map[string]interface{}{}), "did not expect output to be JSON")
+			assert.Contains(t, string(out), "label=daily")
+		}
+	}
+
+	_, err := newLogger(&bytes.Buffer{}, "INFO", "xml")
+	assert.NotNil(t, err)
+}
+
+func TestManageSeries(t *testing.T) {
+	now := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := seriesConfig{Label: "daily", Interval: 24 * time.Hour, Keep: 3}
+	errNoSpace := errors.New("out of space")
+
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	tool := &Tool{l: l, allowCreate: true, allowDestroy: true}
+
+	for _, tt := range []struct {
+		desc      string
+		snaps     []*zfstools.SnapMetadata
+		noCreate  bool
+		createErr error
+		created   bool
+		removed   int
+	}{
+		{"new snapshot due and created", dailySnaps(now.Add(-24*time.Hour), 3), false, nil, true, 1},
+		{"new snapshot due but creation fails", dailySnaps(now.Add(-24*time.Hour), 3), false, errNoSpace, true, 0},
+		{"no new snapshot due", dailySnaps(now, 4), false, nil, false, 1},
+		{"new snapshot due but dataset empty", dailySnaps(now.Add(-24*time.Hour), 4), true, nil, false, 1},
+		{"excluded dataset with a backlog", dailySnaps(now.Add(-48*time.Hour), 6), true, nil, false, 3},
+	} {
+		var created bool
+		var removed []*zfstools.SnapMetadata
+		create := func(*zfstools.SnapMetadata) error { created = true; return tt.createErr }
+		if tt.noCreate {
+			create = nil
+		}
+		err := tool.manageSeries("tank", s, tt.snaps, now, nil, create,
+			func(snaps []*zfstools.SnapMetadata) error { removed = append(removed, snaps...); return nil })
+
+		if tt.createErr != nil {
+			if assert.IsType(t, &createError{}, err, tt.desc) {
+				assert.Equal(t, tt.createErr, err.(*createError).err, tt.desc)
+			}
+		} else {
+			assert.NoError(t, err, tt.desc)
+		}
+		assert.Equal(t, tt.created, created, tt.desc)
+		assert.Equal(t, tt.removed, len(removed), tt.desc)
+	}
+}
+
+func TestManageSeriesKeepNone(t *testing.T) {
+	now := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := seriesConfig{Label: "daily", Interval: 24 * time.Hour, Keep: 0}
+	snaps := dailySnaps(now.Add(-24*time.Hour), 3)
+
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	tool := &Tool{l: l, allowCreate: true, allowDestroy: true}
+
+	var created bool
+	var removed []*zfstools.SnapMetadata
+	err := tool.manageSeries("tank", s, snaps, now, nil,
+		func(*zfstools.SnapMetadata) error { created = true; return nil },
+		func(snaps []*zfstools.SnapMetadata) error { removed = append(removed, snaps...); return nil })
+	assert.NoError(t, err)
+	assert.False(t, created, "no snapshot should be taken for a series that keeps none")
+	assert.Equal(t, snaps, removed)
+}
+
+func TestSnapshotDue(t *testing.T) {
+	now := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	errWritten := errors.New("no such snapshot")
+
+	for _, tt := range []struct {
+		desc       string
+		interval   time.Duration
+		threshold  uint64
+		last       time.Duration // how long ago the most recent snapshot was taken; 0 means there are no snapshots
+		written    uint64
+		writtenErr error
+		due        bool
+	}{
+		{"interval elapsed", 24 * time.Hour, 0, 24 * time.Hour, 0, nil, true},
+		{"interval not elapsed", 24 * time.Hour, 0, time.Hour, 1 << 40, nil, false},
+		{"threshold exceeded before interval", 24 * time.Hour, 1 << 20, time.Hour, 1<<20 + 1, nil, true},
+		{"threshold not exceeded at interval", 24 * time.Hour, 1 << 20, 48 * time.Hour, 1 << 20, nil, false},
+		{"threshold exceeded after interval", 24 * time.Hour, 1 << 20, 48 * time.Hour, 1 << 30, nil, true},
+		{"threshold only, exceeded", 0, 1 << 20, time.Minute, 1 << 30, nil, true},
+		{"threshold only, not exceeded", 0, 1 << 20, 1000 * time.Hour, 0, nil, false},
+		{"no snapshots yet", 24 * time.Hour, 1 << 20, 0, 0, nil, true},
+		{"written unavailable", 24 * time.Hour, 1 << 20, time.Hour, 0, errWritten, false},
+	} {
+		s := seriesConfig{Label: "daily", Interval: tt.interval, Keep: 3, WrittenThreshold: tt.threshold}
+		var snaps []*zfstools.SnapMetadata
+		if tt.last != 0 {
+			snaps = dailySnaps(now.Add(-tt.last), 2)
+		}
+		var writtenSince *zfstools.SnapMetadata
+		written := func(snap *zfstools.SnapMetadata) (uint64, error) {
+			writtenSince = snap
+			return tt.written, tt.writtenErr
+		}
+
+		due, err := snapshotDue(s, snaps, now, written)
+		if tt.writtenErr != nil {
+			assert.Error(t, err, tt.desc)
+		} else {
+			assert.NoError(t, err, tt.desc)
+		}
+		assert.Equal(t, tt.due, due, tt.desc)
+		if tt.threshold != 0 && len(snaps) > 0 {
+			assert.Equal(t, snaps[0], writtenSince, tt.desc)
+		}
+	}
+}
+
+func TestSelectDatasetsRecursive(t *testing.T) {
+	defer func(old bool) { *recursive = old }(*recursive)
+	*recursive = true
+
+	for _, tt := range []struct {
+		names    []string
+		selected []string
+		warning  string
+	}{
+		{[]string{"//"}, []string{"tank", "tank/child", "tank2"}, "-recursive has no effect"},
+		{[]string{"tank", "tank/child"}, []string{"tank", "tank/child"}, `ancestor=tank dataset="tank/child"`},
+		{[]string{"tank/child", "tank"}, []string{"tank", "tank/child"}, `ancestor=tank dataset="tank/child"`},
+		{[]string{"tank/child"}, []string{"tank/child"}, ""},
+		{[]string{"tank//child/"}, []string{"tank/child"}, ""},
+	} {
+		var buf bytes.Buffer
+		l := logrus.New()
+		l.Out = &buf
+		l.Formatter = &logrus.TextFormatter{DisableColors: true, DisableTimestamp: true}
+		tool := &Tool{l: l, datasetsByName: map[string]zfs.Dataset{"tank": {}, "tank/child": {}, "tank2": {}}}
+
+		targets, err := tool.selectDatasets(tt.names)
+		if assert.NoError(t, err, "%v", tt.names) {
+			assert.Equal(t, tt.selected, datasetNames(targets), "%v", tt.names)
+		}
+		if tt.warning != "" {
+			assert.Contains(t, buf.String(), tt.warning, "%v", tt.names)
+		} else {
+			assert.Empty(t, buf.String(), "%v", tt.names)
+		}
+	}
+}
+
+func TestSelectDatasetsInvalidName(t *testing.T) {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	tool := &Tool{l: l, datasetsByName: map[string]zfs.Dataset{"tank": {}}}
+
+	_, err := tool.selectDatasets([]string{"/tank"})
+	if assert.Error(t, err) {
+		assert.IsType(t, &zfstools.InvalidNameError{}, err)
+	}
+}
+
+func TestSelectRoots(t *testing.T) {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	tool := &Tool{l: l, allowCreate: true, datasetsByName: map[string]zfs.Dataset{
+		"tank": {}, "tank/a": {}, "tank/a/b": {}, "backup": {}, "backup/x": {}, "scratch": {},
+	}}
+
+	targets, err := tool.selectRoots([]string{"tank", "backup", "scratch"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"backup", "scratch", "tank"}, datasetNames(targets))
+
+	// Managing the selected datasets snapshots each pool's root dataset, and nothing else.
+	now := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := seriesConfig{Label: "premaint", Interval: time.Hour, Keep: 1}
+	var created []string
+	for _, name := range datasetNames(targets) {
+		assert.NoError(t, tool.manageSeries(name, s, nil, now, nil,
+			func(meta *zfstools.SnapMetadata) error { created = append(created, meta.Dataset); return nil },
+			func([]*zfstools.SnapMetadata) error { return nil }))
+	}
+	assert.Equal(t, []string{"backup", "scratch", "tank"}, created)
+
+	_, err = tool.selectRoots([]string{"tank", "missing"})
+	assert.Error(t, err)
+}
+
+func TestCoveredNames(t *testing.T) {
+	kept, covered := coveredNames([]string{"tank/a/b", "tank", "tank/a", "other", "tank2", "other"})
+	assert.Equal(t, []string{"tank", "other", "tank2"}, kept)
+	assert.Equal(t, map[string]string{"tank/a/b": "tank", "tank/a": "tank", "other": "other"}, covered)
+}
+
+func TestDatasetSeries(t *testing.T) {
+	series := []seriesConfig{
+		{Label: "hourly", Interval: time.Hour, Keep: 24},
+		{Label: "daily", Interval: 24 * time.Hour, Keep: 7},
+	}
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	tool := &Tool{l: l}
+
+	for _, tt := range []struct {
+		desc   string
+		props  map[string]zfs.Property
+		hourly int
+		daily  int
+	}{
+		{"no overrides", nil, 24, 7},
+		{"child overrides hourly", map[string]zfs.Property{
+			"zfstools:keep-hourly": {Value: "48", Source: "local"},
+		}, 48, 7},
+		{"inherited from the pool's root dataset", map[string]zfs.Property{
+			"zfstools:keep-hourly": {Value: "12", Source: "inherited from tank"},
+			"zfstools:keep-daily":  {Value: "-1", Source: "inherited from tank"},
+		}, 12, -1},
+		{"invalid values are ignored", map[string]zfs.Property{
+			"zfstools:keep-hourly": {Value: "lots", Source: "local"},
+			"zfstools:keep-daily":  {Value: "-2", Source: "local"},
+		}, 24, 7},
+	} {
+		effective := tool.datasetSeries("tank/child", zfs.Dataset{UserProperties: tt.props}, series)
+		assert.Equal(t, tt.hourly, effective[0].Keep, tt.desc)
+		assert.Equal(t, tt.daily, effective[1].Keep, tt.desc)
+	}
+
+	// The configured series are not modified.
+	assert.Equal(t, 24, series[0].Keep)
+}
+
+func TestDatasetEmpty(t *testing.T) {
+	for _, tt := range []struct {
+		referenced string
+		empty      bool
+	}{
+		{"0", true},
+		{"512", false},
+		{"24576", false},
+	} {
+		d := zfs.Dataset{Properties: map[zfs.Prop]zfs.Property{zfs.DatasetPropReferenced: {Value: tt.referenced}}}
+		empty, err := datasetEmpty(d)
+		if assert.NoError(t, err, tt.referenced) {
+			assert.Equal(t, tt.empty, empty, tt.referenced)
+		}
+	}
+
+	_, err := datasetEmpty(zfs.Dataset{})
+	assert.Error(t, err)
+}
+
+func TestDatasetReceiving(t *testing.T) {
+	for _, tt := range []struct {
+		path      string
+		props     map[zfs.Prop]zfs.Property
+		receiving bool
+	}{
+		{"tank/fs", map[zfs.Prop]zfs.Property{zfs.DatasetPropReceiveResumeToken: {Value: "1-e604ea4bf-e0-789c63a2"}}, true},
+		{"tank/fs", map[zfs.Prop]zfs.Property{zfs.DatasetPropReceiveResumeToken: {Value: "-"}}, false},
+		{"tank/fs", map[zfs.Prop]zfs.Property{zfs.DatasetPropInconsistent: {Value: "1"}}, true},
+		{"tank/fs", map[zfs.Prop]zfs.Property{zfs.DatasetPropInconsistent: {Value: "0"}}, false},
+		{"tank/fs/%recv", nil, true},
+		{"tank/fs", nil, false},
+	} {
+		assert.Equal(t, tt.receiving, datasetReceiving(tt.path, zfs.Dataset{Properties: tt.props}), "%s %v", tt.path,
+			tt.props)
+	}
+}
+
+func TestRemoveSnapshotsWithClones(t *testing.T) {
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.Out = &buf
+	tool := &Tool{
+		l:                  l,
+		destroyedSnapshots: make(map[string]struct{}),
+		snapshotClones:     map[string]string{"tank@zfs-auto-snap_daily_2010-01-01T03:04:05Z": "tank/experiment"},
+	}
+	snaps := dailySnaps(time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC), 2)
+
+	kept := tool.excludeCloned(snaps)
+	assert.Equal(t, snaps[:1], kept)
+	assert.Contains(t, buf.String(), "tank/experiment")
+	assert.True(t, tool.anyCloned([]string{snaps[0].Path(), snaps[1].Path()}))
+	assert.False(t, tool.anyCloned([]string{snaps[0].Path()}))
+
+	// Removing only the cloned snapshot succeeds without destroying anything.
+	n, err := tool.removeSnapshots(zfs.Dataset{}, snaps[1:], nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Empty(t, tool.destroyedSnapshots)
+}
+
+func TestRemoveSnapshotsErrors(t *testing.T) {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	tool := &Tool{l: l, destroyedSnapshots: make(map[string]struct{})}
+	snaps := dailySnaps(time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC), 2)
+
+	// Each snapshot that cannot be found is reported, not just the first.
+	n, err := tool.removeSnapshots(zfs.Dataset{}, snaps, nil)
+	assert.Equal(t, 0, n)
+	if errs, ok := err.(destroyErrors); assert.True(t, ok, "%v", err) && assert.Len(t, errs, 2) {
+		assert.Contains(t, errs[0].Error(), snaps[1].Path())
+		assert.Contains(t, errs[1].Error(), snaps[0].Path())
+		assert.Equal(t, errs[0].Error()+"; "+errs[1].Error(), err.Error())
+	}
+	assert.Empty(t, tool.destroyedSnapshots)
+}
+
+// withTestPool creates a pool with the given name, backed by a file, for the duration of the test.  Creating pools needs
+// root privileges, so the test is skipped without them.
+func withTestPool(t *testing.T, name string) (cleanup func()) {
+	if os.Geteuid() != 0 {
+		t.Skip("creating pools requires root privileges")
+	}
+
+	dir, err := ioutil.TempDir("", "zfs-auto-snapshot-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name+".img")
+	f, err := os.Create(path)
+	if err == nil {
+		err = f.Truncate(64 << 20) // the smallest vdev that ZFS accepts
+		f.Close()
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	pool, err := zfs.PoolCreate(name, []zfs.VDevTree{{Type: zfs.VDevTypeFile, Path: path}}, nil, zfs.PoolProperties{},
+		zfs.DatasetProperties{})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("failed to create pool %s: %v", name, err)
+	}
+	return func() {
+		pool.Destroy("zfs-auto-snapshot test")
+		pool.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// TestRemoveSnapshotsPartialFailure checks that when some of the snapshots cannot be destroyed, those that were are
+// still counted.
+func TestRemoveSnapshotsPartialFailure(t *testing.T) {
+	const name = "zfsautosnap_remove"
+	defer withTestPool(t, name)()
+
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	tool := &Tool{l: l, destroyedSnapshots: make(map[string]struct{})}
+	snaps := dailySnaps(time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC), 3)
+	for _, snap := range snaps {
+		snap.Dataset = name
+		d, err := zfs.DatasetSnapshot(snap.Path(), false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.Close()
+	}
+	// A held snapshot cannot be destroyed.
+	if err := zfs.DatasetHold(snaps[1].Path(), "test", false); err != nil {
+		t.Fatal(err)
+	}
+	defer zfs.DatasetRelease(snaps[1].Path(), "test", false)
+
+	d, err := zfs.DatasetOpen(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	n, err := tool.removeSnapshots(d, snaps, nil)
+	assert.Equal(t, 2, n)
+	if errs, ok := err.(destroyErrors); assert.True(t, ok, "%v", err) && assert.Len(t, errs, 1) {
+		assert.Contains(t, errs[0].Error(), snaps[1].Path())
+	}
+	assert.Len(t, tool.destroyedSnapshots, 2)
+}
+
+func TestExcludeSubtrees(t *testing.T) {
+	targets := make(map[string]zfs.Dataset)
+	for _, path := range []string{"tank", "tank/cache", "tank/cache/thumbs", "tank/cachet", "tank/home"} {
+		targets[path] = zfs.Dataset{}
+	}
+
+	removed := excludeSubtrees(targets, func(name string) bool { return name == "tank/cache" })
+	assert.Equal(t, []string{"tank/cache", "tank/cache/thumbs"}, removed)
+
+	var remaining []string
+	for path := range targets {
+		remaining = append(remaining, path)
+	}
+	sort.Strings(remaining)
+	assert.Equal(t, []string{"tank", "tank/cachet", "tank/home"}, remaining)
+}
+
+func TestKeepPools(t *testing.T) {
+	targets := make(map[string]zfs.Dataset)
+	for _, path := range []string{"tank", "tank/home", "tanker", "tanker/home", "backup/tank", "scratch"} {
+		targets[path] = zfs.Dataset{}
+	}
+
+	removed := keepPools(targets, map[string]bool{"tank": true, "scratch": true})
+	assert.Equal(t, []string{"backup/tank", "tanker", "tanker/home"}, removed)
+	assert.Equal(t, []string{"scratch", "tank", "tank/home"}, datasetNames(targets))
+
+	assert.Equal(t, []string{"tank", "tank/home"}, keepPools(targets, map[string]bool{"scratch": true}))
+	assert.Equal(t, []string{"scratch"}, keepPools(targets, map[string]bool{"backup": true}))
+	assert.Empty(t, targets)
+}
+
+func TestUnparsedSnapshots(t *testing.T) {
+	snapPaths := []string{
+		"tank@zfs-auto-snap_daily_2016-01-02T03:04:05Z",
+		"tank@zfs-auto-snap_daily_2016-01-02",           // truncated timestamp
+		"tank@zfs-auto-snap-daily-2016-01-02T03:04:05Z", // wrong separators
+		"tank@zfs-auto-snap_daily_2016-13-02T03:04:05Z", // no such month
+		"tank@zfs-auto-snap_hourly_2016-01-02-0304",     // legacy timestamp
+		"tank@manual-2016-01-02",
+		"tank@before-upgrade",
+	}
+
+	assert.Equal(t, []string{
+		"tank@zfs-auto-snap_daily_2016-01-02",
+		"tank@zfs-auto-snap-daily-2016-01-02T03:04:05Z",
+		"tank@zfs-auto-snap_daily_2016-13-02T03:04:05Z",
+		"tank@zfs-auto-snap_hourly_2016-01-02-0304",
+	}, unparsedSnapshots("zfs-auto-snap", snapPaths, "", "", nil))
+
+	// Names with timestamps in a configured legacy format are parsed.
+	assert.Equal(t, []string{
+		"tank@zfs-auto-snap_daily_2016-01-02",
+		"tank@zfs-auto-snap-daily-2016-01-02T03:04:05Z",
+		"tank@zfs-auto-snap_daily_2016-13-02T03:04:05Z",
+	}, unparsedSnapshots("zfs-auto-snap", snapPaths, "", "", []string{"2006-01-02-1504"}))
+
+	// With the label first, names with the prefix first are not parsed, and vice versa.
+	assert.Equal(t, []string{"tank@zfs-auto-snap_daily_2016-01-02T03:04:05Z"}, unparsedSnapshots("zfs-auto-snap",
+		[]string{"tank@zfs-auto-snap_daily_2016-01-02T03:04:05Z", "tank@daily_zfs-auto-snap_2016-01-02T03:04:05Z"},
+		zfstools.NameOrderLabelPrefix, "", nil))
+
+	// With another separator, names separated with underscores are not parsed.
+	assert.Equal(t, []string{"tank@zfs-auto-snap_daily_2016-01-02T03:04:05Z"}, unparsedSnapshots("zfs-auto-snap",
+		[]string{"tank@zfs-auto-snap_daily_2016-01-02T03:04:05Z", "tank@zfs-auto-snap daily 2016-01-02T03:04:05Z"},
+		"", " ", nil))
+}
+
+func TestReadonlyDatasets(t *testing.T) {
+	checked := make(map[string]int)
+	readonly := func(pool string) (bool, error) {
+		checked[pool]++
+		switch pool {
+		case "recovery":
+			return true, nil
+		case "missing":
+			return false, errors.New("no such pool")
+		}
+		return false, nil
+	}
+
+	ro, err := readonlyDatasets([]string{"tank", "tank/a", "recovery", "recovery/a", "recovery/a/b"}, readonly)
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]bool{"recovery": true, "recovery/a": true, "recovery/a/b": true}, ro)
+	}
+	// Each pool's property is read only once.
+	assert.Equal(t, map[string]int{"tank": 1, "recovery": 1}, checked)
+
+	_, err = readonlyDatasets([]string{"tank", "missing/a"}, readonly)
+	assert.Error(t, err)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kelleyk/zfstools"
+)
+
+// manifestEntry describes a snapshot created by a run, in the manifest written to the file given with -manifest.
+type manifestEntry struct {
+	Dataset string    `json:"dataset"`
+	Label   string    `json:"label"`
+	Name    string    `json:"name"` // the part of the snapshot's name after the "@"
+	Created time.Time `json:"created"`
+	GUID    uint64    `json:"guid"`
+}
+
+// manifestHeader is the header row of a CSV manifest.
+var manifestHeader = []string{"dataset", "label", "name", "created", "guid"}
+
+// validManifestFormat returns an error unless format is one that writeManifest understands.
+func validManifestFormat(format string) error {
+	if format != "json" && format != "csv" {
+		return fmt.Errorf("unexpected value for -manifest-format: %q", format)
+	}
+	return nil
+}
+
+// recordCreated adds the snapshot meta, which has just been created, to the entries that will be written to the
+// manifest.
+func (st *runStatus) recordCreated(meta *zfstools.SnapMetadata, guid uint64, created time.Time) {
+	st.manifest = append(st.manifest, manifestEntry{
+		Dataset: meta.Dataset,
+		Label:   meta.Label,
+		Name:    meta.Name(),
+		Created: created,
+		GUID:    guid,
+	})
+}
+
+// writeManifest writes the snapshots created by the run (see recordCreated) to path, in the given format ("json" or
+// "csv"), replacing the file atomically.  Entries are sorted by dataset and then by label, since datasets may have been
+// managed in parallel.
+func (st *runStatus) writeManifest(path, format string) error {
+	entries := append([]manifestEntry{}, st.manifest...)
+	sort.Sort(manifestByDataset(entries))
+
+	var buf []byte
+	switch format {
+	case "json":
+		var err error
+		if buf, err = json.MarshalIndent(entries, "", "  "); err != nil {
+			return err
+		}
+	case "csv":
+		var b bytes.Buffer
+		w := csv.NewWriter(&b)
+		w.Write(manifestHeader)
+		for _, e := range entries {
+			w.Write([]string{e.Dataset, e.Label, e.Name, e.Created.UTC().Format(time.RFC3339),
+				strconv.FormatUint(e.GUID, 10)})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		buf = b.Bytes()
+	default:
+		return validManifestFormat(format)
+	}
+	return writeFileAtomic(path, buf)
+}
+
+type manifestByDataset []manifestEntry
+
+func (a manifestByDataset) Len() int      { return len(a) }
+func (a manifestByDataset) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a manifestByDataset) Less(i, j int) bool {
+	if a[i].Dataset != a[j].Dataset {
+		return a[i].Dataset < a[j].Dataset
+	}
+	return a[i].Label < a[j].Label
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zfs-auto-snapshot-test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	t0 := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	created := []struct {
+		meta *zfstools.SnapMetadata
+		guid uint64
+	}{
+		{&zfstools.SnapMetadata{Dataset: "tank/b", Prefix: "zfs-auto-snap", Label: "hourly", TS: t0}, 3},
+		{&zfstools.SnapMetadata{Dataset: "tank/a", Prefix: "zfs-auto-snap", Label: "hourly", TS: t0}, 2},
+		{&zfstools.SnapMetadata{Dataset: "tank/a", Prefix: "zfs-auto-snap", Label: "daily", TS: t0}, 1},
+	}
+
+	st, err := loadRunStatus("")
+	if !assert.NoError(t, err) {
+		return
+	}
+	// Snapshots created by an earlier run are not included.
+	st.recordCreated(&zfstools.SnapMetadata{Dataset: "tank/old", Label: "daily", TS: t0}, 99, t0)
+	st.beginRun(t0)
+	for _, c := range created {
+		st.recordCreated(c.meta, c.guid, c.meta.TS)
+	}
+
+	// Sorted by dataset and then by label.
+	want := []manifestEntry{
+		{Dataset: "tank/a", Label: "daily", Name: "zfs-auto-snap_daily_2016-01-01T00:00:00Z", Created: t0, GUID: 1},
+		{Dataset: "tank/a", Label: "hourly", Name: "zfs-auto-snap_hourly_2016-01-01T00:00:00Z", Created: t0, GUID: 2},
+		{Dataset: "tank/b", Label: "hourly", Name: "zfs-auto-snap_hourly_2016-01-01T00:00:00Z", Created: t0, GUID: 3},
+	}
+
+	jsonPath := filepath.Join(dir, "manifest.json")
+	if assert.NoError(t, st.writeManifest(jsonPath, "json")) {
+		buf, err := ioutil.ReadFile(jsonPath)
+		var got []manifestEntry
+		if assert.NoError(t, err) && assert.NoError(t, json.Unmarshal(buf, &got)) {
+			assert.Equal(t, want, got)
+		}
+	}
+
+	csvPath := filepath.Join(dir, "manifest.csv")
+	if assert.NoError(t, st.writeManifest(csvPath, "csv")) {
+		f, err := os.Open(csvPath)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer f.Close()
+		records, err := csv.NewReader(f).ReadAll()
+		if assert.NoError(t, err) && assert.Equal(t, len(want)+1, len(records)) {
+			assert.Equal(t, manifestHeader, records[0])
+			for i, e := range want {
+				assert.Equal(t, []string{e.Dataset, e.Label, e.Name, "2016-01-01T00:00:00Z", strconv.FormatUint(e.GUID, 10)},
+					records[i+1])
+			}
+		}
+	}
+
+	assert.Error(t, st.writeManifest(filepath.Join(dir, "manifest.xml"), "xml"))
+}
+
+func TestManifestEmpty(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zfs-auto-snapshot-test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// A run that creates no snapshots still writes a manifest, so that a stale one is not mistaken for it.
+	st, err := loadRunStatus("")
+	if !assert.NoError(t, err) {
+		return
+	}
+	path := filepath.Join(dir, "manifest.json")
+	if assert.NoError(t, st.writeManifest(path, "json")) {
+		buf, err := ioutil.ReadFile(path)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "[]", string(buf))
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// pushgatewayJob is the job label under which metrics are pushed to a Prometheus Pushgateway.
+const pushgatewayJob = "zfs-auto-snapshot"
+
+// pushClient is used to push metrics.  Unlike http.DefaultClient, it gives up on a Pushgateway that does not respond,
+// so that an unreachable gateway cannot hold up the end of a run indefinitely.
+var pushClient = &http.Client{Timeout: 30 * time.Second}
+
+// metrics renders the outcome of the run that st describes, which took duration, in the Prometheus text exposition
+// format.
+func (st *runStatus) metrics(duration time.Duration) []byte {
+	var buf bytes.Buffer
+	gauge := func(name, help string, value interface{}) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+
+	gauge("zfs_auto_snapshot_snapshots_created", "Number of snapshots created by the last run.", st.Created)
+	gauge("zfs_auto_snapshot_snapshots_destroyed", "Number of snapshots destroyed by the last run.", st.Removed)
+	gauge("zfs_auto_snapshot_series_errors", "Number of series that the last run failed to manage.", st.Errors)
+	failed := 0
+	if st.LastError != "" {
+		failed = 1
+	}
+	gauge("zfs_auto_snapshot_failed", "Whether the last run failed.", failed)
+	gauge("zfs_auto_snapshot_duration_seconds", "Duration of the last run.", duration.Seconds())
+	if !st.LastSuccess.IsZero() {
+		gauge("zfs_auto_snapshot_last_success_timestamp_seconds", "Time at which the last successful run began.",
+			st.LastSuccess.Unix())
+	}
+	return buf.Bytes()
+}
+
+// pushMetrics pushes body (in the text exposition format) to the Prometheus Pushgateway at gatewayURL, grouped by job
+// and by instance.  Metrics are POSTed so that those that are absent from body (e.g. the time of the last successful
+// run, when that is not known) keep their previously-pushed values.
+func pushMetrics(gatewayURL, instance string, body []byte) error {
+	u := strings.TrimSuffix(gatewayURL, "/") + "/metrics/job/" + pushgatewayJob + "/instance/" +
+		(&url.URL{Path: instance}).EscapedPath()
+
+	resp, err := pushClient.Post(u, "text/plain; version=0.0.4", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("pushgateway returned %s", resp.Status)
+	}
+	return nil
+}
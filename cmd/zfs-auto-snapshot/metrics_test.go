@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushMetrics(t *testing.T) {
+	var method, path, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := ioutil.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(buf)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	t0 := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	st, err := loadRunStatus("")
+	if !assert.NoError(t, err) {
+		return
+	}
+	st.beginRun(t0)
+	st.recordSeries("tank", "hourly", t0, 1, 2, nil)
+	st.recordSeries("tank", "daily", t0, 1, 0, errors.New("out of space"))
+	st.endRun(t0, nil)
+
+	assert.NoError(t, pushMetrics(srv.URL+"/", "nas", st.metrics(1500*time.Millisecond)))
+	assert.Equal(t, "POST", method)
+	assert.Equal(t, "/metrics/job/zfs-auto-snapshot/instance/nas", path)
+	for _, line := range []string{
+		"zfs_auto_snapshot_snapshots_created 2",
+		"zfs_auto_snapshot_snapshots_destroyed 2",
+		"zfs_auto_snapshot_series_errors 1",
+		"zfs_auto_snapshot_failed 0",
+		"zfs_auto_snapshot_duration_seconds 1.5",
+		"zfs_auto_snapshot_last_success_timestamp_seconds 1451606400",
+		"# TYPE zfs_auto_snapshot_failed gauge",
+	} {
+		assert.Contains(t, strings.Split(body, "\n"), line)
+	}
+
+	// A failed run does not report a last success, so that the previously-pushed value is kept.
+	st, _ = loadRunStatus("")
+	st.beginRun(t0)
+	st.endRun(t0, errors.New("no such dataset"))
+	body = string(st.metrics(time.Second))
+	assert.Contains(t, body, "zfs_auto_snapshot_failed 1\n")
+	assert.NotContains(t, body, "last_success")
+
+	// Errors from the Pushgateway are reported.
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad metrics", http.StatusBadRequest)
+	}))
+	defer failing.Close()
+	assert.Error(t, pushMetrics(failing.URL, "nas", st.metrics(time.Second)))
+}
+
+func TestPushMetricsTimeout(t *testing.T) {
+	stalled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stalled
+	}))
+	defer srv.Close()
+	defer close(stalled)
+
+	defer func(c *http.Client) { pushClient = c }(pushClient)
+	pushClient = &http.Client{Timeout: 100 * time.Millisecond}
+
+	st, _ := loadRunStatus("")
+	start := time.Now()
+	assert.Error(t, pushMetrics(srv.URL, "nas", st.metrics(time.Second)))
+	assert.True(t, time.Since(start) < 5*time.Second, "pushMetrics took %s", time.Since(start))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// forEachDataset calls fn with each of the named datasets, making at most parallelism calls at once and, if perPool is
+// nonzero, at most perPool calls at once for datasets on any one pool.  Each pool has its own workers, which compete
+// for the global limit, so that a pool with many datasets does not keep the datasets of other pools waiting.
+//
+// The datasets of each pool are visited in sorted order.  If a call returns an error, no further calls are started,
+// and the first error is returned once the calls in progress have finished.
+//
+// If parallelism is 1, the datasets are visited one at a time in sorted order (pools are not interleaved), so that
+// the logs and the output of -dry-run are the same from one run to the next.
+//
+// Beware that libzfs is not MT-safe: the calls share the one global libzfs handle, and an error that one call reads
+// from it (see zfs.LastError) may have been left there by another.  That is why -parallelism defaults to 1.
+//
+func forEachDataset(names []string, parallelism, perPool int, fn func(name string) error) error {
+	if parallelism == 1 {
+		sorted := append([]string{}, names...)
+		sort.Strings(sorted)
+		for _, name := range sorted {
+			if err := fn(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	byPool := make(map[string][]string)
+	for _, name := range names {
+		pool := poolName(name)
+		byPool[pool] = append(byPool[pool], name)
+	}
+
+	var mu sync.Mutex
+	var firstErr error
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	global := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	pools := make([]string, 0, len(byPool))
+	for pool := range byPool {
+		pools = append(pools, pool)
+	}
+	sort.Strings(pools)
+	for _, pool := range pools {
+		poolNames := byPool[pool]
+		sort.Strings(poolNames)
+		queue := make(chan string, len(poolNames))
+		for _, name := range poolNames {
+			queue <- name
+		}
+		close(queue)
+
+		workers := len(poolNames)
+		if perPool > 0 && perPool < workers {
+			workers = perPool
+		}
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for name := range queue {
+					global <- struct{}{}
+					if !failed() {
+						if err := fn(name); err != nil {
+							mu.Lock()
+							if firstErr == nil {
+								firstErr = err
+							}
+							mu.Unlock()
+						}
+					}
+					<-global
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	return firstErr
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForEachDataset(t *testing.T) {
+	var names []string
+	for _, pool := range []string{"tank", "scratch", "backup"} {
+		names = append(names, pool)
+		for i := 0; i < 5; i++ {
+			names = append(names, fmt.Sprintf("%s/fs%d", pool, i))
+		}
+	}
+
+	for _, tt := range []struct {
+		parallelism, perPool int
+	}{
+		{1, 0},
+		{4, 2},
+		{8, 1},
+		{3, 0},
+	} {
+		var mu sync.Mutex
+		var visited []string
+		running := make(map[string]int)
+		maxRunning := make(map[string]int)
+		total, maxTotal := 0, 0
+
+		err := forEachDataset(names, tt.parallelism, tt.perPool, func(name string) error {
+			pool := poolName(name)
+			mu.Lock()
+			visited = append(visited, name)
+			running[pool]++
+			total++
+			if running[pool] > maxRunning[pool] {
+				maxRunning[pool] = running[pool]
+			}
+			if total > maxTotal {
+				maxTotal = total
+			}
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			running[pool]--
+			total--
+			mu.Unlock()
+			return nil
+		})
+		desc := fmt.Sprintf("parallelism %d, per-pool %d", tt.parallelism, tt.perPool)
+		assert.NoError(t, err, desc)
+
+		sort.Strings(visited)
+		sorted := append([]string(nil), names...)
+		sort.Strings(sorted)
+		assert.Equal(t, sorted, visited, desc)
+
+		assert.True(t, maxTotal <= tt.parallelism, "%s: %d calls at once", desc, maxTotal)
+		for pool, n := range maxRunning {
+			if tt.perPool > 0 {
+				assert.True(t, n <= tt.perPool, "%s: %d calls at once on %s", desc, n, pool)
+			}
+		}
+	}
+
+	// After a failure, no further calls are started.
+	errFailed := errors.New("failed")
+	calls := 0
+	err := forEachDataset(names, 1, 0, func(name string) error {
+		calls++
+		return errFailed
+	})
+	assert.Equal(t, errFailed, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestForEachDatasetOrder(t *testing.T) {
+	names := []string{"tank/b", "scratch", "tank", "backup/x", "tank/a", "scratch/tmp", "backup"}
+
+	var runs [][]string
+	for i := 0; i < 10; i++ {
+		var visited []string
+		assert.NoError(t, forEachDataset(names, 1, 0, func(name string) error {
+			visited = append(visited, name)
+			return nil
+		}))
+		runs = append(runs, visited)
+	}
+
+	// Without parallelism, every run visits the datasets in the same (sorted) order, whatever the pool.
+	want := []string{"backup", "backup/x", "scratch", "scratch/tmp", "tank", "tank/a", "tank/b"}
+	for _, visited := range runs {
+		assert.Equal(t, want, visited)
+	}
+	// The caller's slice is left alone.
+	assert.Equal(t, "tank/b", names[0])
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/kelleyk/zfstools"
+)
+
+// plan accumulates the changes that a dry run would have made.
+type plan struct {
+	entries []planEntry
+}
+
+type planEntry struct {
+	dataset, label string
+	create         bool
+	snapshot       string // the full name of the snapshot to be created or destroyed
+	ts             time.Time
+}
+
+// addCreate records that the snapshot described by meta would be created.
+func (p *plan) addCreate(meta *zfstools.SnapMetadata) {
+	p.entries = append(p.entries, planEntry{dataset: meta.Dataset, label: meta.Label, create: true,
+		snapshot: meta.Path(), ts: meta.TS})
+}
+
+// addRemove records that snaps would be destroyed.
+func (p *plan) addRemove(snaps []*zfstools.SnapMetadata) {
+	for _, snap := range snaps {
+		p.entries = append(p.entries, planEntry{dataset: snap.Dataset, label: snap.Label, snapshot: snap.Path(),
+			ts: snap.TS})
+	}
+}
+
+// lines returns one tab-separated line per change, sorted by dataset, then label, then snapshot name, with creations
+// before destructions.  A creation is shown as "+ DATASET LABEL"; since the name of the new snapshot depends on the
+// time, it is omitted.  A destruction is shown as "- DATASET LABEL SNAPSHOT".
+func (p *plan) lines() []string {
+	entries := append([]planEntry(nil), p.entries...)
+	sort.Sort(byPlanOrder(entries))
+
+	lines := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.create {
+			lines = append(lines, fmt.Sprintf("+\t%s\t%s", e.dataset, e.label))
+		} else {
+			lines = append(lines, fmt.Sprintf("-\t%s\t%s\t%s", e.dataset, e.label, e.snapshot))
+		}
+	}
+	return lines
+}
+
+// planJSON is the document written by -output=json.
+type planJSON struct {
+	Series []planSeriesJSON `json:"series"`
+}
+
+// planSeriesJSON describes the changes to one series of one dataset.
+type planSeriesJSON struct {
+	Dataset string             `json:"dataset"`
+	Label   string             `json:"label"`
+	Create  []planSnapshotJSON `json:"create"`
+	Destroy []planSnapshotJSON `json:"destroy"`
+}
+
+type planSnapshotJSON struct {
+	Snapshot  string    `json:"snapshot"` // the full name of the snapshot
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// writeJSON writes the changes to w as a JSON document with an entry for each series of each dataset that would
+// change, sorted as by lines.
+func (p *plan) writeJSON(w io.Writer) error {
+	entries := append([]planEntry(nil), p.entries...)
+	sort.Sort(byPlanOrder(entries))
+
+	doc := planJSON{Series: []planSeriesJSON{}}
+	for _, e := range entries {
+		n := len(doc.Series)
+		if n == 0 || doc.Series[n-1].Dataset != e.dataset || doc.Series[n-1].Label != e.label {
+			doc.Series = append(doc.Series, planSeriesJSON{
+				Dataset: e.dataset,
+				Label:   e.label,
+				Create:  []planSnapshotJSON{},
+				Destroy: []planSnapshotJSON{},
+			})
+			n++
+		}
+		snap := planSnapshotJSON{Snapshot: e.snapshot, Timestamp: e.ts}
+		if e.create {
+			doc.Series[n-1].Create = append(doc.Series[n-1].Create, snap)
+		} else {
+			doc.Series[n-1].Destroy = append(doc.Series[n-1].Destroy, snap)
+		}
+	}
+
+	buf, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", buf)
+	return err
+}
+
+type byPlanOrder []planEntry
+
+func (a byPlanOrder) Len() int      { return len(a) }
+func (a byPlanOrder) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byPlanOrder) Less(i, j int) bool {
+	switch {
+	case a[i].dataset != a[j].dataset:
+		return a[i].dataset < a[j].dataset
+	case a[i].label != a[j].label:
+		return a[i].label < a[j].label
+	case a[i].create != a[j].create:
+		return a[i].create
+	default:
+		return a[i].snapshot < a[j].snapshot
+	}
+}
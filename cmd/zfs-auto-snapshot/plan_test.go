@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunDiff(t *testing.T) {
+	now := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	series := []seriesConfig{
+		{Label: "hourly", Interval: time.Hour, Keep: 2},
+		{Label: "daily", Interval: 24 * time.Hour, Keep: 3},
+	}
+
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	tool := &Tool{l: l, dryRun: true, plan: &plan{}}
+
+	// A fixed synthetic state.  tank/b's daily series is up to date; everything else needs a new snapshot.
+	state := map[string]map[string][]*zfstools.SnapMetadata{
+		"tank/b": {
+			"hourly": seriesSnaps(dailySnaps(now.Add(-2*time.Hour), 3), "tank/b", "hourly"),
+			"daily":  seriesSnaps(dailySnaps(now, 4), "tank/b", "daily"),
+		},
+		"tank/a": {
+			"hourly": nil,
+			"daily":  seriesSnaps(dailySnaps(now.Add(-24*time.Hour), 3), "tank/a", "daily"),
+		},
+	}
+
+	remove := func(snaps []*zfstools.SnapMetadata) error {
+		tool.plan.addRemove(snaps)
+		return nil
+	}
+	for dataset, bySeries := range state {
+		for _, s := range series {
+			err := tool.manageSeries(dataset, s, bySeries[s.Label], now, nil,
+				func(*zfstools.SnapMetadata) error { t.Fatal("create called during dry run"); return nil }, remove)
+			assert.NoError(t, err)
+		}
+	}
+
+	golden, err := ioutil.ReadFile("testdata/diff.golden")
+	if assert.NoError(t, err) {
+		assert.Equal(t, string(golden), strings.Join(tool.plan.lines(), "\n")+"\n")
+	}
+}
+
+func TestPlanJSON(t *testing.T) {
+	now := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	p := &plan{}
+	old := seriesSnaps(dailySnaps(now, 3), "tank/b", "daily")
+	p.addRemove(old[1:])
+	p.addCreate(&zfstools.SnapMetadata{Dataset: "tank/a", Prefix: "zfs-auto-snap", Label: "hourly", TS: now})
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, p.writeJSON(&buf)) {
+		return
+	}
+	var doc planJSON
+	if assert.NoError(t, json.Unmarshal(buf.Bytes(), &doc)) {
+		assert.Equal(t, planJSON{Series: []planSeriesJSON{
+			{
+				Dataset: "tank/a",
+				Label:   "hourly",
+				Create: []planSnapshotJSON{
+					{Snapshot: "tank/a@zfs-auto-snap_hourly_2010-01-02T03:04:05Z", Timestamp: now},
+				},
+				Destroy: []planSnapshotJSON{},
+			},
+			{
+				Dataset: "tank/b",
+				Label:   "daily",
+				Create:  []planSnapshotJSON{},
+				Destroy: []planSnapshotJSON{
+					{Snapshot: old[2].Path(), Timestamp: old[2].TS},
+					{Snapshot: old[1].Path(), Timestamp: old[1].TS},
+				},
+			},
+		}}, doc)
+	}
+
+	// An empty plan is still a document.
+	buf.Reset()
+	assert.NoError(t, (&plan{}).writeJSON(&buf))
+	assert.JSONEq(t, `{"series": []}`, buf.String())
+}
+
+// seriesSnaps moves each of snaps into the given dataset and series.
+func seriesSnaps(snaps []*zfstools.SnapMetadata, dataset, label string) []*zfstools.SnapMetadata {
+	for _, snap := range snaps {
+		snap.Dataset, snap.Label = dataset, label
+	}
+	return snaps
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// policyConfig gives the datasets in a subtree their own series (see configFile.Policies).
+type policyConfig struct {
+	// Pattern is a glob (see path.Match, e.g. "tank/vm/*") that selects the datasets that the policy applies to: those
+	// whose names, or the names of any of whose ancestors, match it.
+	Pattern string
+
+	// Series are merged with the configuration file's series: each replaces the series with the same label, if there
+	// is one, and is added otherwise.
+	Series []seriesConfig
+}
+
+// patternSpecificity returns the length of the literal prefix of the glob pattern (the part before its first
+// metacharacter), by which policies are ranked when more than one applies to a dataset.
+func patternSpecificity(pattern string) int {
+	if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+		return i
+	}
+	return len(pattern)
+}
+
+// matchPolicy returns the policy among policies that applies to the dataset name, or nil if none does.  When more than
+// one applies, the one whose pattern has the longest literal prefix wins (so "tank/vm/db/*" beats "tank/vm/*"), then
+// the one that matches the dataset itself or its nearest ancestor, then the one that is listed first.
+func matchPolicy(policies []policyConfig, name string) *policyConfig {
+	var best *policyConfig
+	bestSpecificity, bestDepth := -1, -1
+	for i := range policies {
+		p := &policies[i]
+		depth := -1
+		for ancestor := name; ; ancestor = ancestor[:strings.LastIndex(ancestor, "/")] {
+			if ok, _ := path.Match(p.Pattern, ancestor); ok {
+				depth = strings.Count(ancestor, "/")
+				break
+			}
+			if !strings.Contains(ancestor, "/") {
+				break
+			}
+		}
+		if depth < 0 {
+			continue
+		}
+		specificity := patternSpecificity(p.Pattern)
+		if specificity > bestSpecificity || (specificity == bestSpecificity && depth > bestDepth) {
+			best, bestSpecificity, bestDepth = p, specificity, depth
+		}
+	}
+	return best
+}
+
+// resolvePolicy returns the series that apply to the dataset name: series (the configuration file's series) merged
+// with those of the policy that applies to it (see matchPolicy), if any.  series is not modified.
+func resolvePolicy(policies []policyConfig, name string, series []seriesConfig) []seriesConfig {
+	p := matchPolicy(policies, name)
+	if p == nil {
+		return series
+	}
+
+	merged := append([]seriesConfig(nil), series...)
+	for _, s := range p.Series {
+		replaced := false
+		for i := range merged {
+			if merged[i].Label == s.Label {
+				merged[i] = s
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, s)
+		}
+	}
+	return merged
+}
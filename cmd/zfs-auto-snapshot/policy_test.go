@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestResolvePolicy(t *testing.T) {
+	hourly := seriesConfig{Label: "hourly", Interval: time.Hour, Keep: 24}
+	daily := seriesConfig{Label: "daily", Interval: 24 * time.Hour, Keep: 7}
+	global := []seriesConfig{hourly, daily}
+
+	vmDaily := seriesConfig{Label: "daily", Interval: 24 * time.Hour, Keep: 3}
+	dbDaily := seriesConfig{Label: "daily", Interval: 24 * time.Hour, Keep: 30}
+	backupWeekly := seriesConfig{Label: "weekly", Interval: 168 * time.Hour, Keep: 52}
+	policies := []policyConfig{
+		{Pattern: "tank/*", Series: []seriesConfig{{Label: "hourly", Interval: time.Hour, Keep: 48}}},
+		{Pattern: "tank/vm/*", Series: []seriesConfig{vmDaily}},
+		{Pattern: "tank/vm/db*", Series: []seriesConfig{dbDaily}},
+		{Pattern: "tank/backup", Series: []seriesConfig{backupWeekly}},
+	}
+
+	for _, tt := range []struct {
+		dataset string
+		want    []seriesConfig
+	}{
+		// No policy applies; the global series are used as they are.
+		{"tank", global},
+		{"scratch/tmp", global},
+		// A new series is added to the global ones.
+		{"tank/backup", []seriesConfig{hourly, daily, backupWeekly}},
+		// Policies apply to the descendants of the datasets that they match.
+		{"tank/backup/host1", []seriesConfig{hourly, daily, backupWeekly}},
+		// The policy with the longest literal prefix wins...
+		{"tank/vm/web", []seriesConfig{hourly, vmDaily}},
+		{"tank/vm/web/disk0", []seriesConfig{hourly, vmDaily}},
+		{"tank/vm/db1", []seriesConfig{hourly, dbDaily}},
+		{"tank/vm/db1/log", []seriesConfig{hourly, dbDaily}},
+		// ...and policies are not combined with one another.
+		{"tank/home", []seriesConfig{{Label: "hourly", Interval: time.Hour, Keep: 48}, daily}},
+	} {
+		assert.Equal(t, tt.want, resolvePolicy(policies, tt.dataset, global), tt.dataset)
+	}
+	assert.Equal(t, 7, global[1].Keep, "the global series were modified")
+
+	// Between equally specific patterns, the one that matches the nearest ancestor wins.
+	overlapping := []policyConfig{
+		{Pattern: "tank/*", Series: []seriesConfig{vmDaily}},
+		{Pattern: "tank/*/*", Series: []seriesConfig{dbDaily}},
+	}
+	assert.Equal(t, []seriesConfig{hourly, vmDaily}, resolvePolicy(overlapping, "tank/a", global))
+	assert.Equal(t, []seriesConfig{hourly, dbDaily}, resolvePolicy(overlapping, "tank/a/b", global))
+	assert.Equal(t, []seriesConfig{hourly, dbDaily}, resolvePolicy(overlapping, "tank/a/b/c", global))
+}
+
+func TestPolicyConfig(t *testing.T) {
+	conf := &configFile{}
+	err := yaml.Unmarshal([]byte(`
+series:
+  - label: daily
+    interval: 24h
+    keep: 7
+policies:
+  - pattern: "tank/vm/*"
+    series:
+      - label: daily
+        interval: 24h
+        keep: 3
+`), conf)
+	if assert.NoError(t, err) && assert.NoError(t, conf.Validate()) {
+		assert.Equal(t, 3, resolvePolicy(conf.Policies, "tank/vm/web", conf.Series)[0].Keep)
+		assert.Equal(t, 7, resolvePolicy(conf.Policies, "tank/home", conf.Series)[0].Keep)
+	}
+
+	conf = &configFile{Policies: []policyConfig{
+		{Pattern: "[", Series: []seriesConfig{{Label: "daily", Interval: 24 * time.Hour, Keep: 3}}},
+		{Pattern: "", Series: []seriesConfig{{Label: "daily_x", Interval: time.Second, Keep: 3}}},
+	}}
+	var fields []string
+	if errs, ok := conf.Validate().(configErrors); assert.True(t, ok) {
+		for _, err := range errs {
+			fields = append(fields, err.(configProblem).Field)
+		}
+	}
+	assert.Equal(t, []string{"policies[0].pattern", "policies[1].pattern", "policies[1].series[0].label"}, fields)
+	if errs := conf.fastIntervals(time.Minute); assert.Len(t, errs, 1) {
+		assert.Equal(t, "policies[1].series[0].interval", errs[0].(configProblem).Field)
+	}
+}
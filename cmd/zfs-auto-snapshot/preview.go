@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/kelleyk/go-libzfs"
+	"github.com/kelleyk/zfstools"
+)
+
+// previewRun describes the snapshots of a series after one simulated run of the tool; see simulateRetention.
+type previewRun struct {
+	At        time.Time
+	Created   *zfstools.SnapMetadata   // nil if no snapshot was taken
+	Retained  []*zfstools.SnapMetadata // most recent first, including Created
+	Destroyed []*zfstools.SnapMetadata
+}
+
+// previewStep returns the interval at which to simulate runs of the tool when previewing the given series: that of
+// the most frequent series, since that is how often the tool is expected to be run.
+func previewStep(series []seriesConfig) (time.Duration, error) {
+	var step time.Duration
+	for _, s := range series {
+		if s.Interval > 0 && (step == 0 || s.Interval < step) {
+			step = s.Interval
+		}
+	}
+	if step == 0 {
+		return 0, errors.New("no series has an interval, so there is nothing to preview")
+	}
+	return step, nil
+}
+
+// simulateRetention simulates running the tool every step, starting at start and for span, against the series s of
+// the dataset dsPath, whose existing snapshots are snaps (most recent first).  The same logic as a real run (see
+// manageSeries) decides which snapshots are taken and destroyed; holds and -protect-backup-base are not taken into
+// account.  Since future writes cannot be predicted, a series with a WrittenThreshold is simulated as though nothing
+// were written.
+func simulateRetention(dsPath string, s seriesConfig, snaps []*zfstools.SnapMetadata, start time.Time, span,
+	step time.Duration) ([]previewRun, error) {
+
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	sim := &Tool{l: l, allowCreate: true, allowDestroy: true}
+
+	snaps = append([]*zfstools.SnapMetadata(nil), snaps...)
+	var runs []previewRun
+	for now := start; !now.After(start.Add(span)); now = now.Add(step) {
+		run := previewRun{At: now}
+		written := func(*zfstools.SnapMetadata) (uint64, error) { return 0, nil }
+		create := func(meta *zfstools.SnapMetadata) error {
+			run.Created = meta
+			return nil
+		}
+		remove := func(toRemove []*zfstools.SnapMetadata) error {
+			run.Destroyed = append(run.Destroyed, toRemove...)
+			return nil
+		}
+		if err := sim.manageSeries(dsPath, s, snaps, now, written, create, remove); err != nil {
+			return nil, err
+		}
+
+		if run.Created != nil {
+			snaps = append([]*zfstools.SnapMetadata{run.Created}, snaps...)
+		}
+		snaps = withoutSnapshots(snaps, run.Destroyed)
+		run.Retained = snaps
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// withoutSnapshots returns snaps less those in removed.
+func withoutSnapshots(snaps, removed []*zfstools.SnapMetadata) []*zfstools.SnapMetadata {
+	gone := make(map[*zfstools.SnapMetadata]bool, len(removed))
+	for _, snap := range removed {
+		gone[snap] = true
+	}
+	kept := make([]*zfstools.SnapMetadata, 0, len(snaps))
+	for _, snap := range snaps {
+		if !gone[snap] {
+			kept = append(kept, snap)
+		}
+	}
+	return kept
+}
+
+// formatPreview returns one line for each of runs in which a snapshot was taken or destroyed.  Each line gives the
+// time of the run, then the series' snapshots as of that run, most recent first: "+" for one that was taken by the
+// run, "#" for one that was retained, and "x" for one that was destroyed; then the time of the oldest snapshot
+// retained.
+func formatPreview(runs []previewRun) []string {
+	var lines []string
+	for _, run := range runs {
+		if run.Created == nil && len(run.Destroyed) == 0 {
+			continue
+		}
+		timeline := strings.Repeat("#", len(run.Retained)) + strings.Repeat("x", len(run.Destroyed))
+		if run.Created != nil {
+			timeline = "+" + timeline[1:]
+		}
+		oldest := "-"
+		if len(run.Retained) > 0 {
+			oldest = run.Retained[len(run.Retained)-1].TS.UTC().Format(time.RFC3339)
+		}
+		lines = append(lines, fmt.Sprintf("%s  %s  oldest: %s", run.At.UTC().Format(time.RFC3339), timeline, oldest))
+	}
+	return lines
+}
+
+// previewRetention writes a timeline (see formatPreview) for each of the given series of each of the given datasets
+// to w, simulating runs of the tool over span.
+func (tool *Tool) previewRetention(w io.Writer, datasets map[string]zfs.Dataset, series []seriesConfig,
+	span time.Duration) error {
+
+	step, err := previewStep(series)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, dsPath := range datasetNames(datasets) {
+		series := tool.datasetSeries(dsPath, datasets[dsPath], series)
+		for _, s := range series {
+			snaps, err := tool.getSnapshots(datasets[dsPath], s)
+			if err != nil {
+				return err
+			}
+			runs, err := simulateRetention(dsPath, s, snaps, now, span, step)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%s %s (%d existing snapshots)\n", dsPath, s.Label, len(snaps))
+			for _, line := range formatPreview(runs) {
+				fmt.Fprintf(w, "  %s\n", line)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulateRetention(t *testing.T) {
+	start := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	day := 24 * time.Hour
+	s := seriesConfig{Label: "daily", Interval: day, Keep: 3}
+
+	// Two existing snapshots, the most recent of which was taken half a day ago.
+	existing := dailySnaps(start.Add(-12*time.Hour), 2)
+	runs, err := simulateRetention("tank", s, existing, start, 30*day, day)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, runs, 31)
+
+	// The first run is too soon after the most recent existing snapshot to take another; each later run takes one, and
+	// once three are retained, each destroys the oldest.
+	var created, destroyed []int
+	for i, run := range runs {
+		assert.Equal(t, start.Add(time.Duration(i)*day), run.At)
+		if run.Created != nil {
+			created = append(created, i)
+			assert.Equal(t, run.At, run.Created.TS)
+			assert.Equal(t, run.Created, run.Retained[0])
+		}
+		for range run.Destroyed {
+			destroyed = append(destroyed, i)
+		}
+		assert.True(t, len(run.Retained) <= 3, "run %d retains %d snapshots", i, len(run.Retained))
+	}
+	assert.Len(t, created, 30)
+	assert.NotContains(t, created, 0)
+	assert.Len(t, destroyed, 29)
+	assert.Equal(t, 2, destroyed[0], "the first snapshot should be destroyed once the third new one is taken")
+	assert.Equal(t, existing[1], runs[2].Destroyed[0], "the oldest existing snapshot should be destroyed first")
+	assert.Equal(t, existing[0], runs[3].Destroyed[0])
+
+	last := runs[len(runs)-1]
+	assert.Equal(t, []time.Time{start.Add(30 * day), start.Add(29 * day), start.Add(28 * day)}, snapshotTimes(last.Retained))
+
+	// The existing snapshots are not modified.
+	assert.Len(t, existing, 2)
+}
+
+func TestSimulateRetentionTiers(t *testing.T) {
+	start := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	day := 24 * time.Hour
+	series := []seriesConfig{
+		{Label: "hourly", Interval: time.Hour, Keep: 24},
+		{Label: "daily", Interval: day, Keep: 7, MinRetention: 14 * day},
+		{Label: "monthly", Interval: 30 * day, Keep: -1},
+	}
+	step, err := previewStep(series)
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Hour, step)
+	}
+
+	for _, tt := range []struct {
+		s         seriesConfig
+		created   int
+		destroyed int
+		retained  int
+	}{
+		// Hourly: a snapshot per hour for 30 days and one more at the end; all but the last 24 are destroyed.
+		{series[0], 30*24 + 1, 30*24 + 1 - 24, 24},
+		// Daily: a snapshot per day, with 14 days of history (plus today's) retained despite keep: 7.
+		{series[1], 31, 31 - 15, 15},
+		// Monthly: two snapshots, neither destroyed.
+		{series[2], 2, 0, 2},
+	} {
+		runs, err := simulateRetention("tank", tt.s, nil, start, 30*day, step)
+		if !assert.NoError(t, err, tt.s.Label) {
+			continue
+		}
+		var created, destroyed int
+		for _, run := range runs {
+			if run.Created != nil {
+				created++
+			}
+			destroyed += len(run.Destroyed)
+		}
+		assert.Equal(t, tt.created, created, tt.s.Label)
+		assert.Equal(t, tt.destroyed, destroyed, tt.s.Label)
+		assert.Len(t, runs[len(runs)-1].Retained, tt.retained, tt.s.Label)
+	}
+
+	_, err = previewStep([]seriesConfig{{Label: "churn", WrittenThreshold: 1 << 30}})
+	assert.Error(t, err)
+}
+
+func TestFormatPreview(t *testing.T) {
+	start := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	day := 24 * time.Hour
+	runs, err := simulateRetention("tank", seriesConfig{Label: "daily", Interval: day, Keep: 2}, nil, start, 3*day,
+		day/2)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			"2010-01-02T03:04:05Z  +  oldest: 2010-01-02T03:04:05Z",
+			"2010-01-03T03:04:05Z  +#  oldest: 2010-01-02T03:04:05Z",
+			"2010-01-04T03:04:05Z  +#x  oldest: 2010-01-03T03:04:05Z",
+			"2010-01-05T03:04:05Z  +#x  oldest: 2010-01-04T03:04:05Z",
+		}, formatPreview(runs))
+	}
+}
+
+func snapshotTimes(snaps []*zfstools.SnapMetadata) []time.Time {
+	var times []time.Time
+	for _, snap := range snaps {
+		times = append(times, snap.TS)
+	}
+	return times
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	zfs "github.com/kelleyk/go-libzfs"
+)
+
+// probeOps holds the operations that -dry-run-probe uses.  They are fields so that tests can inject failures; see
+// defaultProbeOps for the real implementations.
+type probeOps struct {
+	create  func(snapPath string) error
+	destroy func(snapPath string) error
+}
+
+var defaultProbeOps = probeOps{
+	create: func(snapPath string) error {
+		return zfs.DatasetSnapshots([]string{snapPath}, make(map[zfs.Prop]zfs.Property))
+	},
+	destroy: func(snapPath string) error {
+		// No other dataset has a snapshot with the probe's name, so only the probe is destroyed.
+		return zfs.DestroySnapshotRecursive(snapPath, false)
+	},
+}
+
+// probeSnapshotPath returns the path of the probe snapshot of dataset taken at now.  Its name starts with the prefix,
+// so that it is recognizable, but is not the name of a snapshot in any series.
+func probeSnapshotPath(dataset, prefix string, now time.Time) string {
+	return fmt.Sprintf("%s@%s-probe-%d", dataset, prefix, now.UnixNano())
+}
+
+// probeSnapshot creates the snapshot snapPath and then destroys it again.  If creating it fails, destroying it is still
+// attempted, in case it was created anyway, but only the failure to create it is returned.
+func probeSnapshot(ops probeOps, snapPath string) error {
+	if err := ops.create(snapPath); err != nil {
+		ops.destroy(snapPath)
+		return fmt.Errorf("failed to create probe snapshot %s: %v", snapPath, err)
+	}
+	if err := ops.destroy(snapPath); err != nil {
+		return fmt.Errorf("failed to destroy probe snapshot %s, which must be destroyed by hand: %v", snapPath, err)
+	}
+	return nil
+}
+
+// probeDatasets implements -dry-run-probe: it checks that a snapshot of each of datasets can actually be created and
+// destroyed (e.g. that the pool is not out of space and that the necessary permissions have been delegated) by
+// creating and destroying a probe snapshot of each.  It logs a warning for each dataset whose probe fails, and returns
+// an error if any did.
+func (tool *Tool) probeDatasets(ops probeOps, datasets []string, now time.Time) error {
+	failed := 0
+	for _, dataset := range datasets {
+		snapPath := probeSnapshotPath(dataset, *prefix, now)
+		if err := probeSnapshot(ops, snapPath); err != nil {
+			tool.l.WithFields(logrus.Fields{"dataset": dataset}).WithError(err).Warn("snapshot probe failed")
+			failed++
+			continue
+		}
+		tool.l.WithFields(logrus.Fields{"dataset": dataset}).Info("snapshot probe succeeded")
+	}
+	if failed > 0 {
+		return fmt.Errorf("snapshot probe failed for %d of %d datasets", failed, len(datasets))
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbeDatasets(t *testing.T) {
+	now := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.Out = &buf
+	tool := &Tool{l: l}
+
+	errNoSpace := errors.New("out of space")
+	errBusy := errors.New("dataset is busy")
+	var created, destroyed []string
+	ops := probeOps{
+		create: func(snapPath string) error {
+			if snapPath == probeSnapshotPath("tank/full", *prefix, now) {
+				return errNoSpace
+			}
+			created = append(created, snapPath)
+			return nil
+		},
+		destroy: func(snapPath string) error {
+			destroyed = append(destroyed, snapPath)
+			if snapPath == probeSnapshotPath("tank/busy", *prefix, now) {
+				return errBusy
+			}
+			return nil
+		},
+	}
+
+	err := tool.probeDatasets(ops, []string{"tank/busy", "tank/full", "tank/ok"}, now)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "2 of 3 datasets")
+	}
+
+	probes := make(map[string]string)
+	for _, dataset := range []string{"tank/busy", "tank/full", "tank/ok"} {
+		probes[dataset] = probeSnapshotPath(dataset, *prefix, now)
+	}
+	assert.Equal(t, "tank/ok@zfs-auto-snap-probe-1262401445000000000", probes["tank/ok"])
+	assert.Equal(t, []string{probes["tank/busy"], probes["tank/ok"]}, created)
+	// Each probe is cleaned up, even the one that could not be created.
+	assert.Equal(t, []string{probes["tank/busy"], probes["tank/full"], probes["tank/ok"]}, destroyed)
+
+	out := buf.String()
+	assert.Contains(t, out, errNoSpace.Error())
+	assert.Contains(t, out, errBusy.Error())
+	assert.Contains(t, out, "must be destroyed by hand")
+
+	// The probe's name is not that of a snapshot in any series.
+	meta, err := zfstools.ParseSnapName(*prefix, probes["tank/ok"])
+	assert.NoError(t, err)
+	assert.Nil(t, meta)
+
+	assert.NoError(t, tool.probeDatasets(ops, []string{"tank/ok"}, now))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/kelleyk/zfstools"
+)
+
+// reclaimable describes the space that pruning the snapshots of a dataset to its series' retention would free.
+type reclaimable struct {
+	Dataset   string
+	Snapshots int    // the number of snapshots beyond retention
+	Bytes     uint64 // the estimated space that destroying them would free
+}
+
+// reclaimableSpace returns, for each of datasets, the snapshots of each of its series (as given by series) that are
+// beyond retention as of now (see snapshotsToRemove), and the space that destroying them is estimated to free, largest
+// first.  The snapshots are found, and the space that each would free is estimated, with env.snapshots and env.freed.
+//
+// Each snapshot's estimate counts only the blocks that it alone references, so the total is a lower bound: blocks
+// shared only by snapshots that are beyond retention are freed too, but are not counted.
+func reclaimableSpace(env spaceEnv, datasets []string, series func(dataset string) []seriesConfig,
+	now time.Time) ([]reclaimable, error) {
+
+	result := make([]reclaimable, 0, len(datasets))
+	for _, dsPath := range datasets {
+		r := reclaimable{Dataset: dsPath}
+		for _, s := range series(dsPath) {
+			snaps, err := env.snapshots(dsPath, s)
+			if err != nil {
+				return nil, err
+			}
+			for _, snap := range snapshotsToRemove(snaps, s, now) {
+				freed, err := env.freed(snap)
+				if err != nil {
+					return nil, err
+				}
+				r.Snapshots++
+				r.Bytes += freed
+			}
+		}
+		result = append(result, r)
+	}
+	sort.Stable(byReclaimable(result))
+	return result, nil
+}
+
+type byReclaimable []reclaimable
+
+func (a byReclaimable) Len() int      { return len(a) }
+func (a byReclaimable) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byReclaimable) Less(i, j int) bool {
+	if a[i].Bytes != a[j].Bytes {
+		return a[i].Bytes > a[j].Bytes
+	}
+	return a[i].Dataset < a[j].Dataset
+}
+
+// formatReclaimable returns a line for each of rs, giving the space that could be reclaimed, the number of snapshots
+// beyond retention, and the dataset's name.
+func formatReclaimable(rs []reclaimable) []string {
+	lines := make([]string, len(rs))
+	for i, r := range rs {
+		lines[i] = fmt.Sprintf("%8s  %5d  %s", zfstools.FormatSize(r.Bytes), r.Snapshots, r.Dataset)
+	}
+	return lines
+}
+
+// reportReclaimable writes the space that pruning each of the given datasets to the given series would free (see
+// reclaimableSpace and -reclaimable) to w.  Per-dataset keep properties and -protect-backup-base are taken into
+// account, but holds are not.
+func (tool *Tool) reportReclaimable(w io.Writer, datasets map[string]zfs.Dataset, series []seriesConfig) error {
+	rs, err := reclaimableSpace(tool.defaultSpaceEnv(datasets), datasetNames(datasets),
+		func(dsPath string) []seriesConfig {
+			return tool.datasetSeries(dsPath, datasets[dsPath], series)
+		}, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%8s  %5s  %s\n", "RECLAIM", "SNAPS", "DATASET")
+	for _, line := range formatReclaimable(rs) {
+		fmt.Fprintln(w, line)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReclaimableSpace(t *testing.T) {
+	now := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	daily := seriesConfig{Label: "daily", Interval: 24 * time.Hour, Keep: 7}
+	hourly := seriesConfig{Label: "hourly", Interval: time.Hour, Keep: 24}
+
+	snapsOf := func(dataset string, s seriesConfig, n int) []*zfstools.SnapMetadata {
+		snaps := make([]*zfstools.SnapMetadata, n)
+		for i := range snaps {
+			snaps[i] = &zfstools.SnapMetadata{Dataset: dataset, Prefix: "zfs-auto-snap", Label: s.Label,
+				TS: now.Add(-time.Duration(i) * s.Interval)}
+		}
+		return snaps
+	}
+	// Each snapshot would free 1 GiB, except that the hourly snapshots of tank/db would free 10 GiB each.
+	p := &fakePool{snaps: map[string][]*zfstools.SnapMetadata{
+		"tank@daily":        snapsOf("tank", daily, 10),
+		"tank/vm@daily":     snapsOf("tank/vm", daily, 30),
+		"tank/home@daily":   snapsOf("tank/home", daily, 5),
+		"tank/db@daily":     snapsOf("tank/db", daily, 7),
+		"tank/db@hourly":    snapsOf("tank/db", hourly, 26),
+		"tank/empty@daily":  nil,
+		"tank/empty@hourly": nil,
+	}}
+	p.freedPct = make(map[string]int)
+	for key, snaps := range p.snaps {
+		for _, snap := range snaps {
+			p.freedPct[snap.Path()] = 1
+			if key == "tank/db@hourly" {
+				p.freedPct[snap.Path()] = 10
+			}
+		}
+	}
+
+	series := func(dataset string) []seriesConfig {
+		switch dataset {
+		case "tank/vm":
+			// e.g. because of a zfstools:keep-daily property.
+			return []seriesConfig{{Label: "daily", Interval: 24 * time.Hour, Keep: 3}}
+		case "tank/db", "tank/empty":
+			return []seriesConfig{daily, hourly}
+		}
+		return []seriesConfig{daily}
+	}
+
+	rs, err := reclaimableSpace(p.env(), []string{"tank", "tank/db", "tank/empty", "tank/home", "tank/vm"}, series,
+		now)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []reclaimable{
+		{Dataset: "tank/vm", Snapshots: 27, Bytes: 27 << 30},
+		{Dataset: "tank/db", Snapshots: 2, Bytes: 20 << 30},
+		{Dataset: "tank", Snapshots: 3, Bytes: 3 << 30},
+		{Dataset: "tank/empty", Snapshots: 0, Bytes: 0},
+		{Dataset: "tank/home", Snapshots: 0, Bytes: 0},
+	}, rs)
+	assert.Equal(t, []string{
+		"   27.0G     27  tank/vm",
+		"   20.0G      2  tank/db",
+		"   3.00G      3  tank",
+		"      0B      0  tank/empty",
+		"      0B      0  tank/home",
+	}, formatReclaimable(rs))
+	assert.Empty(t, p.destroyed)
+
+	// A failed estimate is reported.
+	env := p.env()
+	errFreed := errors.New("no such snapshot")
+	env.freed = func(*zfstools.SnapMetadata) (uint64, error) { return 0, errFreed }
+	_, err = reclaimableSpace(env, []string{"tank"}, series, now)
+	assert.Equal(t, errFreed, err)
+}
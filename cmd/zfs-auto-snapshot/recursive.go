@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+)
+
+// recursiveGroups divides the datasets selected by -recursive into groups that are snapshotted together, atomically,
+// as `zfs snapshot -r` would snapshot them.  roots are the dataset names given on the command line, and datasets are
+// the datasets that remain selected (e.g. after exclusions).  It returns a map from each of roots to its descendants
+// among datasets.  A subtree is left out if it has no other selected datasets, if any of them is in skip (e.g. because
+// it is already snapshotted along with its clones), or if the series of any of them (given by series) are not
+// scheduled just like the root's (see sameSchedule), since the root's series decide when the whole group is
+// snapshotted.
+func recursiveGroups(roots, datasets []string, skip map[string]bool,
+	series func(name string) []seriesConfig) map[string][]string {
+
+	selected := make(map[string]bool)
+	for _, name := range datasets {
+		selected[name] = true
+	}
+
+	groups := make(map[string][]string)
+	for _, root := range roots {
+		if !selected[root] || skip[root] {
+			continue
+		}
+		rootSeries := series(root)
+		var members []string
+		for _, name := range datasets {
+			if !strings.HasPrefix(name, root+"/") {
+				continue
+			}
+			if skip[name] || !sameSchedule(rootSeries, series(name)) {
+				members = nil
+				break
+			}
+			members = append(members, name)
+		}
+		if len(members) > 0 {
+			groups[root] = members
+		}
+	}
+	return groups
+}
+
+// sameSchedule returns true if a and b contain the same series, in the same order, and would take new snapshots at
+// the same times; they may still retain different numbers of them.
+func sameSchedule(a, b []seriesConfig) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Label != b[i].Label || a[i].Interval != b[i].Interval ||
+			a[i].WrittenThreshold != b[i].WrittenThreshold || a[i].Guard != b[i].Guard ||
+			a[i].retainsNone() != b[i].retainsNone() {
+			return false
+		}
+	}
+	return true
+}
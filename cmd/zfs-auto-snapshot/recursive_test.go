@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecursiveGroups(t *testing.T) {
+	hourly := []seriesConfig{{Label: "hourly", Interval: time.Hour, Keep: 24}}
+	daily := []seriesConfig{{Label: "daily", Interval: 24 * time.Hour, Keep: 7}}
+	series := func(name string) []seriesConfig {
+		switch name {
+		case "tank/vm/scratch":
+			return daily
+		case "tank/db/log":
+			// Retaining a different number of snapshots does not matter.
+			return []seriesConfig{{Label: "hourly", Interval: time.Hour, Keep: 48}}
+		}
+		return hourly
+	}
+	datasets := []string{
+		"tank", "tank/db", "tank/db/data", "tank/db/log", "tank/home", "tank/vm", "tank/vm/scratch", "tank/vm/web",
+		"tank/vmx", "tank/solo",
+	}
+	roots := []string{"tank/db", "tank/vm", "tank/solo", "tank/missing"}
+
+	assert.Equal(t, map[string][]string{
+		"tank/db": {"tank/db/data", "tank/db/log"},
+		// tank/vm/scratch is scheduled differently, so tank/vm is snapshotted one dataset at a time.
+	}, recursiveGroups(roots, datasets, nil, series))
+
+	// A subtree that contains a dataset that is snapshotted along with its clones is left alone.
+	assert.Empty(t, recursiveGroups(roots, datasets, map[string]bool{"tank/db/log": true}, series))
+
+	// An excluded descendant simply does not take part.
+	assert.Equal(t, map[string][]string{"tank/vm": {"tank/vm/web"}},
+		recursiveGroups([]string{"tank/vm"}, []string{"tank/vm", "tank/vm/web"}, nil, series))
+}
+
+func TestSameSchedule(t *testing.T) {
+	guard := &guardConfig{File: "/run/ok"}
+	a := []seriesConfig{
+		{Label: "hourly", Interval: time.Hour, Keep: 24},
+		{Label: "daily", Interval: 24 * time.Hour, Keep: 7, Guard: guard},
+	}
+	assert.True(t, sameSchedule(a, a))
+
+	for _, b := range [][]seriesConfig{
+		a[:1],
+		{a[1], a[0]},
+		{a[0], {Label: "daily", Interval: 12 * time.Hour, Keep: 7, Guard: guard}},
+		{a[0], {Label: "daily", Interval: 24 * time.Hour, Keep: 7}},
+		{a[0], {Label: "daily", Interval: 24 * time.Hour, Keep: 0, Guard: guard}},
+		{a[0], {Label: "daily", Interval: 24 * time.Hour, Keep: 7, Guard: guard, WrittenThreshold: 1 << 20}},
+	} {
+		assert.False(t, sameSchedule(a, b), "%v", b)
+	}
+	assert.True(t, sameSchedule(a, []seriesConfig{a[0], {Label: "daily", Interval: 24 * time.Hour, Keep: 30,
+		Guard: guard}}))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"time"
+
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/kelleyk/zfstools"
+)
+
+// snapshotsToRemove returns those of the given snapshots that the series' retention policy says should be destroyed,
+// in the same order.  snaps must be in order from most recent to least recent.
+//
+// The Keep most recent snapshots are always retained.  If the series has a MaxAge, snapshots that are no older than
+// that are retained as well, however many there are; a snapshot is destroyed only if it is beyond both limits.  If the
+// series has a MinRetention, older snapshots are also retained until the oldest retained snapshot is at least that
+// old, so that at least that much history is kept.  A series with a Keep of 0 and neither a MaxAge nor a MinRetention
+// retains no snapshots at all.
+//
+// If the series has a Thinning schedule, the snapshots that would otherwise be retained, other than the Keep most
+// recent, are thinned by it (see applyThinning).
+//
+func snapshotsToRemove(snaps []*zfstools.SnapMetadata, s seriesConfig, now time.Time) []*zfstools.SnapMetadata {
+	retained, toRemove := retainedByCount(snaps, s, now)
+	if len(s.Thinning) == 0 {
+		return toRemove
+	}
+	keep := s.Keep
+	if keep < 0 {
+		keep = 0
+	} else if keep > len(retained) {
+		keep = len(retained)
+	}
+	// The retained snapshots precede the others, so the order of snaps is preserved.
+	return append(applyThinning(retained[keep:], s.Thinning, now), toRemove...)
+}
+
+// retainsNone returns true if the series retains no snapshots at all (see snapshotsToRemove), in which case none are
+// taken.
+func (s seriesConfig) retainsNone() bool {
+	return s.Keep == 0 && s.MinRetention == 0 && s.MaxAge == 0
+}
+
+// retainedByCount splits snaps (most recent first) into those that are retained by the series' Keep, MaxAge, and
+// MinRetention and those that are not; see snapshotsToRemove.
+func retainedByCount(snaps []*zfstools.SnapMetadata, s seriesConfig, now time.Time) (retained,
+	toRemove []*zfstools.SnapMetadata) {
+
+	if s.Keep == -1 {
+		return snaps, nil
+	}
+
+	n := s.Keep
+	for n < len(snaps) && s.MaxAge > 0 && now.Sub(snaps[n].TS) <= s.MaxAge {
+		n++
+	}
+	for n < len(snaps) && s.MinRetention > 0 && (n == 0 || now.Sub(snaps[n-1].TS) < s.MinRetention) {
+		n++
+	}
+
+	if n >= len(snaps) {
+		return snaps, nil
+	}
+	return snaps[:n], snaps[n:]
+}
+
+// excludeBackupBase returns snaps without the snapshot named backupBase (the part of its name after the "@"), if any.
+// If backupBase is empty, snaps is returned unchanged.
+func excludeBackupBase(snaps []*zfstools.SnapMetadata, backupBase string) []*zfstools.SnapMetadata {
+	if backupBase == "" {
+		return snaps
+	}
+	kept := make([]*zfstools.SnapMetadata, 0, len(snaps))
+	for _, snap := range snaps {
+		if snap.Name() != backupBase {
+			kept = append(kept, snap)
+		}
+	}
+	return kept
+}
+
+// dropHoldTag returns those of snaps that have a hold with the given tag, and a copy of holds (which is keyed by full
+// snapshot name, as returned by Dataset.AllHolds) without those holds.
+func dropHoldTag(snaps []*zfstools.SnapMetadata, holds map[string][]zfs.HoldInfo,
+	tag string) ([]*zfstools.SnapMetadata, map[string][]zfs.HoldInfo) {
+
+	var tagged []*zfstools.SnapMetadata
+	for _, snap := range snaps {
+		for _, h := range holds[snap.Path()] {
+			if h.Tag == tag {
+				tagged = append(tagged, snap)
+				break
+			}
+		}
+	}
+
+	rest := make(map[string][]zfs.HoldInfo, len(holds))
+	for path, hs := range holds {
+		for _, h := range hs {
+			if h.Tag != tag {
+				rest[path] = append(rest[path], h)
+			}
+		}
+	}
+	return tagged, rest
+}
+
+// excludeHeld returns snaps without the snapshots that have holds (which cannot be destroyed).  holds is keyed by
+// full snapshot name, as returned by Dataset.AllHolds.
+func excludeHeld(snaps []*zfstools.SnapMetadata, holds map[string][]zfs.HoldInfo) []*zfstools.SnapMetadata {
+	kept := make([]*zfstools.SnapMetadata, 0, len(snaps))
+	for _, snap := range snaps {
+		if len(holds[snap.Path()]) == 0 {
+			kept = append(kept, snap)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+// dailySnaps returns n snapshots taken once a day, ending at now, in order from most recent to least recent.
+func dailySnaps(now time.Time, n int) []*zfstools.SnapMetadata {
+	snaps := make([]*zfstools.SnapMetadata, n)
+	for i := range snaps {
+		snaps[i] = &zfstools.SnapMetadata{Dataset: "tank", Prefix: "zfs-auto-snap", Label: "daily", TS: now.Add(-time.Duration(i) * 24 * time.Hour)}
+	}
+	return snaps
+}
+
+func TestSnapshotsToRemove(t *testing.T) {
+	now := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	day := 24 * time.Hour
+	snaps := dailySnaps(now, 40)
+
+	for _, tt := range []struct {
+		desc      string
+		s         seriesConfig
+		remaining int
+	}{
+		{"keep all", seriesConfig{Keep: -1}, 40},
+		{"keep count", seriesConfig{Keep: 3}, 3},
+		{"keep none", seriesConfig{Keep: 0}, 0},
+		{"keep none but min retention", seriesConfig{Keep: 0, MinRetention: 2 * day}, 3},
+		{"keep more than exist", seriesConfig{Keep: 50}, 40},
+		// The snapshot taken 30 days ago is the 31st.
+		{"min retention forces keeping more", seriesConfig{Keep: 3, MinRetention: 30 * day}, 31},
+		{"min retention already satisfied", seriesConfig{Keep: 35, MinRetention: 30 * day}, 35},
+		{"min retention longer than history", seriesConfig{Keep: 3, MinRetention: 60 * day}, 40},
+		// The snapshot taken 30 days ago is no older than the max age, so it is kept.
+		{"max age instead of count", seriesConfig{Keep: 0, MaxAge: 30 * day}, 31},
+		{"max age keeps more than count", seriesConfig{Keep: 3, MaxAge: 10 * day}, 11},
+		{"count keeps more than max age", seriesConfig{Keep: 35, MaxAge: 10 * day}, 35},
+		{"max age between snapshots", seriesConfig{Keep: 0, MaxAge: 29*day + 12*time.Hour}, 30},
+		{"max age longer than history", seriesConfig{Keep: 3, MaxAge: 60 * day}, 40},
+		{"max age and min retention", seriesConfig{Keep: 0, MaxAge: 2 * day, MinRetention: 5 * day}, 6},
+	} {
+		toRemove := snapshotsToRemove(snaps, tt.s, now)
+		assert.Equal(t, 40-tt.remaining, len(toRemove), tt.desc)
+		if len(toRemove) > 0 {
+			assert.Equal(t, snaps[tt.remaining], toRemove[0], tt.desc)
+		}
+	}
+}
+
+func TestExcludeBackupBase(t *testing.T) {
+	now := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	snaps := dailySnaps(now, 5)
+	base := snaps[4].Name() // the oldest snapshot was the last one sent
+
+	// Retention would destroy the two oldest snapshots, including the backup base...
+	toRemove := snapshotsToRemove(snaps, seriesConfig{Label: "daily", Keep: 3}, now)
+	assert.Equal(t, []*zfstools.SnapMetadata{snaps[3], snaps[4]}, toRemove)
+
+	// ...but the backup base survives.
+	assert.Equal(t, []*zfstools.SnapMetadata{snaps[3]}, excludeBackupBase(toRemove, base))
+
+	// With no backup base, nothing is excluded.
+	assert.Equal(t, toRemove, excludeBackupBase(toRemove, ""))
+}
+
+func TestExcludeHeld(t *testing.T) {
+	now := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	snaps := dailySnaps(now, 3)
+	holds := map[string][]zfs.HoldInfo{
+		snaps[1].Path(): {{Tag: "keep"}, {Tag: "backup"}},
+	}
+
+	assert.Equal(t, []*zfstools.SnapMetadata{snaps[0], snaps[2]}, excludeHeld(snaps, holds))
+	assert.Equal(t, snaps, excludeHeld(snaps, nil))
+}
+
+func TestDropHoldTag(t *testing.T) {
+	now := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	snaps := dailySnaps(now, 3)
+	holds := map[string][]zfs.HoldInfo{
+		snaps[0].Path(): {{Tag: "zfs-auto-snapshot"}},
+		snaps[1].Path(): {{Tag: "zfs-auto-snapshot"}, {Tag: "backup"}},
+	}
+
+	tagged, rest := dropHoldTag(snaps[1:], holds, "zfs-auto-snapshot")
+	assert.Equal(t, []*zfstools.SnapMetadata{snaps[1]}, tagged)
+	assert.Equal(t, map[string][]zfs.HoldInfo{snaps[1].Path(): {{Tag: "backup"}}}, rest)
+
+	// Once this tool's hold is released, only snapshots held by something else are kept.
+	assert.Equal(t, []*zfstools.SnapMetadata{snaps[0], snaps[2]}, excludeHeld(snaps, rest))
+	// The original holds are not modified.
+	assert.Len(t, holds[snaps[1].Path()], 2)
+}
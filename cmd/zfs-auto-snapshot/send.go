@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/kelleyk/go-libzfs"
+	"github.com/kelleyk/zfstools"
+)
+
+// sendArgs are the arguments to the "send" subcommand, which writes a send stream to stdout:
+//
+//   zfs-auto-snapshot send [-n] [-c] [-R] [-i SNAPSHOT | -I SNAPSHOT] [-rate-limit BYTES-PER-SEC] DATASET[@SNAPSHOT]
+//
+// If no snapshot of DATASET is named, its most recent snapshot is sent.  With -n, only the estimated size of the
+// stream is written.
+//
+type sendArgs struct {
+	dataset  string
+	toSnap   string // the part of the snapshot's name after the "@"; empty means the most recent snapshot
+	fromSnap string // likewise; empty means a full stream
+	flags    zfs.SendFlags
+	dryRun   bool
+
+	rateLimit uint64 // in bytes per second; zero means no limit
+}
+
+func parseSendArgs(args []string) (*sendArgs, error) {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	dryRun := fs.Bool("n", false, "Instead of sending the stream, print its estimated size.")
+	compress := fs.Bool("c", false, "Send blocks compressed as they are on disk.")
+	replicate := fs.Bool("R", false, "Send the dataset's descendants, along with all snapshots and properties.")
+	raw := fs.Bool("w", false, "Send encrypted datasets as raw (still-encrypted) data.")
+	incr := fs.String("i", "", "Send an incremental stream from this snapshot.")
+	incrAll := fs.String("I", "", "Send an incremental stream from this snapshot, including all intermediate snapshots.")
+	rateLimit := fs.Uint64("rate-limit", 0, "Send no more than this many bytes per second.  0 means no limit.")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if fs.NArg() != 1 {
+		return nil, errors.New("send: expected exactly one dataset or snapshot")
+	}
+	if *raw {
+		return nil, errors.New("send: raw (-w) streams are not supported by this version of libzfs")
+	}
+	if *incr != "" && *incrAll != "" {
+		return nil, errors.New("send: -i and -I may not both be given")
+	}
+
+	if *dryRun && *replicate {
+		return nil, errors.New("send: the size of a replication (-R) stream cannot be estimated")
+	}
+
+	a := &sendArgs{flags: zfs.SendFlags{Replicate: *replicate, Compress: *compress}, dryRun: *dryRun,
+		rateLimit: *rateLimit}
+	name, err := zfstools.NormalizeDatasetName(fs.Arg(0))
+	if err != nil {
+		return nil, fmt.Errorf("send: %v", err)
+	}
+	a.dataset, a.toSnap = splitSnapName(name)
+
+	from := *incr
+	if *incrAll != "" {
+		from = *incrAll
+		a.flags.DoAll = true
+	}
+	if from != "" {
+		// Like `zfs send`, accept "SNAP", "@SNAP", or "DATASET@SNAP".
+		fromDataset, fromSnap := splitSnapName(from)
+		if fromSnap == "" {
+			fromSnap = fromDataset
+		} else if fromDataset != "" && fromDataset != a.dataset {
+			return nil, fmt.Errorf("send: incremental source %q is not a snapshot of %q", from, a.dataset)
+		}
+		a.fromSnap = fromSnap
+	}
+
+	return a, nil
+}
+
+// splitSnapName splits `dataset@snap` into its two parts.  If there is no "@", snap is empty.
+func splitSnapName(path string) (dataset, snap string) {
+	if i := strings.Index(path, "@"); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
+
+// snapTxg identifies a snapshot (by the part of its name after the "@") and the transaction group it was created in.
+type snapTxg struct {
+	name string
+	txg  uint64
+}
+
+// latestSnapshot returns the name of the most recently created of snaps, or "" if snaps is empty.
+func latestSnapshot(snaps []snapTxg) string {
+	var latest *snapTxg
+	for i := range snaps {
+		if latest == nil || snaps[i].txg > latest.txg {
+			latest = &snaps[i]
+		}
+	}
+	if latest == nil {
+		return ""
+	}
+	return latest.name
+}
+
+// runSend implements the "send" subcommand.  Nothing but the stream (or, with -n, its estimated size) is written to w.
+func runSend(w io.Writer, args []string) error {
+	a, err := parseSendArgs(args)
+	if err != nil {
+		return err
+	}
+
+	d, err := zfs.DatasetOpen(a.dataset)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	if a.toSnap == "" {
+		var snaps []snapTxg
+		for _, dd := range d.Children {
+			if dd.Type != zfs.DatasetTypeSnapshot {
+				continue
+			}
+			path, err := dd.Path()
+			if err != nil {
+				return err
+			}
+			txg, err := strconv.ParseUint(dd.Properties[zfs.DatasetPropCreatetxg].Value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s: unexpected createtxg %q", path, dd.Properties[zfs.DatasetPropCreatetxg].Value)
+			}
+			_, name := splitSnapName(path)
+			snaps = append(snaps, snapTxg{name: name, txg: txg})
+		}
+		if a.toSnap = latestSnapshot(snaps); a.toSnap == "" {
+			return fmt.Errorf("send: %q has no snapshots", a.dataset)
+		}
+	}
+
+	if a.dryRun {
+		size, err := d.SendSize(a.fromSnap, a.toSnap, a.flags)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, sendEstimate(a, size))
+		return nil
+	}
+
+	paths := []string{a.dataset + "@" + a.toSnap}
+	if a.fromSnap != "" {
+		paths = append(paths, a.dataset+"@"+a.fromSnap)
+	}
+	done, err := inUse.beginSend(paths...)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	return d.Send(a.fromSnap, a.toSnap, a.flags, zfstools.NewRateLimitedWriter(w, a.rateLimit))
+}
+
+// sendEstimate describes the stream that a would send, whose estimated size is size.
+func sendEstimate(a *sendArgs, size uint64) string {
+	kind := "full"
+	if a.fromSnap != "" {
+		kind = "incremental from " + a.fromSnap
+	}
+	if a.flags.Compress {
+		kind += ", compressed"
+	}
+	return fmt.Sprintf("would send ~%s (%s@%s, %s)", zfstools.FormatSize(size), a.dataset, a.toSnap, kind)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kelleyk/go-libzfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSendArgs(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want *sendArgs
+	}{
+		{[]string{"tank/data"}, &sendArgs{dataset: "tank/data"}},
+		{[]string{"tank/data@snap2"}, &sendArgs{dataset: "tank/data", toSnap: "snap2"}},
+		{[]string{"tank//data/"}, &sendArgs{dataset: "tank/data"}},
+		{[]string{"-R", "tank/data@snap2"}, &sendArgs{dataset: "tank/data", toSnap: "snap2", flags: zfs.SendFlags{Replicate: true}}},
+		{[]string{"-i", "snap1", "tank/data@snap2"}, &sendArgs{dataset: "tank/data", toSnap: "snap2", fromSnap: "snap1"}},
+		{[]string{"-i", "@snap1", "tank/data@snap2"}, &sendArgs{dataset: "tank/data", toSnap: "snap2", fromSnap: "snap1"}},
+		{[]string{"-rate-limit", "1048576", "tank/data"}, &sendArgs{dataset: "tank/data", rateLimit: 1 << 20}},
+		{[]string{"-I", "tank/data@snap1", "tank/data@snap2"}, &sendArgs{dataset: "tank/data", toSnap: "snap2", fromSnap: "snap1", flags: zfs.SendFlags{DoAll: true}}},
+		{[]string{"-n", "-c", "-i", "snap1", "tank/data@snap2"}, &sendArgs{dataset: "tank/data", toSnap: "snap2", fromSnap: "snap1", flags: zfs.SendFlags{Compress: true}, dryRun: true}},
+		// Errors.
+		{[]string{}, nil},
+		{[]string{"tank/a", "tank/b"}, nil},
+		{[]string{"-w", "tank/data"}, nil},
+		{[]string{"-i", "snap1", "-I", "snap1", "tank/data@snap2"}, nil},
+		{[]string{"-i", "tank/other@snap1", "tank/data@snap2"}, nil},
+		{[]string{"-n", "-R", "tank/data@snap2"}, nil},
+		{[]string{"tank/data@snap1@snap2"}, nil},
+	} {
+		a, err := parseSendArgs(tt.args)
+		if tt.want == nil {
+			assert.Error(t, err, "%v", tt.args)
+		} else if assert.NoError(t, err, "%v", tt.args) {
+			assert.Equal(t, tt.want, a, "%v", tt.args)
+		}
+	}
+}
+
+func TestSendEstimate(t *testing.T) {
+	for _, tt := range []struct {
+		a    *sendArgs
+		size uint64
+		want string
+	}{
+		{&sendArgs{dataset: "tank/data", toSnap: "snap2"}, 5 << 30, "would send ~5.00G (tank/data@snap2, full)"},
+		{&sendArgs{dataset: "tank/data", toSnap: "snap2", fromSnap: "snap1", flags: zfs.SendFlags{Compress: true}}, 0,
+			"would send ~0B (tank/data@snap2, incremental from snap1, compressed)"},
+	} {
+		assert.Equal(t, tt.want, sendEstimate(tt.a, tt.size))
+	}
+}
+
+func TestLatestSnapshot(t *testing.T) {
+	assert.Equal(t, "", latestSnapshot(nil))
+	assert.Equal(t, "b", latestSnapshot([]snapTxg{{"a", 10}, {"b", 30}, {"c", 20}}))
+}
+
+// TestRunSend sends the most recent snapshot of a dataset, and an incremental stream, to a buffer.
+func TestRunSend(t *testing.T) {
+	const name = "zfsautosnap_send"
+	defer withTestPool(t, name)()
+	for _, snap := range []string{"first", "second"} {
+		d, err := zfs.DatasetSnapshot(name+"@"+snap, false, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		d.Close()
+	}
+
+	for _, tt := range []struct {
+		args     []string
+		toName   string
+		full     bool
+		compound bool
+	}{
+		{[]string{name}, name + "@second", true, false},
+		{[]string{name + "@first"}, name + "@first", true, false},
+		{[]string{"-i", "first", name}, name + "@second", false, false},
+		{[]string{"-R", name + "@second"}, name + "@second", true, true},
+	} {
+		var buf bytes.Buffer
+		if !assert.NoError(t, runSend(&buf, tt.args), "%v", tt.args) {
+			continue
+		}
+		h, err := zfs.ParseSendStreamHeader(buf.Bytes())
+		if !assert.NoError(t, err, "%v", tt.args) {
+			continue
+		}
+		assert.Equal(t, tt.toName, h.ToName, "%v", tt.args)
+		assert.Equal(t, tt.full, h.FromGUID == 0, "%v", tt.args)
+		assert.Equal(t, tt.compound, h.Compound, "%v", tt.args)
+	}
+}
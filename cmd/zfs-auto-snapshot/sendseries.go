@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Sirupsen/logrus"
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/kelleyk/zfstools"
+)
+
+// incrementalPair returns the two most recent of snaps (which must be most recent first): the base of an incremental
+// stream, and the snapshot that it brings the receiver up to.
+func incrementalPair(dsPath, label string, snaps []*zfstools.SnapMetadata) (prev, cur *zfstools.SnapMetadata,
+	err error) {
+
+	switch len(snaps) {
+	case 0:
+		return nil, nil, fmt.Errorf("%s has no snapshots in series %q to send", dsPath, label)
+	case 1:
+		return nil, nil, fmt.Errorf("%s has no snapshot in series %q older than %s to send it incrementally from",
+			dsPath, label, snaps[0].Name())
+	}
+	return snaps[1], snaps[0], nil
+}
+
+// sendIncremental writes an incremental send stream from the snapshot prev of d to the snapshot cur to dest; with
+// -recursive, it is a replication stream that includes d's descendants.  Neither snapshot can be destroyed by this
+// process while the stream is being written.
+func (tool *Tool) sendIncremental(d zfs.Dataset, prev, cur *zfstools.SnapMetadata, dest io.Writer) error {
+	done, err := inUse.beginSend(prev.Path(), cur.Path())
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	tool.l.WithFields(logrus.Fields{"from": prev.Path(), "snapshot": cur.Path(), "recursive": *recursive}).Info(
+		"sending incremental stream")
+	return d.Send(prev.Name(), cur.Name(), zfs.SendFlags{Replicate: *recursive}, dest)
+}
+
+// sendFull writes a full send stream for the snapshot snap of d to dest, e.g. to seed a replica before incremental
+// streams are sent; with -recursive, it is a replication stream that includes d's descendants.  The snapshot cannot be
+// destroyed by this process while the stream is being written.
+func (tool *Tool) sendFull(d zfs.Dataset, snap *zfstools.SnapMetadata, dest io.Writer) error {
+	done, err := inUse.beginSend(snap.Path())
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	tool.l.WithFields(logrus.Fields{"snapshot": snap.Path(), "recursive": *recursive}).Info("sending full stream")
+	return d.Send("", snap.Name(), zfs.SendFlags{Replicate: *recursive}, dest)
+}
+
+// sendSeries implements -send-incr and -send-full: after the run, it writes a stream for the most recent snapshot in
+// the series labeled label (which may be empty if there is only one series) of the one dataset named on the command
+// line to the file at path ("-" means stdout).  If full is false, the stream is incremental from the series' second
+// most recent snapshot.  The dataset is opened afresh, so that a snapshot taken by the run is included, and is closed
+// (releasing its libzfs handle) even if the stream cannot be written in full.
+func (tool *Tool) sendSeries(names []string, series []seriesConfig, label, path string, full bool) error {
+	if len(names) != 1 || names[0] == "//" {
+		return errors.New("-send-incr and -send-full require exactly one dataset to be named")
+	}
+	dsPath, err := zfstools.NormalizeDatasetName(names[0])
+	if err != nil {
+		return err
+	}
+	series = resolvePolicy(tool.policies, dsPath, series)
+	if label == "" && len(series) == 1 {
+		label = series[0].Label
+	}
+	s, ok := findSeries(series, label)
+	if !ok {
+		return fmt.Errorf("-send-label: no series is labeled %q", label)
+	}
+
+	d, err := zfs.DatasetOpen(dsPath)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	snaps, err := tool.getSnapshots(d, s)
+	if err != nil {
+		return err
+	}
+
+	if full {
+		if len(snaps) == 0 {
+			return fmt.Errorf("%s has no snapshots in series %q to send", dsPath, label)
+		}
+		if tool.dryRun {
+			tool.l.WithFields(logrus.Fields{"snapshot": snaps[0].Path(), "dest": path}).Info("would send full stream")
+			return nil
+		}
+		return withDestination(path, func(w io.Writer) error {
+			return tool.sendFull(d, snaps[0], w)
+		})
+	}
+
+	prev, cur, err := incrementalPair(dsPath, label, snaps)
+	if err != nil {
+		return err
+	}
+	if tool.dryRun {
+		tool.l.WithFields(logrus.Fields{"from": prev.Path(), "snapshot": cur.Path(), "dest": path}).Info(
+			"would send incremental stream")
+		return nil
+	}
+	return withDestination(path, func(w io.Writer) error {
+		return tool.sendIncremental(d, prev, cur, w)
+	})
+}
+
+// findSeries returns the series in series that is labeled label.
+func findSeries(series []seriesConfig, label string) (seriesConfig, bool) {
+	for _, s := range series {
+		if s.Label == label {
+			return s, true
+		}
+	}
+	return seriesConfig{}, false
+}
+
+// withDestination calls f with the file at path, which is created (or truncated), or with stdout if path is "-".  The
+// file is closed afterward, and an error from closing it is returned if f succeeded.
+func withDestination(path string, f func(w io.Writer) error) (err error) {
+	if path == "" {
+		return errors.New("no destination given")
+	}
+	if path == "-" {
+		return f(os.Stdout)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	return f(out)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncrementalPair(t *testing.T) {
+	now := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	snaps := dailySnaps(now, 3)
+
+	prev, cur, err := incrementalPair("tank", "daily", snaps)
+	if assert.NoError(t, err) {
+		assert.Equal(t, snaps[1], prev)
+		assert.Equal(t, snaps[0], cur)
+	}
+
+	// Without a base, there is nothing to send incrementally.
+	_, _, err = incrementalPair("tank", "daily", snaps[:1])
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "older than zfs-auto-snap_daily_2010-01-02T03:04:05Z")
+	}
+	_, _, err = incrementalPair("tank", "daily", nil)
+	assert.Error(t, err)
+}
+
+func TestSendSeriesArgs(t *testing.T) {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	tool := &Tool{l: l}
+	series := []seriesConfig{{Label: "hourly", Keep: 24}, {Label: "daily", Keep: 7}}
+
+	for _, names := range [][]string{nil, {"//"}, {"tank/a", "tank/b"}} {
+		for _, full := range []bool{false, true} {
+			err := tool.sendSeries(names, series, "daily", "-", full)
+			if assert.Error(t, err, "%v", names) {
+				assert.Contains(t, err.Error(), "exactly one dataset", "%v", names)
+			}
+		}
+	}
+	// With more than one series, the label must be given.
+	err := tool.sendSeries([]string{"tank"}, series, "", "-", true)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no series is labeled")
+	}
+	assert.IsType(t, &zfstools.InvalidNameError{}, tool.sendSeries([]string{"tank/x*"}, series, "daily", "-", true))
+}
+
+func TestFindSeries(t *testing.T) {
+	series := []seriesConfig{{Label: "hourly", Keep: 24}, {Label: "daily", Keep: 7}}
+	s, ok := findSeries(series, "daily")
+	assert.True(t, ok)
+	assert.Equal(t, 7, s.Keep)
+	_, ok = findSeries(series, "weekly")
+	assert.False(t, ok)
+}
+
+func TestWithDestination(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zfs-auto-snapshot-test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "stream")
+	assert.NoError(t, withDestination(path, func(w io.Writer) error {
+		_, err := w.Write([]byte("stream"))
+		return err
+	}))
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "stream", string(data))
+
+	errSend := errors.New("send failed")
+	assert.Equal(t, errSend, withDestination(path, func(io.Writer) error { return errSend }))
+	assert.Error(t, withDestination("", func(io.Writer) error { return nil }))
+}
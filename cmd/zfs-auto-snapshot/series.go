@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/kelleyk/zfstools"
+)
+
+// seriesID returns the identity of the series s that is recorded in the AutoSnapshotSeriesProperty of its snapshots.
+func (s seriesConfig) seriesID() string {
+	if s.ID != "" {
+		return s.ID
+	}
+	return s.Label
+}
+
+// taggedSnapshot is an automatic snapshot together with the value of its AutoSnapshotSeriesProperty, which is empty
+// if the property is not set (e.g. because the snapshot was taken by an older version of this tool).
+type taggedSnapshot struct {
+	meta   *zfstools.SnapMetadata
+	series string
+}
+
+// selectSeries returns those of snaps that belong to the series s.  A snapshot belongs to s if its series property is
+// s's ID or, if the property is not set, if the label in its name is s's ID.  Members of the latter kind are also
+// returned as backfill: their series property should be set, so that they stay in the series even if its label is
+// changed.
+func selectSeries(snaps []taggedSnapshot, s seriesConfig) (members, backfill []*zfstools.SnapMetadata) {
+	id := s.seriesID()
+	for _, snap := range snaps {
+		if snap.series == "" {
+			if snap.meta.Label == id {
+				members = append(members, snap.meta)
+				backfill = append(backfill, snap.meta)
+			}
+		} else if snap.series == id {
+			members = append(members, snap.meta)
+		}
+	}
+	return members, backfill
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectSeries(t *testing.T) {
+	ts := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	snap := func(label, series string) taggedSnapshot {
+		return taggedSnapshot{meta: &zfstools.SnapMetadata{Dataset: "tank", Prefix: "zfs-auto-snap", Label: label, TS: ts},
+			series: series}
+	}
+	tagged := snap("daily", "daily")
+	untagged := snap("daily", "")
+	renamed := snap("day", "daily") // taken after the series' label was changed from "daily" to "day"
+	other := snap("hourly", "hourly")
+	untaggedOther := snap("hourly", "")
+	all := []taggedSnapshot{tagged, untagged, renamed, other, untaggedOther}
+
+	for _, tt := range []struct {
+		desc     string
+		s        seriesConfig
+		members  []taggedSnapshot
+		backfill []taggedSnapshot
+	}{
+		{"grouped by property, with untagged snapshots backfilled", seriesConfig{Label: "daily"},
+			[]taggedSnapshot{tagged, untagged, renamed}, []taggedSnapshot{untagged}},
+		{"label changed, with ID set to the old label", seriesConfig{Label: "day", ID: "daily"},
+			[]taggedSnapshot{tagged, untagged, renamed}, []taggedSnapshot{untagged}},
+		{"label changed without an ID", seriesConfig{Label: "day"}, nil, nil},
+		{"another series", seriesConfig{Label: "hourly"},
+			[]taggedSnapshot{other, untaggedOther}, []taggedSnapshot{untaggedOther}},
+	} {
+		members, backfill := selectSeries(all, tt.s)
+		assert.Equal(t, metas(tt.members), members, tt.desc)
+		assert.Equal(t, metas(tt.backfill), backfill, tt.desc)
+	}
+}
+
+func metas(snaps []taggedSnapshot) []*zfstools.SnapMetadata {
+	var out []*zfstools.SnapMetadata
+	for _, snap := range snaps {
+		out = append(out, snap.meta)
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// errShuttingDown is returned in place of work that was not started because the process was asked to stop.
+var errShuttingDown = errors.New("stopped before finishing, since the process was asked to exit")
+
+// shutdown coordinates an orderly exit when the process is asked to stop (e.g. with SIGTERM, by systemd or by a
+// cron daemon that is being stopped).  Once it has been asked to stop, no new work is started, but work that is in
+// progress (e.g. taking a snapshot or writing a send stream) is allowed to finish, so that it is not left half-done.
+//
+// A nil *shutdown never stops, so that tests can leave it unset.
+type shutdown struct {
+	mu       sync.Mutex
+	stopping bool
+	inflight sync.WaitGroup
+}
+
+func newShutdown() *shutdown {
+	return &shutdown{}
+}
+
+// begin registers a unit of work that is about to start, and returns false (registering nothing) if the process has
+// been asked to stop, in which case the work must not be started.  Each successful call must be followed by a call to
+// end once the work has finished.
+func (s *shutdown) begin() bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopping {
+		return false
+	}
+	s.inflight.Add(1)
+	return true
+}
+
+// end records that a unit of work registered with begin has finished.
+func (s *shutdown) end() {
+	if s == nil {
+		return
+	}
+	s.inflight.Done()
+}
+
+// track wraps fn (e.g. the function passed to forEachDataset) so that each call is registered with begin and end, and
+// so that calls are not made once the process has been asked to stop; errShuttingDown is returned instead.
+func (s *shutdown) track(fn func(name string) error) func(name string) error {
+	return func(name string) error {
+		if !s.begin() {
+			return errShuttingDown
+		}
+		defer s.end()
+		return fn(name)
+	}
+}
+
+// stop asks that no new work be started, and waits up to timeout for the work in progress to finish.  It returns
+// false if the timeout elapsed first.
+func (s *shutdown) stop(timeout time.Duration) bool {
+	s.mu.Lock()
+	s.stopping = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// handle waits for a signal on sigs and then stops s (see stop).  If the work in progress does not finish within
+// timeout, it gives up on that work and calls exit (os.Exit, outside of tests) with a nonzero status.  Otherwise, it
+// returns, and the process exits once the caller notices that no more work is being started.
+func (s *shutdown) handle(l *logrus.Logger, sigs <-chan os.Signal, timeout time.Duration, exit func(int)) {
+	sig := <-sigs
+	l.WithFields(logrus.Fields{"signal": sig, "timeout": timeout}).Warn(
+		"received signal; waiting for snapshots in progress to finish before exiting")
+	if !s.stop(timeout) {
+		l.WithFields(logrus.Fields{"signal": sig, "timeout": timeout}).Error(
+			"snapshots in progress did not finish within -shutdown-timeout; exiting anyway")
+		exit(1)
+		return
+	}
+	l.WithFields(logrus.Fields{"signal": sig}).Info("snapshots in progress have finished; exiting")
+}
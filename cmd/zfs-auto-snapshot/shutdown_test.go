@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownWaitsForSnapshot(t *testing.T) {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+
+	sd := newShutdown()
+	sigs := make(chan os.Signal, 1)
+	exited := make(chan int, 1)
+	handled := make(chan struct{})
+	go func() {
+		sd.handle(l, sigs, time.Minute, func(code int) { exited <- code })
+		close(handled)
+	}()
+
+	// A long snapshot is in progress when SIGTERM arrives.
+	started, release := make(chan struct{}), make(chan struct{})
+	var finished []string
+	snapshot := sd.track(func(name string) error {
+		close(started)
+		<-release
+		finished = append(finished, name)
+		return nil
+	})
+	result := make(chan error, 1)
+	go func() { result <- snapshot("tank/a") }()
+	<-started
+	sigs <- syscall.SIGTERM
+	for deadline := time.Now().Add(time.Second); sd.begin(); {
+		sd.end()
+		if time.Now().After(deadline) {
+			t.Fatal("signal was not handled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// No new snapshots are started, but the handler waits for the one in progress.
+	assert.Equal(t, errShuttingDown, sd.track(func(name string) error {
+		t.Errorf("unexpected call for %s", name)
+		return nil
+	})("tank/b"))
+	select {
+	case <-handled:
+		t.Fatal("handler returned while a snapshot was in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	assert.NoError(t, <-result)
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("handler did not return after the snapshot finished")
+	}
+	assert.Equal(t, []string{"tank/a"}, finished)
+	assert.Empty(t, exited)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+
+	sd := newShutdown()
+	sigs := make(chan os.Signal, 1)
+	exited := make(chan int, 1)
+	go sd.handle(l, sigs, 10*time.Millisecond, func(code int) { exited <- code })
+
+	// The snapshot never finishes, so the process is made to exit anyway.
+	assert.True(t, sd.begin())
+	sigs <- syscall.SIGTERM
+	select {
+	case code := <-exited:
+		assert.Equal(t, 1, code)
+	case <-time.After(time.Second):
+		t.Fatal("did not exit after -shutdown-timeout")
+	}
+	sd.end()
+}
+
+func TestShutdownNil(t *testing.T) {
+	var sd *shutdown
+	assert.True(t, sd.begin())
+	sd.end()
+	assert.NoError(t, sd.track(func(name string) error { return nil })("tank"))
+}
@@ -1,64 +1,45 @@
 package main
 
 import (
-	"fmt"
-	"regexp"
-	"time"
+	"strings"
 
-	"github.com/kelleyk/gokk"
+	"github.com/kelleyk/zfstools"
 )
 
-const (
-	// `Mon Jan 2 15:04:05 -0700 MST 2006`
-	snapNameTimestampFormat = time.RFC3339
-)
-
-var (
-	// dataset@zfs-auto-snap_label_ts
-	//   where ts format = e.g. `2006-01-02T15:04:05Z07:00`
-	snapNameRegexp = regexp.MustCompile(`(?i)^(.*)@(.+)_([^_]+)_(` + gokk.RFC3339Pattern + `)$`)
-)
-
-type snapMetadata struct {
-	dataset string
-	prefix  string
-	label   string
-	ts      time.Time
-}
-
-func (m *snapMetadata) Path() string {
-	return fmt.Sprintf("%s@%s_%s_%s", m.dataset, m.prefix, m.label, m.ts.Format(snapNameTimestampFormat))
-}
-
-func parseSnapName(expectedPrefix, path string) (*snapMetadata, error) {
-
-	m := snapNameRegexp.FindStringSubmatch(path)
-	if len(m) == 0 {
-		// No regexp match.
-		return nil, nil
+// recursiveSnapshotPaths returns those of allSnapPaths that a recursive destroy of snapPath would remove: snapPath
+// itself, and the snapshot of each descendant of its dataset that has the same name.  Descendants that do not have a
+// snapshot with that name are simply absent from the result.
+func recursiveSnapshotPaths(snapPath string, allSnapPaths []string) []string {
+	i := strings.Index(snapPath, "@")
+	if i == -1 {
+		return nil
 	}
-	dataset, snapPrefix, label, tsStr := m[1], m[2], m[3], m[4]
-
-	if snapPrefix != expectedPrefix {
-		// Wrong prefix; no match.
-		return nil, nil
+	dataset, name := snapPath[:i], snapPath[i+1:]
+
+	var paths []string
+	for _, path := range allSnapPaths {
+		j := strings.Index(path, "@")
+		if j == -1 || path[j+1:] != name {
+			continue
+		}
+		if path[:j] == dataset || strings.HasPrefix(path[:j], dataset+"/") {
+			paths = append(paths, path)
+		}
 	}
+	return paths
+}
 
-	ts, err := time.Parse(snapNameTimestampFormat, tsStr)
-	if err != nil {
-		return nil, err
+// recursiveDestroyOK returns true if a recursive destroy that would remove the snapshots covered (see
+// recursiveSnapshotPaths) may be used in place of destroying them one at a time: that is, if it would remove more than
+// one snapshot and every one of them is in due, which is keyed by snapshot path.
+func recursiveDestroyOK(covered []string, due map[string]*zfstools.SnapMetadata) bool {
+	if len(covered) < 2 {
+		return false
 	}
-
-	return &snapMetadata{
-		dataset: dataset,
-		prefix:  snapPrefix,
-		label:   label,
-		ts:      ts,
-	}, nil
+	for _, path := range covered {
+		if _, ok := due[path]; !ok {
+			return false
+		}
+	}
+	return true
 }
-
-type byTS []*snapMetadata
-
-func (a byTS) Len() int           { return len(a) }
-func (a byTS) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a byTS) Less(i, j int) bool { return a[i].ts.After(a[j].ts) }
@@ -1,41 +1,79 @@
 package main
 
 import (
+	"io/ioutil"
 	"testing"
 	"time"
 
+	"github.com/Sirupsen/logrus"
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/kelleyk/zfstools"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestParseSnapName(t *testing.T) {
-	const prefix = "zfs-auto-snap"
+func TestRecursiveSnapshotPaths(t *testing.T) {
+	allSnapPaths := []string{
+		"tank@snap1",
+		"tank/a@snap1",
+		"tank/a/b@snap1",
+		"tank/a@snap2",
+		"tank/ab@snap1", // not a descendant of tank/a, despite the shared prefix
+		"tank/c@snap2",  // tank/c lacks snap1
+		"other@snap1",
+	}
 
 	for _, tt := range []struct {
-		path string
-		meta *snapMetadata
+		snapPath string
+		expected []string
 	}{
-		{"ds@zfs-auto-snap_daily_2010-01-02T03:04:05Z", &snapMetadata{dataset: "ds", label: "daily", ts: time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)}},
-		{"ds@some-other-prefix_daily_2010-01-02T03:04:05Z", nil},
+		{"tank@snap1", []string{"tank@snap1", "tank/a@snap1", "tank/a/b@snap1", "tank/ab@snap1"}},
+		{"tank/a@snap1", []string{"tank/a@snap1", "tank/a/b@snap1"}},
+		{"tank/a@snap2", []string{"tank/a@snap2"}},
+		{"tank/a/b@snap1", []string{"tank/a/b@snap1"}},
+		{"tank", nil},
 	} {
-		meta, err := parseSnapName(prefix, tt.path)
-
-		if assert.Nil(t, err) {
-			if tt.meta == nil {
-				assert.Nil(t, meta, "did not expect name to match, but result was returned")
-			} else {
-				if assert.NotNil(t, meta, "expected name to match, but no result was returned") {
-					ok := true
-					ok = ok || assert.Equal(t, prefix, meta.prefix)
-					ok = ok || assert.Equal(t, tt.meta.label, meta.label)
-					ok = ok || assert.Equal(t, tt.meta.ts, meta.ts)
-					ok = ok || assert.Equal(t, tt.meta.dataset, meta.dataset)
-
-					// Finally, check that we can get the original snapshot path back.
-					if ok {
-						assert.Equal(t, tt.path, meta.Path())
-					}
-				}
-			}
-		}
+		assert.Equal(t, tt.expected, recursiveSnapshotPaths(tt.snapPath, allSnapPaths), tt.snapPath)
+	}
+}
+
+func TestRecursiveDestroyOK(t *testing.T) {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	tool := &Tool{l: l}
+	now := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	series := []seriesConfig{{Label: "daily", Interval: 24 * time.Hour, Keep: 1}}
+
+	parent := dailySnaps(now, 3)
+	child := dailySnaps(now, 3)
+	for _, snap := range child {
+		snap.Dataset = "tank/child"
+	}
+	due := make(map[string]*zfstools.SnapMetadata)
+	for _, snap := range snapshotsToRemove(parent, series[0], now) {
+		due[snap.Path()] = snap
 	}
+	oldest := parent[2].Path()
+	covered := []string{oldest, child[2].Path()}
+
+	// The child shares the parent's snapshot names, but keeps more snapshots under its own retention, so the parent's
+	// snapshots must be destroyed one at a time.
+	keepAll := zfs.Dataset{UserProperties: map[string]zfs.Property{"zfstools:keep-daily": {Value: "7"}}}
+	assert.Empty(t, tool.dueSnapshots("tank/child", keepAll, series, "daily", child, nil, now))
+	assert.False(t, recursiveDestroyOK(covered, due))
+
+	// A held snapshot is not due either, even if its retention would remove it.
+	holds := map[string][]zfs.HoldInfo{child[2].Path(): {{Tag: "backup"}}}
+	assert.Equal(t, child[1:2], tool.dueSnapshots("tank/child", zfs.Dataset{}, series, "daily", child, holds, now))
+
+	// Once the child's retention would remove the snapshot too, it can be destroyed recursively.
+	for _, snap := range tool.dueSnapshots("tank/child", zfs.Dataset{}, series, "daily", child, nil, now) {
+		due[snap.Path()] = snap
+	}
+	assert.True(t, recursiveDestroyOK(covered, due))
+
+	// A snapshot with no descendants' snapshots of the same name is destroyed on its own.
+	assert.False(t, recursiveDestroyOK([]string{oldest}, due))
+
+	// A descendant that is not managed along with the parent (e.g. because it is excluded) is never due.
+	assert.False(t, recursiveDestroyOK(append(covered, "tank/child/excluded@"+parent[2].Name()), due))
 }
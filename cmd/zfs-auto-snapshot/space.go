@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/kelleyk/zfstools"
+)
+
+// spaceEnv holds the operations used to relieve space pressure.  They are fields so that tests can substitute a fake
+// pool; see Tool.defaultSpaceEnv for the real implementations.
+type spaceEnv struct {
+	// capacity returns the percentage of the named pool's space that is in use.
+	capacity func(pool string) (int, error)
+	// snapshots returns the snapshots of dataset in the series s, most recent first.
+	snapshots func(dataset string, s seriesConfig) ([]*zfstools.SnapMetadata, error)
+	// remove destroys snap, unless it cannot be removed (see Tool.removable).
+	remove func(snap *zfstools.SnapMetadata) error
+	// freed estimates how many bytes destroying snap (alone) would free.
+	freed func(snap *zfstools.SnapMetadata) (uint64, error)
+}
+
+// pruneStrategy is the order in which relieveSpacePressure destroys snapshots (see -prune-strategy).
+type pruneStrategy string
+
+const (
+	// pruneOldest destroys the oldest snapshots first.
+	pruneOldest pruneStrategy = "oldest"
+	// pruneMostSpace destroys the snapshots that are estimated to free the most space first, so that fewer snapshots
+	// are lost; ties are broken by destroying the oldest first.
+	pruneMostSpace pruneStrategy = "most-space"
+)
+
+// spaceFlags returns the capacity below which relieveSpacePressure stops destroying snapshots and the order in which
+// it destroys them, as given by -space-low-pct and -prune-strategy, or an error if those flags or -space-emergency-keep
+// are invalid.  It is called when flags are parsed, so that a mistake is reported before any work is done.
+func spaceFlags() (lowPct int, strategy pruneStrategy, err error) {
+	lowPct = *spaceLowPct
+	if lowPct == 0 {
+		lowPct = *spaceHighPct
+	}
+	if *spaceHighPct > 0 && lowPct > *spaceHighPct {
+		return 0, "", errors.New("-space-low-pct must not exceed -space-high-pct")
+	}
+	if *spaceEmergencyKeep < 0 {
+		return 0, "", errors.New("-space-emergency-keep must not be negative")
+	}
+	strategy = pruneStrategy(*pruneStrategyFlag)
+	if strategy != pruneOldest && strategy != pruneMostSpace {
+		return 0, "", fmt.Errorf("unexpected value for -prune-strategy: %q", *pruneStrategyFlag)
+	}
+	return lowPct, strategy, nil
+}
+
+// littleSpace is the estimated amount of space freed below which a snapshot is reported as freeing little space, e.g.
+// because nearly all of its blocks are shared with adjacent snapshots or with its dataset.
+const littleSpace = 1 << 20
+
+func (tool *Tool) defaultSpaceEnv(datasets map[string]zfs.Dataset) spaceEnv {
+	return spaceEnv{
+		capacity: poolCapacity,
+		snapshots: func(dataset string, s seriesConfig) ([]*zfstools.SnapMetadata, error) {
+			snaps, err := tool.getSnapshots(datasets[dataset], s)
+			if err != nil {
+				return nil, err
+			}
+			return excludeBackupBase(snaps, tool.backupBase(datasets[dataset])), nil
+		},
+		remove: func(snap *zfstools.SnapMetadata) error {
+			d := datasets[snap.Dataset]
+			holds, err := d.AllHolds()
+			if err != nil {
+				return err
+			}
+			snaps, err := tool.removable(snap.Dataset, d, []*zfstools.SnapMetadata{snap}, holds)
+			if err != nil || len(snaps) == 0 {
+				return err
+			}
+			_, err = tool.removeSnapshots(d, snaps, nil)
+			return err
+		},
+		freed: snapshotUsed,
+	}
+}
+
+// snapshotUsed returns the value of the named snapshot's used property, which is the amount of space that is
+// referenced by it alone, and so would be freed if it were destroyed.
+func snapshotUsed(snap *zfstools.SnapMetadata) (uint64, error) {
+	d, err := zfs.DatasetOpen(snap.Path())
+	if err != nil {
+		return 0, err
+	}
+	defer d.Close()
+
+	value := d.Properties[zfs.DatasetPropUsed].Value
+	used, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected value for used property of %s: %q", snap.Path(), value)
+	}
+	return used, nil
+}
+
+// poolCapacity returns the value of the named pool's capacity property.  The pool is opened afresh on each call so
+// that the value is current.
+func poolCapacity(name string) (int, error) {
+	p, err := zfs.PoolOpen(name)
+	if err != nil {
+		return 0, err
+	}
+	defer p.Close()
+
+	v := strings.TrimSuffix(p.Properties[zfs.PoolPropCapacity].Value, "%")
+	pct, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("pool %s: unexpected capacity %q", name, v)
+	}
+	return pct, nil
+}
+
+// orderCandidates returns the snapshots in candidates, whose destruction is estimated to free freed[i] bytes each, in
+// the order in which strategy destroys them.
+func orderCandidates(candidates []*zfstools.SnapMetadata, freed []uint64,
+	strategy pruneStrategy) []*zfstools.SnapMetadata {
+	ordered := make([]spaceCandidate, len(candidates))
+	for i, snap := range candidates {
+		ordered[i] = spaceCandidate{snap, freed[i]}
+	}
+	sort.Stable(byStrategy{ordered, strategy})
+
+	result := make([]*zfstools.SnapMetadata, len(ordered))
+	for i, c := range ordered {
+		result[i] = c.snap
+	}
+	return result
+}
+
+type spaceCandidate struct {
+	snap  *zfstools.SnapMetadata
+	freed uint64
+}
+
+type byStrategy struct {
+	candidates []spaceCandidate
+	strategy   pruneStrategy
+}
+
+func (a byStrategy) Len() int { return len(a.candidates) }
+func (a byStrategy) Swap(i, j int) {
+	a.candidates[i], a.candidates[j] = a.candidates[j], a.candidates[i]
+}
+func (a byStrategy) Less(i, j int) bool {
+	ci, cj := a.candidates[i], a.candidates[j]
+	if a.strategy == pruneMostSpace && ci.freed != cj.freed {
+		return ci.freed > cj.freed
+	}
+	return ci.snap.TS.Before(cj.snap.TS)
+}
+
+// poolName returns the name of the pool that contains the named dataset.
+func poolName(dataset string) string {
+	return strings.SplitN(dataset, "/", 2)[0]
+}
+
+// relieveSpacePressure is run after snapshots have been managed normally.  For each pool whose capacity is at least
+// highPct, it destroys snapshots of the given datasets on that pool, in the order given by strategy, until the pool's
+// capacity drops below lowPct or each series has only emergencyKeep snapshots left.  series returns each dataset's
+// series (see Tool.datasetSeries).  Series that keep all snapshots (whether by configuration or by property) are left
+// alone, and no snapshot younger than its series' MinRetention is destroyed.  Snapshots that are estimated to free
+// little space are reported before any are destroyed.  A snapshot that cannot be destroyed (e.g. because it is held)
+// is logged and skipped.
+//
+// N.B.: ZFS may free space asynchronously after a snapshot is destroyed, so the pool's capacity may lag behind; this
+// can cause more snapshots to be destroyed than are strictly necessary.  Likewise, the space that a snapshot would free
+// is estimated before any are destroyed; destroying one snapshot can increase the space that its neighbours would free.
+//
+func (tool *Tool) relieveSpacePressure(env spaceEnv, datasets []string, series func(dataset string) []seriesConfig,
+	highPct, lowPct, emergencyKeep int, strategy pruneStrategy, now time.Time) error {
+
+	datasetsByPool := make(map[string][]string)
+	for _, dataset := range datasets {
+		pool := poolName(dataset)
+		datasetsByPool[pool] = append(datasetsByPool[pool], dataset)
+	}
+
+	for pool, poolDatasets := range datasetsByPool {
+		pct, err := env.capacity(pool)
+		if err != nil {
+			return err
+		}
+		if pct < highPct {
+			continue
+		}
+		tool.l.WithFields(logrus.Fields{"pool": pool, "capacity": pct, "highPct": highPct}).Warn(
+			"pool is above high-water mark; pruning snapshots")
+
+		var candidates []*zfstools.SnapMetadata
+		for _, dataset := range poolDatasets {
+			for _, s := range series(dataset) {
+				if s.Keep == -1 {
+					continue
+				}
+				snaps, err := env.snapshots(dataset, s)
+				if err != nil {
+					return err
+				}
+				emergency := s
+				if emergency.Keep > emergencyKeep {
+					emergency.Keep = emergencyKeep
+				}
+				candidates = append(candidates, snapshotsToRemove(snaps, emergency, now)...)
+			}
+		}
+		freed := make([]uint64, len(candidates))
+		for i, snap := range candidates {
+			if freed[i], err = env.freed(snap); err != nil {
+				return err
+			}
+			if freed[i] < littleSpace {
+				tool.l.WithFields(logrus.Fields{"snapshot": snap.Path(), "freed": freed[i]}).Info(
+					"destroying snapshot would free little space")
+			}
+		}
+		candidates = orderCandidates(candidates, freed, strategy)
+
+		for _, snap := range candidates {
+			if pct < lowPct {
+				break
+			}
+			tool.l.WithFields(logrus.Fields{"snapshot": snap.Path(), "capacity": pct}).Info(
+				"removing snapshot to relieve space pressure")
+			if err := env.remove(snap); err != nil {
+				tool.l.WithFields(logrus.Fields{"snapshot": snap.Path()}).WithError(err).Warn(
+					"failed to remove snapshot to relieve space pressure; skipping it")
+				continue
+			}
+			if pct, err = env.capacity(pool); err != nil {
+				return err
+			}
+		}
+		if pct >= lowPct {
+			tool.l.WithFields(logrus.Fields{"pool": pool, "capacity": pct, "lowPct": lowPct}).Warn(
+				"pool is still above low-water mark after pruning")
+		}
+	}
+
+	return nil
+}
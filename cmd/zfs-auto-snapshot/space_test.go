@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePool is a pool whose capacity drops by a fixed amount for each snapshot destroyed, or, if freedPct is set, by the
+// amount given there for the snapshot.
+type fakePool struct {
+	capacity  int
+	perSnap   int
+	freedPct  map[string]int                      // keyed by snapshot path
+	snaps     map[string][]*zfstools.SnapMetadata // keyed by dataset + "@" + label
+	held      map[string]bool                     // keyed by snapshot path; these cannot be destroyed
+	destroyed []string
+}
+
+func (p *fakePool) pctFreed(snap *zfstools.SnapMetadata) int {
+	if p.freedPct != nil {
+		return p.freedPct[snap.Path()]
+	}
+	return p.perSnap
+}
+
+func (p *fakePool) env() spaceEnv {
+	return spaceEnv{
+		capacity: func(pool string) (int, error) {
+			return p.capacity, nil
+		},
+		snapshots: func(dataset string, s seriesConfig) ([]*zfstools.SnapMetadata, error) {
+			return p.snaps[dataset+"@"+s.Label], nil
+		},
+		remove: func(snap *zfstools.SnapMetadata) error {
+			if p.held[snap.Path()] {
+				return fmt.Errorf("cannot destroy snapshot %s: dataset is busy", snap.Path())
+			}
+			p.destroyed = append(p.destroyed, snap.Path())
+			p.capacity -= p.pctFreed(snap)
+			return nil
+		},
+		freed: func(snap *zfstools.SnapMetadata) (uint64, error) {
+			// Pretend that the pool is 100 GiB.
+			return uint64(p.pctFreed(snap)) << 30, nil
+		},
+	}
+}
+
+func TestRelieveSpacePressure(t *testing.T) {
+	now := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	configured := []seriesConfig{{Label: "daily", Interval: 24 * time.Hour, Keep: 10}}
+
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	tool := &Tool{l: l, allowDestroy: true}
+	datasets := map[string]zfs.Dataset{"tank": {}}
+	series := func(dsPath string) []seriesConfig {
+		return tool.datasetSeries(dsPath, datasets[dsPath], configured)
+	}
+
+	newPool := func(capacity int) *fakePool {
+		return &fakePool{capacity: capacity, perSnap: 3, snaps: map[string][]*zfstools.SnapMetadata{
+			"tank@daily": dailySnaps(now, 10),
+		}}
+	}
+
+	// Below the high-water mark: nothing is destroyed.
+	p := newPool(80)
+	assert.NoError(t, tool.relieveSpacePressure(p.env(), []string{"tank"}, series, 85, 75, 2, pruneOldest, now))
+	assert.Empty(t, p.destroyed)
+
+	// Above the high-water mark: the oldest snapshots are destroyed until the pool is below the low-water mark.
+	p = newPool(90)
+	assert.NoError(t, tool.relieveSpacePressure(p.env(), []string{"tank"}, series, 85, 75, 2, pruneOldest, now))
+	assert.Equal(t, []string{
+		"tank@zfs-auto-snap_daily_2009-12-24T03:04:05Z",
+		"tank@zfs-auto-snap_daily_2009-12-25T03:04:05Z",
+		"tank@zfs-auto-snap_daily_2009-12-26T03:04:05Z",
+		"tank@zfs-auto-snap_daily_2009-12-27T03:04:05Z",
+		"tank@zfs-auto-snap_daily_2009-12-28T03:04:05Z",
+		"tank@zfs-auto-snap_daily_2009-12-29T03:04:05Z",
+	}, p.destroyed)
+	assert.Equal(t, 72, p.capacity)
+
+	// The pool can't get below the low-water mark: pruning stops at -space-emergency-keep.
+	p = newPool(99)
+	assert.NoError(t, tool.relieveSpacePressure(p.env(), []string{"tank"}, series, 85, 75, 2, pruneOldest, now))
+	assert.Equal(t, 8, len(p.destroyed))
+
+	// A snapshot that cannot be destroyed is skipped, and the next one is destroyed in its place.
+	p = newPool(90)
+	p.held = map[string]bool{"tank@zfs-auto-snap_daily_2009-12-25T03:04:05Z": true}
+	assert.NoError(t, tool.relieveSpacePressure(p.env(), []string{"tank"}, series, 85, 75, 2, pruneOldest, now))
+	assert.Equal(t, []string{
+		"tank@zfs-auto-snap_daily_2009-12-24T03:04:05Z",
+		"tank@zfs-auto-snap_daily_2009-12-26T03:04:05Z",
+		"tank@zfs-auto-snap_daily_2009-12-27T03:04:05Z",
+		"tank@zfs-auto-snap_daily_2009-12-28T03:04:05Z",
+		"tank@zfs-auto-snap_daily_2009-12-29T03:04:05Z",
+		"tank@zfs-auto-snap_daily_2009-12-30T03:04:05Z",
+	}, p.destroyed)
+	assert.Equal(t, 72, p.capacity)
+
+	// Series that keep all snapshots are left alone.
+	p = newPool(99)
+	keepAll := func(string) []seriesConfig {
+		return []seriesConfig{{Label: "daily", Interval: 24 * time.Hour, Keep: -1}}
+	}
+	assert.NoError(t, tool.relieveSpacePressure(p.env(), []string{"tank"}, keepAll, 85, 75, 2, pruneOldest, now))
+	assert.Empty(t, p.destroyed)
+
+	// So are those that a dataset's property says to keep all of.
+	p = newPool(99)
+	datasets["tank"] = zfs.Dataset{UserProperties: map[string]zfs.Property{"zfstools:keep-daily": {Value: "-1"}}}
+	assert.NoError(t, tool.relieveSpacePressure(p.env(), []string{"tank"}, series, 85, 75, 2, pruneOldest, now))
+	assert.Empty(t, p.destroyed)
+}
+
+func TestRelieveSpacePressureStrategy(t *testing.T) {
+	now := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	series := func(string) []seriesConfig {
+		return []seriesConfig{{Label: "daily", Interval: 24 * time.Hour, Keep: 10}}
+	}
+	snaps := dailySnaps(now, 6)
+
+	// The two oldest snapshots share all of their blocks with their neighbours, so destroying them frees nothing;
+	// destroying the snapshot from two days ago frees the most.
+	newPool := func() *fakePool {
+		return &fakePool{
+			capacity: 90,
+			snaps:    map[string][]*zfstools.SnapMetadata{"tank@daily": snaps},
+			freedPct: map[string]int{
+				snaps[5].Path(): 0,
+				snaps[4].Path(): 0,
+				snaps[3].Path(): 1,
+				snaps[2].Path(): 12,
+				snaps[1].Path(): 2,
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		strategy  pruneStrategy
+		destroyed []*zfstools.SnapMetadata
+		capacity  int
+	}{
+		// Oldest first: the snapshots that free nothing are lost for no gain before the big one is reached.
+		{pruneOldest, []*zfstools.SnapMetadata{snaps[5], snaps[4], snaps[3], snaps[2]}, 77},
+		// Most space first: one snapshot is enough.
+		{pruneMostSpace, []*zfstools.SnapMetadata{snaps[2]}, 78},
+	} {
+		var buf bytes.Buffer
+		l := logrus.New()
+		l.Out = &buf
+		l.Formatter = &logrus.TextFormatter{DisableColors: true, DisableTimestamp: true}
+		tool := &Tool{l: l, allowDestroy: true}
+
+		p := newPool()
+		assert.NoError(t, tool.relieveSpacePressure(p.env(), []string{"tank"}, series, 85, 80, 1, tt.strategy, now))
+		var want []string
+		for _, snap := range tt.destroyed {
+			want = append(want, snap.Path())
+		}
+		assert.Equal(t, want, p.destroyed, string(tt.strategy))
+		assert.Equal(t, tt.capacity, p.capacity, string(tt.strategy))
+
+		// Either way, the snapshots that would free little space are reported.
+		assert.Equal(t, 2, strings.Count(buf.String(), "destroying snapshot would free little space"), string(tt.strategy))
+	}
+}
+
+func TestSpaceFlags(t *testing.T) {
+	defer func(high, low, keep int, strategy string) {
+		*spaceHighPct, *spaceLowPct, *spaceEmergencyKeep, *pruneStrategyFlag = high, low, keep, strategy
+	}(*spaceHighPct, *spaceLowPct, *spaceEmergencyKeep, *pruneStrategyFlag)
+
+	for _, tt := range []struct {
+		high, low, keep int
+		strategy        string
+		lowPct          int // the low-water mark; -1 if the flags are invalid
+	}{
+		{0, 0, 1, "oldest", 0},
+		{90, 0, 1, "oldest", 90},
+		{90, 80, 0, "most-space", 80},
+		{0, 80, 1, "oldest", 80}, // -space-low-pct has no effect without -space-high-pct
+		{90, 95, 1, "oldest", -1},
+		{90, 80, -1, "oldest", -1},
+		{90, 80, 1, "newest", -1},
+		{0, 0, 1, "", -1},
+	} {
+		*spaceHighPct, *spaceLowPct, *spaceEmergencyKeep, *pruneStrategyFlag = tt.high, tt.low, tt.keep, tt.strategy
+		lowPct, strategy, err := spaceFlags()
+		if tt.lowPct < 0 {
+			assert.Error(t, err, "%+v", tt)
+		} else if assert.NoError(t, err, "%+v", tt) {
+			assert.Equal(t, tt.lowPct, lowPct, "%+v", tt)
+			assert.Equal(t, pruneStrategy(tt.strategy), strategy, "%+v", tt)
+		}
+	}
+}
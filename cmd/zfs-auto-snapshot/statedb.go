@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/kelleyk/zfstools"
+)
+
+// stateDB records the snapshots that this tool has created and when it created them, so that the series that a
+// snapshot belongs to and its creation time need not be parsed out of its name.  It is stored as a JSON file.
+type stateDB struct {
+	path string
+
+	// Series maps a dataset name and then a series label to the snapshots in that series.
+	Series map[string]map[string][]stateEntry `json:"series"`
+
+	// Trims maps a pool name to the time at which this tool last started a trim of that pool (see Tool.scheduleTrims).
+	Trims map[string]time.Time `json:"trims,omitempty"`
+
+	// known contains the datasets that the database had snapshots of when it was loaded, and seeded contains the
+	// dataset name + "@" + series label of each series that has since been seeded (see needsSeed).
+	known  map[string]bool
+	seeded map[string]bool
+}
+
+type stateEntry struct {
+	Name    string    `json:"name"` // the part of the snapshot's name after the "@"
+	Created time.Time `json:"created"`
+}
+
+// loadStateDB reads the state file at path.  If the file does not exist, an empty database is returned; it will be
+// created when the database is saved.
+func loadStateDB(path string) (*stateDB, error) {
+	db := &stateDB{path: path}
+
+	buf, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(buf, db); err != nil {
+			return nil, err
+		}
+	}
+
+	if db.Series == nil {
+		db.Series = make(map[string]map[string][]stateEntry)
+	}
+	if db.Trims == nil {
+		db.Trims = make(map[string]time.Time)
+	}
+	db.known = make(map[string]bool)
+	for dataset := range db.Series {
+		db.known[dataset] = true
+	}
+	db.seeded = make(map[string]bool)
+	return db, nil
+}
+
+// save writes the database back to the file it was loaded from.
+func (db *stateDB) save() error {
+	buf, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(db.path, buf)
+}
+
+// add records that the snapshot described by meta was created as part of the series meta.Label.
+func (db *stateDB) add(meta *zfstools.SnapMetadata) {
+	if db.Series[meta.Dataset] == nil {
+		db.Series[meta.Dataset] = make(map[string][]stateEntry)
+	}
+	db.Series[meta.Dataset][meta.Label] = append(db.Series[meta.Dataset][meta.Label],
+		stateEntry{Name: meta.Name(), Created: meta.TS})
+}
+
+// needsSeed returns true if the snapshots of dataset in the series label must be found some other way (e.g. by their
+// names) and recorded with seed: that is, if the database had no snapshots of dataset when it was loaded (e.g. because
+// the dataset was snapshotted before -state-db was given), and the series has not been seeded since.
+func (db *stateDB) needsSeed(dataset, label string) bool {
+	return !db.known[dataset] && !db.seeded[dataset+"@"+label]
+}
+
+// seed records snaps, the existing snapshots of dataset in the series label, except those that are already recorded
+// (e.g. because they were created during this run).
+func (db *stateDB) seed(dataset, label string, snaps []*zfstools.SnapMetadata) {
+	if db.seeded == nil {
+		db.seeded = make(map[string]bool)
+	}
+	db.seeded[dataset+"@"+label] = true
+
+	recorded := make(map[string]bool)
+	for _, e := range db.Series[dataset][label] {
+		recorded[e.Name] = true
+	}
+	for _, snap := range snaps {
+		if !recorded[snap.Name()] {
+			db.add(snap)
+		}
+	}
+}
+
+// forget removes the snapshot with the given full name from the database, if it is there.
+func (db *stateDB) forget(path string) {
+	dataset, err := zfstools.SnapshotParent(path)
+	if err != nil {
+		return
+	}
+	name := path[len(dataset)+1:]
+
+	for label, entries := range db.Series[dataset] {
+		kept := entries[:0]
+		for _, e := range entries {
+			if e.Name != name {
+				kept = append(kept, e)
+			}
+		}
+		db.Series[dataset][label] = kept
+	}
+}
+
+// reconcile removes every snapshot that is not among existingPaths (the full names of the snapshots that actually
+// exist) from the database, and returns the number of snapshots removed.
+func (db *stateDB) reconcile(existingPaths []string) int {
+	existing := make(map[string]struct{}, len(existingPaths))
+	for _, path := range existingPaths {
+		existing[path] = struct{}{}
+	}
+
+	dropped := 0
+	for dataset, series := range db.Series {
+		for label, entries := range series {
+			kept := entries[:0]
+			for _, e := range entries {
+				if _, ok := existing[dataset+"@"+e.Name]; ok {
+					kept = append(kept, e)
+				} else {
+					dropped++
+				}
+			}
+			if len(kept) == 0 {
+				delete(series, label)
+			} else {
+				series[label] = kept
+			}
+		}
+		if len(series) == 0 {
+			delete(db.Series, dataset)
+		}
+	}
+	return dropped
+}
+
+// snapshots returns the snapshots of dataset in the series label, in order from most recent to least recent.
+func (db *stateDB) snapshots(dataset, label string) []*zfstools.SnapMetadata {
+	snaps := []*zfstools.SnapMetadata{}
+	for _, e := range db.Series[dataset][label] {
+		snaps = append(snaps, &zfstools.SnapMetadata{
+			Dataset:  dataset,
+			Prefix:   *prefix,
+			Label:    label,
+			TS:       e.Created,
+			SnapName: e.Name,
+		})
+	}
+	sort.Sort(zfstools.ByTS(snaps))
+	return snaps
+}
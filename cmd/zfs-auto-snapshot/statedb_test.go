@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateDBPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zfs-auto-snapshot-test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	// First run: the file does not exist yet.
+	db, err := loadStateDB(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Empty(t, db.snapshots("tank/foo", "daily"))
+
+	t0 := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		db.add(&zfstools.SnapMetadata{Dataset: "tank/foo", Prefix: "zfs-auto-snap", Label: "daily", TS: t0.AddDate(0, 0, i)})
+	}
+	db.add(&zfstools.SnapMetadata{Dataset: "tank/foo", Prefix: "zfs-auto-snap", Label: "hourly", TS: t0})
+	assert.NoError(t, db.save())
+
+	// Second run: the snapshots recorded by the first run are found, most recent first.
+	db, err = loadStateDB(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	snaps := db.snapshots("tank/foo", "daily")
+	if assert.Equal(t, 2, len(snaps)) {
+		assert.Equal(t, "tank/foo@zfs-auto-snap_daily_2016-01-02T00:00:00Z", snaps[0].Path())
+		assert.True(t, snaps[0].TS.Equal(t0.AddDate(0, 0, 1)))
+		assert.Equal(t, "tank/foo@zfs-auto-snap_daily_2016-01-01T00:00:00Z", snaps[1].Path())
+	}
+	assert.Equal(t, 1, len(db.snapshots("tank/foo", "hourly")))
+
+	db.forget("tank/foo@zfs-auto-snap_daily_2016-01-01T00:00:00Z")
+	assert.Equal(t, 1, len(db.snapshots("tank/foo", "daily")))
+}
+
+func TestStateDBReconcile(t *testing.T) {
+	db := &stateDB{Series: map[string]map[string][]stateEntry{
+		"tank/foo": {
+			"daily": {
+				{Name: "zfs-auto-snap_daily_2016-01-01T00:00:00Z"},
+				{Name: "zfs-auto-snap_daily_2016-01-02T00:00:00Z"},
+			},
+		},
+		"tank/bar": {
+			"daily": {{Name: "zfs-auto-snap_daily_2016-01-01T00:00:00Z"}},
+		},
+	}}
+
+	// Someone destroyed one of tank/foo's snapshots and all of tank/bar's by hand.
+	dropped := db.reconcile([]string{
+		"tank/foo@zfs-auto-snap_daily_2016-01-02T00:00:00Z",
+		"tank/foo@manual",
+	})
+
+	assert.Equal(t, 2, dropped)
+	assert.Equal(t, map[string]map[string][]stateEntry{
+		"tank/foo": {
+			"daily": {{Name: "zfs-auto-snap_daily_2016-01-02T00:00:00Z"}},
+		},
+	}, db.Series)
+}
+
+func TestStateDBSeed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zfs-auto-snapshot-test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	now := time.Date(2016, 1, 3, 0, 0, 0, 0, time.UTC)
+	db, err := loadStateDB(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	db.add(&zfstools.SnapMetadata{Dataset: "tank/foo", Prefix: "zfs-auto-snap", Label: "daily", TS: now})
+	assert.NoError(t, db.save())
+
+	db, err = loadStateDB(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// tank/foo's snapshots are already recorded; tank/bar has not been seen before.
+	assert.False(t, db.needsSeed("tank/foo", "daily"))
+	assert.False(t, db.needsSeed("tank/foo", "hourly"))
+	assert.True(t, db.needsSeed("tank/bar", "daily"))
+
+	// A snapshot of tank/bar was created during this run, before its existing snapshots were found; it is not
+	// recorded twice.
+	snaps := dailySnaps(now, 3)
+	for _, snap := range snaps {
+		snap.Dataset = "tank/bar"
+	}
+	db.add(snaps[0])
+	db.seed("tank/bar", "daily", snaps)
+	assert.False(t, db.needsSeed("tank/bar", "daily"))
+	assert.True(t, db.needsSeed("tank/bar", "hourly"))
+
+	recorded := db.snapshots("tank/bar", "daily")
+	if assert.Equal(t, 3, len(recorded)) {
+		for i, snap := range recorded {
+			assert.Equal(t, snaps[i].Path(), snap.Path())
+			assert.True(t, snaps[i].TS.Equal(snap.TS))
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// runStatus is written to the file given with -status-file so that other tools can see what the most recent run did.
+// Per-series entries are kept from earlier runs (e.g. so that the last successful run of a series is known even if
+// the most recent run failed).
+type runStatus struct {
+	path string
+
+	LastRun     time.Time `json:"lastRun"`
+	LastSuccess time.Time `json:"lastSuccess,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+
+	// Created and Removed are the numbers of snapshots created and removed by the last run, and Errors is the number
+	// of series that it failed to manage.
+	Created int `json:"created"`
+	Removed int `json:"removed"`
+	Errors  int `json:"errors"`
+
+	// Series maps a dataset name and then a series label to the status of that series.
+	Series map[string]map[string]*seriesStatus `json:"series"`
+
+	// manifest lists the snapshots created by this run (see -manifest); unlike the other fields, it is not saved.
+	manifest []manifestEntry
+}
+
+type seriesStatus struct {
+	LastRun     time.Time `json:"lastRun"`
+	LastSuccess time.Time `json:"lastSuccess,omitempty"`
+	Created     int       `json:"created"` // snapshots created by the last run
+	Removed     int       `json:"removed"` // snapshots removed by the last run
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// loadRunStatus reads the status file at path, if it exists.  If path is empty, the status is kept only in memory
+// (e.g. for -pushgateway).
+func loadRunStatus(path string) (*runStatus, error) {
+	st := &runStatus{path: path}
+
+	if path != "" {
+		buf, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(buf, st); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if st.Series == nil {
+		st.Series = make(map[string]map[string]*seriesStatus)
+	}
+	return st, nil
+}
+
+// beginRun resets the run-level fields at the start of a run.
+func (st *runStatus) beginRun(now time.Time) {
+	st.LastRun = now
+	st.LastError = ""
+	st.Created, st.Removed, st.Errors = 0, 0, 0
+	st.manifest = nil
+}
+
+// endRun records the outcome of the run that began with beginRun.
+func (st *runStatus) endRun(now time.Time, err error) {
+	if err != nil {
+		st.LastError = err.Error()
+	} else {
+		st.LastSuccess = now
+	}
+}
+
+// recordSeries records the outcome of a run of the series label of dataset at the given time.
+func (st *runStatus) recordSeries(dataset, label string, now time.Time, created, removed int, err error) {
+	if st.Series[dataset] == nil {
+		st.Series[dataset] = make(map[string]*seriesStatus)
+	}
+	ss := st.Series[dataset][label]
+	if ss == nil {
+		ss = &seriesStatus{}
+		st.Series[dataset][label] = ss
+	}
+
+	ss.LastRun = now
+	ss.Created, ss.Removed = created, removed
+	st.Created += created
+	st.Removed += removed
+	if err != nil {
+		ss.LastError = err.Error()
+		st.Errors++
+	} else {
+		ss.LastError = ""
+		ss.LastSuccess = now
+	}
+}
+
+// save writes the status back to the file it was loaded from.  It does nothing if the status was not loaded from a
+// file.
+func (st *runStatus) save() error {
+	if st.path == "" {
+		return nil
+	}
+	buf, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(st.path, buf)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zfs-auto-snapshot-test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "status.json")
+
+	t0 := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Hour)
+
+	// First run: both series succeed.
+	st, err := loadRunStatus(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	st.LastRun = t0
+	st.recordSeries("tank", "hourly", t0, 1, 2, nil)
+	st.recordSeries("tank", "daily", t0, 1, 0, nil)
+	assert.NoError(t, st.save())
+
+	// Second run: the hourly series fails.
+	st, err = loadRunStatus(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	st.LastRun = t1
+	st.recordSeries("tank", "hourly", t1, 0, 0, errors.New("out of space"))
+	st.LastError = "out of space"
+	assert.NoError(t, st.save())
+
+	// The file reflects the second run, but still knows when the hourly series last succeeded.
+	st, err = loadRunStatus(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, st.LastRun.Equal(t1))
+	assert.Equal(t, "out of space", st.LastError)
+
+	hourly := st.Series["tank"]["hourly"]
+	if assert.NotNil(t, hourly) {
+		assert.True(t, hourly.LastRun.Equal(t1))
+		assert.True(t, hourly.LastSuccess.Equal(t0))
+		assert.Equal(t, 0, hourly.Created)
+		assert.Equal(t, "out of space", hourly.LastError)
+	}
+	daily := st.Series["tank"]["daily"]
+	if assert.NotNil(t, daily) {
+		assert.True(t, daily.LastSuccess.Equal(t0))
+		assert.Equal(t, 1, daily.Created)
+		assert.Equal(t, "", daily.LastError)
+	}
+
+	// No temporary file is left behind.
+	_, err = os.Stat(path + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+}
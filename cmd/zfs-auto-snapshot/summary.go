@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// runStats is what a run did to one dataset (see runSummary).
+type runStats struct {
+	created, destroyed int
+	err                error
+}
+
+// runSummary accumulates the runStats of each dataset that a run manages, for the summary printed at the end of the
+// run.
+type runSummary struct {
+	datasets map[string]*runStats
+}
+
+func newRunSummary() *runSummary {
+	return &runSummary{datasets: make(map[string]*runStats)}
+}
+
+// record adds created and destroyed to the counts for dataset and, if err is not nil and no error has been recorded
+// for dataset yet, records err.
+func (s *runSummary) record(dataset string, created, destroyed int, err error) {
+	st := s.datasets[dataset]
+	if st == nil {
+		st = &runStats{}
+		s.datasets[dataset] = st
+	}
+	st.created += created
+	st.destroyed += destroyed
+	if st.err == nil {
+		st.err = err
+	}
+}
+
+// eventful returns true if any snapshot was created or destroyed, or any dataset failed (see -quiet).
+func (s *runSummary) eventful() bool {
+	for _, st := range s.datasets {
+		if st.created > 0 || st.destroyed > 0 || st.err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// write writes a line for each dataset, sorted by name, giving the numbers of snapshots created and destroyed and the
+// error, if any, followed by a line with the totals and the run's duration.
+func (s *runSummary) write(w io.Writer, duration time.Duration) {
+	names := make([]string, 0, len(s.datasets))
+	for name := range s.datasets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var created, destroyed, failed int
+	fmt.Fprintf(w, "%7s  %9s  %s\n", "CREATED", "DESTROYED", "DATASET")
+	for _, name := range names {
+		st := s.datasets[name]
+		line := fmt.Sprintf("%7d  %9d  %s", st.created, st.destroyed, name)
+		if st.err != nil {
+			line += fmt.Sprintf(" (error: %v)", st.err)
+			failed++
+		}
+		fmt.Fprintln(w, line)
+		created += st.created
+		destroyed += st.destroyed
+	}
+	fmt.Fprintf(w, "%d created, %d destroyed, %d of %d datasets failed in %v\n", created, destroyed, failed, len(names),
+		duration)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunSummary(t *testing.T) {
+	s := newRunSummary()
+	s.record("tank/home", 0, 0, nil)
+	assert.False(t, s.eventful())
+
+	s.record("tank/home", 1, 2, nil)
+	s.record("tank/home", 1, 0, nil)
+	s.record("tank/db", 0, 0, errors.New("out of space"))
+	s.record("tank/db", 0, 0, errors.New("second error"))
+	s.record("tank/tmp", 0, 0, nil)
+	assert.True(t, s.eventful())
+
+	var buf bytes.Buffer
+	s.write(&buf, 1500*time.Millisecond)
+	assert.Equal(t, ""+
+		"CREATED  DESTROYED  DATASET\n"+
+		"      0          0  tank/db (error: out of space)\n"+
+		"      2          2  tank/home\n"+
+		"      0          0  tank/tmp\n"+
+		"2 created, 2 destroyed, 1 of 3 datasets failed in 1.5s\n", buf.String())
+
+	// A failure alone makes a run eventful.
+	s = newRunSummary()
+	s.record("tank/db", 0, 0, errors.New("out of space"))
+	assert.True(t, s.eventful())
+}
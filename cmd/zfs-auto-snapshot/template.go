@@ -0,0 +1,37 @@
+package main
+
+import (
+	"sort"
+
+	zfs "github.com/kelleyk/go-libzfs"
+)
+
+// templateProperties returns the properties set locally on the template dataset d (see -property-template) that can
+// be given to a new snapshot.  Only user properties can be: a snapshot takes its native properties (e.g. compression)
+// from its dataset, so the names of the native properties set locally on d are returned in skipped instead.
+// Properties that d merely inherits are ignored, since they are not part of the template.
+func templateProperties(d zfs.Dataset) (userProps map[string]string, skipped []string) {
+	userProps = make(map[string]string)
+	for name, prop := range d.UserProperties {
+		if prop.Source == "local" {
+			userProps[name] = prop.Value
+		}
+	}
+	for p, prop := range d.Properties {
+		if prop.Source == "local" {
+			skipped = append(skipped, zfs.DatasetPropertyToName(p))
+		}
+	}
+	sort.Strings(skipped)
+	return userProps, skipped
+}
+
+// mergeTemplateProperties adds to userProps each of the template's properties that userProps does not already set;
+// the properties that the tool sets itself (e.g. AutoSnapshotSeriesProperty) take precedence over the template.
+func mergeTemplateProperties(userProps, template map[string]string) {
+	for name, value := range template {
+		if _, ok := userProps[name]; !ok {
+			userProps[name] = value
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateProperties(t *testing.T) {
+	template := zfs.Dataset{
+		Properties: map[zfs.Prop]zfs.Property{
+			zfs.DatasetPropCompression: {Value: "lz4", Source: "local"},
+			zfs.DatasetPropRecordsize:  {Value: "131072", Source: "default"},
+		},
+		UserProperties: map[string]zfs.Property{
+			"backup:catalog":                {Value: "nightly", Source: "local"},
+			"backup:owner":                  {Value: "ops", Source: "inherited from tank"},
+			"zfstools:auto-snapshot-series": {Value: "bogus", Source: "local"},
+		},
+	}
+
+	userProps, skipped := templateProperties(template)
+	assert.Equal(t, map[string]string{"backup:catalog": "nightly", "zfstools:auto-snapshot-series": "bogus"}, userProps)
+	// compression cannot be set on a snapshot; recordsize is not set locally, so it is not part of the template.
+	assert.Equal(t, []string{"compression"}, skipped)
+
+	// The properties that the tool sets itself win.
+	props := map[string]string{AutoSnapshotSeriesProperty: "daily"}
+	mergeTemplateProperties(props, userProps)
+	assert.Equal(t, map[string]string{AutoSnapshotSeriesProperty: "daily", "backup:catalog": "nightly"}, props)
+
+	// Without a template, nothing is added.
+	props = map[string]string{AutoSnapshotSeriesProperty: "daily"}
+	mergeTemplateProperties(props, nil)
+	assert.Equal(t, map[string]string{AutoSnapshotSeriesProperty: "daily"}, props)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"time"
+
+	"github.com/kelleyk/zfstools"
+)
+
+// thinningStep is one step of a thinningSchedule: of the snapshots that are at least After old, only one is kept in
+// each period of length Every.
+type thinningStep struct {
+	After time.Duration
+	Every time.Duration
+}
+
+// thinningSchedule thins a series' snapshots more and more coarsely as they age (see seriesConfig.Thinning), e.g.
+// keeping every snapshot for 2 days, then one per day until they are a week old, and then one per week:
+//
+//	thinning:
+//	  - after: 48h
+//	    every: 24h
+//	  - after: 168h
+//	    every: 168h
+//
+// Its steps must be in order of increasing After.
+type thinningSchedule []thinningStep
+
+// step returns the index of the step of t that applies to a snapshot that is age old, or -1 if none does.
+func (t thinningSchedule) step(age time.Duration) int {
+	for i := len(t) - 1; i >= 0; i-- {
+		if age >= t[i].After {
+			return i
+		}
+	}
+	return -1
+}
+
+// applyThinning returns those of snaps (which must be in order from most recent to least recent) that the schedule t
+// says should be destroyed, in the same order.  Periods are aligned to multiples of Every since the zero time (so that
+// e.g. a period of 24h is a calendar day in UTC), and the oldest snapshot in each period is the one that is kept: it
+// stays the period's representative as newer snapshots age into the period, and the oldest snapshot overall is never
+// destroyed.
+func applyThinning(snaps []*zfstools.SnapMetadata, t thinningSchedule, now time.Time) []*zfstools.SnapMetadata {
+	type period struct {
+		step  int
+		start time.Time
+	}
+	oldest := make(map[period]*zfstools.SnapMetadata)
+	for _, snap := range snaps {
+		i := t.step(now.Sub(snap.TS))
+		if i < 0 {
+			continue
+		}
+		// Since snaps are most recent first, the last snapshot seen in each period is its oldest.
+		oldest[period{i, snap.TS.Truncate(t[i].Every)}] = snap
+	}
+
+	var toRemove []*zfstools.SnapMetadata
+	for _, snap := range snaps {
+		i := t.step(now.Sub(snap.TS))
+		if i >= 0 && oldest[period{i, snap.TS.Truncate(t[i].Every)}] != snap {
+			toRemove = append(toRemove, snap)
+		}
+	}
+	return toRemove
+}
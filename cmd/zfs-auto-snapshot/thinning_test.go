@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+// hourlySnaps returns n snapshots taken an hour apart, the most recent at now, most recent first.
+func hourlySnaps(now time.Time, n int) []*zfstools.SnapMetadata {
+	snaps := make([]*zfstools.SnapMetadata, n)
+	for i := range snaps {
+		snaps[i] = &zfstools.SnapMetadata{Dataset: "tank", Prefix: "zfs-auto-snap", Label: "hourly",
+			TS: now.Add(-time.Duration(i) * time.Hour)}
+	}
+	return snaps
+}
+
+func TestApplyThinning(t *testing.T) {
+	now := time.Date(2010, 1, 20, 0, 0, 0, 0, time.UTC)
+	// Everything for 2 days, then one per day until a week, then one per week.
+	schedule := thinningSchedule{
+		{After: 48 * time.Hour, Every: 24 * time.Hour},
+		{After: 168 * time.Hour, Every: 168 * time.Hour},
+	}
+	snaps := hourlySnaps(now, 20*24)
+
+	toRemove := applyThinning(snaps, schedule, now)
+	removed := make(map[*zfstools.SnapMetadata]bool)
+	for _, snap := range toRemove {
+		removed[snap] = true
+	}
+
+	// Every snapshot younger than 2 days is kept.
+	for i := 0; i < 48; i++ {
+		assert.False(t, removed[snaps[i]], "snapshot %d hours old", i)
+	}
+
+	// From 2 days to a week, the oldest snapshot of each day is kept: midnight, except on the oldest (partial) day.
+	var kept []int
+	for i := 48; i < 168; i++ {
+		if !removed[snaps[i]] {
+			kept = append(kept, i)
+		}
+	}
+	assert.Equal(t, []int{48, 72, 96, 120, 144, 167}, kept)
+
+	// After that, exactly one snapshot is kept per week, and it is the oldest of its week.
+	weeks := make(map[time.Time]*zfstools.SnapMetadata)
+	for _, snap := range snaps[168:] {
+		weeks[snap.TS.Truncate(168*time.Hour)] = snap
+	}
+	kept = nil
+	for i := 168; i < len(snaps); i++ {
+		if !removed[snaps[i]] {
+			kept = append(kept, i)
+			assert.Equal(t, weeks[snaps[i].TS.Truncate(168*time.Hour)], snaps[i], "snapshot %d hours old", i)
+		}
+	}
+	assert.Equal(t, len(weeks), len(kept))
+	assert.Contains(t, kept, len(snaps)-1, "the oldest snapshot should be kept")
+
+	// The snapshots to remove are in the same order as snaps.
+	for i := 1; i < len(toRemove); i++ {
+		assert.True(t, toRemove[i-1].TS.After(toRemove[i].TS))
+	}
+
+	// Without a schedule, nothing is thinned.
+	assert.Empty(t, applyThinning(snaps, nil, now))
+}
+
+func TestSnapshotsToRemoveThinning(t *testing.T) {
+	now := time.Date(2010, 1, 20, 0, 0, 0, 0, time.UTC)
+	snaps := hourlySnaps(now, 4*24)
+	schedule := thinningSchedule{{After: 24 * time.Hour, Every: 24 * time.Hour}}
+
+	// With keep: -1, only thinning removes snapshots: of those at least a day old, which were taken on 4 days, one per
+	// day is kept.
+	toRemove := snapshotsToRemove(snaps, seriesConfig{Keep: -1, Thinning: schedule}, now)
+	assert.Equal(t, len(snaps)-24-4, len(toRemove))
+
+	// The Keep most recent snapshots are never thinned, even though 12 of them are at least a day old.
+	toRemove = snapshotsToRemove(snaps, seriesConfig{Keep: 36, Thinning: schedule}, now)
+	assert.Equal(t, snaps[36:], toRemove)
+
+	// Snapshots that are retained beyond Keep (here, by MaxAge) are thinned, and snapshots beyond both are removed as
+	// usual, after those removed by thinning: of the 25 snapshots from 24 to 48 hours old, which were taken on 2 days,
+	// 23 are thinned.
+	toRemove = snapshotsToRemove(snaps, seriesConfig{Keep: 12, MaxAge: 48 * time.Hour, Thinning: schedule}, now)
+	if assert.Equal(t, 23+len(snaps)-49, len(toRemove)) {
+		assert.Equal(t, snaps[25:48], toRemove[:23])
+		assert.Equal(t, snaps[49:], toRemove[23:])
+	}
+}
+
+func TestValidateThinning(t *testing.T) {
+	daily := seriesConfig{Label: "daily", Interval: 24 * time.Hour, Keep: -1}
+	for _, tt := range []struct {
+		schedule thinningSchedule
+		fields   []string
+	}{
+		{thinningSchedule{{After: 48 * time.Hour, Every: 24 * time.Hour}, {After: 168 * time.Hour, Every: 168 * time.Hour}},
+			nil},
+		{thinningSchedule{{After: 0, Every: 24 * time.Hour}}, []string{"series[0].thinning[0].after"}},
+		{thinningSchedule{{After: 48 * time.Hour, Every: 0}}, []string{"series[0].thinning[0].every"}},
+		{thinningSchedule{{After: 168 * time.Hour, Every: 168 * time.Hour}, {After: 48 * time.Hour, Every: 24 * time.Hour}},
+			[]string{"series[0].thinning[1].after"}},
+	} {
+		s := daily
+		s.Thinning = tt.schedule
+		var fields []string
+		if errs, ok := (&configFile{Series: []seriesConfig{s}}).Validate().(configErrors); ok {
+			for _, err := range errs {
+				fields = append(fields, err.(configProblem).Field)
+			}
+		}
+		assert.Equal(t, tt.fields, fields)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	zfs "github.com/kelleyk/go-libzfs"
+)
+
+// trimEnv holds the operations used to schedule trims.  They are fields so that tests can substitute fake pools; see
+// defaultTrimEnv for the real implementations.
+type trimEnv struct {
+	// supported returns true if any of the named pool's devices support TRIM.
+	supported func(pool string) (bool, error)
+	// autotrim returns true if the named pool's autotrim property is on.
+	autotrim func(pool string) (bool, error)
+	// trim starts a trim of the named pool; it does not wait for the trim to finish.
+	trim func(pool string) error
+}
+
+// defaultTrimEnv starts trims with the `zpool` command, since go-libzfs cannot start them, and reads the autotrim
+// property the same way, since the vendored libzfs headers predate it.
+var defaultTrimEnv = trimEnv{
+	supported: poolTrimSupported,
+	autotrim: func(pool string) (bool, error) {
+		rows, err := runZpool("get", "-H", "-o", "value", "autotrim", pool)
+		if err != nil {
+			return false, err
+		}
+		if len(rows) != 1 || len(rows[0]) != 1 {
+			return false, fmt.Errorf("unexpected output from zpool get: %q", rows)
+		}
+		return rows[0][0] == "on", nil
+	},
+	trim: func(pool string) error {
+		_, err := runZpool("trim", pool)
+		return err
+	},
+}
+
+// poolTrimSupported returns true if any of the named pool's devices support TRIM.  It returns false if the installed
+// version of ZFS does not support TRIM at all.
+func poolTrimSupported(name string) (bool, error) {
+	p, err := zfs.PoolOpen(name)
+	if err != nil {
+		return false, err
+	}
+	defer p.Close()
+
+	stats, err := p.TrimStatus()
+	if err != nil {
+		return false, err
+	}
+	for _, s := range stats {
+		if !s.NotSupported {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// scheduleTrims starts a trim of each of the named pools that this tool has not trimmed within interval of now, and
+// records in last (which maps a pool name to the time at which its most recent trim was started) when it did so.
+// Pools whose devices do not support TRIM are skipped, as are those with autotrim on, which need no scheduled trims.
+// A pool that cannot be trimmed does not keep the others from being trimmed; the first such error is returned.
+func (tool *Tool) scheduleTrims(env trimEnv, pools []string, interval time.Duration, last map[string]time.Time,
+	now time.Time) error {
+
+	var firstErr error
+	for _, pool := range pools {
+		l := tool.l.WithFields(logrus.Fields{"pool": pool})
+		if prev, ok := last[pool]; ok && now.Sub(prev) < interval {
+			l.WithFields(logrus.Fields{"lastTrim": prev}).Debug("pool trimmed recently")
+			continue
+		}
+
+		err := func() error {
+			supported, err := env.supported(pool)
+			if err != nil {
+				return err
+			}
+			if !supported {
+				l.Info("trim skipped, since the pool's devices do not support it")
+				return nil
+			}
+			autotrim, err := env.autotrim(pool)
+			if err != nil {
+				return err
+			}
+			if autotrim {
+				l.Info("trim skipped, since autotrim is on")
+				return nil
+			}
+
+			if tool.dryRun {
+				l.Info("pool would be trimmed")
+				return nil
+			}
+			l.Info("trimming pool")
+			if err := env.trim(pool); err != nil {
+				return err
+			}
+			last[pool] = now
+			return nil
+		}()
+		if err != nil {
+			l.WithError(err).Error("failed to trim pool")
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// datasetPools returns the names of the pools that the named datasets are on, in sorted order and without duplicates.
+func datasetPools(datasets []string) []string {
+	var pools []string
+	seen := make(map[string]bool)
+	for _, name := range datasets {
+		if pool := poolName(name); !seen[pool] {
+			seen[pool] = true
+			pools = append(pools, pool)
+		}
+	}
+	sort.Strings(pools)
+	return pools
+}
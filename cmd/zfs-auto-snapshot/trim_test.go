@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTrimPools is a set of pools for trimEnv, which records the trims that are started.
+type fakeTrimPools struct {
+	unsupported map[string]bool
+	autotrim    map[string]bool
+	fail        map[string]bool
+	trimmed     []string
+}
+
+func (f *fakeTrimPools) env() trimEnv {
+	return trimEnv{
+		supported: func(pool string) (bool, error) { return !f.unsupported[pool], nil },
+		autotrim:  func(pool string) (bool, error) { return f.autotrim[pool], nil },
+		trim: func(pool string) error {
+			if f.fail[pool] {
+				return errors.New("trim failed")
+			}
+			f.trimmed = append(f.trimmed, pool)
+			return nil
+		},
+	}
+}
+
+func TestScheduleTrims(t *testing.T) {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	tool := &Tool{l: l}
+	f := &fakeTrimPools{unsupported: map[string]bool{"hdd": true}, autotrim: map[string]bool{"auto": true}}
+	pools := []string{"auto", "hdd", "ssd", "tank"}
+	week := 7 * 24 * time.Hour
+	start := time.Date(2016, 1, 4, 3, 0, 0, 0, time.UTC)
+	last := map[string]time.Time{"tank": start.Add(-6 * 24 * time.Hour)}
+
+	for _, tt := range []struct {
+		now     time.Time
+		trimmed []string
+	}{
+		// tank was trimmed six days ago; the pools without TRIM support or with autotrim on are never trimmed.
+		{start, []string{"ssd"}},
+		{start.Add(time.Hour), nil},
+		{start.Add(24 * time.Hour), []string{"tank"}},
+		{start.Add(week - time.Minute), nil},
+		{start.Add(week), []string{"ssd"}},
+		{start.Add(week + 24*time.Hour), []string{"tank"}},
+	} {
+		f.trimmed = nil
+		if assert.NoError(t, tool.scheduleTrims(f.env(), pools, week, last, tt.now), "%v", tt.now) {
+			assert.Equal(t, tt.trimmed, f.trimmed, "%v", tt.now)
+		}
+	}
+	assert.Equal(t, map[string]time.Time{"ssd": start.Add(week), "tank": start.Add(week + 24*time.Hour)}, last)
+
+	// A dry run starts no trims and records none.
+	tool.dryRun = true
+	f.trimmed = nil
+	assert.NoError(t, tool.scheduleTrims(f.env(), pools, week, last, start.Add(3*week)))
+	assert.Nil(t, f.trimmed)
+	assert.Equal(t, start.Add(week), last["ssd"])
+	tool.dryRun = false
+
+	// A pool that cannot be trimmed is retried on the next run, and does not keep the others from being trimmed.
+	f.fail = map[string]bool{"ssd": true}
+	f.trimmed = nil
+	assert.Error(t, tool.scheduleTrims(f.env(), pools, week, last, start.Add(3*week)))
+	assert.Equal(t, []string{"tank"}, f.trimmed)
+	assert.Equal(t, start.Add(week), last["ssd"])
+}
+
+func TestDatasetPools(t *testing.T) {
+	assert.Equal(t, []string{"backup", "tank"}, datasetPools([]string{"tank/a", "backup", "tank", "tank/b/c"}))
+	assert.Nil(t, datasetPools(nil))
+}
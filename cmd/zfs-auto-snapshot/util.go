@@ -1,6 +1,11 @@
 package main
 
-import zfs "github.com/kelleyk/go-libzfs"
+import (
+	"io/ioutil"
+	"os"
+
+	zfs "github.com/kelleyk/go-libzfs"
+)
 
 // walkDataset visits the dataset d and its children, including snapshots.
 //
@@ -31,3 +36,49 @@ func poolScanning(d zfs.Dataset) (bool, error) {
 	}
 	return (rootVDev.ScanStat.State == zfs.DSLScanStateScanning), nil
 }
+
+// poolReadonly returns true iff the named pool is imported read-only (e.g. for recovery), in which case no snapshot can
+// be created or destroyed on it.
+func poolReadonly(name string) (bool, error) {
+	p, err := zfs.PoolOpen(name)
+	if err != nil {
+		return false, err
+	}
+	defer p.Close()
+	return p.Properties[zfs.PoolPropReadonly].Value == "on", nil
+}
+
+// readonlyDatasets returns the set of those of datasets that are on read-only pools.  readonly (e.g. poolReadonly) is
+// called only once for each pool.
+func readonlyDatasets(datasets []string, readonly func(pool string) (bool, error)) (map[string]bool, error) {
+	datasetsByPool := make(map[string][]string)
+	for _, dataset := range datasets {
+		pool := poolName(dataset)
+		datasetsByPool[pool] = append(datasetsByPool[pool], dataset)
+	}
+
+	result := make(map[string]bool)
+	for pool, poolDatasets := range datasetsByPool {
+		ro, err := readonly(pool)
+		if err != nil {
+			return nil, err
+		}
+		if !ro {
+			continue
+		}
+		for _, dataset := range poolDatasets {
+			result[dataset] = true
+		}
+	}
+	return result, nil
+}
+
+// writeFileAtomic writes buf to the file at path by writing a temporary file and then renaming it over path, so that
+// readers never see a partially-written file and an interrupted write does not destroy the previous contents.
+func writeFileAtomic(path string, buf []byte) error {
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
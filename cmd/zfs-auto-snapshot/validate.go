@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	zfs "github.com/kelleyk/go-libzfs"
+)
+
+// runValidate implements the "validate" subcommand, which checks a configuration file (e.g. before it is deployed)
+// and, optionally, that the datasets that the tool will be run on exist.  Each problem is written to w.  It returns
+// true iff there were none.
+func runValidate(w io.Writer, args []string) bool {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	path := fs.String("config", *configPath, "Path to the configuration file to validate.")
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(w, "Error: %s\n", err)
+		return false
+	}
+
+	errs := validateDeployment(*path, fs.Args(), checkDataset)
+	for _, err := range errs {
+		fmt.Fprintf(w, "Error: %s\n", err)
+	}
+	return len(errs) == 0
+}
+
+// validateDeployment returns every problem with the configuration file at path, loaded as Main loads it (see
+// loadConfig), that would stop Main from running with the flags given (see configFile.labelsContaining,
+// configFile.fastIntervals, and spaceFlags), and an error for each of datasets (other than "//") that check fails for.
+func validateDeployment(path string, datasets []string, check func(name string) error) []error {
+	var errs []error
+	if _, _, err := spaceFlags(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if path == "" {
+		errs = append(errs, fmt.Errorf("no config file path given"))
+	} else if conf, err := loadConfig(path); err != nil {
+		if problems, ok := err.(configErrors); ok {
+			errs = append(errs, problems...)
+		} else {
+			errs = append(errs, err)
+		}
+	} else {
+		errs = append(errs, conf.labelsContaining(*sep)...)
+		if !*allowFastIntervals {
+			errs = append(errs, conf.fastIntervals(*minInterval)...)
+		}
+		if conf.Trim != nil && *stateDBPath == "" {
+			errs = append(errs, errTrimNeedsStateDB)
+		}
+	}
+
+	for _, name := range datasets {
+		if name == "//" {
+			continue
+		}
+		if err := check(name); err != nil {
+			errs = append(errs, fmt.Errorf("dataset %s: %v", name, err))
+		}
+	}
+
+	return errs
+}
+
+// checkDataset returns an error if the named dataset cannot be opened (e.g. because it does not exist).
+func checkDataset(name string) error {
+	if err := zfs.Available(); err != nil {
+		return err
+	}
+	d, err := zfs.DatasetOpen(name)
+	if err != nil {
+		return err
+	}
+	d.Close()
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDeployment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zfs-auto-snapshot-test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	check := func(name string) error {
+		if name == "tank" || name == "tank/foo" {
+			return nil
+		}
+		return errors.New("dataset does not exist")
+	}
+
+	for _, tt := range []struct {
+		desc     string
+		conf     string
+		datasets []string
+		errs     []string
+	}{
+		{"valid", `
+series:
+  - label: hourly
+    interval: 1h
+    keep: 24
+  - label: daily
+    interval: 24h
+    keep: 7
+`, []string{"tank", "tank/foo"}, nil},
+		{"every problem is reported", `
+series:
+  - label: hourly
+    interval: 1h
+    keep: -2
+  - label: hourly
+    interval: 0s
+    keep: 7
+  - label: week_ly
+    interval: 168h
+    keep: 4
+excluderegexps:
+  - "(unclosed"
+`, []string{"//"}, []string{
+			`excluderegexps[0]: invalid exclude regexp "(unclosed"`,
+			`series[0].keep: series "hourly" has invalid value for 'keep'`,
+			`series[1].label: more than one series has label "hourly"`,
+			`series[1].interval: series "hourly" has interval <= 0`,
+			`series[2].label: series label "week_ly" contains an underscore`,
+		}},
+		{"fast interval", `
+series:
+  - label: tensec
+    interval: 10s
+    keep: 3
+`, nil, []string{
+			`series[0].interval: series "tensec" has interval 10s, which is shorter than -min-interval (1m0s)`,
+		}},
+		{"missing datasets", `
+series:
+  - label: daily
+    interval: 24h
+    keep: 7
+`, []string{"tank", "tank/nope", "other"}, []string{"dataset tank/nope:", "dataset other:"}},
+		{"unparseable", "series: [", []string{"tank/nope"}, []string{"yaml:", "dataset tank/nope:"}},
+	} {
+		path := filepath.Join(dir, "config.yaml")
+		if !assert.NoError(t, ioutil.WriteFile(path, []byte(tt.conf), 0644)) {
+			continue
+		}
+
+		errs := validateDeployment(path, tt.datasets, check)
+		if assert.Len(t, errs, len(tt.errs), "%s: %v", tt.desc, errs) {
+			for i, err := range errs {
+				assert.Contains(t, err.Error(), tt.errs[i], tt.desc)
+			}
+		}
+	}
+
+	errs := validateDeployment(filepath.Join(dir, "missing.yaml"), nil, check)
+	assert.Len(t, errs, 1)
+}
+
+// TestValidateDeploymentFlags checks that the configuration file is validated as Main would load and check it with the
+// flags given.
+func TestValidateDeploymentFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zfs-auto-snapshot-test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	validate := func(conf string) []error {
+		if !assert.NoError(t, ioutil.WriteFile(path, []byte(conf), 0644)) {
+			return nil
+		}
+		return validateDeployment(path, nil, nil)
+	}
+
+	// Series without labels are given them with -auto-label.
+	unlabeled := `
+series:
+  - interval: 1h
+    keep: 24
+`
+	assert.Len(t, validate(unlabeled), 1)
+	*autoLabel = true
+	assert.Empty(t, validate(unlabeled))
+	*autoLabel = false
+
+	// Labels may not contain the separator given with -sep.
+	spaced := `
+series:
+  - label: two hours
+    interval: 2h
+    keep: 12
+`
+	assert.Empty(t, validate(spaced))
+	*sep = " "
+	errs := validate(spaced)
+	*sep = zfstools.DefaultSep
+	if assert.Len(t, errs, 1) {
+		assert.Contains(t, errs[0].Error(), "contains the separator")
+	}
+
+	// A trim section requires -state-db.
+	trimmed := `
+series:
+  - label: daily
+    interval: 24h
+    keep: 7
+trim:
+  interval: 168h
+`
+	assert.Equal(t, []error{errTrimNeedsStateDB}, validate(trimmed))
+	*stateDBPath = filepath.Join(dir, "state.json")
+	assert.Empty(t, validate(trimmed))
+	*stateDBPath = ""
+
+	// Invalid space-pressure flags are reported.
+	*pruneStrategyFlag = "newest"
+	errs = validate(spaced)
+	*pruneStrategyFlag = string(pruneOldest)
+	if assert.Len(t, errs, 1) {
+		assert.Contains(t, errs[0].Error(), "-prune-strategy")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	zfs "github.com/kelleyk/go-libzfs"
+)
+
+// waitBackoffInitial and waitBackoffMax bound the delay between attempts to open datasets (see waitForDatasets).
+const (
+	waitBackoffInitial = time.Second
+	waitBackoffMax     = 30 * time.Second
+)
+
+// waitForDatasets calls open (e.g. zfs.DatasetOpenAll) until it returns at least one dataset, e.g. because the tool was
+// started at boot before pools finished importing (see -wait-for-pools).  Between attempts, it calls sleep with a delay
+// that doubles each time, up to waitBackoffMax; once the delays would add up to more than timeout, it returns the
+// result of the last attempt, whatever it was.  A timeout of 0 means that open is called only once.
+func waitForDatasets(l *logrus.Logger, open func() ([]zfs.Dataset, error), timeout time.Duration,
+	sleep func(time.Duration)) ([]zfs.Dataset, error) {
+
+	var waited time.Duration
+	delay := waitBackoffInitial
+	for {
+		datasets, err := open()
+		if (err == nil && len(datasets) > 0) || waited+delay > timeout {
+			return datasets, err
+		}
+		l.WithFields(logrus.Fields{"waited": waited, "delay": delay}).WithError(err).Info(
+			"no datasets available yet; waiting for pools to be imported")
+		sleep(delay)
+		waited += delay
+		if delay *= 2; delay > waitBackoffMax {
+			delay = waitBackoffMax
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitForDatasets(t *testing.T) {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	errNotReady := errors.New("not ready")
+
+	// The source fails, then returns nothing, and then returns a dataset.
+	results := []func() ([]zfs.Dataset, error){
+		func() ([]zfs.Dataset, error) { return nil, errNotReady },
+		func() ([]zfs.Dataset, error) { return nil, nil },
+		func() ([]zfs.Dataset, error) { return []zfs.Dataset{{}}, nil },
+	}
+	var calls int
+	open := func() ([]zfs.Dataset, error) {
+		calls++
+		return results[calls-1]()
+	}
+	var slept []time.Duration
+	sleep := func(d time.Duration) { slept = append(slept, d) }
+
+	datasets, err := waitForDatasets(l, open, time.Minute, sleep)
+	assert.NoError(t, err)
+	assert.Len(t, datasets, 1)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, slept)
+
+	// Without a timeout, the source is tried only once.
+	calls, slept = 0, nil
+	_, err = waitForDatasets(l, open, 0, sleep)
+	assert.Equal(t, errNotReady, err)
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, slept)
+
+	// Once the timeout would be exceeded, the last result is returned.
+	slept = nil
+	never := func() ([]zfs.Dataset, error) { return nil, nil }
+	datasets, err = waitForDatasets(l, never, 100*time.Second, sleep)
+	assert.NoError(t, err)
+	assert.Empty(t, datasets)
+	assert.Equal(t, []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second,
+		30 * time.Second, 30 * time.Second,
+	}, slept)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/kelleyk/go-libzfs"
+)
+
+// stringsFlag is a flag that may be given more than once; each value is appended.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string     { return strings.Join(*f, ",") }
+func (f *stringsFlag) Set(v string) error { *f = append(*f, v); return nil }
+
+// wherePredicate is a condition on the value of a dataset property, given with -where as e.g. `compression=lz4`,
+// `readonly!=on`, or `mountpoint=/data/*`.  The value is a glob pattern (see path.Match); a value without any
+// metacharacters matches only itself.
+type wherePredicate struct {
+	prop    string
+	negate  bool // true for "!=", false for "="
+	pattern string
+}
+
+func parseWhere(s string) (wherePredicate, error) {
+	var p wherePredicate
+
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return p, fmt.Errorf("-where %q: expected PROPERTY=VALUE or PROPERTY!=VALUE", s)
+	}
+	p.prop, p.pattern = s[:i], strings.TrimSpace(s[i+1:])
+	if strings.HasSuffix(p.prop, "!") {
+		p.prop, p.negate = p.prop[:len(p.prop)-1], true
+	}
+	p.prop = strings.TrimSpace(p.prop)
+	if p.prop == "" {
+		return p, fmt.Errorf("-where %q: missing property name", s)
+	}
+	if _, err := path.Match(p.pattern, ""); err != nil {
+		return p, fmt.Errorf("-where %q: %v", s, err)
+	}
+
+	return p, nil
+}
+
+// match returns true iff the predicate holds for a dataset with the given property values (keyed by property name).
+// A property that is not set is treated as having the empty string as its value.
+func (p wherePredicate) match(props map[string]string) bool {
+	matched, _ := path.Match(p.pattern, props[p.prop]) // the pattern was checked by parseWhere
+	return matched != p.negate
+}
+
+// datasetPropertyValues returns the values of d's native and user properties, keyed by property name.
+func datasetPropertyValues(d zfs.Dataset) map[string]string {
+	values := make(map[string]string, len(d.Properties)+len(d.UserProperties))
+	for prop, v := range d.Properties {
+		values[zfs.DatasetPropertyToName(prop)] = v.Value
+	}
+	for name, v := range d.UserProperties {
+		values[name] = v.Value
+	}
+	return values
+}
+
+// matchAll returns true iff every one of preds holds.
+func matchAll(preds []wherePredicate, props map[string]string) bool {
+	for _, p := range preds {
+		if !p.match(props) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkMountpointPatterns returns an error if any of patterns (see -exclude-mountpoint) is malformed.
+func checkMountpointPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("-exclude-mountpoint %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// mountpointExcluded returns true if the mountpoint (the value of a dataset's mountpoint property), or any directory
+// that contains it, matches any of patterns (see -exclude-mountpoint and path.Match), so that e.g. "/var/lib/docker"
+// matches "/var/lib/docker/volumes/x".  A mountpoint that is not a path (e.g. "legacy", "none", or "-" for volumes)
+// matches nothing.
+func mountpointExcluded(patterns []string, mountpoint string) bool {
+	if !strings.HasPrefix(mountpoint, "/") {
+		return false
+	}
+	for dir := path.Clean(mountpoint); ; dir = path.Dir(dir) {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, dir); matched {
+				return true
+			}
+		}
+		if dir == "/" {
+			return false
+		}
+	}
+}
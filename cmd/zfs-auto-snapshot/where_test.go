@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWhere(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		pred wherePredicate
+		ok   bool
+	}{
+		{"compression=lz4", wherePredicate{prop: "compression", pattern: "lz4"}, true},
+		{"readonly != on", wherePredicate{prop: "readonly", negate: true, pattern: "on"}, true},
+		{"mountpoint=/data/*", wherePredicate{prop: "mountpoint", pattern: "/data/*"}, true},
+		{"com.example:tier=", wherePredicate{prop: "com.example:tier"}, true},
+		{"compression", wherePredicate{}, false},
+		{"=lz4", wherePredicate{}, false},
+		{"mountpoint=/data/[", wherePredicate{}, false},
+	} {
+		pred, err := parseWhere(tt.s)
+		if tt.ok {
+			assert.NoError(t, err, tt.s)
+			assert.Equal(t, tt.pred, pred, tt.s)
+		} else {
+			assert.Error(t, err, tt.s)
+		}
+	}
+}
+
+func TestMatchAll(t *testing.T) {
+	datasets := map[string]map[string]string{
+		"tank/data":    {"readonly": "off", "compression": "lz4", "mountpoint": "/data/main"},
+		"tank/archive": {"readonly": "on", "compression": "lz4", "mountpoint": "/data/archive"},
+		"tank/scratch": {"readonly": "off", "compression": "off", "mountpoint": "/scratch"},
+	}
+
+	mustParse := func(ss ...string) []wherePredicate {
+		var preds []wherePredicate
+		for _, s := range ss {
+			p, err := parseWhere(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			preds = append(preds, p)
+		}
+		return preds
+	}
+
+	for _, tt := range []struct {
+		where []string
+		want  []string
+	}{
+		// A boolean property.
+		{[]string{"readonly=off"}, []string{"tank/data", "tank/scratch"}},
+		{[]string{"readonly!=off"}, []string{"tank/archive"}},
+		// A string property, exactly and by glob.
+		{[]string{"compression=lz4"}, []string{"tank/archive", "tank/data"}},
+		{[]string{"mountpoint=/data/*"}, []string{"tank/archive", "tank/data"}},
+		// Multiple predicates must all hold.
+		{[]string{"mountpoint=/data/*", "readonly=off"}, []string{"tank/data"}},
+		// An unset property has the empty string as its value.
+		{[]string{"com.example:tier=gold"}, nil},
+		{[]string{"com.example:tier="}, []string{"tank/archive", "tank/data", "tank/scratch"}},
+	} {
+		preds := mustParse(tt.where...)
+		var got []string
+		for _, name := range []string{"tank/archive", "tank/data", "tank/scratch"} {
+			if matchAll(preds, datasets[name]) {
+				got = append(got, name)
+			}
+		}
+		assert.Equal(t, tt.want, got, "%v", tt.where)
+	}
+}
+
+func TestMountpointExcluded(t *testing.T) {
+	patterns := []string{"/var/lib/docker", "/home/*/.cache"}
+	assert.NoError(t, checkMountpointPatterns(patterns))
+
+	for _, tt := range []struct {
+		mountpoint string
+		want       bool
+	}{
+		{"/var/lib/docker", true},
+		{"/var/lib/docker/volumes/x", true},
+		{"/var/lib/docker/", true},
+		{"/var/lib/dockerd", false},
+		{"/var/lib", false},
+		{"/home/alice/.cache", true},
+		{"/home/alice/.cache/thumbnails", true},
+		{"/home/alice", false},
+		{"/", false},
+		// Datasets that are not mounted at a path never match, even a pattern that would match anything.
+		{"legacy", false},
+		{"none", false},
+		{"-", false},
+		{"", false},
+	} {
+		assert.Equal(t, tt.want, mountpointExcluded(patterns, tt.mountpoint), tt.mountpoint)
+	}
+	assert.False(t, mountpointExcluded([]string{"*"}, "legacy"))
+	assert.True(t, mountpointExcluded([]string{"/"}, "/srv"))
+	assert.False(t, mountpointExcluded(nil, "/srv"))
+
+	assert.Error(t, checkMountpointPatterns([]string{"/data/["}))
+}
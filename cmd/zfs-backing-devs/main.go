@@ -10,7 +10,10 @@ import (
 )
 
 var (
-	help = flag.Bool("help", false, "Print this usage message.")
+	help   = flag.Bool("help", false, "Print this usage message.")
+	byGUID = flag.Bool("by-guid", false, "Print each device's vdev GUID, followed by a tab, before its name.")
+
+	includeSpares = flag.Bool("include-spares", false, "Also print hot spares that are in use in place of other devices.")
 )
 
 func main() {
@@ -23,7 +26,7 @@ func main() {
 		return
 	}
 
-	devs, err := getBackingDevices(flag.Arg(0))
+	devs, err := getBackingDevices(flag.Arg(0), *byGUID, *includeSpares)
 	if err == nil && len(devs) == 0 {
 		err = errors.New("failed to find any backing devices for dataset")
 	}
@@ -37,7 +40,7 @@ func main() {
 	}
 }
 
-func getBackingDevices(datasetPath string) ([]string, error) {
+func getBackingDevices(datasetPath string, byGUID, includeSpares bool) ([]string, error) {
 	ds, err := zfs.DatasetOpen(datasetPath)
 	if err != nil {
 		return []string{}, err
@@ -53,37 +56,55 @@ func getBackingDevices(datasetPath string) ([]string, error) {
 		return []string{}, err
 	}
 
+	return backingDevices(&vdevTree, byGUID, includeSpares)
+}
+
+// backingDevices returns the names of the disks in vdevTree.  If byGUID is true, each name is preceded by the disk's
+// vdev GUID and a tab.
+//
+// A device that is being replaced is not listed; only its replacement is.  A hot spare that is in use in place of
+// another device is listed (after that device) only if includeSpares is true.
+func backingDevices(vdevTree *zfs.VDevTree, byGUID, includeSpares bool) ([]string, error) {
 	var backingDevices []string
-	if err := visitVDevTreeNodes(func(vdev *zfs.VDevTree) (bool, error) {
+	if err := visitVDevTreeNodes(func(vdev *zfs.VDevTree) ([]zfs.VDevTree, error) {
 		switch vdev.Type {
 		case zfs.VDevTypeRoot, zfs.VDevTypeMirror, zfs.VDevTypeRaidz:
 			if len(vdev.Devices) == 0 {
 				panic("expected device to have children")
 			}
-			return true, nil // recurse
+			return vdev.Devices, nil // recurse
 		case zfs.VDevTypeHole:
 			if len(vdev.Devices) > 0 {
 				panic("did not expect device to have children")
 			}
-			return false, nil // ignore
+			return nil, nil // ignore
 		case zfs.VDevTypeSpare:
-			if len(vdev.Devices) > 0 {
-				panic("did not expect device to have children")
+			// While a hot spare is in use, it and the device that it stands in for are the children of a "spare" vdev;
+			// the first child is the original device, and the others are spares.
+			if len(vdev.Devices) == 0 {
+				return nil, nil
+			}
+			if includeSpares {
+				return vdev.Devices, nil
 			}
-			return true, nil // ignore, or include? (add flag?)
+			return vdev.Devices[:1], nil
 		case zfs.VDevTypeLog, zfs.VDevTypeL2cache:
 			if len(vdev.Devices) > 0 {
 				panic("did not expect device to have children")
 			}
-			return true, nil // ignore, or include? (add flag?)
+			return nil, nil // ignore, or include? (add flag?)
 		case zfs.VDevTypeDisk:
 			// vdev.Path is the empty string; the name here is `/dev/mapper/d0-main_crypt`, which I bet is just the
 			// naame that ZFS has for the device.
-			backingDevices = append(backingDevices, vdev.Name)
+			if byGUID {
+				backingDevices = append(backingDevices, fmt.Sprintf("%d\t%s", vdev.GUID, vdev.Name))
+			} else {
+				backingDevices = append(backingDevices, vdev.Name)
+			}
 			if len(vdev.Devices) > 0 {
 				panic("did not expect device to have children")
 			}
-			return true, nil // backing things; but what to do with files?
+			return nil, nil // backing things; but what to do with files?
 		case zfs.VDevTypeFile:
 			// XXX: Ideally, we'd probably figure out what device the file is on.
 			panic("pool contains backing file; unsure what to do")
@@ -92,38 +113,39 @@ func getBackingDevices(datasetPath string) ([]string, error) {
 			// if len(vdev.Devices) > 0 {
 			// 	panic("did not expect device to have children")
 			// }
-			// return true, nil // backing things; but what to do with files?
+			// return nil, nil // backing things; but what to do with files?
 		case zfs.VDevTypeReplacing:
+			// The children of a "replacing" vdev are the old device and its replacement, in that order; only the
+			// replacement will remain once resilvering finishes.
 			if len(vdev.Devices) == 0 {
 				panic("expected device to have children")
 			}
-			return true, nil // not sure what to do with this
+			return vdev.Devices[len(vdev.Devices)-1:], nil
 		case zfs.VDevTypeMissing:
 			if len(vdev.Devices) > 0 {
 				panic("did not expect device to have children")
 			}
-			return true, nil // not sure what to do with this
+			return nil, nil // not sure what to do with this
 		default:
 			panic("unexpected vdev type")
 		}
-	}, &vdevTree); err != nil {
+	}, vdevTree); err != nil {
 		return []string{}, err
 	}
 
 	return backingDevices, nil
 }
 
-func visitVDevTreeNodes(f func(*zfs.VDevTree) (bool, error), n *zfs.VDevTree) error {
-	recurse, err := f(n)
+// visitVDevTreeNodes calls f with n and then, recursively, with each of the children of n that f returns.
+func visitVDevTreeNodes(f func(*zfs.VDevTree) ([]zfs.VDevTree, error), n *zfs.VDevTree) error {
+	children, err := f(n)
 	if err != nil {
 		return err
 	}
 
-	if recurse {
-		for _, child := range n.Devices {
-			if err := visitVDevTreeNodes(f, &child); err != nil {
-				return err
-			}
+	for _, child := range children {
+		if err := visitVDevTreeNodes(f, &child); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackingDevicesByGUID(t *testing.T) {
+	tree := zfs.VDevTree{Type: zfs.VDevTypeRoot, Name: "tank", GUID: 100, Devices: []zfs.VDevTree{
+		{Type: zfs.VDevTypeMirror, Name: "mirror-0", GUID: 200, Devices: []zfs.VDevTree{
+			{Type: zfs.VDevTypeDisk, Name: "/dev/mapper/disk0", GUID: 14230596346476224621},
+			{Type: zfs.VDevTypeDisk, Name: "/dev/mapper/disk1", GUID: 3915285837214574826},
+		}},
+	}}
+
+	devs, err := backingDevices(&tree, false, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/dev/mapper/disk0", "/dev/mapper/disk1"}, devs)
+
+	devs, err = backingDevices(&tree, true, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"14230596346476224621\t/dev/mapper/disk0",
+		"3915285837214574826\t/dev/mapper/disk1",
+	}, devs)
+
+	// Each leaf vdev in the mirror has a distinct, nonzero GUID.
+	guids := make(map[uint64]struct{})
+	for _, dev := range devs {
+		guid, err := strconv.ParseUint(strings.SplitN(dev, "\t", 2)[0], 10, 64)
+		assert.NoError(t, err)
+		assert.NotZero(t, guid)
+		guids[guid] = struct{}{}
+	}
+	assert.Equal(t, 2, len(guids))
+}
+
+func TestBackingDevicesReplacing(t *testing.T) {
+	// sdb is being replaced by sdc.
+	tree := zfs.VDevTree{Type: zfs.VDevTypeRoot, Name: "tank", Devices: []zfs.VDevTree{
+		{Type: zfs.VDevTypeMirror, Name: "mirror-0", Devices: []zfs.VDevTree{
+			{Type: zfs.VDevTypeDisk, Name: "sda"},
+			{Type: zfs.VDevTypeReplacing, Name: "replacing-1", Devices: []zfs.VDevTree{
+				{Type: zfs.VDevTypeDisk, Name: "sdb"},
+				{Type: zfs.VDevTypeDisk, Name: "sdc"},
+			}},
+		}},
+	}}
+
+	devs, err := backingDevices(&tree, false, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sda", "sdc"}, devs)
+}
+
+func TestBackingDevicesSpare(t *testing.T) {
+	// The hot spare sdd is in use in place of sdb.
+	tree := zfs.VDevTree{Type: zfs.VDevTypeRoot, Name: "tank", Devices: []zfs.VDevTree{
+		{Type: zfs.VDevTypeMirror, Name: "mirror-0", Devices: []zfs.VDevTree{
+			{Type: zfs.VDevTypeDisk, Name: "sda"},
+			{Type: zfs.VDevTypeSpare, Name: "spare-1", Devices: []zfs.VDevTree{
+				{Type: zfs.VDevTypeDisk, Name: "sdb"},
+				{Type: zfs.VDevTypeDisk, Name: "sdd"},
+			}},
+		}},
+	}}
+
+	devs, err := backingDevices(&tree, false, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sda", "sdb"}, devs)
+
+	devs, err = backingDevices(&tree, false, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sda", "sdb", "sdd"}, devs)
+}
@@ -0,0 +1,234 @@
+// zfs-backup takes a snapshot of a dataset and sends it to a file of its own or, over ssh, to another host.  Once a backup has
+// succeeded, later backups of the same dataset are sent incrementally from it.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/kelleyk/zfstools"
+)
+
+var (
+	help   = flag.Bool("help", false, "Print this usage message.")
+	prefix = flag.String("prefix", "zfs-backup", "Prefix for the names of the snapshots that are created.")
+	label  = flag.String("label", "backup", "Label for the names of the snapshots that are created.")
+
+	rateLimit = flag.Uint64("rate-limit", 0, "Send no more than this many bytes per second.  0 means no limit.")
+
+	dryRun   = flag.Bool("dry-run", false, "Instead of taking a snapshot and sending it, print the estimated size of the stream that would be sent.")
+	compress = flag.Bool("c", false, "Send blocks compressed as they are on disk.")
+)
+
+func main() {
+	flag.Parse()
+
+	if *help || len(flag.Args()) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] DATASET TARGET\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "TARGET is either a file name, to which \".SNAPSHOT\" is appended for each stream sent, or [USER@]HOST:DATASET, which is received with `zfs receive` over ssh.\n")
+		flag.PrintDefaults()
+		return
+	}
+
+	if err := backup(flag.Arg(0), flag.Arg(1)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func backup(dsPath, target string) error {
+	d, err := zfs.DatasetOpen(dsPath)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	var snapNames []string
+	for _, dd := range d.Children {
+		if dd.Type != zfs.DatasetTypeSnapshot {
+			continue
+		}
+		path, err := dd.Path()
+		if err != nil {
+			return err
+		}
+		snapNames = append(snapNames, path[strings.Index(path, "@")+1:])
+	}
+	base := backupBase(d.UserProperties[zfstools.LastBackupProperty].Value, snapNames)
+	if host, dest, ok := parseRemoteTarget(target); ok {
+		// The remote dataset is the authority on what has been received: if an earlier backup was interrupted
+		// after the stream was received but before the property was updated (or the property has been lost),
+		// resume from the latest snapshot that the two sides actually have in common.
+		remote, err := remoteSnapshots(host, dest)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to list snapshots of %s on %s (falling back to %s): %s\n",
+				dest, host, zfstools.LastBackupProperty, err)
+		} else {
+			local, err := zfstools.SnapRefs(&d)
+			if err != nil {
+				return err
+			}
+			base, _ = zfstools.FindLatestCommonSnapshot(local, remote)
+		}
+	}
+
+	if *dryRun {
+		size, err := estimateBackup(&d, base, *compress)
+		if err != nil {
+			return err
+		}
+		kind := "full"
+		if base != "" {
+			kind = "incremental from " + base
+		}
+		fmt.Printf("would send ~%s (%s, %s)\n", zfstools.FormatSize(size), dsPath, kind)
+		return nil
+	}
+
+	meta := &zfstools.SnapMetadata{
+		Dataset: dsPath,
+		Prefix:  *prefix,
+		Label:   *label,
+		TS:      time.Now().UTC().Truncate(time.Second),
+	}
+	snap, err := zfs.DatasetSnapshot(meta.Path(), false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot %q: %s", meta.Path(), err)
+	}
+	snap.Close()
+
+	if err := sendTo(&d, base, meta.Name(), target); err != nil {
+		return fmt.Errorf("failed to send snapshot %q: %s", meta.Path(), err)
+	}
+
+	return d.SetUserProperty(zfstools.LastBackupProperty, meta.Name())
+}
+
+// backupBase returns the name of the snapshot that a backup should be sent incrementally from, or "" if a full
+// stream should be sent.  lastSent is the name of the snapshot that was most recently sent (or "" if there has not
+// been a backup yet); an incremental stream can only be sent from it if it still exists.
+func backupBase(lastSent string, snapNames []string) string {
+	if lastSent == "" {
+		return ""
+	}
+	for _, name := range snapNames {
+		if name == lastSent {
+			return lastSent
+		}
+	}
+	return ""
+}
+
+// estimateBackup returns the estimated size of the stream that a backup of d would send, incrementally from the
+// snapshot base or, if base is empty, in full.  The snapshot that would be sent does not exist yet, so the estimate
+// cannot come from libzfs (see zfs.Dataset.SendSize); instead, it is the amount of space written to d since base (or
+// referenced by d), which is roughly the size of a compressed stream.
+func estimateBackup(d *zfs.Dataset, base string, compressed bool) (uint64, error) {
+	value := d.Properties[zfs.DatasetPropReferenced].Value
+	referenced, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected value for referenced property: %q", value)
+	}
+	value = d.Properties[zfs.DatasetPropLogicalreferenced].Value
+	logical, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected value for logicalreferenced property: %q", value)
+	}
+	written := referenced
+	if base != "" {
+		if written, err = d.WrittenSince(base); err != nil {
+			return 0, err
+		}
+	}
+	return estimateStreamSize(written, referenced, logical, compressed), nil
+}
+
+// estimateStreamSize estimates the size of a send stream from the space (as allocated on disk) that it covers,
+// written.  An uncompressed stream is assumed to be larger in the same proportion as the logical size of the dataset
+// (logicalReferenced) is to the space that it references (referenced).
+func estimateStreamSize(written, referenced, logicalReferenced uint64, compressed bool) uint64 {
+	if compressed || referenced == 0 || logicalReferenced <= referenced {
+		return written
+	}
+	return uint64(float64(written) * float64(logicalReferenced) / float64(referenced))
+}
+
+// sendTo sends the snapshot toSnap of d (incrementally from fromSnap, if that is nonempty) to target.
+func sendTo(d *zfs.Dataset, fromSnap, toSnap, target string) error {
+	flags := zfs.SendFlags{Compress: *compress}
+	if host, dest, ok := parseRemoteTarget(target); ok {
+		cmd := exec.Command("ssh", host, "zfs", "receive", dest)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		w, err := cmd.StdinPipe()
+		if err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		sendErr := d.Send(fromSnap, toSnap, flags, zfstools.NewRateLimitedWriter(w, *rateLimit))
+		w.Close()
+		if err := cmd.Wait(); err != nil {
+			return fmt.Errorf("zfs receive on %s: %s", host, err)
+		}
+		return sendErr
+	}
+
+	_, err := sendToFile(target, fromSnap, toSnap, func(fromSnap, toSnap string, w io.Writer) error {
+		return d.Send(fromSnap, toSnap, flags, zfstools.NewRateLimitedWriter(w, *rateLimit))
+	})
+	return err
+}
+
+// sendToFile writes the stream that send produces for the snapshot toSnap (incrementally from fromSnap, if that is
+// nonempty) to a file of its own, whose name is target followed by "." and toSnap, and returns that name.  Each stream
+// gets its own file because an incremental stream can only be received on top of the streams before it; an existing
+// file is never overwritten.  If the stream cannot be written in full, the partial file is removed.
+func sendToFile(target, fromSnap, toSnap string,
+	send func(fromSnap, toSnap string, w io.Writer) error) (string, error) {
+
+	path := target + "." + toSnap
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	if err := send(fromSnap, toSnap, f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// remoteSnapshots lists the snapshots of dataset on host over ssh.
+func remoteSnapshots(host, dataset string) ([]zfstools.SnapRef, error) {
+	cmd := exec.Command("ssh", host, "zfs", "list", "-H", "-p", "-t", "snapshot", "-o", "name,guid", "-d", "1", dataset)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return zfstools.ParseSnapRefs(bytes.NewReader(out))
+}
+
+// parseRemoteTarget splits a target of the form `[user@]host:dataset`.  ok is false if target is a file path.
+func parseRemoteTarget(target string) (host, dataset string, ok bool) {
+	i := strings.Index(target, ":")
+	if i <= 0 || strings.Contains(target[:i], "/") {
+		return "", "", false
+	}
+	return target[:i], target[i+1:], true
+}
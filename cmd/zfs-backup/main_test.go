@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupBase(t *testing.T) {
+	snaps := []string{"zfs-backup_backup_2016-01-01T00:00:00Z", "zfs-backup_backup_2016-01-02T00:00:00Z"}
+
+	for _, tc := range []struct {
+		lastSent string
+		want     string
+	}{
+		// First backup: full send.
+		{"", ""},
+		// Subsequent backup: incremental from the last snapshot sent.
+		{"zfs-backup_backup_2016-01-02T00:00:00Z", "zfs-backup_backup_2016-01-02T00:00:00Z"},
+		// The last snapshot sent has since been destroyed: full send.
+		{"zfs-backup_backup_2015-12-31T00:00:00Z", ""},
+	} {
+		assert.Equal(t, tc.want, backupBase(tc.lastSent, snaps), "lastSent=%q", tc.lastSent)
+	}
+}
+
+func TestEstimateStreamSize(t *testing.T) {
+	for _, tt := range []struct {
+		desc                                   string
+		written, referenced, logicalReferenced uint64
+		compressed                             bool
+		want                                   uint64
+	}{
+		{"full, compressed", 10 << 30, 10 << 30, 15 << 30, true, 10 << 30},
+		{"full, uncompressed", 10 << 30, 10 << 30, 15 << 30, false, 15 << 30},
+		{"incremental, uncompressed", 2 << 30, 10 << 30, 15 << 30, false, 3 << 30},
+		{"empty incremental", 0, 10 << 30, 15 << 30, false, 0},
+		{"incompressible data", 1 << 30, 10 << 30, 10 << 30, false, 1 << 30},
+		{"empty dataset", 0, 0, 0, false, 0},
+	} {
+		assert.Equal(t, tt.want, estimateStreamSize(tt.written, tt.referenced, tt.logicalReferenced, tt.compressed),
+			tt.desc)
+	}
+}
+
+func TestParseRemoteTarget(t *testing.T) {
+	for _, tc := range []struct {
+		target        string
+		host, dataset string
+		ok            bool
+	}{
+		{"backup@nas:tank/backups/foo", "backup@nas", "tank/backups/foo", true},
+		{"nas:tank", "nas", "tank", true},
+		{"/mnt/backups/foo.zfs", "", "", false},
+		{"./odd:name", "", "", false},
+		{"foo.zfs", "", "", false},
+	} {
+		host, dataset, ok := parseRemoteTarget(tc.target)
+		assert.Equal(t, tc.host, host, tc.target)
+		assert.Equal(t, tc.dataset, dataset, tc.target)
+		assert.Equal(t, tc.ok, ok, tc.target)
+	}
+}
+
+func TestSendToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zfs-backup")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "foo.zfs")
+
+	send := func(fromSnap, toSnap string, w io.Writer) error {
+		_, err := fmt.Fprintf(w, "stream %q..%q", fromSnap, toSnap)
+		return err
+	}
+
+	// A full stream, then an incremental one on top of it: each is kept in its own file.
+	full, err := sendToFile(target, "", "a", send)
+	if assert.NoError(t, err) {
+		assert.Equal(t, target+".a", full)
+	}
+	incr, err := sendToFile(target, "a", "b", send)
+	if assert.NoError(t, err) {
+		assert.Equal(t, target+".b", incr)
+	}
+	for path, want := range map[string]string{full: `stream "".."a"`, incr: `stream "a".."b"`} {
+		got, err := ioutil.ReadFile(path)
+		if assert.NoError(t, err, path) {
+			assert.Equal(t, want, string(got), path)
+		}
+	}
+
+	// An existing stream is never overwritten.
+	_, err = sendToFile(target, "", "a", send)
+	assert.Error(t, err)
+	got, _ := ioutil.ReadFile(full)
+	assert.Equal(t, `stream "".."a"`, string(got))
+
+	// A stream that fails part of the way through leaves no file behind.
+	_, err = sendToFile(target, "b", "c", func(fromSnap, toSnap string, w io.Writer) error {
+		fmt.Fprint(w, "partial")
+		return errors.New("send failed")
+	})
+	assert.EqualError(t, err, "send failed")
+	_, err = os.Stat(target + ".c")
+	assert.True(t, os.IsNotExist(err), "%v", err)
+}
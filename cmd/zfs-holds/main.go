@@ -0,0 +1,95 @@
+// zfs-holds lists the user holds on the snapshots of a dataset, and can release them.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	zfs "github.com/kelleyk/go-libzfs"
+)
+
+var (
+	help    = flag.Bool("help", false, "Print this usage message.")
+	release = flag.String("release", "", "Release the hold with this tag from each snapshot of the dataset that has it.")
+)
+
+func main() {
+	flag.Parse()
+
+	if *help || len(flag.Args()) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] DATASET\n", os.Args[0])
+		flag.PrintDefaults()
+		return
+	}
+
+	d, err := zfs.DatasetOpen(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	defer d.Close()
+
+	holds, err := d.AllHolds()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	if *release == "" {
+		for _, line := range formatHolds(holds) {
+			fmt.Println(line)
+		}
+		return
+	}
+
+	failed := false
+	for _, snap := range snapshotsWithTag(holds, *release) {
+		if err := zfs.DatasetRelease(snap, *release, false); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to release %q from %s: %s\n", *release, snap, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("released %s\t%s\n", snap, *release)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// formatHolds returns one tab-separated line per hold, giving the snapshot's name, the hold's tag, and the time at
+// which the hold was placed, sorted by snapshot name and then by tag.
+func formatHolds(holds map[string][]zfs.HoldInfo) []string {
+	var lines []string
+	for _, snap := range sortedSnapshots(holds) {
+		for _, h := range holds[snap] {
+			lines = append(lines, fmt.Sprintf("%s\t%s\t%s", snap, h.Tag, h.Created.UTC().Format(time.RFC3339)))
+		}
+	}
+	return lines
+}
+
+// snapshotsWithTag returns the names of the snapshots that have a hold with the given tag, in sorted order.
+func snapshotsWithTag(holds map[string][]zfs.HoldInfo, tag string) []string {
+	var snaps []string
+	for _, snap := range sortedSnapshots(holds) {
+		for _, h := range holds[snap] {
+			if h.Tag == tag {
+				snaps = append(snaps, snap)
+				break
+			}
+		}
+	}
+	return snaps
+}
+
+func sortedSnapshots(holds map[string][]zfs.HoldInfo) []string {
+	snaps := make([]string, 0, len(holds))
+	for snap := range holds {
+		snaps = append(snaps, snap)
+	}
+	sort.Strings(snaps)
+	return snaps
+}
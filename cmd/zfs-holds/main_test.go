@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHolds(t *testing.T) {
+	t0 := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	holds := map[string][]zfs.HoldInfo{
+		"tank/data@b": {{Tag: "keep", Created: t0}},
+		"tank/data@a": {{Tag: "backup", Created: t0}, {Tag: "keep", Created: t0.Add(time.Hour)}},
+	}
+
+	assert.Equal(t, []string{
+		"tank/data@a\tbackup\t2016-01-02T03:04:05Z",
+		"tank/data@a\tkeep\t2016-01-02T04:04:05Z",
+		"tank/data@b\tkeep\t2016-01-02T03:04:05Z",
+	}, formatHolds(holds))
+
+	assert.Equal(t, []string{"tank/data@a", "tank/data@b"}, snapshotsWithTag(holds, "keep"))
+	assert.Equal(t, []string{"tank/data@a"}, snapshotsWithTag(holds, "backup"))
+
+	// Snapshots without holds are not in the map at all; a dataset with no holds is fine, too.
+	assert.Empty(t, formatHolds(map[string][]zfs.HoldInfo{}))
+	assert.Empty(t, snapshotsWithTag(map[string][]zfs.HoldInfo{}, "keep"))
+}
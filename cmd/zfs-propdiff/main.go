@@ -0,0 +1,93 @@
+// zfs-propdiff prints the dataset properties whose values differ between two snapshots.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	zfs "github.com/kelleyk/go-libzfs"
+)
+
+var (
+	help = flag.Bool("help", false, "Print this usage message.")
+	all  = flag.Bool("all", false, "Also print properties that describe the snapshots themselves (e.g. guid, creation, used), which nearly always differ.")
+)
+
+// statisticProps are properties that identify a snapshot or that describe its space usage.  They are not settings,
+// and they nearly always differ between two snapshots, so they are not printed unless -all is given.
+var statisticProps = map[zfs.Prop]struct{}{
+	zfs.DatasetPropName:              {},
+	zfs.DatasetPropGUID:              {},
+	zfs.DatasetPropCreatetxg:         {},
+	zfs.DatasetPropCreation:          {},
+	zfs.DatasetPropObjsetid:          {},
+	zfs.DatasetPropUnique:            {},
+	zfs.DatasetPropUsed:              {},
+	zfs.DatasetPropReferenced:        {},
+	zfs.DatasetPropWritten:           {},
+	zfs.DatasetPropCompressratio:     {},
+	zfs.DatasetPropRefratio:          {},
+	zfs.DatasetPropLogicalused:       {},
+	zfs.DatasetPropLogicalreferenced: {},
+	zfs.DatasetPropUserrefs:          {},
+	zfs.DatasetPropClones:            {},
+	zfs.DatasetPropNumclones:         {},
+	zfs.DatasetPropDeferDestroy:      {},
+}
+
+func main() {
+	flag.Parse()
+
+	if *help || len(flag.Args()) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] SNAPSHOT-A SNAPSHOT-B\n", os.Args[0])
+		flag.PrintDefaults()
+		return
+	}
+
+	diff, err := zfs.DatasetPropertyDiff(flag.Arg(0), flag.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	for _, line := range formatDiff(diff, *all) {
+		fmt.Println(line)
+	}
+}
+
+// formatDiff returns one tab-separated line per differing property, giving the property's name and its values in
+// each snapshot, sorted by property name.  A property that is absent from one of the snapshots is shown as "-".
+func formatDiff(diff map[zfs.Prop][2]string, all bool) []string {
+	var rows []diffRow
+	for p, values := range diff {
+		if _, ok := statisticProps[p]; ok && !all {
+			continue
+		}
+		for i := range values {
+			if values[i] == "" {
+				values[i] = "-"
+			}
+		}
+		rows = append(rows, diffRow{zfs.DatasetPropertyToName(p), values})
+	}
+	sort.Sort(byName(rows))
+
+	lines := make([]string, 0, len(rows))
+	for _, r := range rows {
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%s", r.name, r.values[0], r.values[1]))
+	}
+	return lines
+}
+
+type diffRow struct {
+	name   string
+	values [2]string
+}
+
+type byName []diffRow
+
+func (a byName) Len() int           { return len(a) }
+func (a byName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byName) Less(i, j int) bool { return a[i].name < a[j].name }
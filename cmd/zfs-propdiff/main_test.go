@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatDiff(t *testing.T) {
+	a := map[zfs.Prop]zfs.Property{
+		zfs.DatasetPropCompression: {Value: "off", Source: "default"},
+		zfs.DatasetPropRecordsize:  {Value: "128K", Source: "default"},
+		zfs.DatasetPropAtime:       {Value: "on", Source: "default"},
+		zfs.DatasetPropGUID:        {Value: "1234", Source: "none"},
+	}
+	b := map[zfs.Prop]zfs.Property{
+		zfs.DatasetPropCompression: {Value: "lz4", Source: "local"},
+		zfs.DatasetPropRecordsize:  {Value: "1M", Source: "local"},
+		zfs.DatasetPropAtime:       {Value: "on", Source: "inherited"},
+		zfs.DatasetPropGUID:        {Value: "5678", Source: "none"},
+		zfs.DatasetPropMountpoint:  {Value: "/tank", Source: "default"},
+	}
+	diff := zfs.PropertyDiff(a, b)
+
+	assert.Equal(t, []string{
+		"compression\toff\tlz4",
+		"mountpoint\t-\t/tank",
+		"recordsize\t128K\t1M",
+	}, formatDiff(diff, false))
+
+	assert.Equal(t, []string{
+		"compression\toff\tlz4",
+		"guid\t1234\t5678",
+		"mountpoint\t-\t/tank",
+		"recordsize\t128K\t1M",
+	}, formatDiff(diff, true))
+}
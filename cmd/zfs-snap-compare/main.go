@@ -0,0 +1,77 @@
+// zfs-snap-compare compares the snapshots of a local dataset with a list of the snapshots of its replica on another
+// host, so that replication that has fallen behind (or snapshots that are missing on either side) can be detected.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/kelleyk/zfstools"
+)
+
+var (
+	help = flag.Bool("help", false, "Print this usage message.")
+)
+
+// comparison is printed (as JSON) to describe the difference between the local and remote snapshots.
+type comparison struct {
+	Dataset string `json:"dataset"`
+	zfstools.SnapRefComparison
+}
+
+func main() {
+	flag.Parse()
+
+	if *help || len(flag.Args()) < 1 || len(flag.Args()) > 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] DATASET [REMOTE-LIST]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "REMOTE-LIST (by default, stdin) contains a name and a GUID per line, as printed by\n")
+		fmt.Fprintf(os.Stderr, "`zfs list -H -p -t snapshot -o name,guid -d 1 DATASET` on the remote host.\n")
+		flag.PrintDefaults()
+		return
+	}
+
+	var in io.Reader = os.Stdin
+	if len(flag.Args()) == 2 && flag.Arg(1) != "-" {
+		f, err := os.Open(flag.Arg(1))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	remote, err := zfstools.ParseSnapRefs(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to read remote snapshot list: %s\n", err)
+		os.Exit(1)
+	}
+
+	local, err := localSnapshots(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	c := comparison{Dataset: flag.Arg(0), SnapRefComparison: zfstools.CompareSnapRefs(local, remote)}
+	buf, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s\n", buf)
+}
+
+// localSnapshots returns the snapshots of the named dataset, oldest first.
+func localSnapshots(name string) ([]zfstools.SnapRef, error) {
+	d, err := zfs.DatasetOpen(name)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	return zfstools.SnapRefs(&d)
+}
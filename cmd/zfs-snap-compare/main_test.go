@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComparisonJSON(t *testing.T) {
+	c := comparison{
+		Dataset: "tank/data",
+		SnapRefComparison: zfstools.CompareSnapRefs(
+			[]zfstools.SnapRef{{Name: "b", GUID: 2}, {Name: "c", GUID: 3}},
+			[]zfstools.SnapRef{{Name: "a", GUID: 1}, {Name: "b", GUID: 2}}),
+	}
+	buf, err := json.Marshal(c)
+	if assert.NoError(t, err) {
+		assert.JSONEq(t, `{
+			"dataset": "tank/data",
+			"localOnly": [{"name": "c", "guid": 3}],
+			"remoteOnly": [{"name": "a", "guid": 1}],
+			"latestCommon": {"name": "b", "guid": 2},
+			"lag": 1
+		}`, string(buf))
+	}
+}
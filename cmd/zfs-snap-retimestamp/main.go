@@ -0,0 +1,171 @@
+// zfs-snap-retimestamp renames automatic snapshots whose names contain the wrong timestamp (e.g. because they were
+// created while the system clock was wrong) so that their names reflect their actual creation times.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/kelleyk/zfstools"
+)
+
+var (
+	help      = flag.Bool("help", false, "Print this usage message.")
+	dryRun    = flag.Bool("dry-run", false, "Print the snapshots that would be renamed without renaming them.")
+	prefix    = flag.String("prefix", "zfs-auto-snap", "Only consider snapshots whose names have this prefix.")
+	tolerance = flag.Duration("tolerance", 10*time.Minute, "Leave a snapshot alone if the timestamp in its name differs from its creation time by no more than this.")
+	nameOrder = flag.String("name-order", string(zfstools.NameOrderPrefixLabel), "The order of the prefix and the label in the names of snapshots: \"prefix_label\" or \"label_prefix\".")
+	sep       = flag.String("sep", zfstools.DefaultSep, "The character (\"_\" or \" \") that separates the prefix, the label, and the timestamp in the names of snapshots.")
+	debug     = flag.Bool("debug", false, "Print the snapshots that are skipped because their names cannot be parsed.")
+)
+
+// debugOut is where debugging messages are written; see -debug.
+var debugOut io.Writer = ioutil.Discard
+
+func main() {
+	flag.Parse()
+
+	if *help || len(flag.Args()) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] DATASET...\n", os.Args[0])
+		flag.PrintDefaults()
+		return
+	}
+	if err := zfstools.NameOrder(*nameOrder).Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -name-order: %s\n", err)
+		os.Exit(2)
+	}
+	if err := zfstools.ValidateSep(*sep); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -sep: %s\n", err)
+		os.Exit(2)
+	}
+	if *debug {
+		debugOut = os.Stderr
+	}
+
+	failed := false
+	for _, dsPath := range flag.Args() {
+		if err := retimestampAll(dsPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// retimestampAll renames the misnamed snapshots of the dataset dsPath and of its descendants.  If any of them cannot be
+// renamed, those that were renamed are renamed back.
+func retimestampAll(dsPath string) error {
+	d, err := zfs.DatasetOpen(dsPath)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	renames := make(map[string]string)
+	if err := walkSnapshots(&d, renames); err != nil {
+		return err
+	}
+	if *dryRun {
+		existing, err := zfstools.SnapshotNames(&d)
+		if err != nil {
+			return err
+		}
+		plan, err := zfstools.PlanSnapshotRenames(renames, existing)
+		if err != nil {
+			return err
+		}
+		for _, r := range plan {
+			fmt.Printf("%s -> %s\n", r.From, r.To)
+		}
+		return nil
+	}
+	return zfstools.RenameSnapshotsBulk(&d, renames, func(r zfstools.SnapshotRename, done, total int) {
+		fmt.Printf("%s -> %s\n", r.From, r.To)
+	})
+}
+
+// walkSnapshots adds the new name of each misnamed snapshot of d and of its descendants to renames.
+func walkSnapshots(d *zfs.Dataset, renames map[string]string) error {
+	for i := range d.Children {
+		dd := &d.Children[i]
+		if dd.Type != zfs.DatasetTypeSnapshot {
+			if err := walkSnapshots(dd, renames); err != nil {
+				return err
+			}
+			continue
+		}
+
+		path, err := dd.Path()
+		if err != nil {
+			return err
+		}
+		newPath, err := newName(path, dd.Properties[zfs.DatasetPropCreation].Value)
+		if err != nil {
+			return err
+		}
+		if newPath != "" {
+			renames[path] = newPath
+		}
+	}
+	return nil
+}
+
+// newName returns the name that the snapshot path, whose creation property has the value creationValue, should be
+// renamed to, or "" if it should be left alone.  Snapshots whose names were not generated by these tools (with the
+// configured prefix, -name-order, and -sep), or that cannot be parsed, are left alone.
+func newName(path, creationValue string) (string, error) {
+	meta, err := zfstools.ParseSnapNameSep(zfstools.NameOrder(*nameOrder), *sep, *prefix, path)
+	if err != nil {
+		// Most likely taken by hand or by another tool.
+		fmt.Fprintf(debugOut, "skipping snapshot whose name cannot be parsed: %s\n", err)
+		return "", nil
+	}
+	if meta == nil {
+		return "", nil
+	}
+	creation, err := parseCreation(creationValue)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", path, err)
+	}
+
+	if newMeta := retimestamp(meta, creation, *tolerance); newMeta != nil {
+		return newMeta.Path(), nil
+	}
+	return "", nil
+}
+
+// parseCreation parses the (literal) value of the creation property, which is a Unix timestamp.
+func parseCreation(value string) (time.Time, error) {
+	secs, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unexpected creation time %q", value)
+	}
+	return time.Unix(secs, 0), nil
+}
+
+// retimestamp returns metadata for the name that the snapshot described by meta should have, given that it was
+// actually created at creation.  It returns nil if the timestamp in the snapshot's name is already within tolerance
+// of its creation time.  The new timestamp is given in the same time zone as the old one, and the new name is in the
+// standard format even if the old one was not (e.g. if its timestamp had fractional seconds).
+func retimestamp(meta *zfstools.SnapMetadata, creation time.Time, tolerance time.Duration) *zfstools.SnapMetadata {
+	delta := meta.TS.Sub(creation)
+	if delta < 0 {
+		delta = -delta
+	}
+	if delta <= tolerance {
+		return nil
+	}
+
+	newMeta := *meta
+	newMeta.TS = creation.In(meta.TS.Location())
+	newMeta.SnapName = "" // otherwise the new name would be the old one
+	return &newMeta
+}
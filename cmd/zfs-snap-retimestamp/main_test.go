@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/kelleyk/zfstools"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCreation(t *testing.T) {
+	ts, err := parseCreation("1451606400")
+	assert.NoError(t, err)
+	assert.True(t, ts.Equal(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	_, err = parseCreation("Fri Jan  1  0:00 2016")
+	assert.Error(t, err)
+}
+
+func TestRetimestamp(t *testing.T) {
+	nameTS := time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC) // e.g. the clock had not been set yet
+	meta, err := zfstools.ParseSnapName("zfs-auto-snap", "tank/foo@zfs-auto-snap_daily_"+nameTS.Format(time.RFC3339))
+	if !assert.NoError(t, err) || !assert.NotNil(t, meta) {
+		return
+	}
+	creation := time.Date(2016, 1, 1, 0, 0, 3, 0, time.UTC)
+
+	// The name and the creation property disagree: the snapshot is renamed, keeping its label.
+	newMeta := retimestamp(meta, creation, 10*time.Minute)
+	if assert.NotNil(t, newMeta) {
+		assert.Equal(t, "tank/foo@zfs-auto-snap_daily_2016-01-01T00:00:03Z", newMeta.Path())
+	}
+	// The original metadata is not modified.
+	assert.Equal(t, nameTS, meta.TS)
+
+	// The name is within tolerance of the creation property: the snapshot is left alone.
+	assert.Nil(t, retimestamp(meta, nameTS.Add(3*time.Second), 10*time.Minute))
+	assert.Nil(t, retimestamp(meta, nameTS.Add(-3*time.Second), 10*time.Minute))
+}
+
+func TestRetimestampNonstandardName(t *testing.T) {
+	creation := time.Date(2016, 1, 1, 0, 0, 3, 0, time.UTC)
+
+	// Names that cannot be regenerated from their metadata are renamed to the standard format.
+	for _, path := range []string{
+		"tank/foo@zfs-auto-snap_daily_1970-01-01T00:00:00.5Z",
+		"tank/foo@zfs-auto-snap_daily_1970-01-01T00:00:00",
+		"tank/foo@zfs-auto-snap_daily_1970-01-01t00:00:00z",
+	} {
+		meta, err := zfstools.ParseSnapName("zfs-auto-snap", path)
+		if !assert.NoError(t, err, path) || !assert.NotNil(t, meta, path) {
+			continue
+		}
+		assert.Equal(t, path, meta.Path())
+		newMeta := retimestamp(meta, creation, 10*time.Minute)
+		if assert.NotNil(t, newMeta, path) {
+			assert.Equal(t, "tank/foo@zfs-auto-snap_daily_2016-01-01T00:00:03Z", newMeta.Path(), path)
+		}
+		assert.Equal(t, path, meta.Path(), "the original metadata is not modified")
+	}
+}
+
+func TestNewName(t *testing.T) {
+	defer func(order, s string, w io.Writer) { *nameOrder, *sep, debugOut = order, s, w }(*nameOrder, *sep, debugOut)
+	var debugBuf bytes.Buffer
+	debugOut = &debugBuf
+
+	const creation = "1451606403" // 2016-01-01T00:00:03Z
+	for _, tt := range []struct {
+		order, sep, path, newPath string
+	}{
+		{"prefix_label", "_", "tank/foo@zfs-auto-snap_daily_1970-01-01T00:00:00Z",
+			"tank/foo@zfs-auto-snap_daily_2016-01-01T00:00:03Z"},
+		{"prefix_label", "_", "tank/foo@zfs-auto-snap_daily_2016-01-01T00:00:00Z", ""},
+		{"label_prefix", "_", "tank/foo@daily_zfs-auto-snap_1970-01-01T00:00:00Z",
+			"tank/foo@daily_zfs-auto-snap_2016-01-01T00:00:03Z"},
+		{"prefix_label", " ", "tank/foo@zfs-auto-snap daily 1970-01-01T00:00:00Z",
+			"tank/foo@zfs-auto-snap daily 2016-01-01T00:00:03Z"},
+		// Names in another format, or with another prefix, are left alone.
+		{"prefix_label", "_", "tank/foo@daily_zfs-auto-snap_1970-01-01T00:00:00Z", ""},
+		{"prefix_label", "_", "tank/foo@zfs-auto-snap daily 1970-01-01T00:00:00Z", ""},
+		{"prefix_label", "_", "tank/foo@backup_daily_1970-01-01T00:00:00Z", ""},
+		{"prefix_label", "_", "tank/foo@manual", ""},
+	} {
+		*nameOrder, *sep = tt.order, tt.sep
+		newPath, err := newName(tt.path, creation)
+		if assert.NoError(t, err, tt.path) {
+			assert.Equal(t, tt.newPath, newPath, tt.path)
+		}
+	}
+	assert.Empty(t, debugBuf.String())
+
+	// A foreign snapshot whose name looks like one of ours, but has an impossible timestamp, is skipped.
+	*nameOrder, *sep = "prefix_label", "_"
+	newPath, err := newName("tank/foo@zfs-auto-snap_daily_2016-13-45T00:00:00Z", creation)
+	assert.NoError(t, err)
+	assert.Equal(t, "", newPath)
+	assert.Contains(t, debugBuf.String(), "2016-13-45T00:00:00Z")
+
+	_, err = newName("tank/foo@zfs-auto-snap_daily_1970-01-01T00:00:00Z", "not a timestamp")
+	assert.Error(t, err)
+}
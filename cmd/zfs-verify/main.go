@@ -0,0 +1,77 @@
+// zfs-verify reads all of the data in the given snapshots so that ZFS validates their checksums, as a lighter-weight
+// alternative to scrubbing an entire pool.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	zfs "github.com/kelleyk/go-libzfs"
+)
+
+var (
+	help    = flag.Bool("help", false, "Print this usage message.")
+	timeout = flag.Duration("timeout", 0, "Stop verifying after this long (e.g. \"2h\").  0 means no limit.")
+)
+
+func main() {
+	flag.Parse()
+
+	if *help || len(flag.Args()) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] SNAPSHOT...\n", os.Args[0])
+		flag.PrintDefaults()
+		return
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	if failed := verifyAll(ctx, flag.Args(), verifySnapshot, os.Stdout); failed > 0 {
+		fmt.Fprintf(os.Stderr, "Error: %d of %d snapshots failed verification\n", failed, len(flag.Args()))
+		os.Exit(1)
+	}
+}
+
+// verifySnapshot verifies the named snapshot; see Dataset.Verify.
+func verifySnapshot(ctx context.Context, name string) (uint64, error) {
+	d, err := zfs.DatasetOpen(name)
+	if err != nil {
+		return 0, err
+	}
+	defer d.Close()
+
+	if d.Type != zfs.DatasetTypeSnapshot {
+		return 0, fmt.Errorf("not a snapshot: %s", name)
+	}
+	return d.Verify(ctx)
+}
+
+// verifyAll verifies each of the named snapshots with verify, and writes a tab-separated line for each to w giving its
+// name and either "ok" and the number of bytes read or "FAILED" and the error.  It returns the number of snapshots that
+// failed verification.  Once ctx is done, the remaining snapshots fail without being verified.
+func verifyAll(ctx context.Context, names []string, verify func(context.Context, string) (uint64, error),
+	w io.Writer) int {
+
+	failed := 0
+	for _, name := range names {
+		var n uint64
+		err := ctx.Err()
+		if err == nil {
+			n, err = verify(ctx, name)
+		}
+		if err != nil {
+			fmt.Fprintf(w, "%s\tFAILED\t%s\n", name, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(w, "%s\tok\t%d\n", name, n)
+	}
+	return failed
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyAll(t *testing.T) {
+	errChecksum := errors.New("checksum mismatch")
+	verify := func(ctx context.Context, name string) (uint64, error) {
+		switch name {
+		case "tank/good@snap":
+			return 1 << 20, nil
+		case "tank/bad@snap":
+			return 4096, errChecksum
+		}
+		return 0, errors.New("dataset does not exist")
+	}
+
+	var buf bytes.Buffer
+	failed := verifyAll(context.Background(), []string{"tank/good@snap", "tank/bad@snap"}, verify, &buf)
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, "tank/good@snap\tok\t1048576\ntank/bad@snap\tFAILED\tchecksum mismatch\n", buf.String())
+
+	// Once the context is done, snapshots are not verified.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	buf.Reset()
+	failed = verifyAll(ctx, []string{"tank/good@snap"}, verify, &buf)
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, "tank/good@snap\tFAILED\tcontext canceled\n", buf.String())
+}
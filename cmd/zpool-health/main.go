@@ -0,0 +1,91 @@
+// zpool-health prints the state and status of each imported pool and a summary of its devices' health, along with a
+// warning for each device that has needed repairs or that has had checksum errors.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	zfs "github.com/kelleyk/go-libzfs"
+)
+
+var (
+	help = flag.Bool("help", false, "Print this usage message.")
+)
+
+func main() {
+	flag.Parse()
+
+	if *help || len(flag.Args()) != 0 {
+		flag.Usage()
+		return
+	}
+
+	healthy, err := printHealth()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+	if !healthy {
+		os.Exit(2)
+	}
+}
+
+// printHealth prints a report for each pool.  It returns false if any pool is unhealthy or has a flaky device.
+func printHealth() (bool, error) {
+	pools, err := zfs.PoolOpenAll()
+	defer zfs.PoolCloseAll(pools)
+	if err != nil {
+		return false, err
+	}
+
+	healthy := true
+	for _, p := range pools {
+		name, err := p.Name()
+		if err != nil {
+			return false, err
+		}
+		state, err := p.State()
+		if err != nil {
+			return false, err
+		}
+		status, err := p.Status()
+		if err != nil {
+			return false, err
+		}
+		vdevTree, err := p.VDevTree()
+		if err != nil {
+			return false, err
+		}
+		results := vdevTree.ScrubResults()
+
+		fmt.Printf("%s\n  state: %v\n  status: %v\n", name, state, status)
+		fmt.Printf("  devices: %v\n", vdevTree.HealthSummary())
+		switch status {
+		case zfs.PoolStatusOk, zfs.PoolStatusVersionOlder, zfs.PoolStatusFeatDisabled:
+			// Like `zpool status -x`, don't complain about pools that could merely be upgraded.
+		default:
+			healthy = false
+		}
+		for _, warning := range flakyDevices(results) {
+			fmt.Printf("  WARNING: %s\n", warning)
+			healthy = false
+		}
+	}
+
+	return healthy, nil
+}
+
+// flakyDevices returns a warning for each device that has had checksum errors or that has needed repairs.
+func flakyDevices(results []zfs.VDevScrubResult) []string {
+	var warnings []string
+	for _, r := range results {
+		if r.ChecksumErrors == 0 && !r.Repaired {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("device %s: %d checksum errors; %d bytes repaired",
+			r.Name, r.ChecksumErrors, r.SelfHealed))
+	}
+	return warnings
+}
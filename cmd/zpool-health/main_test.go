@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlakyDevices(t *testing.T) {
+	tree := zfs.VDevTree{Type: zfs.VDevTypeRoot, Name: "tank", Devices: []zfs.VDevTree{
+		{Type: zfs.VDevTypeMirror, Name: "mirror-0", Devices: []zfs.VDevTree{
+			{Type: zfs.VDevTypeDisk, Name: "sda"},
+			{Type: zfs.VDevTypeDisk, Name: "sdb", Stat: zfs.VDevStat{ChecksumErrors: 3, SelfHealed: 4096}},
+		}},
+		{Type: zfs.VDevTypeMirror, Name: "mirror-1", Devices: []zfs.VDevTree{
+			{Type: zfs.VDevTypeDisk, Name: "sdc", Stat: zfs.VDevStat{SelfHealed: 512}},
+			{Type: zfs.VDevTypeDisk, Name: "sdd"},
+		}},
+	}}
+
+	results := tree.ScrubResults()
+	if assert.Equal(t, 4, len(results)) {
+		assert.Equal(t, zfs.VDevScrubResult{Name: "sdb", ChecksumErrors: 3, SelfHealed: 4096, Repaired: true}, results[1])
+		assert.False(t, results[3].Repaired)
+	}
+
+	assert.Equal(t, []string{
+		"device sdb: 3 checksum errors; 4096 bytes repaired",
+		"device sdc: 0 checksum errors; 512 bytes repaired",
+	}, flakyDevices(results))
+}
+
+func TestHealthSummary(t *testing.T) {
+	tree := zfs.VDevTree{Type: zfs.VDevTypeRoot, Name: "tank", Stat: zfs.VDevStat{State: zfs.VDevStateDegraded},
+		Devices: []zfs.VDevTree{
+			{Type: zfs.VDevTypeMirror, Name: "mirror-0", Stat: zfs.VDevStat{State: zfs.VDevStateDegraded, ReadErrors: 9},
+				Devices: []zfs.VDevTree{
+					{Type: zfs.VDevTypeDisk, Name: "sda", Stat: zfs.VDevStat{State: zfs.VDevStateHealthy}},
+					{Type: zfs.VDevTypeDisk, Name: "sdb",
+						Stat: zfs.VDevStat{State: zfs.VDevStateFaulted, ReadErrors: 2, ChecksumErrors: 5}},
+				}},
+			{Type: zfs.VDevTypeRaidz, Name: "raidz1-1", Stat: zfs.VDevStat{State: zfs.VDevStateHealthy},
+				Devices: []zfs.VDevTree{
+					{Type: zfs.VDevTypeDisk, Name: "sdc", Stat: zfs.VDevStat{State: zfs.VDevStateHealthy}},
+					{Type: zfs.VDevTypeReplacing, Name: "replacing-1", Stat: zfs.VDevStat{State: zfs.VDevStateDegraded},
+						Devices: []zfs.VDevTree{
+							{Type: zfs.VDevTypeDisk, Name: "sdd", Stat: zfs.VDevStat{State: zfs.VDevStateCantOpen, WriteErrors: 1}},
+							{Type: zfs.VDevTypeDisk, Name: "sde", Stat: zfs.VDevStat{State: zfs.VDevStateHealthy}},
+						}},
+					{Type: zfs.VDevTypeDisk, Name: "sdf", Stat: zfs.VDevStat{State: zfs.VDevStateOffline}},
+				}},
+		}}
+
+	summary := tree.HealthSummary()
+	// The errors of the mirror are those of its members; they are not counted again.
+	assert.Equal(t, zfs.VDevHealthSummary{Online: 3, Faulted: 1, Offline: 1, Unavailable: 1, ReadErrors: 2,
+		WriteErrors: 1, ChecksumErrors: 5}, summary)
+	assert.Equal(t, "3 online, 1 faulted, 1 offline, 1 unavailable; 2 read, 1 write, 5 checksum errors",
+		summary.String())
+
+	assert.Equal(t, "no devices; 0 read, 0 write, 0 checksum errors", (&zfs.VDevTree{}).HealthSummary().String())
+}
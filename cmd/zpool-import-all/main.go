@@ -0,0 +1,61 @@
+// zpool-import-all imports every pool that is available for import, like `zpool import -a`.  It is intended for use
+// at boot on recovery appliances and similar systems.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	zfs "github.com/kelleyk/go-libzfs"
+)
+
+// stringsFlag is a flag that may be given more than once; each value is appended.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string     { return strings.Join(*f, ",") }
+func (f *stringsFlag) Set(v string) error { *f = append(*f, v); return nil }
+
+var (
+	help    = flag.Bool("help", false, "Print this usage message.")
+	altRoot = flag.String("altroot", "", "Import each pool with this alternate root directory.")
+
+	searchPaths stringsFlag
+)
+
+func main() {
+	flag.Var(&searchPaths, "d", "Search for devices in this directory; may be given more than once.  (default: /dev)")
+	flag.Parse()
+
+	if *help || len(flag.Args()) != 0 {
+		flag.Usage()
+		return
+	}
+
+	if errs := importAll(os.Stdout, searchPaths, zfs.ImportOptions{AltRoot: *altRoot}); len(errs) != 0 {
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// importAll imports every pool that is available for import from the devices in searchPaths (see zfs.PoolImportAll)
+// and writes the name of each to w.  It returns an error for each pool that could not be imported.  The handles to the
+// imported pools are closed before it returns, so that the caller may exit.
+func importAll(w io.Writer, searchPaths []string, opts zfs.ImportOptions) []error {
+	pools, errs := zfs.PoolImportAll(searchPaths, opts)
+	defer zfs.PoolCloseAll(pools)
+
+	for _, p := range pools {
+		name, err := p.Name()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Fprintf(w, "%s\n", name)
+	}
+	return errs
+}
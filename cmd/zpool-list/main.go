@@ -0,0 +1,152 @@
+// zpool-list prints the state and status of each imported pool, either for people or, with -json, as a JSON array that
+// also includes each pool's tree of devices, for scripts.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	zfs "github.com/kelleyk/go-libzfs"
+)
+
+var (
+	help     = flag.Bool("help", false, "Print this usage message.")
+	jsonFlag = flag.Bool("json", false, "Print a JSON array with an object for each pool, including its tree of devices.")
+)
+
+// poolJSON describes a pool in the output of -json.
+type poolJSON struct {
+	Name       string   `json:"name"`
+	State      string   `json:"state"`
+	Status     string   `json:"status"`
+	StatusCode int      `json:"statusCode"` // the numeric value of the zpool_status_t
+	VDevs      vdevJSON `json:"vdevs"`
+}
+
+// vdevJSON describes a device (or a group of devices, such as a mirror) in the output of -json.
+type vdevJSON struct {
+	Type           string     `json:"type"`
+	Name           string     `json:"name"`
+	Path           string     `json:"path,omitempty"`
+	GUID           uint64     `json:"guid"`
+	State          string     `json:"state"`
+	ReadErrors     uint64     `json:"readErrors"`
+	WriteErrors    uint64     `json:"writeErrors"`
+	ChecksumErrors uint64     `json:"checksumErrors"`
+	Devices        []vdevJSON `json:"devices,omitempty"`
+}
+
+// pool is what is printed about each pool.
+type pool struct {
+	name   string
+	state  zfs.PoolState
+	status zfs.PoolStatus
+	vdevs  zfs.VDevTree
+}
+
+func main() {
+	flag.Parse()
+
+	if *help || len(flag.Args()) != 0 {
+		flag.Usage()
+		return
+	}
+
+	pools, err := listPools()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+
+	if *jsonFlag {
+		err = writeJSON(os.Stdout, pools)
+	} else {
+		writeText(os.Stdout, pools)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// listPools returns each imported pool.
+func listPools() ([]pool, error) {
+	pools, err := zfs.PoolOpenAll()
+	defer zfs.PoolCloseAll(pools)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []pool
+	for _, p := range pools {
+		name, err := p.Name()
+		if err != nil {
+			return nil, err
+		}
+		state, err := p.State()
+		if err != nil {
+			return nil, err
+		}
+		status, err := p.Status()
+		if err != nil {
+			return nil, err
+		}
+		vdevTree, err := p.VDevTree()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, pool{name: name, state: state, status: status, vdevs: vdevTree})
+	}
+	return result, nil
+}
+
+// writeText writes a human-readable description of each of pools to w.
+func writeText(w io.Writer, pools []pool) {
+	for _, p := range pools {
+		fmt.Fprintf(w, "%v\n  state: %v\n  status: %v\n", p.name, p.state, p.status)
+		fmt.Fprintf(w, "  root-vdev stat-state: %s\n", p.vdevs.Stat.State)
+		fmt.Fprintf(w, "  root-vdev scanstat-state: %s\n", p.vdevs.ScanStat.State)
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+// writeJSON writes a JSON array describing pools to w.
+func writeJSON(w io.Writer, pools []pool) error {
+	out := make([]poolJSON, len(pools))
+	for i, p := range pools {
+		out[i] = poolJSON{
+			Name:       p.name,
+			State:      p.state.String(),
+			Status:     p.status.String(),
+			StatusCode: int(p.status),
+			VDevs:      vdevTreeJSON(p.vdevs),
+		}
+	}
+	buf, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", buf)
+	return err
+}
+
+// vdevTreeJSON converts t and its descendants to their JSON representation.
+func vdevTreeJSON(t zfs.VDevTree) vdevJSON {
+	v := vdevJSON{
+		Type:           string(t.Type),
+		Name:           t.Name,
+		Path:           t.Path,
+		GUID:           t.GUID,
+		State:          t.Stat.State.String(),
+		ReadErrors:     t.Stat.ReadErrors,
+		WriteErrors:    t.Stat.WriteErrors,
+		ChecksumErrors: t.Stat.ChecksumErrors,
+	}
+	for _, child := range t.Devices {
+		v.Devices = append(v.Devices, vdevTreeJSON(child))
+	}
+	return v
+}
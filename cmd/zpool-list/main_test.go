@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	zfs "github.com/kelleyk/go-libzfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteJSON(t *testing.T) {
+	pools := []pool{{
+		name:   "tank",
+		state:  zfs.PoolStateActive,
+		status: zfs.PoolStatusMissingDevR,
+		vdevs: zfs.VDevTree{Type: zfs.VDevTypeRoot, Name: "tank", Stat: zfs.VDevStat{State: zfs.VDevStateDegraded},
+			Devices: []zfs.VDevTree{
+				{Type: zfs.VDevTypeMirror, Name: "mirror-0", GUID: 7, Stat: zfs.VDevStat{State: zfs.VDevStateDegraded},
+					Devices: []zfs.VDevTree{
+						{Type: zfs.VDevTypeDisk, Name: "sda", Path: "/dev/sda1", GUID: 8,
+							Stat: zfs.VDevStat{State: zfs.VDevStateHealthy}},
+						{Type: zfs.VDevTypeDisk, Name: "sdb", Path: "/dev/sdb1", GUID: 9,
+							Stat: zfs.VDevStat{State: zfs.VDevStateFaulted, ReadErrors: 2, ChecksumErrors: 5}},
+					}},
+			}},
+	}}
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, writeJSON(&buf, pools)) {
+		return
+	}
+	var out []poolJSON
+	if !assert.NoError(t, json.Unmarshal(buf.Bytes(), &out)) || !assert.Len(t, out, 1) {
+		return
+	}
+	p := out[0]
+	assert.Equal(t, "tank", p.Name)
+	assert.Equal(t, "active", p.State)
+	assert.Equal(t, int(zfs.PoolStatusMissingDevR), p.StatusCode)
+	assert.Equal(t, "root", p.VDevs.Type)
+	if assert.Len(t, p.VDevs.Devices, 1) {
+		mirror := p.VDevs.Devices[0]
+		assert.Equal(t, "mirror", mirror.Type)
+		assert.Equal(t, "degraded", mirror.State)
+		if assert.Len(t, mirror.Devices, 2) {
+			assert.Equal(t, vdevJSON{Type: "disk", Name: "sdb", Path: "/dev/sdb1", GUID: 9, State: "faulted",
+				ReadErrors: 2, ChecksumErrors: 5}, mirror.Devices[1])
+		}
+	}
+
+	// Leaf devices have no "devices" key; the mirror has no "path" key.
+	assert.NotContains(t, buf.String(), `"devices": null`)
+	assert.NotContains(t, buf.String(), `"path": ""`)
+}
@@ -0,0 +1,99 @@
+package zfstools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxDatasetNameLen is the maximum length of the full name of a dataset, snapshot, or bookmark (ZFS_MAXNAMELEN, less
+// the terminating NUL).
+const MaxDatasetNameLen = 255
+
+// InvalidNameError is returned by NormalizeDatasetName for a name that ZFS would refuse (with EZFS_INVALIDNAME).
+type InvalidNameError struct {
+	Name   string
+	Reason string
+}
+
+func (e *InvalidNameError) Error() string {
+	return fmt.Sprintf("invalid dataset name %q: %s", e.Name, e.Reason)
+}
+
+// NormalizeDatasetName cleans up name, the name of a filesystem, volume, snapshot (e.g. "tank/data@snap"), or bookmark
+// (e.g. "tank/data#mark") given by a user, and checks it against the rules that ZFS applies to names, so that a
+// mistake is reported clearly before libzfs is asked to do anything with it.  Repeated slashes are collapsed, and
+// trailing slashes are removed, so that "tank//data/" becomes "tank/data".
+//
+// Each component must be nonempty, other than "." or "..", and made up only of letters, digits, and the characters
+// "-_.: "; the pool's name must begin with a letter.  A name may contain at most one "@" or "#", after its last "/".
+// The resulting name may be no longer than MaxDatasetNameLen.  If name is invalid, an *InvalidNameError is returned.
+func NormalizeDatasetName(name string) (string, error) {
+	invalid := func(format string, args ...interface{}) (string, error) {
+		return "", &InvalidNameError{Name: name, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if name == "" {
+		return invalid("name is empty")
+	}
+	if strings.HasPrefix(name, "/") {
+		return invalid("name begins with /; dataset names (unlike mountpoints) do not")
+	}
+
+	dataset, sep, suffix := name, "", ""
+	if i := strings.IndexAny(name, "@#"); i >= 0 {
+		dataset, sep, suffix = name[:i], name[i:i+1], name[i+1:]
+		if strings.ContainsAny(suffix, "@#") {
+			return invalid("name contains more than one @ or #")
+		}
+		if strings.Contains(suffix, "/") {
+			return invalid("%s is not in the last component", sep)
+		}
+		if suffix == "" {
+			return invalid("nothing follows %s", sep)
+		}
+		if c, ok := invalidNameChar(suffix); !ok {
+			return invalid("%q is not allowed in names", c)
+		}
+	}
+
+	var components []string
+	for _, c := range strings.Split(dataset, "/") {
+		if c != "" {
+			components = append(components, c)
+		}
+	}
+	if len(components) == 0 {
+		return invalid("no pool is named")
+	}
+	for _, c := range components {
+		if c == "." || c == ".." {
+			return invalid("%q is not allowed as a component", c)
+		}
+		if r, ok := invalidNameChar(c); !ok {
+			return invalid("%q is not allowed in names", r)
+		}
+	}
+	if r := components[0][0]; !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z') {
+		return invalid("pool name %q does not begin with a letter", components[0])
+	}
+
+	normalized := strings.Join(components, "/") + sep + suffix
+	if len(normalized) > MaxDatasetNameLen {
+		return invalid("name is longer than %d characters", MaxDatasetNameLen)
+	}
+	return normalized, nil
+}
+
+// invalidNameChar returns the first character of s that is not allowed in a component of a name, and false, or true
+// if there is none.
+func invalidNameChar(s string) (rune, bool) {
+	for _, r := range s {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case strings.ContainsRune("-_.: ", r):
+		default:
+			return r, false
+		}
+	}
+	return 0, true
+}
@@ -0,0 +1,56 @@
+package zfstools
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeDatasetName(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{"tank", "tank"},
+		{"tank/data", "tank/data"},
+		{"tank/data/", "tank/data"},
+		{"tank//data///child", "tank/data/child"},
+		{"tank/data@zfs-auto-snap_daily_2016-01-01T00:00:00Z", "tank/data@zfs-auto-snap_daily_2016-01-01T00:00:00Z"},
+		{"tank/data#mark", "tank/data#mark"},
+		{"tank/my data.v2:x", "tank/my data.v2:x"},
+		{"Tank9/-_.", "Tank9/-_."},
+	} {
+		got, err := NormalizeDatasetName(tc.name)
+		if assert.NoError(t, err, tc.name) {
+			assert.Equal(t, tc.want, got, tc.name)
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		reason string
+	}{
+		{"", "empty"},
+		{"/tank/data", "begins with /"},
+		{"/", "begins with /"},
+		{"tank/da*ta", `'*'`},
+		{"tank/data@snap/x", "not in the last component"},
+		{"tank/data@a@b", "more than one"},
+		{"tank/data@snap#mark", "more than one"},
+		{"tank/data@", "nothing follows @"},
+		{"tank/data#", "nothing follows #"},
+		{"@snap", "no pool"},
+		{"tank/../data", `".."`},
+		{"tank/./data", `"."`},
+		{"9tank/data", "does not begin with a letter"},
+		{"tank/data@sn%ap", `'%'`},
+		{"tank/" + strings.Repeat("x", MaxDatasetNameLen), "longer than"},
+	} {
+		got, err := NormalizeDatasetName(tc.name)
+		assert.Empty(t, got, tc.name)
+		if assert.IsType(t, &InvalidNameError{}, err, tc.name) {
+			assert.Contains(t, err.Error(), tc.reason, tc.name)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package zfstools
+
+import (
+	"io"
+	"time"
+)
+
+// rateLimitedWriter is a token bucket: each byte written consumes a token, and tokens accumulate at a fixed rate, up
+// to one second's worth.  A write that would overdraw the bucket sleeps until the debt has been repaid.
+type rateLimitedWriter struct {
+	w      io.Writer
+	rate   float64 // tokens (bytes) per second
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimitedWriter returns a writer that writes to w at no more than bytesPerSec bytes per second, on average.
+// If bytesPerSec is zero, w is returned unchanged.
+//
+// The returned writer blocks while it waits; when it is used as the destination of e.g. Dataset.Send, the sender
+// simply blocks on the full pipe in the meantime.
+//
+func NewRateLimitedWriter(w io.Writer, bytesPerSec uint64) io.Writer {
+	if bytesPerSec == 0 {
+		return w
+	}
+	return &rateLimitedWriter{w: w, rate: float64(bytesPerSec), last: time.Now()}
+}
+
+func (r *rateLimitedWriter) Write(p []byte) (int, error) {
+	// Write at most one second's worth at a time, so that the output is reasonably smooth.
+	burst := int(r.rate)
+	if burst < 1 {
+		burst = 1
+	}
+
+	n := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > burst {
+			chunk = chunk[:burst]
+		}
+		r.wait(len(chunk))
+		m, err := r.w.Write(chunk)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// wait takes n tokens from the bucket, sleeping first if there are not enough.
+func (r *rateLimitedWriter) wait(n int) {
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.rate {
+		r.tokens = r.rate
+	}
+	r.last = now
+
+	r.tokens -= float64(n)
+	if r.tokens < 0 {
+		time.Sleep(time.Duration(-r.tokens / r.rate * float64(time.Second)))
+	}
+}
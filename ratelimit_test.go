@@ -0,0 +1,31 @@
+package zfstools
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitedWriter(t *testing.T) {
+	const (
+		rate = 1 << 20   // bytes per second
+		size = 256 << 10 // bytes
+	)
+	src := bytes.Repeat([]byte{0x5a}, size)
+
+	var dst bytes.Buffer
+	start := time.Now()
+	n, err := io.Copy(NewRateLimitedWriter(&dst, rate), bytes.NewReader(src))
+	elapsed := time.Since(start)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(size), n)
+	assert.Equal(t, src, dst.Bytes())
+	assert.True(t, elapsed >= size*time.Second/rate, "transfer took %v", elapsed)
+
+	// A limit of zero means no limit.
+	assert.Equal(t, io.Writer(&dst), NewRateLimitedWriter(&dst, 0))
+}
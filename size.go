@@ -0,0 +1,26 @@
+package zfstools
+
+import "fmt"
+
+// FormatSize formats a number of bytes the way that the zfs command does (e.g. "512B", "1.50K", "23.4M", "118G"), with
+// binary (power-of-1024) units and three significant digits.
+func FormatSize(n uint64) string {
+	const units = "BKMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+	v := float64(n)
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	switch {
+	case v < 10:
+		return fmt.Sprintf("%.2f%c", v, units[i])
+	case v < 100:
+		return fmt.Sprintf("%.1f%c", v, units[i])
+	default:
+		return fmt.Sprintf("%.0f%c", v, units[i])
+	}
+}
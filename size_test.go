@@ -0,0 +1,26 @@
+package zfstools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatSize(t *testing.T) {
+	for _, tc := range []struct {
+		n    uint64
+		want string
+	}{
+		{0, "0B"},
+		{512, "512B"},
+		{1023, "1023B"},
+		{1024, "1.00K"},
+		{1536, "1.50K"},
+		{23*1024*1024 + 400*1024, "23.4M"},
+		{118 << 30, "118G"},
+		{3 << 40, "3.00T"},
+		{1<<64 - 1, "16.0E"},
+	} {
+		assert.Equal(t, tc.want, FormatSize(tc.n), "%d", tc.n)
+	}
+}
@@ -0,0 +1,244 @@
+// Package zfstools contains code that is shared by the command-line utilities in this repository.
+package zfstools
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kelleyk/gokk"
+)
+
+const (
+	// `Mon Jan 2 15:04:05 -0700 MST 2006`
+	snapNameTimestampFormat = time.RFC3339
+)
+
+// NameOrder is the order in which the prefix and the label appear in a snapshot's name; the timestamp always comes
+// last.  The empty NameOrder is the same as NameOrderPrefixLabel.
+type NameOrder string
+
+const (
+	// NameOrderPrefixLabel gives names of the form `prefix_label_timestamp`.
+	NameOrderPrefixLabel NameOrder = "prefix_label"
+	// NameOrderLabelPrefix gives names of the form `label_prefix_timestamp`.
+	NameOrderLabelPrefix NameOrder = "label_prefix"
+)
+
+// Validate returns an error if o is not one of the NameOrder constants (or empty).
+func (o NameOrder) Validate() error {
+	switch o {
+	case "", NameOrderPrefixLabel, NameOrderLabelPrefix:
+		return nil
+	}
+	return fmt.Errorf("invalid name order %q (expected %q or %q)", string(o), NameOrderPrefixLabel, NameOrderLabelPrefix)
+}
+
+// DefaultSep is the separator between the parts of a snapshot's name unless another is chosen.
+const DefaultSep = "_"
+
+// ValidateSep returns an error if sep cannot separate the parts of a snapshot's name.  It must be a single character
+// that ZFS allows in snapshot names and that can be told apart from the letters and digits of prefixes and labels and
+// from the characters of timestamps ("-", ":" and "."); that leaves "_" and " ".
+func ValidateSep(sep string) error {
+	switch {
+	case sep == "_" || sep == " ":
+		return nil
+	case len(sep) != 1:
+		return fmt.Errorf("invalid separator %q: must be a single character", sep)
+	}
+	if _, ok := invalidNameChar(sep); !ok {
+		return fmt.Errorf("invalid separator %q: not allowed in snapshot names", sep)
+	}
+	return fmt.Errorf("invalid separator %q: could be mistaken for part of a prefix, label, or timestamp", sep)
+}
+
+// snapNameRegexps caches the regexps returned by NameOrder.regexps, by order and separator.
+var snapNameRegexps = struct {
+	sync.Mutex
+	m map[string][2]*regexp.Regexp
+}{m: make(map[string][2]*regexp.Regexp)}
+
+// match matches path against re, which has groups for the dataset, the first and second parts of the name (whose
+// meaning depends on o) and the timestamp.
+func (o NameOrder) match(re *regexp.Regexp, path string) (dataset, prefix, label, ts string, ok bool) {
+	m := re.FindStringSubmatch(path)
+	if len(m) == 0 {
+		return "", "", "", "", false
+	}
+	if o == NameOrderLabelPrefix {
+		return m[1], m[3], m[2], m[4], true
+	}
+	return m[1], m[2], m[3], m[4], true
+}
+
+// regexps returns the regexps that match the names of snapshots whose parts are in the order o and separated by sep
+// (or DefaultSep, if sep is empty), for both RFC 3339 and legacy timestamps.  Labels never contain the separator, but
+// prefixes may.  For example, with the default order and separator:
+//
+//	dataset@zfs-auto-snap_label_ts, where ts format = e.g. `2006-01-02T15:04:05Z07:00`
+//	dataset@prefix_label_ts, where ts is in some other format (and does not contain an underscore)
+func (o NameOrder) regexps(sep string) (snapName, legacySnapName *regexp.Regexp) {
+	if sep == "" {
+		sep = DefaultSep
+	}
+	if o == "" {
+		o = NameOrderPrefixLabel
+	}
+	key := string(o) + "/" + sep
+
+	snapNameRegexps.Lock()
+	defer snapNameRegexps.Unlock()
+	if res, ok := snapNameRegexps.m[key]; ok {
+		return res[0], res[1]
+	}
+
+	q := regexp.QuoteMeta(sep)
+	part := `([^` + q + `]+)`
+	first, second := `(.+)`, part
+	if o == NameOrderLabelPrefix {
+		first, second = part, `(.+)`
+	}
+	snapName = regexp.MustCompile(`(?i)^(.*)@` + first + q + second + q + `(` + gokk.RFC3339Pattern + `)$`)
+	legacySnapName = regexp.MustCompile(`^(.*)@` + first + q + second + q + part + `$`)
+	snapNameRegexps.m[key] = [2]*regexp.Regexp{snapName, legacySnapName}
+	return snapName, legacySnapName
+}
+
+// SnapMetadata describes a snapshot whose name was generated by one of these tools; the name has the form
+// `dataset@prefix_label_timestamp` (or `dataset@label_prefix_timestamp`; see NameOrder).
+type SnapMetadata struct {
+	Dataset string
+	Prefix  string
+	Label   string
+	TS      time.Time
+
+	// Order is the order of Prefix and Label in the snapshot's name.
+	Order NameOrder
+
+	// Sep separates the parts of the snapshot's name; if it is empty, DefaultSep is used.
+	Sep string
+
+	// SnapName, if not empty, is the part of the snapshot's name after the `@`.  It is used instead of a name
+	// generated from the fields above, e.g. when the snapshot's metadata came from somewhere other than its name.
+	SnapName string
+}
+
+// Path returns the snapshot's full name (e.g. `dataset@prefix_label_timestamp`).
+func (m *SnapMetadata) Path() string {
+	return fmt.Sprintf("%s@%s", m.Dataset, m.Name())
+}
+
+// Name returns the part of the snapshot's name after the `@`.
+func (m *SnapMetadata) Name() string {
+	if m.SnapName != "" {
+		return m.SnapName
+	}
+	first, second := m.Prefix, m.Label
+	if m.Order == NameOrderLabelPrefix {
+		first, second = second, first
+	}
+	sep := m.Sep
+	if sep == "" {
+		sep = DefaultSep
+	}
+	return strings.Join([]string{first, second, m.TS.Format(snapNameTimestampFormat)}, sep)
+}
+
+// ParseSnapName parses the full name of a snapshot.  If the name was not generated by these tools or does not have
+// the expected prefix, it returns nil.
+//
+// The timestamp is parsed with gokk.ExtractRFC3339, so it may also have fractional seconds, a lower-case "t" or "z", or
+// no time zone (in which case it is taken to be in UTC); since such a name cannot be regenerated from the metadata,
+// its SnapName is set.
+//
+// If the timestamp in the name is not in RFC 3339 format, each of legacyFormats (layouts for time.Parse, e.g.
+// "2006-01-02-1504") is tried in turn; timestamps without a time zone are taken to be in local time.  Since a name with
+// a legacy timestamp cannot be regenerated from the metadata, its SnapName is set.
+//
+func ParseSnapName(expectedPrefix, path string, legacyFormats ...string) (*SnapMetadata, error) {
+	return ParseSnapNameOrder("", expectedPrefix, path, legacyFormats...)
+}
+
+// ParseSnapNameOrder is like ParseSnapName, but expects the prefix and the label to appear in the name in the given
+// order.  The returned metadata has its Order set to order, so that Name regenerates the same name.
+func ParseSnapNameOrder(order NameOrder, expectedPrefix, path string, legacyFormats ...string) (*SnapMetadata, error) {
+	return ParseSnapNameSep(order, "", expectedPrefix, path, legacyFormats...)
+}
+
+// ParseSnapNameSep is like ParseSnapNameOrder, but expects the parts of the name to be separated by sep (or by
+// DefaultSep, if sep is empty) rather than by underscores, e.g. to recognize snapshots taken by other tools.  The
+// returned metadata has its Sep set to sep.
+func ParseSnapNameSep(order NameOrder, sep, expectedPrefix, path string, legacyFormats ...string) (*SnapMetadata,
+	error) {
+
+	re, legacyRe := order.regexps(sep)
+
+	dataset, snapPrefix, label, tsStr, ok := order.match(re, path)
+	if !ok {
+		// No regexp match.
+		return parseLegacySnapName(order, sep, legacyRe, expectedPrefix, path, legacyFormats), nil
+	}
+
+	if snapPrefix != expectedPrefix {
+		// Wrong prefix; no match.
+		return nil, nil
+	}
+
+	ts, rest, ok := gokk.ExtractRFC3339(tsStr)
+	if !ok || rest != "" {
+		return nil, fmt.Errorf("cannot parse timestamp %q in snapshot name %q", tsStr, path)
+	}
+
+	meta := &SnapMetadata{
+		Dataset: dataset,
+		Prefix:  snapPrefix,
+		Label:   label,
+		TS:      ts,
+		Order:   order,
+		Sep:     sep,
+	}
+	if name := path[len(dataset)+1:]; meta.Name() != name {
+		// E.g. a timestamp with fractional seconds, with a lower-case "t", or without a time zone.
+		meta.SnapName = name
+	}
+	return meta, nil
+}
+
+func parseLegacySnapName(order NameOrder, sep string, re *regexp.Regexp, expectedPrefix, path string,
+	legacyFormats []string) *SnapMetadata {
+	if len(legacyFormats) == 0 {
+		return nil
+	}
+
+	dataset, snapPrefix, label, tsStr, ok := order.match(re, path)
+	if !ok || snapPrefix != expectedPrefix {
+		return nil
+	}
+
+	for _, layout := range legacyFormats {
+		ts, err := time.ParseInLocation(layout, tsStr, time.Local)
+		if err != nil {
+			continue
+		}
+		return &SnapMetadata{
+			Dataset:  dataset,
+			Prefix:   snapPrefix,
+			Label:    label,
+			TS:       ts,
+			Order:    order,
+			Sep:      sep,
+			SnapName: path[len(dataset)+1:],
+		}
+	}
+	return nil
+}
+
+// ByTS sorts snapshots from most recent to least recent.
+type ByTS []*SnapMetadata
+
+func (a ByTS) Len() int           { return len(a) }
+func (a ByTS) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a ByTS) Less(i, j int) bool { return a[i].TS.After(a[j].TS) }
@@ -0,0 +1,178 @@
+package zfstools
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSnapName(t *testing.T) {
+	const prefix = "zfs-auto-snap"
+
+	for _, tt := range []struct {
+		path string
+		meta *SnapMetadata
+	}{
+		{"ds@zfs-auto-snap_daily_2010-01-02T03:04:05Z", &SnapMetadata{Dataset: "ds", Label: "daily", TS: time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)}},
+		{"ds@some-other-prefix_daily_2010-01-02T03:04:05Z", nil},
+		// Names that cannot be regenerated from the metadata are kept as they are.
+		{"ds@zfs-auto-snap_daily_2010-01-02t03:04:05z", &SnapMetadata{Dataset: "ds", Label: "daily", TS: time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)}},
+		{"ds@zfs-auto-snap_daily_2010-01-02T03:04:05.5Z", &SnapMetadata{Dataset: "ds", Label: "daily", TS: time.Date(2010, 1, 2, 3, 4, 5, 5e8, time.UTC)}},
+		{"ds@zfs-auto-snap_daily_2010-01-02T03:04:05", &SnapMetadata{Dataset: "ds", Label: "daily", TS: time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)}},
+	} {
+		meta, err := ParseSnapName(prefix, tt.path)
+
+		if assert.Nil(t, err) {
+			if tt.meta == nil {
+				assert.Nil(t, meta, "did not expect name to match, but result was returned")
+			} else {
+				if assert.NotNil(t, meta, "expected name to match, but no result was returned") {
+					ok := assert.Equal(t, prefix, meta.Prefix, tt.path)
+					ok = assert.Equal(t, tt.meta.Label, meta.Label, tt.path) && ok
+					ok = assert.True(t, tt.meta.TS.Equal(meta.TS), "%s: %v", tt.path, meta.TS) && ok
+					ok = assert.Equal(t, tt.meta.Dataset, meta.Dataset, tt.path) && ok
+
+					// Finally, check that we can get the original snapshot path back.
+					if ok {
+						assert.Equal(t, tt.path, meta.Path())
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestParseSnapNameLegacy(t *testing.T) {
+	const prefix = "zfs-auto-snap"
+	legacyFormats := []string{"2006-01-02-1504"}
+
+	var snaps []*SnapMetadata
+	for _, path := range []string{
+		"ds@zfs-auto-snap_daily_2020-01-02-1504",
+		"ds@zfs-auto-snap_daily_2020-01-04T15:04:00Z",
+		"ds@zfs-auto-snap_daily_2020-01-03-1504",
+	} {
+		meta, err := ParseSnapName(prefix, path, legacyFormats...)
+		if assert.NoError(t, err, path) && assert.NotNil(t, meta, path) {
+			assert.Equal(t, "daily", meta.Label, path)
+			// The original name can still be recovered (e.g. to destroy the snapshot).
+			assert.Equal(t, path, meta.Path(), path)
+			snaps = append(snaps, meta)
+		}
+	}
+	if !assert.Equal(t, 3, len(snaps)) {
+		return
+	}
+	assert.True(t, snaps[0].TS.Equal(time.Date(2020, 1, 2, 15, 4, 0, 0, time.Local)))
+
+	// Legacy and RFC 3339 timestamps are ordered together.
+	sort.Sort(ByTS(snaps))
+	assert.Equal(t, "ds@zfs-auto-snap_daily_2020-01-04T15:04:00Z", snaps[0].Path())
+	assert.Equal(t, "ds@zfs-auto-snap_daily_2020-01-03-1504", snaps[1].Path())
+	assert.Equal(t, "ds@zfs-auto-snap_daily_2020-01-02-1504", snaps[2].Path())
+
+	// Without legacy formats, or with the wrong prefix, legacy names are not recognized.
+	for _, tt := range []struct {
+		prefix  string
+		formats []string
+	}{
+		{prefix, nil},
+		{"other", legacyFormats},
+	} {
+		meta, err := ParseSnapName(tt.prefix, "ds@zfs-auto-snap_daily_2020-01-02-1504", tt.formats...)
+		assert.NoError(t, err)
+		assert.Nil(t, meta)
+	}
+}
+
+func TestParseSnapNameOrder(t *testing.T) {
+	ts := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	legacyFormats := []string{"2006-01-02-1504"}
+
+	for _, tt := range []struct {
+		order  NameOrder
+		prefix string
+		name   string
+	}{
+		{"", "zfs-auto-snap", "zfs-auto-snap_daily_2010-01-02T03:04:05Z"},
+		{NameOrderPrefixLabel, "zfs-auto-snap", "zfs-auto-snap_daily_2010-01-02T03:04:05Z"},
+		{NameOrderLabelPrefix, "zfs-auto-snap", "daily_zfs-auto-snap_2010-01-02T03:04:05Z"},
+		// Prefixes (unlike labels) may contain underscores.
+		{NameOrderPrefixLabel, "auto_snap", "auto_snap_daily_2010-01-02T03:04:05Z"},
+		{NameOrderLabelPrefix, "auto_snap", "daily_auto_snap_2010-01-02T03:04:05Z"},
+	} {
+		meta := &SnapMetadata{Dataset: "ds", Prefix: tt.prefix, Label: "daily", TS: ts, Order: tt.order}
+		assert.Equal(t, "ds@"+tt.name, meta.Path(), "order=%q", tt.order)
+
+		// Parsing with the same order recovers the metadata...
+		parsed, err := ParseSnapNameOrder(tt.order, tt.prefix, meta.Path(), legacyFormats...)
+		if assert.NoError(t, err) && assert.NotNil(t, parsed, "order=%q", tt.order) {
+			assert.Equal(t, meta, parsed, "order=%q", tt.order)
+		}
+
+		// ...but parsing with the other order does not match.
+		other := NameOrderLabelPrefix
+		if tt.order == NameOrderLabelPrefix {
+			other = NameOrderPrefixLabel
+		}
+		parsed, err = ParseSnapNameOrder(other, tt.prefix, meta.Path())
+		assert.NoError(t, err)
+		assert.Nil(t, parsed, "order=%q parsed as %q", tt.order, other)
+	}
+
+	// Legacy timestamps are recognized in either order.
+	meta, err := ParseSnapNameOrder(NameOrderLabelPrefix, "zfs-auto-snap", "ds@daily_zfs-auto-snap_2020-01-02-1504",
+		legacyFormats...)
+	if assert.NoError(t, err) && assert.NotNil(t, meta) {
+		assert.Equal(t, "daily", meta.Label)
+		assert.Equal(t, "zfs-auto-snap", meta.Prefix)
+		assert.Equal(t, "ds@daily_zfs-auto-snap_2020-01-02-1504", meta.Path())
+	}
+}
+
+func TestParseSnapNameSep(t *testing.T) {
+	ts := time.Date(2010, 1, 2, 3, 4, 5, 0, time.UTC)
+	legacyFormats := []string{"2006-01-02-1504"}
+
+	for _, order := range []NameOrder{NameOrderPrefixLabel, NameOrderLabelPrefix} {
+		meta := &SnapMetadata{Dataset: "ds", Prefix: "auto_snap", Label: "daily", TS: ts, Order: order, Sep: " "}
+		parsed, err := ParseSnapNameSep(order, " ", "auto_snap", meta.Path(), legacyFormats...)
+		if assert.NoError(t, err) && assert.NotNil(t, parsed, "order=%q", order) {
+			assert.Equal(t, meta, parsed, "order=%q", order)
+		}
+
+		// Names with other separators are not matched.
+		parsed, err = ParseSnapNameSep(order, "", "auto_snap", meta.Path())
+		assert.NoError(t, err)
+		assert.Nil(t, parsed, "order=%q", order)
+	}
+	assert.Equal(t, "ds@auto_snap daily 2010-01-02T03:04:05Z",
+		(&SnapMetadata{Dataset: "ds", Prefix: "auto_snap", Label: "daily", TS: ts, Sep: " "}).Path())
+
+	meta, err := ParseSnapNameSep("", " ", "zfs-auto-snap", "ds@zfs-auto-snap daily 2020-01-02-1504", legacyFormats...)
+	if assert.NoError(t, err) && assert.NotNil(t, meta) {
+		assert.Equal(t, "daily", meta.Label)
+		assert.Equal(t, "ds@zfs-auto-snap daily 2020-01-02-1504", meta.Path())
+	}
+}
+
+func TestValidateSep(t *testing.T) {
+	for _, sep := range []string{"_", " "} {
+		assert.NoError(t, ValidateSep(sep), sep)
+	}
+	// Separators that could appear in timestamps, prefixes, or labels are refused, as are those that ZFS refuses.
+	for _, sep := range []string{"", "__", "-", ":", ".", "T", "z", "0", "@", "/", "+"} {
+		assert.Error(t, ValidateSep(sep), sep)
+	}
+}
+
+func TestNameOrderValidate(t *testing.T) {
+	for _, o := range []NameOrder{"", NameOrderPrefixLabel, NameOrderLabelPrefix} {
+		assert.NoError(t, o.Validate(), string(o))
+	}
+	for _, o := range []NameOrder{"label-prefix", "prefix_label_ts", "PREFIX_LABEL"} {
+		assert.Error(t, o.Validate(), string(o))
+	}
+}
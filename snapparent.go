@@ -0,0 +1,37 @@
+package zfstools
+
+import (
+	"fmt"
+	"strings"
+
+	zfs "github.com/kelleyk/go-libzfs"
+)
+
+// SnapshotParent returns the name of the filesystem or volume that the snapshot snapName (e.g. "tank/data@snap")
+// belongs to, normalized by NormalizeDatasetName.  It returns an error if snapName is not the valid name of a snapshot:
+// it must contain exactly one "@", with something on either side of it.  In particular, the names of filesystems and
+// of bookmarks (e.g. "tank/data#mark") are rejected.
+func SnapshotParent(snapName string) (string, error) {
+	if strings.Contains(snapName, "#") {
+		return "", fmt.Errorf("not a snapshot name (but perhaps a bookmark name): %s", snapName)
+	}
+	name, err := NormalizeDatasetName(snapName)
+	if err != nil {
+		return "", err
+	}
+	i := strings.Index(name, "@")
+	if i < 0 {
+		return "", fmt.Errorf("not a snapshot name: %s", snapName)
+	}
+	return name[:i], nil
+}
+
+// OpenSnapshotParent opens the filesystem or volume that the snapshot snapName belongs to (see SnapshotParent).  The
+// caller must close it.
+func OpenSnapshotParent(snapName string) (zfs.Dataset, error) {
+	parent, err := SnapshotParent(snapName)
+	if err != nil {
+		return zfs.Dataset{}, err
+	}
+	return zfs.DatasetOpen(parent)
+}
@@ -0,0 +1,37 @@
+package zfstools
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotParent(t *testing.T) {
+	for _, tc := range []struct {
+		snapName string
+		parent   string
+		ok       bool
+	}{
+		{"tank/data@snap", "tank/data", true},
+		{"tank@zfs-auto-snap_daily_2016-01-01T00:00:00Z", "tank", true},
+		{"tank/a/b/c@x", "tank/a/b/c", true},
+		{"tank//data/@snap", "tank/data", true},
+		{"tank/da*ta@snap", "", false},
+		{"tank/data", "", false},
+		{"tank/data#mark", "", false},
+		{"tank/data@snap#mark", "", false},
+		{"tank/data@a@b", "", false},
+		{"@snap", "", false},
+		{"tank/data@", "", false},
+		{"", "", false},
+	} {
+		parent, err := SnapshotParent(tc.snapName)
+		assert.Equal(t, tc.parent, parent, tc.snapName)
+		assert.Equal(t, tc.ok, err == nil, "%s: %v", tc.snapName, err)
+	}
+
+	_, err := OpenSnapshotParent("tank/data#mark")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "bookmark")
+	}
+}
@@ -0,0 +1,144 @@
+package zfstools
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	zfs "github.com/kelleyk/go-libzfs"
+)
+
+// SnapRef identifies a snapshot by the part of its name after the "@" and by its GUID.  The GUID is preserved when a
+// snapshot is sent to another host (and when it is renamed), so it is what should be used to decide whether two
+// snapshots are the same.
+type SnapRef struct {
+	Name string `json:"name"`
+	GUID uint64 `json:"guid"`
+}
+
+// SnapRefComparison describes the difference between the snapshots of a dataset and those of its replica; see
+// CompareSnapRefs.
+type SnapRefComparison struct {
+	// LocalOnly and RemoteOnly are the snapshots that exist on only one side, in the order in which they were listed.
+	LocalOnly  []SnapRef `json:"localOnly"`
+	RemoteOnly []SnapRef `json:"remoteOnly"`
+
+	// LatestCommon is the most recent local snapshot that also exists remotely (i.e. the last one replicated), or nil
+	// if there is none; Lag is the number of local snapshots that are more recent than it.
+	LatestCommon *SnapRef `json:"latestCommon"`
+	Lag          int      `json:"lag"`
+}
+
+// CompareSnapRefs matches the local snapshots (oldest first) with the remote ones by GUID, so that a snapshot that has
+// been renamed on either side still matches.  The order of remote does not matter.
+func CompareSnapRefs(local, remote []SnapRef) SnapRefComparison {
+	c := SnapRefComparison{LocalOnly: []SnapRef{}, RemoteOnly: []SnapRef{}}
+
+	localGUIDs := make(map[uint64]bool, len(local))
+	for _, s := range local {
+		localGUIDs[s.GUID] = true
+	}
+	remoteGUIDs := make(map[uint64]bool, len(remote))
+	for _, s := range remote {
+		remoteGUIDs[s.GUID] = true
+		if !localGUIDs[s.GUID] {
+			c.RemoteOnly = append(c.RemoteOnly, s)
+		}
+	}
+
+	for i, s := range local {
+		if !remoteGUIDs[s.GUID] {
+			c.LocalOnly = append(c.LocalOnly, s)
+			continue
+		}
+		s := s
+		c.LatestCommon = &s
+		c.Lag = len(local) - i - 1
+	}
+	if c.LatestCommon == nil {
+		c.Lag = len(local)
+	}
+	return c
+}
+
+// FindLatestCommonSnapshot returns the name (on the local side) of the most recent snapshot in local that is also
+// present in remote, matching them by GUID; ok is false if they have no snapshot in common.  local must be ordered
+// oldest first; the order of remote does not matter.  An incremental stream sent from the snapshot that it returns
+// can be received on the remote side, which makes it the base from which an interrupted replication can be resumed.
+func FindLatestCommonSnapshot(local, remote []SnapRef) (name string, ok bool) {
+	c := CompareSnapRefs(local, remote)
+	if c.LatestCommon == nil {
+		return "", false
+	}
+	return c.LatestCommon.Name, true
+}
+
+// SnapRefs returns the snapshots of d (but not of its descendants), oldest first.
+func SnapRefs(d *zfs.Dataset) ([]SnapRef, error) {
+	var refs []SnapRef
+	var txgs []uint64
+	for _, dd := range d.Children {
+		if dd.Type != zfs.DatasetTypeSnapshot {
+			continue
+		}
+		path, err := dd.Path()
+		if err != nil {
+			return nil, err
+		}
+		value := dd.Properties[zfs.DatasetPropGUID].Value
+		guid, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected value for guid property of %s: %q", path, value)
+		}
+		value = dd.Properties[zfs.DatasetPropCreatetxg].Value
+		txg, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected value for createtxg property of %s: %q", path, value)
+		}
+		refs = append(refs, SnapRef{Name: path[strings.Index(path, "@")+1:], GUID: guid})
+		txgs = append(txgs, txg)
+	}
+	sort.Sort(refsByTxg{refs, txgs})
+	return refs, nil
+}
+
+// ParseSnapRefs reads a list of snapshots, one per line, each given by its name (either in full or just the part after
+// the "@") and its GUID, separated by whitespace, as printed by `zfs list -H -p -t snapshot -o name,guid`.  Blank
+// lines are ignored.
+func ParseSnapRefs(r io.Reader) ([]SnapRef, error) {
+	var refs []SnapRef
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected a name and a GUID", lineno)
+		}
+		guid, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid GUID %q", lineno, fields[1])
+		}
+		refs = append(refs, SnapRef{Name: fields[0][strings.LastIndex(fields[0], "@")+1:], GUID: guid})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+type refsByTxg struct {
+	refs []SnapRef
+	txgs []uint64
+}
+
+func (a refsByTxg) Len() int           { return len(a.refs) }
+func (a refsByTxg) Less(i, j int) bool { return a.txgs[i] < a.txgs[j] }
+func (a refsByTxg) Swap(i, j int) {
+	a.refs[i], a.refs[j] = a.refs[j], a.refs[i]
+	a.txgs[i], a.txgs[j] = a.txgs[j], a.txgs[i]
+}
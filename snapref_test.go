@@ -0,0 +1,105 @@
+package zfstools
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindLatestCommonSnapshot(t *testing.T) {
+	local := []SnapRef{{"a", 1}, {"b", 2}, {"c", 3}, {"d", 4}}
+
+	for _, tc := range []struct {
+		desc   string
+		remote []SnapRef
+		name   string
+		ok     bool
+	}{
+		{"overlapping", []SnapRef{{"a", 1}, {"b", 2}}, "b", true},
+		{"fully replicated", []SnapRef{{"a", 1}, {"b", 2}, {"c", 3}, {"d", 4}}, "d", true},
+		{"remote order does not matter", []SnapRef{{"c", 3}, {"a", 1}}, "c", true},
+		{"matched by GUID, not by name", []SnapRef{{"renamed", 3}, {"d", 99}}, "c", true},
+		{"remote has pruned older snapshots", []SnapRef{{"c", 3}, {"e", 5}}, "c", true},
+		{"disjoint", []SnapRef{{"x", 10}, {"y", 11}}, "", false},
+		{"same names, different GUIDs", []SnapRef{{"a", 10}, {"b", 11}}, "", false},
+		{"no remote snapshots", nil, "", false},
+	} {
+		name, ok := FindLatestCommonSnapshot(local, tc.remote)
+		assert.Equal(t, tc.name, name, tc.desc)
+		assert.Equal(t, tc.ok, ok, tc.desc)
+	}
+
+	_, ok := FindLatestCommonSnapshot(nil, local)
+	assert.False(t, ok, "no local snapshots")
+}
+
+func TestCompareSnapRefs(t *testing.T) {
+	for _, tt := range []struct {
+		desc         string
+		local        []SnapRef
+		remote       []SnapRef
+		localOnly    []SnapRef
+		remoteOnly   []SnapRef
+		latestCommon *SnapRef
+		lag          int
+	}{
+		{
+			desc:         "in sync",
+			local:        []SnapRef{{"a", 1}, {"b", 2}},
+			remote:       []SnapRef{{"a", 1}, {"b", 2}},
+			localOnly:    []SnapRef{},
+			remoteOnly:   []SnapRef{},
+			latestCommon: &SnapRef{"b", 2},
+			lag:          0,
+		},
+		{
+			desc:         "remote behind, and has a snapshot that has been pruned locally",
+			local:        []SnapRef{{"b", 2}, {"c", 3}, {"d", 4}},
+			remote:       []SnapRef{{"a", 1}, {"b", 2}},
+			localOnly:    []SnapRef{{"c", 3}, {"d", 4}},
+			remoteOnly:   []SnapRef{{"a", 1}},
+			latestCommon: &SnapRef{"b", 2},
+			lag:          2,
+		},
+		{
+			desc:         "matched by GUID despite renames",
+			local:        []SnapRef{{"a", 1}, {"b-renamed", 2}},
+			remote:       []SnapRef{{"a-renamed", 1}, {"b", 2}},
+			localOnly:    []SnapRef{},
+			remoteOnly:   []SnapRef{},
+			latestCommon: &SnapRef{"b-renamed", 2},
+			lag:          0,
+		},
+		{
+			desc:       "nothing replicated",
+			local:      []SnapRef{{"a", 1}, {"b", 2}},
+			remote:     nil,
+			localOnly:  []SnapRef{{"a", 1}, {"b", 2}},
+			remoteOnly: []SnapRef{},
+			lag:        2,
+		},
+	} {
+		c := CompareSnapRefs(tt.local, tt.remote)
+		assert.Equal(t, tt.localOnly, c.LocalOnly, tt.desc)
+		assert.Equal(t, tt.remoteOnly, c.RemoteOnly, tt.desc)
+		assert.Equal(t, tt.latestCommon, c.LatestCommon, tt.desc)
+		assert.Equal(t, tt.lag, c.Lag, tt.desc)
+	}
+}
+
+func TestParseSnapRefs(t *testing.T) {
+	refs, err := ParseSnapRefs(strings.NewReader("tank/data@a\t11\n\ntank/data@b\t12\nc 13\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []SnapRef{{"a", 11}, {"b", 12}, {"c", 13}}, refs)
+	}
+
+	for _, in := range []string{
+		"tank/data@a\n",
+		"tank/data@a 11 extra\n",
+		"tank/data@a guid\n",
+	} {
+		_, err := ParseSnapRefs(strings.NewReader(in))
+		assert.Error(t, err, in)
+	}
+}